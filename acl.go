@@ -0,0 +1,335 @@
+package redis
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ACLRules builds the rules of ACL SETUSER. Rules are applied in order.
+type ACLRules struct {
+	rules []string
+}
+
+func NewACLRules() *ACLRules {
+	return &ACLRules{}
+}
+
+func (r *ACLRules) add(rules ...string) *ACLRules {
+	r.rules = append(r.rules, rules...)
+	return r
+}
+
+func (r *ACLRules) addPrefixed(prefix string, values []string) *ACLRules {
+	for _, v := range values {
+		r.rules = append(r.rules, prefix+v)
+	}
+	return r
+}
+
+// Reset removes all permissions and passwords and disables the user.
+func (r *ACLRules) Reset() *ACLRules {
+	return r.add("reset")
+}
+
+func (r *ACLRules) On() *ACLRules {
+	return r.add("on")
+}
+
+func (r *ACLRules) Off() *ACLRules {
+	return r.add("off")
+}
+
+func (r *ACLRules) AddPasswords(passwords ...string) *ACLRules {
+	return r.addPrefixed(">", passwords)
+}
+
+func (r *ACLRules) RemovePasswords(passwords ...string) *ACLRules {
+	return r.addPrefixed("<", passwords)
+}
+
+// AddPasswordHashes adds passwords by their hex-encoded SHA-256.
+func (r *ACLRules) AddPasswordHashes(hashes ...string) *ACLRules {
+	return r.addPrefixed("#", hashes)
+}
+
+// NoPass lets the user authenticate with any password.
+func (r *ACLRules) NoPass() *ACLRules {
+	return r.add("nopass")
+}
+
+func (r *ACLRules) ResetPass() *ACLRules {
+	return r.add("resetpass")
+}
+
+// Keys allows reading and writing keys matching patterns.
+func (r *ACLRules) Keys(patterns ...string) *ACLRules {
+	return r.addPrefixed("~", patterns)
+}
+
+func (r *ACLRules) ReadKeys(patterns ...string) *ACLRules {
+	return r.addPrefixed("%R~", patterns)
+}
+
+func (r *ACLRules) WriteKeys(patterns ...string) *ACLRules {
+	return r.addPrefixed("%W~", patterns)
+}
+
+func (r *ACLRules) AllKeys() *ACLRules {
+	return r.add("allkeys")
+}
+
+func (r *ACLRules) ResetKeys() *ACLRules {
+	return r.add("resetkeys")
+}
+
+// Channels allows pub/sub channels matching patterns.
+func (r *ACLRules) Channels(patterns ...string) *ACLRules {
+	return r.addPrefixed("&", patterns)
+}
+
+func (r *ACLRules) AllChannels() *ACLRules {
+	return r.add("allchannels")
+}
+
+func (r *ACLRules) ResetChannels() *ACLRules {
+	return r.add("resetchannels")
+}
+
+// AllowCommands allows commands, or subcommands such as "config|get".
+func (r *ACLRules) AllowCommands(commands ...string) *ACLRules {
+	return r.addPrefixed("+", commands)
+}
+
+func (r *ACLRules) DenyCommands(commands ...string) *ACLRules {
+	return r.addPrefixed("-", commands)
+}
+
+// AllowCategories allows the commands of categories (see ACLCat) given
+// without the leading "@".
+func (r *ACLRules) AllowCategories(categories ...string) *ACLRules {
+	return r.addPrefixed("+@", categories)
+}
+
+func (r *ACLRules) DenyCategories(categories ...string) *ACLRules {
+	return r.addPrefixed("-@", categories)
+}
+
+func (r *ACLRules) AllCommands() *ACLRules {
+	return r.add("allcommands")
+}
+
+func (r *ACLRules) NoCommands() *ACLRules {
+	return r.add("nocommands")
+}
+
+// Selector adds a set of key, channel and command rules that's checked
+// independently of the root permissions (Redis 7.0+).
+func (r *ACLRules) Selector(s *ACLRules) *ACLRules {
+	return r.add("(" + strings.Join(s.rules, " ") + ")")
+}
+
+func (r *ACLRules) ClearSelectors() *ACLRules {
+	return r.add("clearselectors")
+}
+
+func (r *ACLRules) String() string {
+	return strings.Join(r.rules, " ")
+}
+
+// ACLSetUser creates or modifies a user by applying rules which may be
+// nil.
+func (cli *Client) ACLSetUser(username string, rules *ACLRules) error {
+	var r []string
+	if rules != nil {
+		r = rules.rules
+	}
+	return cli.okRequest("ACL", "SETUSER", username, r)
+}
+
+// ACLSelector holds the rules of a selector or of the root permissions of
+// a user, in the format of ACL SETUSER.
+type ACLSelector struct {
+	Commands string
+	Keys     string
+	Channels string
+}
+
+type ACLUser struct {
+	Flags []string
+	// Passwords are hex-encoded SHA-256 hashes.
+	Passwords []string
+	ACLSelector
+	Selectors []ACLSelector
+}
+
+// ACLGetUser returns the rules of a user or nil if it doesn't exist.
+func (cli *Client) ACLGetUser(username string) (*ACLUser, error) {
+	r, err := cli.replyRequest("ACL", "GETUSER", username)
+	if err != nil || isNilReply(r) {
+		return nil, err
+	}
+	m, ok := replyMap(r)
+	if !ok {
+		return nil, ErrInvalidValue
+	}
+	flags, _ := m["flags"].([]interface{})
+	passwords, _ := m["passwords"].([]interface{})
+	user := &ACLUser{
+		Flags:       replyStrings(flags),
+		Passwords:   replyStrings(passwords),
+		ACLSelector: parseACLSelector(m),
+	}
+	selectors, _ := m["selectors"].([]interface{})
+	for _, s := range selectors {
+		sm, ok := replyMap(s)
+		if !ok {
+			return nil, ErrInvalidValue
+		}
+		user.Selectors = append(user.Selectors, parseACLSelector(sm))
+	}
+	return user, nil
+}
+
+func parseACLSelector(m map[string]interface{}) ACLSelector {
+	return ACLSelector{
+		Commands: aclRuleString(m["commands"]),
+		Keys:     aclRuleString(m["keys"]),
+		Channels: aclRuleString(m["channels"]),
+	}
+}
+
+// aclRuleString returns rules as a string. Redis 6 reports keys and
+// channels as a list of patterns instead.
+func aclRuleString(r interface{}) string {
+	if a, ok := r.([]interface{}); ok {
+		return strings.Join(replyStrings(a), " ")
+	}
+	return replyString(r)
+}
+
+// ACLDelUser deletes users and returns how many existed.
+func (cli *Client) ACLDelUser(usernames ...string) (int64, error) {
+	return cli.integerRequest("ACL", "DELUSER", usernames)
+}
+
+// ACLList returns the rules of every user in the format of the ACL file.
+func (cli *Client) ACLList() ([]string, error) {
+	return cli.aclStrings("LIST")
+}
+
+func (cli *Client) ACLUsers() ([]string, error) {
+	return cli.aclStrings("USERS")
+}
+
+// ACLCat returns the command categories, or the commands of category if
+// it's not empty.
+func (cli *Client) ACLCat(category string) ([]string, error) {
+	if category == "" {
+		return cli.aclStrings("CAT")
+	}
+	return cli.aclStrings("CAT", category)
+}
+
+func (cli *Client) aclStrings(args ...interface{}) ([]string, error) {
+	r, err := cli.replyRequest("ACL", args...)
+	if err != nil {
+		return nil, err
+	}
+	a, ok := r.([]interface{})
+	if !ok {
+		return nil, ErrInvalidValue
+	}
+	return replyStrings(a), nil
+}
+
+// ACLWhoAmI returns the user that the connections are authenticated as.
+func (cli *Client) ACLWhoAmI() (string, error) {
+	r, err := cli.replyRequest("ACL", "WHOAMI")
+	return replyString(r), err
+}
+
+// ACLLogEntry is a command or authentication denied by ACLs.
+type ACLLogEntry struct {
+	// Count is the number of similar denials grouped in the entry.
+	Count int64
+	// Reason is one of command, key, channel or auth.
+	Reason   string
+	Context  string
+	Object   string
+	Username string
+	Age      time.Duration
+	Client   *ClientInfo
+	// EntryID, Created and Updated are only reported since Redis 7.2.
+	EntryID int64
+	Created time.Time
+	Updated time.Time
+}
+
+// ACLLog returns the count most recent ACL denials, or the server's
+// default number if count is zero.
+func (cli *Client) ACLLog(count int) ([]ACLLogEntry, error) {
+	var r interface{}
+	var err error
+	if count == 0 {
+		r, err = cli.replyRequest("ACL", "LOG")
+	} else {
+		r, err = cli.replyRequest("ACL", "LOG", count)
+	}
+	if err != nil {
+		return nil, err
+	}
+	a, ok := r.([]interface{})
+	if !ok {
+		return nil, ErrInvalidValue
+	}
+	entries := make([]ACLLogEntry, len(a))
+	for i, e := range a {
+		m, ok := replyMap(e)
+		if !ok {
+			return nil, ErrInvalidValue
+		}
+		entry := &entries[i]
+		entry.Count, _ = m["count"].(int64)
+		entry.Reason = replyString(m["reason"])
+		entry.Context = replyString(m["context"])
+		entry.Object = replyString(m["object"])
+		entry.Username = replyString(m["username"])
+		if age, err := strconv.ParseFloat(replyString(m["age-seconds"]), 64); err == nil {
+			entry.Age = time.Duration(age * float64(time.Second))
+		}
+		if info := replyString(m["client-info"]); info != "" {
+			entry.Client = parseClientInfo(info)
+		}
+		entry.EntryID, _ = m["entry-id"].(int64)
+		if ms, ok := m["timestamp-created"].(int64); ok {
+			entry.Created = time.UnixMilli(ms)
+		}
+		if ms, ok := m["timestamp-last-updated"].(int64); ok {
+			entry.Updated = time.UnixMilli(ms)
+		}
+	}
+	return entries, nil
+}
+
+func (cli *Client) ACLLogReset() error {
+	return cli.okRequest("ACL", "LOG", "RESET")
+}
+
+// ACLDryRun checks whether a user may run a command without running it. It
+// returns the reason when it's not allowed.
+func (cli *Client) ACLDryRun(username, cmd string, args ...interface{}) (bool, string, error) {
+	r, err := cli.replyRequest("ACL", append([]interface{}{"DRYRUN", username, cmd}, args...)...)
+	if err != nil {
+		return false, "", err
+	}
+	switch v := r.(type) {
+	case string:
+		if v == "OK" {
+			return true, "", nil
+		}
+	case []byte:
+		return false, string(v), nil
+	}
+	return false, "", ErrInvalidValue
+}
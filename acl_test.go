@@ -0,0 +1,211 @@
+package redis
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestACLRules(t *testing.T) {
+	rules := NewACLRules().
+		Reset().
+		On().
+		AddPasswords("secret").
+		Keys("orders:*").
+		ReadKeys("users:*").
+		Channels("events:*").
+		AllowCategories("read").
+		AllowCommands("set", "config|get").
+		DenyCommands("flushall").
+		Selector(NewACLRules().Keys("tmp:*").AllowCommands("del"))
+	exp := "reset on >secret ~orders:* %R~users:* &events:* +@read +set +config|get -flushall (~tmp:* +del)"
+	if s := rules.String(); s != exp {
+		t.Fatalf("expected %q, got %q", exp, s)
+	}
+}
+
+func TestACL(t *testing.T) {
+	var cr commandRecorder
+	srv := NewServer()
+	srv.HandleFunc("auth", func(ctx context.Context, conn *ServerConn, args [][]byte) {
+		if len(args) != 3 || string(args[1]) != "orders" || string(args[2]) != "secret" {
+			cr.reply(ErrReply{tag: "WRONGPASS", msg: "invalid username-password pair or user is disabled."})(ctx, conn, args)
+			return
+		}
+		cr.reply("OK")(ctx, conn, args)
+	})
+	srv.HandleFunc("acl", func(ctx context.Context, conn *ServerConn, args [][]byte) {
+		var reply interface{} = "OK"
+		switch string(args[1]) {
+		case "GETUSER":
+			if string(args[2]) == "missing" {
+				reply = nil
+				break
+			}
+			reply = []interface{}{
+				[]byte("flags"), []interface{}{[]byte("on")},
+				[]byte("passwords"), []interface{}{[]byte("2bb80d53")},
+				[]byte("commands"), []byte("+@read +set"),
+				[]byte("keys"), []byte("~orders:*"),
+				[]byte("channels"), []byte(""),
+				[]byte("selectors"), []interface{}{
+					[]interface{}{
+						[]byte("commands"), []byte("+del"),
+						[]byte("keys"), []byte("~tmp:*"),
+						[]byte("channels"), []byte(""),
+					},
+				},
+			}
+		case "DELUSER":
+			reply = int64(1)
+		case "USERS":
+			reply = []interface{}{[]byte("default"), []byte("orders")}
+		case "WHOAMI":
+			reply = []byte("orders")
+		case "LOG":
+			reply = []interface{}{
+				[]interface{}{
+					[]byte("count"), int64(2),
+					[]byte("reason"), []byte("command"),
+					[]byte("context"), []byte("toplevel"),
+					[]byte("object"), []byte("flushall"),
+					[]byte("username"), []byte("orders"),
+					[]byte("age-seconds"), []byte("1.5"),
+					[]byte("client-info"), []byte("id=7 addr=127.0.0.1:5000 name=svc"),
+					[]byte("entry-id"), int64(3),
+					[]byte("timestamp-created"), int64(1700000000000),
+					[]byte("timestamp-last-updated"), int64(1700000001000),
+				},
+			}
+		case "DRYRUN":
+			reply = []byte("User orders has no permissions to run the 'flushall' command")
+		}
+		cr.reply(reply)(ctx, conn, args)
+	})
+	addr := startServer(t, srv)
+
+	bad := NewClient("tcp", addr)
+	defer bad.Close()
+	bad.SetAuth("orders", "wrong")
+	if _, err := bad.ACLWhoAmI(); err == nil {
+		t.Fatal("expected authentication to fail")
+	} else if e, ok := err.(ErrReply); !ok || e.tag != "WRONGPASS" {
+		t.Fatalf("expected WRONGPASS, got %v", err)
+	}
+
+	cli := NewClient("tcp", addr)
+	defer cli.Close()
+	cli.SetAuth("orders", "secret")
+
+	if name, err := cli.ACLWhoAmI(); err != nil {
+		t.Fatal(err)
+	} else if name != "orders" {
+		t.Fatalf("expected orders, got %q", name)
+	}
+	if err := cli.ACLSetUser("orders", NewACLRules().On().Keys("orders:*")); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := cli.ACLGetUser("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expUser := &ACLUser{
+		Flags:       []string{"on"},
+		Passwords:   []string{"2bb80d53"},
+		ACLSelector: ACLSelector{Commands: "+@read +set", Keys: "~orders:*"},
+		Selectors:   []ACLSelector{{Commands: "+del", Keys: "~tmp:*"}},
+	}
+	if !reflect.DeepEqual(user, expUser) {
+		t.Fatalf("expected %+v, got %+v", expUser, user)
+	}
+	if user, err := cli.ACLGetUser("missing"); err != nil {
+		t.Fatal(err)
+	} else if user != nil {
+		t.Fatalf("expected nil user, got %+v", user)
+	}
+
+	if n, err := cli.ACLDelUser("old"); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("expected 1, got %d", n)
+	}
+	if users, err := cli.ACLUsers(); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(users, []string{"default", "orders"}) {
+		t.Fatalf("unexpected users %v", users)
+	}
+
+	entries, err := cli.ACLLog(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.Count != 2 || e.Reason != "command" || e.Object != "flushall" || e.Username != "orders" {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+	if e.Age != 1500*time.Millisecond || e.Client == nil || e.Client.Name != "svc" || e.EntryID != 3 {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+	if !e.Created.Equal(time.UnixMilli(1700000000000)) || !e.Updated.Equal(time.UnixMilli(1700000001000)) {
+		t.Fatalf("unexpected entry times %+v", e)
+	}
+
+	if ok, reason, err := cli.ACLDryRun("orders", "flushall"); err != nil {
+		t.Fatal(err)
+	} else if ok || !strings.Contains(reason, "flushall") {
+		t.Fatalf("expected flushall to be denied, got %t %q", ok, reason)
+	}
+
+	cr.check(t, []string{
+		"AUTH orders wrong",
+		"AUTH orders secret",
+		"ACL WHOAMI",
+		"ACL SETUSER orders on ~orders:*",
+		"ACL GETUSER orders",
+		"ACL GETUSER missing",
+		"ACL DELUSER old",
+		"ACL USERS",
+		"ACL LOG 10",
+		"ACL DRYRUN orders flushall",
+	})
+}
+
+func TestSetAuthDropsConnections(t *testing.T) {
+	cr := &commandRecorder{}
+	srv := NewServer()
+	srv.HandleFunc("ping", cr.reply("PONG"))
+	srv.HandleFunc("auth", cr.reply("OK"))
+	cli := NewClient("tcp", startServer(t, srv))
+	defer cli.Close()
+
+	if err := cli.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	// A connection in use while the credentials change isn't pooled
+	p, err := cli.Pipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.SetAuth("orders", "secret")
+	p.Do("PING")
+	if _, err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	cli.SetAuth("orders", "other")
+	if err := cli.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	cr.check(t, []string{"PING", "PING", "AUTH orders secret", "PING", "PING", "AUTH orders other", "PING"})
+}
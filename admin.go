@@ -0,0 +1,473 @@
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Info is the parsed reply of INFO: the fields of every section by
+// lowercase section name.
+type Info map[string]map[string]string
+
+// Get returns the value of a field or an empty string if it's missing.
+func (info Info) Get(section, key string) string {
+	return info[section][key]
+}
+
+// Int returns the value of an integer field. It returns false if the
+// field is missing or not an integer.
+func (info Info) Int(section, key string) (int64, bool) {
+	i, err := strconv.ParseInt(info.Get(section, key), 10, 64)
+	return i, err == nil
+}
+
+// Info returns the given sections of INFO, or the default ones if none.
+func (cli *Client) Info(sections ...string) (Info, error) {
+	b, err := cli.bulkRequest("INFO", sections)
+	if err != nil {
+		return nil, err
+	}
+	return parseInfo(b), nil
+}
+
+func parseInfo(b []byte) Info {
+	info := make(Info)
+	section := info[""]
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		if line[0] == '#' {
+			name := strings.ToLower(strings.TrimSpace(line[1:]))
+			section = make(map[string]string)
+			info[name] = section
+			continue
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		if section == nil {
+			section = make(map[string]string)
+			info[""] = section
+		}
+		section[k] = v
+	}
+	return info
+}
+
+// ConfigGet returns the configuration parameters matching pattern.
+func (cli *Client) ConfigGet(pattern string) (map[string]string, error) {
+	r, err := cli.replyRequest("CONFIG", "GET", pattern)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := replyMap(r)
+	if !ok {
+		return nil, ErrInvalidValue
+	}
+	params := make(map[string]string, len(m))
+	for k, v := range m {
+		params[k] = replyString(v)
+	}
+	return params, nil
+}
+
+func (cli *Client) ConfigSet(param, value string) error {
+	return cli.okRequest("CONFIG", "SET", param, value)
+}
+
+func (cli *Client) ConfigResetStat() error {
+	return cli.okRequest("CONFIG", "RESETSTAT")
+}
+
+// ConfigRewrite writes the running configuration to the config file.
+func (cli *Client) ConfigRewrite() error {
+	return cli.okRequest("CONFIG", "REWRITE")
+}
+
+func (cli *Client) DBSize() (int64, error) {
+	return cli.integerRequest("DBSIZE")
+}
+
+// Flush modes of FlushDB and FlushAll. An empty mode uses the server's
+// lazyfree-lazy-user-flush setting.
+const (
+	FlushAsync = "ASYNC"
+	FlushSync  = "SYNC"
+)
+
+func (cli *Client) FlushDB(mode string) error {
+	return cli.flush("FLUSHDB", mode)
+}
+
+func (cli *Client) FlushAll(mode string) error {
+	return cli.flush("FLUSHALL", mode)
+}
+
+func (cli *Client) flush(cmd, mode string) error {
+	if mode == "" {
+		return cli.okRequest(cmd)
+	}
+	return cli.okRequest(cmd, mode)
+}
+
+func (cli *Client) Save() error {
+	return cli.okRequest("SAVE")
+}
+
+func (cli *Client) BGSave() error {
+	_, err := cli.statusRequest("BGSAVE")
+	return err
+}
+
+// LastSave returns the time of the last successful save.
+func (cli *Client) LastSave() (time.Time, error) {
+	i, err := cli.integerRequest("LASTSAVE")
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(i, 0), nil
+}
+
+// Time returns the server's clock.
+func (cli *Client) Time() (time.Time, error) {
+	r, err := cli.replyRequest("TIME")
+	if err != nil {
+		return time.Time{}, err
+	}
+	a, ok := r.([]interface{})
+	if !ok || len(a) != 2 {
+		return time.Time{}, ErrInvalidValue
+	}
+	sec, err1 := strconv.ParseInt(replyString(a[0]), 10, 64)
+	usec, err2 := strconv.ParseInt(replyString(a[1]), 10, 64)
+	if err1 != nil || err2 != nil {
+		return time.Time{}, ErrInvalidValue
+	}
+	return time.Unix(sec, usec*1e3), nil
+}
+
+type SlowLogEntry struct {
+	ID       int64
+	Time     time.Time
+	Duration time.Duration
+	Args     []string
+	// ClientAddr and ClientName are only reported since Redis 4.0.
+	ClientAddr string
+	ClientName string
+}
+
+// SlowLogGet returns the count most recent entries of the slow log, all of
+// them if count is negative or the server's default if it's zero.
+func (cli *Client) SlowLogGet(count int) ([]SlowLogEntry, error) {
+	var r interface{}
+	var err error
+	if count == 0 {
+		r, err = cli.replyRequest("SLOWLOG", "GET")
+	} else {
+		r, err = cli.replyRequest("SLOWLOG", "GET", count)
+	}
+	if err != nil {
+		return nil, err
+	}
+	a, ok := r.([]interface{})
+	if !ok {
+		return nil, ErrInvalidValue
+	}
+	entries := make([]SlowLogEntry, len(a))
+	for i, e := range a {
+		fields, ok := e.([]interface{})
+		if !ok || len(fields) < 4 {
+			return nil, ErrInvalidValue
+		}
+		id, ok1 := fields[0].(int64)
+		ts, ok2 := fields[1].(int64)
+		us, ok3 := fields[2].(int64)
+		args, ok4 := fields[3].([]interface{})
+		if !ok1 || !ok2 || !ok3 || !ok4 {
+			return nil, ErrInvalidValue
+		}
+		entry := &entries[i]
+		entry.ID = id
+		entry.Time = time.Unix(ts, 0)
+		entry.Duration = time.Duration(us) * time.Microsecond
+		entry.Args = make([]string, len(args))
+		for j, arg := range args {
+			entry.Args[j] = replyString(arg)
+		}
+		if len(fields) >= 6 {
+			entry.ClientAddr = replyString(fields[4])
+			entry.ClientName = replyString(fields[5])
+		}
+	}
+	return entries, nil
+}
+
+func (cli *Client) SlowLogLen() (int64, error) {
+	return cli.integerRequest("SLOWLOG", "LEN")
+}
+
+func (cli *Client) SlowLogReset() error {
+	return cli.okRequest("SLOWLOG", "RESET")
+}
+
+// LatencyEvent is the latest latency spike of an event.
+type LatencyEvent struct {
+	Event  string
+	Time   time.Time
+	Latest time.Duration
+	Max    time.Duration
+}
+
+func (cli *Client) LatencyLatest() ([]LatencyEvent, error) {
+	r, err := cli.replyRequest("LATENCY", "LATEST")
+	if err != nil {
+		return nil, err
+	}
+	a, ok := r.([]interface{})
+	if !ok {
+		return nil, ErrInvalidValue
+	}
+	events := make([]LatencyEvent, len(a))
+	for i, e := range a {
+		fields, ok := e.([]interface{})
+		if !ok || len(fields) < 4 {
+			return nil, ErrInvalidValue
+		}
+		ts, ok1 := fields[1].(int64)
+		latest, ok2 := fields[2].(int64)
+		max, ok3 := fields[3].(int64)
+		if !ok1 || !ok2 || !ok3 {
+			return nil, ErrInvalidValue
+		}
+		events[i] = LatencyEvent{
+			Event:  replyString(fields[0]),
+			Time:   time.Unix(ts, 0),
+			Latest: time.Duration(latest) * time.Millisecond,
+			Max:    time.Duration(max) * time.Millisecond,
+		}
+	}
+	return events, nil
+}
+
+type LatencySample struct {
+	Time    time.Time
+	Latency time.Duration
+}
+
+// LatencyHistory returns the latency spikes recorded for event.
+func (cli *Client) LatencyHistory(event string) ([]LatencySample, error) {
+	r, err := cli.replyRequest("LATENCY", "HISTORY", event)
+	if err != nil {
+		return nil, err
+	}
+	a, ok := r.([]interface{})
+	if !ok {
+		return nil, ErrInvalidValue
+	}
+	samples := make([]LatencySample, len(a))
+	for i, e := range a {
+		fields, ok := e.([]interface{})
+		if !ok || len(fields) != 2 {
+			return nil, ErrInvalidValue
+		}
+		ts, ok1 := fields[0].(int64)
+		ms, ok2 := fields[1].(int64)
+		if !ok1 || !ok2 {
+			return nil, ErrInvalidValue
+		}
+		samples[i] = LatencySample{Time: time.Unix(ts, 0), Latency: time.Duration(ms) * time.Millisecond}
+	}
+	return samples, nil
+}
+
+// MemoryUsage returns the number of bytes used by key and its value, or 0
+// if it doesn't exist. Nested values are sampled if samples is positive,
+// or all counted if it's negative.
+func (cli *Client) MemoryUsage(key string, samples int) (int64, error) {
+	var r interface{}
+	var err error
+	switch {
+	case samples > 0:
+		r, err = cli.replyRequest("MEMORY", "USAGE", key, "SAMPLES", samples)
+	case samples < 0:
+		r, err = cli.replyRequest("MEMORY", "USAGE", key, "SAMPLES", 0)
+	default:
+		r, err = cli.replyRequest("MEMORY", "USAGE", key)
+	}
+	if err != nil {
+		return 0, err
+	}
+	switch v := r.(type) {
+	case int64:
+		return v, nil
+	case []byte:
+		if v == nil {
+			return 0, nil
+		}
+	}
+	return 0, ErrInvalidValue
+}
+
+// MemoryStats returns the memory usage details of the server with values
+// of the types returned by Client.Do.
+func (cli *Client) MemoryStats() (map[string]interface{}, error) {
+	r, err := cli.replyRequest("MEMORY", "STATS")
+	if err != nil {
+		return nil, err
+	}
+	m, ok := replyMap(r)
+	if !ok {
+		return nil, ErrInvalidValue
+	}
+	return m, nil
+}
+
+// MemoryDoctor returns a report of memory issues.
+func (cli *Client) MemoryDoctor() (string, error) {
+	r, err := cli.replyRequest("MEMORY", "DOCTOR")
+	return replyString(r), err
+}
+
+func (cli *Client) CommandCount() (int64, error) {
+	return cli.integerRequest("COMMAND", "COUNT")
+}
+
+type CommandInfo struct {
+	Name string
+	// Arity is the number of arguments including the command name. It's
+	// negative when it's the minimum number.
+	Arity    int
+	Flags    []string
+	FirstKey int
+	LastKey  int
+	Step     int
+	// ACLCategories are only reported since Redis 6.0.
+	ACLCategories []string
+}
+
+// CommandInfo returns the details of the given commands, or nil for
+// unknown ones.
+func (cli *Client) CommandInfo(names ...string) ([]*CommandInfo, error) {
+	r, err := cli.replyRequest("COMMAND", "INFO", names)
+	if err != nil {
+		return nil, err
+	}
+	a, ok := r.([]interface{})
+	if !ok {
+		return nil, ErrInvalidValue
+	}
+	infos := make([]*CommandInfo, len(a))
+	for i, e := range a {
+		if b, ok := e.([]byte); e == nil || ok && b == nil {
+			continue
+		}
+		fields, ok := e.([]interface{})
+		if !ok || len(fields) < 6 {
+			return nil, ErrInvalidValue
+		}
+		arity, ok1 := fields[1].(int64)
+		flags, ok2 := fields[2].([]interface{})
+		first, ok3 := fields[3].(int64)
+		last, ok4 := fields[4].(int64)
+		step, ok5 := fields[5].(int64)
+		if !ok1 || !ok2 || !ok3 || !ok4 || !ok5 {
+			return nil, ErrInvalidValue
+		}
+		info := &CommandInfo{
+			Name:     replyString(fields[0]),
+			Arity:    int(arity),
+			Flags:    replyStrings(flags),
+			FirstKey: int(first),
+			LastKey:  int(last),
+			Step:     int(step),
+		}
+		if len(fields) >= 7 {
+			if cats, ok := fields[6].([]interface{}); ok {
+				info.ACLCategories = replyStrings(cats)
+			}
+		}
+		infos[i] = info
+	}
+	return infos, nil
+}
+
+type CommandDoc struct {
+	Summary    string
+	Since      string
+	Group      string
+	Complexity string
+}
+
+// CommandDocs returns the documentation of the given commands, or of all
+// of them if none, by lowercase command name.
+func (cli *Client) CommandDocs(names ...string) (map[string]CommandDoc, error) {
+	r, err := cli.replyRequest("COMMAND", "DOCS", names)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := replyMap(r)
+	if !ok {
+		return nil, ErrInvalidValue
+	}
+	docs := make(map[string]CommandDoc, len(m))
+	for name, v := range m {
+		fields, ok := replyMap(v)
+		if !ok {
+			return nil, ErrInvalidValue
+		}
+		docs[name] = CommandDoc{
+			Summary:    replyString(fields["summary"]),
+			Since:      replyString(fields["since"]),
+			Group:      replyString(fields["group"]),
+			Complexity: replyString(fields["complexity"]),
+		}
+	}
+	return docs, nil
+}
+
+// Shutdown modes. An empty mode saves if save points are configured.
+const (
+	ShutdownSave   = "SAVE"
+	ShutdownNoSave = "NOSAVE"
+)
+
+// Shutdown stops the server. The server closes the connection instead of
+// replying on success.
+func (cli *Client) Shutdown(mode string) error {
+	args := []interface{}{}
+	if mode != "" {
+		args = append(args, mode)
+	}
+	_, err := cli.statusRequest("SHUTDOWN", args...)
+	if err == nil || err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil
+	}
+	return err
+}
+
+// ReplicaOf makes the server a replica of host:port, or a master if host
+// is empty.
+func (cli *Client) ReplicaOf(host string, port int) error {
+	if host == "" {
+		_, err := cli.statusRequest("REPLICAOF", "NO", "ONE")
+		return err
+	}
+	_, err := cli.statusRequest("REPLICAOF", host, port)
+	return err
+}
+
+func replyStrings(a []interface{}) []string {
+	s := make([]string, len(a))
+	for i, v := range a {
+		s[i] = replyString(v)
+	}
+	return s
+}
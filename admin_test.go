@@ -0,0 +1,216 @@
+package redis
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseInfo(t *testing.T) {
+	info := parseInfo([]byte("# Server\r\nredis_version:7.2.4\r\nuptime_in_seconds:1234\r\n\r\n# Keyspace\r\ndb0:keys=1,expires=0,avg_ttl=0\r\n"))
+	if v := info.Get("server", "redis_version"); v != "7.2.4" {
+		t.Fatalf("expected 7.2.4, got %q", v)
+	}
+	if i, ok := info.Int("server", "uptime_in_seconds"); !ok || i != 1234 {
+		t.Fatalf("expected 1234, got %d %t", i, ok)
+	}
+	if _, ok := info.Int("server", "missing"); ok {
+		t.Fatal("expected missing field to not be an integer")
+	}
+	if v := info.Get("keyspace", "db0"); v != "keys=1,expires=0,avg_ttl=0" {
+		t.Fatalf("unexpected keyspace %q", v)
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	var cr commandRecorder
+	// subcommands replies by lowercase subcommand
+	subcommands := func(replies map[string]interface{}) HandlerFunc {
+		return func(ctx context.Context, conn *ServerConn, args [][]byte) {
+			cr.reply(replies[strings.ToLower(string(args[1]))])(ctx, conn, args)
+		}
+	}
+	srv := NewServer()
+	srv.HandleFunc("info", cr.reply([]byte("# Memory\r\nused_memory:1024\r\n")))
+	srv.HandleFunc("config", subcommands(map[string]interface{}{
+		"get":       []interface{}{[]byte("maxmemory"), []byte("0")},
+		"set":       "OK",
+		"resetstat": "OK",
+	}))
+	srv.HandleFunc("flushdb", cr.reply("OK"))
+	srv.HandleFunc("time", cr.reply([]interface{}{[]byte("1700000000"), []byte("250000")}))
+	srv.HandleFunc("slowlog", subcommands(map[string]interface{}{
+		"get": []interface{}{
+			[]interface{}{
+				int64(14), int64(1700000000), int64(15000),
+				[]interface{}{[]byte("KEYS"), []byte("*")},
+				[]byte("127.0.0.1:5000"), []byte("worker"),
+			},
+		},
+		"len": int64(1),
+	}))
+	srv.HandleFunc("latency", subcommands(map[string]interface{}{
+		"latest":  []interface{}{[]interface{}{[]byte("command"), int64(1700000000), int64(250), int64(1000)}},
+		"history": []interface{}{[]interface{}{int64(1700000000), int64(250)}},
+	}))
+	srv.HandleFunc("memory", subcommands(map[string]interface{}{
+		"usage": nil,
+		"stats": []interface{}{[]byte("peak.allocated"), int64(2048)},
+	}))
+	srv.HandleFunc("command", subcommands(map[string]interface{}{
+		"info": []interface{}{
+			[]interface{}{
+				[]byte("get"), int64(2),
+				[]interface{}{"readonly", "fast"},
+				int64(1), int64(1), int64(1),
+				[]interface{}{"@read", "@string", "@fast"},
+			},
+			nil,
+		},
+		"docs": []interface{}{
+			[]byte("get"),
+			[]interface{}{
+				[]byte("summary"), []byte("Returns the string value of a key."),
+				[]byte("since"), []byte("1.0.0"),
+				[]byte("group"), []byte("string"),
+				[]byte("complexity"), []byte("O(1)"),
+			},
+		},
+	}))
+	srv.HandleFunc("replicaof", cr.reply("OK"))
+	cli := NewClient("tcp", startServer(t, srv))
+	defer cli.Close()
+
+	info, err := cli.Info("memory")
+	if err != nil {
+		t.Fatal(err)
+	} else if i, _ := info.Int("memory", "used_memory"); i != 1024 {
+		t.Fatalf("expected 1024, got %d", i)
+	}
+
+	if cfg, err := cli.ConfigGet("maxmemory"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(cfg, map[string]string{"maxmemory": "0"}) {
+		t.Fatalf("unexpected config %v", cfg)
+	}
+	if err := cli.ConfigSet("maxmemory", "100mb"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.ConfigResetStat(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.FlushDB(FlushAsync); err != nil {
+		t.Fatal(err)
+	}
+
+	if tm, err := cli.Time(); err != nil {
+		t.Fatal(err)
+	} else if !tm.Equal(time.Unix(1700000000, 250e6)) {
+		t.Fatalf("unexpected time %s", tm)
+	}
+
+	entries, err := cli.SlowLogGet(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expEntry := SlowLogEntry{
+		ID:         14,
+		Time:       time.Unix(1700000000, 0),
+		Duration:   15 * time.Millisecond,
+		Args:       []string{"KEYS", "*"},
+		ClientAddr: "127.0.0.1:5000",
+		ClientName: "worker",
+	}
+	if len(entries) != 1 || !reflect.DeepEqual(entries[0], expEntry) {
+		t.Fatalf("unexpected slowlog %+v", entries)
+	}
+	if n, err := cli.SlowLogLen(); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("expected 1, got %d", n)
+	}
+
+	events, err := cli.LatencyLatest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expEvent := LatencyEvent{Event: "command", Time: time.Unix(1700000000, 0), Latest: 250 * time.Millisecond, Max: time.Second}
+	if len(events) != 1 || !reflect.DeepEqual(events[0], expEvent) {
+		t.Fatalf("unexpected latency events %+v", events)
+	}
+	samples, err := cli.LatencyHistory("command")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(samples) != 1 || samples[0].Latency != 250*time.Millisecond {
+		t.Fatalf("unexpected latency history %+v", samples)
+	}
+
+	if n, err := cli.MemoryUsage("missing", -1); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("expected 0, got %d", n)
+	}
+	if stats, err := cli.MemoryStats(); err != nil {
+		t.Fatal(err)
+	} else if stats["peak.allocated"] != int64(2048) {
+		t.Fatalf("unexpected memory stats %v", stats)
+	}
+
+	infos, err := cli.CommandInfo("get", "nope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expInfo := &CommandInfo{
+		Name:          "get",
+		Arity:         2,
+		Flags:         []string{"readonly", "fast"},
+		FirstKey:      1,
+		LastKey:       1,
+		Step:          1,
+		ACLCategories: []string{"@read", "@string", "@fast"},
+	}
+	if len(infos) != 2 || !reflect.DeepEqual(infos[0], expInfo) || infos[1] != nil {
+		t.Fatalf("unexpected command info %+v", infos)
+	}
+	if docs, err := cli.CommandDocs("get"); err != nil {
+		t.Fatal(err)
+	} else if docs["get"].Since != "1.0.0" || docs["get"].Complexity != "O(1)" {
+		t.Fatalf("unexpected command docs %+v", docs)
+	}
+
+	if err := cli.ReplicaOf("", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	cr.check(t, []string{
+		"INFO memory",
+		"CONFIG GET maxmemory",
+		"CONFIG SET maxmemory 100mb",
+		"CONFIG RESETSTAT",
+		"FLUSHDB ASYNC",
+		"TIME",
+		"SLOWLOG GET -1",
+		"SLOWLOG LEN",
+		"LATENCY LATEST",
+		"LATENCY HISTORY command",
+		"MEMORY USAGE missing SAMPLES 0",
+		"MEMORY STATS",
+		"COMMAND INFO get nope",
+		"COMMAND DOCS get",
+		"REPLICAOF NO ONE",
+	})
+}
+
+func TestShutdown(t *testing.T) {
+	srv := NewServer()
+	srv.HandleFunc("shutdown", func(ctx context.Context, conn *ServerConn, args [][]byte) {
+		conn.Close()
+	})
+	cli := NewClient("tcp", startServer(t, srv))
+	defer cli.Close()
+	if err := cli.Shutdown(ShutdownNoSave); err != nil {
+		t.Fatal(err)
+	}
+}
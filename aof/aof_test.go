@@ -0,0 +1,191 @@
+package aof
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/samuel/go-redis"
+	"github.com/samuel/go-redis/rdb"
+	"github.com/samuel/go-redis/redistest"
+)
+
+func resp(args ...string) string {
+	var b strings.Builder
+	b.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, a := range args {
+		b.WriteString("$" + strconv.Itoa(len(a)) + "\r\n" + a + "\r\n")
+	}
+	return b.String()
+}
+
+func TestReader(t *testing.T) {
+	data := resp("SELECT", "2") + "#TS:1700000000\r\n" + resp("SET", "foo", "bar") + resp("DEL", "foo")
+	r := NewReader(strings.NewReader(data))
+	var names []string
+	for {
+		cmd, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if cmd.DB != 2 {
+			t.Fatalf("expected DB 2, got %d", cmd.DB)
+		}
+		names = append(names, cmd.Name())
+	}
+	if strings.Join(names, " ") != "SELECT SET DEL" {
+		t.Fatalf("unexpected commands %v", names)
+	}
+	if r.Offset() != int64(len(data)) {
+		t.Fatalf("expected offset %d, got %d", len(data), r.Offset())
+	}
+
+	r = NewReader(strings.NewReader(data[:len(data)-3]))
+	var err error
+	for err == nil {
+		_, err = r.Next()
+	}
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected ErrUnexpectedEOF for truncated file, got %v", err)
+	}
+}
+
+func TestParseRDBPreamble(t *testing.T) {
+	// RDB with a string in db 0 and a list in db 1, followed by commands
+	var f bytes.Buffer
+	f.WriteString("REDIS0011")
+	f.Write([]byte{0xfe, 0, 0, 1, 'a', 1, '1'})
+	f.Write([]byte{0xfe, 1, 1, 1, 'l', 2, 1, 'x', 1, 'y'})
+	f.Write([]byte{0xff, 0, 0, 0, 0, 0, 0, 0, 0})
+	f.WriteString(resp("INCR", "a"))
+
+	var cmds []string
+	err := Parse(&f, func(cmd *Command) error {
+		cmds = append(cmds, strconv.Itoa(cmd.DB)+":"+string(bytes.Join(cmd.Args, []byte(" "))))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "0:SET a 1,1:SELECT 1,1:RPUSH l x y,0:INCR a"
+	if s := strings.Join(cmds, ","); s != expected {
+		t.Fatalf("expected %q, got %q", expected, s)
+	}
+}
+
+func TestEntryCommandsLargeHash(t *testing.T) {
+	h := make(map[string][]byte)
+	for i := 0; i < rdbBatchSize+100; i++ {
+		h[strconv.Itoa(i)] = []byte("v")
+	}
+	// Commands are kept like Replayer batches them
+	var cmds [][][]byte
+	err := entryCommands(&rdb.Entry{Key: []byte("h"), Type: rdb.TypeHash, Value: h}, func(args ...[]byte) error {
+		cmds = append(cmds, args)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := make(map[string]bool)
+	for _, args := range cmds {
+		for i := 2; i < len(args); i += 2 {
+			fields[string(args[i])] = true
+		}
+	}
+	if len(cmds) != 2 || len(fields) != len(h) {
+		t.Fatalf("expected %d fields in 2 commands, got %d in %d", len(h), len(fields), len(cmds))
+	}
+}
+
+func TestManifest(t *testing.T) {
+	m, err := ReadManifest(strings.NewReader(
+		"file appendonly.aof.1.base.rdb seq 1 type b\n" +
+			"file appendonly.aof.1.incr.aof seq 1 type h\n" +
+			"file \"append only.aof.2.incr.aof\" seq 2 type i\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := m.Files()
+	if len(files) != 2 || files[0].Name != "appendonly.aof.1.base.rdb" || files[1].Name != "append only.aof.2.incr.aof" || files[1].Seq != 2 {
+		t.Fatalf("unexpected files %+v", files)
+	}
+	if len(m.History) != 1 {
+		t.Fatalf("expected a history file, got %+v", m.History)
+	}
+	if _, err := ReadManifest(strings.NewReader("file ../etc/passwd seq 1 type b\n")); err != ErrInvalidManifest {
+		t.Fatalf("expected ErrInvalidManifest, got %v", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"appendonly.aof.manifest":    "file appendonly.aof.1.base.aof seq 1 type b\nfile appendonly.aof.1.incr.aof seq 1 type i\n",
+		"appendonly.aof.1.base.aof":  resp("SET", "user:1", "a") + resp("SET", "other", "b"),
+		"appendonly.aof.1.incr.aof":  resp("MULTI") + resp("INCR", "user:2") + resp("INCR", "user:2") + resp("EXEC") + resp("SELECT", "3") + resp("SET", "user:3", "c"),
+		"appendonly.aof.1.ignored.x": resp("SET", "user:4", "d"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := redistest.NewServer()
+	defer s.Close()
+	cli := redis.NewClient("tcp", s.Addr())
+	defer cli.Close()
+
+	rp := NewReplayer(cli)
+	rp.Pattern = "user:*"
+	rp.BatchSize = 2
+	if err := rp.ReplayFile(dir); err != nil {
+		t.Fatal(err)
+	}
+	if rp.Commands != 6 || rp.Skipped != 1 {
+		t.Fatalf("expected 6 commands and 1 skipped, got %d and %d", rp.Commands, rp.Skipped)
+	}
+	for key, expected := range map[string]string{"user:1": "a", "user:2": "2", "other": "", "user:4": ""} {
+		if b, err := cli.Get(key); err != nil || string(b) != expected {
+			t.Fatalf("%s: expected %q, got %q, %v", key, expected, b, err)
+		}
+	}
+	p, err := cli.Pipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Do("SELECT", "3")
+	r := p.Get("user:3")
+	p.Do("SELECT", "0")
+	if _, err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if string(r.Value()) != "c" {
+		t.Fatalf("expected user:3 in db 3, got %q, %v", r.Value(), r.Err())
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, c := range []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"user:*", "user:1", true},
+		{"user:*", "session:1", false},
+		{"h?llo", "hello", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"a/*", "a/b/c", true},
+	} {
+		if m := match(c.pattern, c.s); m != c.match {
+			t.Errorf("match(%q, %q) = %v", c.pattern, c.s, m)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package aof
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidManifest = errors.New("aof: invalid manifest")
+	ErrNoManifest      = errors.New("aof: no manifest found")
+)
+
+// File types in a manifest.
+const (
+	FileBase        = 'b'
+	FileIncremental = 'i'
+	FileHistory     = 'h'
+)
+
+// ManifestFile is a file listed in a multi-part AOF manifest.
+type ManifestFile struct {
+	Name string
+	Seq  int64
+	Type byte
+}
+
+// Manifest lists the files of a multi-part AOF as used since Redis 7.
+type Manifest struct {
+	Base        *ManifestFile
+	Incremental []ManifestFile
+	History     []ManifestFile
+}
+
+// Files returns the files to load in order: the base file followed by
+// the incremental files.
+func (m *Manifest) Files() []ManifestFile {
+	var files []ManifestFile
+	if m.Base != nil {
+		files = append(files, *m.Base)
+	}
+	return append(files, m.Incremental...)
+}
+
+// ReadManifest parses a manifest with lines such as
+//
+//	file appendonly.aof.1.base.rdb seq 1 type b
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	m := &Manifest{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields, err := splitManifestLine(line)
+		if err != nil || len(fields)%2 != 0 {
+			return nil, ErrInvalidManifest
+		}
+		var f ManifestFile
+		for i := 0; i < len(fields); i += 2 {
+			switch v := fields[i+1]; fields[i] {
+			case "file":
+				f.Name = v
+			case "seq":
+				if f.Seq, err = strconv.ParseInt(v, 10, 64); err != nil {
+					return nil, ErrInvalidManifest
+				}
+			case "type":
+				if len(v) != 1 {
+					return nil, ErrInvalidManifest
+				}
+				f.Type = v[0]
+			}
+		}
+		if f.Name == "" || strings.ContainsAny(f.Name, `/\`) {
+			return nil, ErrInvalidManifest
+		}
+		switch f.Type {
+		case FileBase:
+			if m.Base != nil {
+				return nil, ErrInvalidManifest
+			}
+			m.Base = &f
+		case FileIncremental:
+			m.Incremental = append(m.Incremental, f)
+		case FileHistory:
+			m.History = append(m.History, f)
+		default:
+			return nil, ErrInvalidManifest
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// splitManifestLine splits a line into fields which may be quoted when
+// the file name contains spaces.
+func splitManifestLine(line string) ([]string, error) {
+	var fields []string
+	for line = strings.TrimLeft(line, " "); line != ""; line = strings.TrimLeft(line, " ") {
+		if line[0] == '"' {
+			q, err := strconv.QuotedPrefix(line)
+			if err != nil {
+				return nil, err
+			}
+			f, err := strconv.Unquote(q)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, f)
+			line = line[len(q):]
+			continue
+		}
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			i = len(line)
+		}
+		fields = append(fields, line[:i])
+		line = line[i:]
+	}
+	return fields, nil
+}
+
+// ParseFile parses a legacy AOF file or, if path is a directory, a
+// multi-part AOF using the manifest in the directory.
+func ParseFile(path string, fn func(cmd *Command) error) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return ParseDir(path, fn)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return Parse(f, fn)
+}
+
+// ParseDir parses the base and incremental files of a multi-part AOF in
+// dir (e.g. appendonlydir).
+func ParseDir(dir string, fn func(cmd *Command) error) error {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.manifest"))
+	if err != nil {
+		return err
+	}
+	if len(matches) != 1 {
+		return ErrNoManifest
+	}
+	mf, err := os.Open(matches[0])
+	if err != nil {
+		return err
+	}
+	m, err := ReadManifest(mf)
+	mf.Close()
+	if err != nil {
+		return err
+	}
+	for _, file := range m.Files() {
+		f, err := os.Open(filepath.Join(dir, file.Name))
+		if err != nil {
+			return err
+		}
+		err = Parse(f, fn)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+// Package aof reads Redis append-only files and replays them to a server.
+//
+// Both the legacy single file format and the multi-part format of Redis 7
+// (a directory with a manifest, a base file and incremental files) are
+// supported. A base file or legacy file may start with an RDB preamble
+// which is converted to commands that recreate its keys.
+package aof
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/samuel/go-redis/rdb"
+)
+
+var (
+	ErrInvalidCommand   = errors.New("aof: invalid command")
+	ErrUnsupportedValue = errors.New("aof: stream and module values can't be converted to commands")
+)
+
+const (
+	maxArgs      = 1024 * 1024
+	maxBulkLen   = 512 * 1024 * 1024
+	rdbBatchSize = 512
+)
+
+// Command is a command from an AOF file and the database it applies to.
+type Command struct {
+	DB   int
+	Args [][]byte
+}
+
+// Name returns the command name in upper case.
+func (c *Command) Name() string {
+	if len(c.Args) == 0 {
+		return ""
+	}
+	return strings.ToUpper(string(c.Args[0]))
+}
+
+// Reader reads a stream of commands in the Redis protocol as written to
+// AOF files and sent by a master to its replicas.
+type Reader struct {
+	r   *bufio.Reader
+	db  int
+	off int64
+}
+
+// NewReader returns a reader starting at database 0. If r is a
+// *bufio.Reader it's used directly.
+func NewReader(r io.Reader) *Reader {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Reader{r: br}
+}
+
+// Offset returns the number of bytes consumed so far.
+func (r *Reader) Offset() int64 {
+	return r.off
+}
+
+// DB returns the currently selected database.
+func (r *Reader) DB() int {
+	return r.db
+}
+
+// SetDB sets the current database, e.g. to continue a stream that started
+// with another database selected.
+func (r *Reader) SetDB(db int) {
+	r.db = db
+}
+
+// Next returns the next command. SELECT commands are returned as well
+// after updating the current database. At the end of the stream io.EOF is
+// returned, or io.ErrUnexpectedEOF if the last command is truncated.
+func (r *Reader) Next() (*Command, error) {
+	for {
+		b, err := r.r.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		switch b[0] {
+		case '*':
+		case '#':
+			// Annotation such as a timestamp added by aof-timestamp-enabled
+			if _, err := r.readLine(); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			continue
+		case '\n':
+			// Replication keepalives
+			r.r.ReadByte()
+			r.off++
+			continue
+		default:
+			return nil, ErrInvalidCommand
+		}
+		args, err := r.readCommand()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if len(args) == 0 {
+			return nil, ErrInvalidCommand
+		}
+		if len(args) == 2 && strings.EqualFold(string(args[0]), "SELECT") {
+			db, err := strconv.Atoi(string(args[1]))
+			if err != nil {
+				return nil, ErrInvalidCommand
+			}
+			r.db = db
+		}
+		return &Command{DB: r.db, Args: args}, nil
+	}
+}
+
+func (r *Reader) readLine() ([]byte, error) {
+	line, err := r.r.ReadSlice('\n')
+	r.off += int64(len(line))
+	if err == bufio.ErrBufferFull {
+		return nil, ErrInvalidCommand
+	} else if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, ErrInvalidCommand
+	}
+	return line[:len(line)-2], nil
+}
+
+func (r *Reader) readNumber(marker byte, max int) (int, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return 0, err
+	}
+	if len(line) < 2 || line[0] != marker {
+		return 0, ErrInvalidCommand
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < 0 || n > max {
+		return 0, ErrInvalidCommand
+	}
+	return n, nil
+}
+
+func (r *Reader) readCommand() ([][]byte, error) {
+	n, err := r.readNumber('*', maxArgs)
+	if err != nil {
+		return nil, err
+	}
+	args := make([][]byte, n)
+	for i := range args {
+		l, err := r.readNumber('$', maxBulkLen)
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, l+2)
+		m, err := io.ReadFull(r.r, b)
+		r.off += int64(m)
+		if err != nil {
+			return nil, err
+		}
+		if b[l] != '\r' || b[l+1] != '\n' {
+			return nil, ErrInvalidCommand
+		}
+		args[i] = b[:l]
+	}
+	return args, nil
+}
+
+// Parse reads an AOF file and calls fn for every command. If the file
+// starts with an RDB preamble its keys are passed to fn as commands
+// (SET, RPUSH, SADD, HSET, ZADD and PEXPIREAT) preceded by SELECT.
+func Parse(r io.Reader, fn func(cmd *Command) error) error {
+	br := bufio.NewReader(r)
+	if b, err := br.Peek(5); err == nil && string(b) == "REDIS" {
+		if err := parseRDB(br, fn); err != nil {
+			return err
+		}
+	}
+	ar := NewReader(br)
+	for {
+		cmd, err := ar.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(cmd); err != nil {
+			return err
+		}
+	}
+}
+
+func parseRDB(r *bufio.Reader, fn func(cmd *Command) error) error {
+	db := 0
+	return rdb.Parse(r, &rdb.Handler{
+		Entry: func(e *rdb.Entry) error {
+			if e.DB != db {
+				db = e.DB
+				if err := fn(&Command{DB: db, Args: [][]byte{[]byte("SELECT"), []byte(strconv.Itoa(db))}}); err != nil {
+					return err
+				}
+			}
+			return entryCommands(e, func(args ...[]byte) error {
+				return fn(&Command{DB: db, Args: args})
+			})
+		},
+	})
+}
+
+// entryCommands calls fn with the commands that recreate an entry. Large
+// values are split into several commands.
+func entryCommands(e *rdb.Entry, fn func(args ...[]byte) error) error {
+	key := e.Key
+	var err error
+	switch v := e.Value.(type) {
+	case []byte:
+		err = fn([]byte("SET"), key, v)
+	case [][]byte:
+		cmd := []byte("SADD")
+		if e.Type == rdb.TypeList {
+			cmd = []byte("RPUSH")
+		}
+		for i := 0; i < len(v) && err == nil; i += rdbBatchSize {
+			args := [][]byte{cmd, key}
+			args = append(args, v[i:min(i+rdbBatchSize, len(v))]...)
+			err = fn(args...)
+		}
+	case map[string][]byte:
+		args := [][]byte{[]byte("HSET"), key}
+		for f, val := range v {
+			args = append(args, []byte(f), val)
+			if len(args) >= 2+2*rdbBatchSize {
+				if err = fn(args...); err != nil {
+					return err
+				}
+				args = [][]byte{[]byte("HSET"), key}
+			}
+		}
+		if len(args) > 2 {
+			err = fn(args...)
+		}
+	case []rdb.ZMember:
+		for i := 0; i < len(v) && err == nil; i += rdbBatchSize {
+			args := [][]byte{[]byte("ZADD"), key}
+			for _, m := range v[i:min(i+rdbBatchSize, len(v))] {
+				args = append(args, formatScore(m.Score), m.Member)
+			}
+			err = fn(args...)
+		}
+	default:
+		return ErrUnsupportedValue
+	}
+	if err == nil && !e.Expires.IsZero() {
+		err = fn([]byte("PEXPIREAT"), key, strconv.AppendInt(nil, e.Expires.UnixMilli(), 10))
+	}
+	return err
+}
+
+func formatScore(f float64) []byte {
+	switch {
+	case math.IsInf(f, 1):
+		return []byte("inf")
+	case math.IsInf(f, -1):
+		return []byte("-inf")
+	}
+	return strconv.AppendFloat(nil, f, 'g', -1, 64)
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
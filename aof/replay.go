@@ -0,0 +1,218 @@
+package aof
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/samuel/go-redis"
+)
+
+const DefaultReplayBatchSize = 100
+
+// Replayer sends commands read from AOF files to a server in pipelined
+// batches. Batches never split a MULTI/EXEC transaction.
+//
+// Each batch starts by selecting the database of its first command and
+// ends by selecting database 0 again since the connection is returned to
+// the Client's pool.
+type Replayer struct {
+	cli *redis.Client
+
+	// DB only replays commands on the given database when not negative.
+	DB int
+
+	// Pattern only replays commands with a key matching the glob-style
+	// pattern when not empty. Commands without keys are always replayed
+	// and commands with several keys are replayed if any key matches.
+	Pattern string
+
+	BatchSize int
+
+	// Commands and Skipped count the replayed and filtered out commands.
+	Commands int64
+	Skipped  int64
+
+	batch   []*Command
+	inMulti bool
+}
+
+func NewReplayer(cli *redis.Client) *Replayer {
+	return &Replayer{
+		cli:       cli,
+		DB:        -1,
+		BatchSize: DefaultReplayBatchSize,
+	}
+}
+
+// ReplayFile replays a legacy AOF file or a multi-part AOF directory.
+func (rp *Replayer) ReplayFile(path string) error {
+	if err := ParseFile(path, rp.Add); err != nil {
+		return err
+	}
+	return rp.Flush()
+}
+
+// Add queues a command and sends the batch if it's full.
+func (rp *Replayer) Add(cmd *Command) error {
+	if !rp.include(cmd) {
+		rp.Skipped++
+		return nil
+	}
+	switch cmd.Name() {
+	case "SELECT":
+		// Every batch selects its databases itself
+		return nil
+	case "MULTI":
+		rp.inMulti = true
+	case "EXEC", "DISCARD":
+		rp.inMulti = false
+	}
+	rp.batch = append(rp.batch, cmd)
+	if len(rp.batch) >= rp.BatchSize && !rp.inMulti {
+		return rp.Flush()
+	}
+	return nil
+}
+
+// Flush sends the queued commands. It returns an error if any command
+// fails.
+func (rp *Replayer) Flush() error {
+	if len(rp.batch) == 0 {
+		return nil
+	}
+	p, err := rp.cli.Pipeline()
+	if err != nil {
+		return err
+	}
+	db := 0
+	replies := make([]*redis.GenericReply, len(rp.batch))
+	for i, cmd := range rp.batch {
+		if cmd.DB != db {
+			db = cmd.DB
+			p.Do("SELECT", strconv.Itoa(db))
+		}
+		args := make([]interface{}, len(cmd.Args)-1)
+		for j, a := range cmd.Args[1:] {
+			args[j] = a
+		}
+		replies[i] = p.Do(string(cmd.Args[0]), args...)
+	}
+	if db != 0 {
+		p.Do("SELECT", "0")
+	}
+	batch := rp.batch
+	rp.batch = rp.batch[:0]
+	if _, err := p.Flush(); err != nil {
+		return err
+	}
+	for i, r := range replies {
+		if err := r.Err(); err != nil {
+			return fmt.Errorf("aof: %s failed: %s", batch[i].Name(), err)
+		}
+		// Errors of commands in a transaction are in the EXEC reply
+		if v, ok := r.Value().([]interface{}); ok && batch[i].Name() == "EXEC" {
+			for _, e := range v {
+				if err, ok := e.(redis.ErrReply); ok {
+					return fmt.Errorf("aof: EXEC failed: %s", err)
+				}
+			}
+		}
+	}
+	rp.Commands += int64(len(batch))
+	return nil
+}
+
+func (rp *Replayer) include(cmd *Command) bool {
+	if rp.DB >= 0 && cmd.DB != rp.DB && cmd.Name() != "SELECT" {
+		return false
+	}
+	if rp.Pattern == "" {
+		return true
+	}
+	keys := redis.CommandKeys(cmd.Args)
+	if len(keys) == 0 {
+		return true
+	}
+	for _, k := range keys {
+		if match(rp.Pattern, string(k)) {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether s matches a glob-style pattern as used by KEYS.
+func match(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if match(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		case '[':
+			end := strings.IndexByte(pattern[1:], ']')
+			if len(s) == 0 || end < 0 {
+				if len(s) == 0 || s[0] != '[' {
+					return false
+				}
+				s = s[1:]
+				pattern = pattern[1:]
+				continue
+			}
+			class := pattern[1 : end+1]
+			not := len(class) > 0 && class[0] == '^'
+			if not {
+				class = class[1:]
+			}
+			matched := false
+			for i := 0; i < len(class); i++ {
+				if class[i] == '\\' && i+1 < len(class) {
+					i++
+					matched = matched || class[i] == s[0]
+				} else if i+2 < len(class) && class[i+1] == '-' {
+					lo, hi := class[i], class[i+2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+					matched = matched || s[0] >= lo && s[0] <= hi
+					i += 2
+				} else {
+					matched = matched || class[i] == s[0]
+				}
+			}
+			if matched == not {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[end+2:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(s) == 0
+}
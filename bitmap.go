@@ -0,0 +1,206 @@
+package redis
+
+import "strconv"
+
+const (
+	BitOpAnd = "AND"
+	BitOpOr  = "OR"
+	BitOpXor = "XOR"
+	BitOpNot = "NOT"
+)
+
+// BitRange limits BITCOUNT and BITPOS to the bytes, or bits if Bit is
+// set, from Start to End inclusive. Negative indexes count from the end.
+type BitRange struct {
+	Start, End int64
+	Bit        bool
+}
+
+func (r *BitRange) args(args []interface{}) []interface{} {
+	if r == nil {
+		return args
+	}
+	unit := "BYTE"
+	if r.Bit {
+		unit = "BIT"
+	}
+	return append(args, r.Start, r.End, unit)
+}
+
+// SetBit sets the bit at offset to value (0 or 1) and returns its
+// previous value.
+func (cli *Client) SetBit(key string, offset int64, value int) (int64, error) {
+	return cli.integerRequest("SETBIT", key, offset, value)
+}
+
+func (cli *Client) GetBit(key string, offset int64) (i int64, err error) {
+	err = cli.withReadConnection(func(c *redisConnection) (err error) {
+		i, err = c.integerRequest("GETBIT", key, offset)
+		return
+	})
+	return
+}
+
+// BitCount counts the bits set in the range, or in the whole string if r
+// is nil.
+func (cli *Client) BitCount(key string, r *BitRange) (i int64, err error) {
+	err = cli.withReadConnection(func(c *redisConnection) (err error) {
+		i, err = c.integerRequest("BITCOUNT", r.args([]interface{}{key})...)
+		return
+	})
+	return
+}
+
+// BitPos returns the position of the first bit set to bit (0 or 1) in the
+// range, or in the whole string if r is nil. It returns -1 if not found.
+func (cli *Client) BitPos(key string, bit int, r *BitRange) (i int64, err error) {
+	err = cli.withReadConnection(func(c *redisConnection) (err error) {
+		i, err = c.integerRequest("BITPOS", r.args([]interface{}{key, bit})...)
+		return
+	})
+	return
+}
+
+// BitOp stores the result of a bitwise operation (BitOpAnd, ...) between
+// keys in destKey and returns its length.
+func (cli *Client) BitOp(op, destKey string, keys ...string) (int64, error) {
+	return cli.integerRequest("BITOP", op, destKey, keys)
+}
+
+// Overflow behaviors of BITFIELD.
+const (
+	OverflowWrap = "WRAP"
+	OverflowSat  = "SAT"
+	OverflowFail = "FAIL"
+)
+
+// BitFieldType is the type of an integer field: "i" or "u" followed by the
+// number of bits.
+type BitFieldType string
+
+// Signed is a signed integer of up to 64 bits.
+func Signed(bits int) BitFieldType {
+	return BitFieldType("i" + strconv.Itoa(bits))
+}
+
+// Unsigned is an unsigned integer of up to 63 bits.
+func Unsigned(bits int) BitFieldType {
+	return BitFieldType("u" + strconv.Itoa(bits))
+}
+
+// BitField builds a BITFIELD command. Offsets are in bits. Commands with
+// only gets are sent as BITFIELD_RO so they can be read from replicas.
+type BitField struct {
+	key      string
+	args     []interface{}
+	readOnly bool
+}
+
+func NewBitField(key string) *BitField {
+	return &BitField{key: key, readOnly: true}
+}
+
+func (f *BitField) Get(typ BitFieldType, offset int64) *BitField {
+	f.args = append(f.args, "GET", string(typ), offset)
+	return f
+}
+
+func (f *BitField) Set(typ BitFieldType, offset, value int64) *BitField {
+	f.args = append(f.args, "SET", string(typ), offset, value)
+	f.readOnly = false
+	return f
+}
+
+func (f *BitField) IncrBy(typ BitFieldType, offset, increment int64) *BitField {
+	f.args = append(f.args, "INCRBY", string(typ), offset, increment)
+	f.readOnly = false
+	return f
+}
+
+// Overflow sets the behavior of the following SET and INCRBY operations
+// (OverflowWrap, OverflowSat or OverflowFail). BITFIELD_RO doesn't accept
+// it so the command isn't sent as read-only.
+func (f *BitField) Overflow(mode string) *BitField {
+	f.args = append(f.args, "OVERFLOW", mode)
+	f.readOnly = false
+	return f
+}
+
+func (f *BitField) command() (string, []interface{}) {
+	cmd := "BITFIELD"
+	if f.readOnly {
+		cmd = "BITFIELD_RO"
+	}
+	return cmd, append([]interface{}{f.key}, f.args...)
+}
+
+// BitField runs f and returns the result of every GET, SET and INCRBY. A
+// result is nil when the operation wasn't performed because of
+// OverflowFail.
+func (cli *Client) BitField(f *BitField) ([]*int64, error) {
+	cmd, args := f.command()
+	var r interface{}
+	var err error
+	if f.readOnly {
+		err = cli.withReadConnection(func(c *redisConnection) (err error) {
+			r, err = c.replyRequest(cmd, args...)
+			return
+		})
+	} else {
+		r, err = cli.replyRequest(cmd, args...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bitFieldValues(r)
+}
+
+func bitFieldValues(r interface{}) ([]*int64, error) {
+	a, ok := r.([]interface{})
+	if !ok {
+		return nil, ErrInvalidValue
+	}
+	values := make([]*int64, len(a))
+	for i, v := range a {
+		switch v := v.(type) {
+		case int64:
+			values[i] = &v
+		case []byte:
+			// Null bulk for an operation skipped by OverflowFail
+			if v != nil {
+				return nil, ErrInvalidValue
+			}
+		case nil:
+		default:
+			return nil, ErrInvalidValue
+		}
+	}
+	return values, nil
+}
+
+func (p *Pipeline) SetBit(key string, offset int64, value int) *IntegerReply {
+	return p.integer("SETBIT", key, offset, value)
+}
+
+func (p *Pipeline) GetBit(key string, offset int64) *IntegerReply {
+	return p.integer("GETBIT", key, offset)
+}
+
+func (p *Pipeline) BitCount(key string, r *BitRange) *IntegerReply {
+	return p.integer("BITCOUNT", r.args([]interface{}{key})...)
+}
+
+func (p *Pipeline) BitPos(key string, bit int, r *BitRange) *IntegerReply {
+	return p.integer("BITPOS", r.args([]interface{}{key, bit})...)
+}
+
+func (p *Pipeline) BitOp(op, destKey string, keys ...string) *IntegerReply {
+	return p.integer("BITOP", op, destKey, keys)
+}
+
+func (p *Pipeline) BitField(f *BitField) *BitFieldReply {
+	r := &BitFieldReply{}
+	cmd, args := f.command()
+	p.send(r, cmd, args...)
+	return r
+}
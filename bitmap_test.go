@@ -0,0 +1,104 @@
+package redis
+
+import "testing"
+
+func TestBitmap(t *testing.T) {
+	var cr commandRecorder
+	srv := NewServer()
+	srv.HandleFunc("setbit", cr.reply(int64(0)))
+	srv.HandleFunc("getbit", cr.reply(int64(1)))
+	srv.HandleFunc("bitcount", cr.reply(int64(3)))
+	srv.HandleFunc("bitpos", cr.reply(int64(-1)))
+	srv.HandleFunc("bitop", cr.reply(int64(2)))
+	srv.HandleFunc("bitfield", cr.reply([]interface{}{int64(1), nil, int64(-3)}))
+	srv.HandleFunc("bitfield_ro", cr.reply([]interface{}{int64(7)}))
+	cli := NewClient("tcp", startServer(t, srv))
+	defer cli.Close()
+
+	check := func(i int64, err error, exp int64) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		} else if i != exp {
+			t.Fatalf("expected %d, got %d", exp, i)
+		}
+	}
+	i, err := cli.SetBit("k", 7, 1)
+	check(i, err, 0)
+	i, err = cli.GetBit("k", 7)
+	check(i, err, 1)
+	i, err = cli.BitCount("k", nil)
+	check(i, err, 3)
+	i, err = cli.BitCount("k", &BitRange{Start: 1, End: -1})
+	check(i, err, 3)
+	i, err = cli.BitPos("k", 0, &BitRange{Start: 2, End: 9, Bit: true})
+	check(i, err, -1)
+	i, err = cli.BitOp(BitOpAnd, "dst", "a", "b")
+	check(i, err, 2)
+
+	v, err := cli.BitField(NewBitField("k").
+		Overflow(OverflowFail).
+		IncrBy(Unsigned(2), 0, 1).
+		Set(Signed(8), 8, 5).
+		Get(Signed(8), 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v) != 3 || *v[0] != 1 || v[1] != nil || *v[2] != -3 {
+		t.Fatalf("unexpected bitfield result %v", v)
+	}
+	v, err = cli.BitField(NewBitField("k").Get(Unsigned(4), 0))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(v) != 1 || *v[0] != 7 {
+		t.Fatalf("unexpected bitfield result %v", v)
+	}
+
+	p, err := cli.Pipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r1 := p.GetBit("k", 3)
+	r2 := p.BitCount("k", &BitRange{Start: 0, End: 0})
+	r3 := p.BitField(NewBitField("k").IncrBy(Signed(5), 100, 1))
+	if _, err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	check(r1.Value(), r1.Err(), 1)
+	check(r2.Value(), r2.Err(), 3)
+	if r3.Err() != nil {
+		t.Fatal(r3.Err())
+	} else if len(r3.Value()) != 3 {
+		t.Fatalf("unexpected bitfield result %v", r3.Value())
+	}
+
+	exp := []string{
+		"SETBIT k 7 1",
+		"GETBIT k 7",
+		"BITCOUNT k",
+		"BITCOUNT k 1 -1 BYTE",
+		"BITPOS k 0 2 9 BIT",
+		"BITOP AND dst a b",
+		"BITFIELD k OVERFLOW FAIL INCRBY u2 0 1 SET i8 8 5 GET i8 8",
+		"BITFIELD_RO k GET u4 0",
+		"GETBIT k 3",
+		"BITCOUNT k 0 0 BYTE",
+		"BITFIELD k INCRBY i5 100 1",
+	}
+	cr.check(t, exp)
+}
+
+func TestBitFieldReadOnly(t *testing.T) {
+	for _, c := range []struct {
+		f   *BitField
+		cmd string
+	}{
+		{NewBitField("k").Get(Unsigned(4), 0), "BITFIELD_RO"},
+		{NewBitField("k").Overflow(OverflowSat).Get(Unsigned(4), 0), "BITFIELD"},
+		{NewBitField("k").Get(Unsigned(4), 0).Set(Unsigned(4), 0, 1), "BITFIELD"},
+	} {
+		if cmd, _ := c.f.command(); cmd != c.cmd {
+			t.Errorf("%v: expected %s, got %s", c.f.args, c.cmd, cmd)
+		}
+	}
+}
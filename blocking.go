@@ -0,0 +1,129 @@
+package redis
+
+import (
+	"context"
+	"time"
+)
+
+// unblockRetryDelay is how long DoContext waits before retrying CLIENT
+// UNBLOCK when the command isn't blocked yet.
+const unblockRetryDelay = 10 * time.Millisecond
+
+// DoContext is like Do but returns ctx.Err() if ctx is done before a
+// blocking command such as BLPOP returns. The command is interrupted with
+// CLIENT UNBLOCK from another connection so its connection can be reused.
+// Only with servers older than 5.0 the connection is closed instead.
+func (cli *Client) DoContext(ctx context.Context, cmd string, args ...interface{}) (r interface{}, err error) {
+	if ctx.Done() == nil {
+		return cli.Do(cmd, args...)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	err = cli.withConnection(func(c *redisConnection) error {
+		// The ID stays 0 if CLIENT ID isn't supported
+		id, err := c.clientID()
+		if _, ok := err.(ErrReply); err != nil && !ok {
+			return err
+		}
+		if err := c.sendCommand(cmd, args...); err != nil {
+			return err
+		}
+		if err := c.flush(); err != nil {
+			return err
+		}
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			select {
+			case <-done:
+			case <-ctx.Done():
+				cli.unblock(c, id, done)
+			}
+		}()
+		r, err = c.readReply()
+		close(done)
+		// The connection mustn't be reused while it may get unblocked
+		<-stopped
+		return err
+	})
+	// A reply that arrived before the command was unblocked isn't lost
+	if ctx.Err() != nil && isNilReply(r) {
+		return nil, ctx.Err()
+	}
+	return r, err
+}
+
+// unblock unblocks the command that c is blocked on. Since the command may
+// not have reached the server yet it's retried until done is closed. The
+// connection is closed as a last resort.
+func (cli *Client) unblock(c *redisConnection, id int64, done <-chan struct{}) {
+	for id != 0 {
+		ok, err := cli.ClientUnblock(id, false)
+		if err != nil {
+			break
+		}
+		if ok {
+			return
+		}
+		t := time.NewTimer(unblockRetryDelay)
+		select {
+		case <-done:
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+	c.close()
+}
+
+func isNilReply(r interface{}) bool {
+	b, ok := r.([]byte)
+	return r == nil || ok && b == nil
+}
+
+// BLPop pops the first element of the first non-empty list of keys, waiting
+// up to timeout (forever if zero) for one. It returns a nil value if it
+// timed out and ctx.Err() if ctx is done first.
+func (cli *Client) BLPop(ctx context.Context, timeout time.Duration, keys ...string) (string, []byte, error) {
+	return cli.blockingPop(ctx, "BLPOP", timeout, keys)
+}
+
+// BRPop is like BLPop but pops the last element.
+func (cli *Client) BRPop(ctx context.Context, timeout time.Duration, keys ...string) (string, []byte, error) {
+	return cli.blockingPop(ctx, "BRPOP", timeout, keys)
+}
+
+func (cli *Client) blockingPop(ctx context.Context, cmd string, timeout time.Duration, keys []string) (string, []byte, error) {
+	r, err := cli.DoContext(ctx, cmd, keys, timeout.Seconds())
+	if err != nil || r == nil {
+		return "", nil, err
+	}
+	a, ok := r.([]interface{})
+	if !ok || len(a) != 2 {
+		return "", nil, ErrInvalidValue
+	}
+	key, ok1 := a[0].([]byte)
+	value, ok2 := a[1].([]byte)
+	if !ok1 || !ok2 {
+		return "", nil, ErrInvalidValue
+	}
+	return string(key), value, nil
+}
+
+// BLMove atomically moves an element from the srcPos end ("LEFT" or
+// "RIGHT") of the src list to the destPos end of dest and returns it,
+// waiting up to timeout (forever if zero) for src to be non-empty. It
+// returns nil if it timed out and ctx.Err() if ctx is done first.
+func (cli *Client) BLMove(ctx context.Context, src, dest, srcPos, destPos string, timeout time.Duration) ([]byte, error) {
+	r, err := cli.DoContext(ctx, "BLMOVE", src, dest, srcPos, destPos, timeout.Seconds())
+	if err != nil || r == nil {
+		return nil, err
+	}
+	b, ok := r.([]byte)
+	if !ok {
+		return nil, ErrInvalidValue
+	}
+	return b, nil
+}
@@ -0,0 +1,101 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingServer is a fake server with BLPOP blocking until unblocked
+// by CLIENT UNBLOCK, unless the first key is "ready".
+type blockingServer struct {
+	mu      sync.Mutex
+	lastID  int64
+	blocked map[int64]chan struct{}
+	popIDs  []int64
+}
+
+func (bs *blockingServer) id(conn *ServerConn) int64 {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	id, ok := conn.Get("id").(int64)
+	if !ok {
+		bs.lastID++
+		id = bs.lastID
+		conn.Set("id", id)
+	}
+	return id
+}
+
+func (bs *blockingServer) start(t *testing.T) string {
+	bs.blocked = make(map[int64]chan struct{})
+	srv := NewServer()
+	srv.HandleFunc("client", func(ctx context.Context, conn *ServerConn, args [][]byte) {
+		switch string(args[1]) {
+		case "ID":
+			conn.WriteInteger(bs.id(conn))
+		case "UNBLOCK":
+			id, _ := strconv.ParseInt(string(args[2]), 10, 64)
+			bs.mu.Lock()
+			defer bs.mu.Unlock()
+			if ch, ok := bs.blocked[id]; ok {
+				close(ch)
+				delete(bs.blocked, id)
+				conn.WriteInteger(1)
+			} else {
+				conn.WriteInteger(0)
+			}
+		}
+	})
+	srv.HandleFunc("blpop", func(ctx context.Context, conn *ServerConn, args [][]byte) {
+		id := bs.id(conn)
+		bs.mu.Lock()
+		bs.popIDs = append(bs.popIDs, id)
+		if string(args[1]) == "ready" {
+			bs.mu.Unlock()
+			conn.WriteReply([]interface{}{[]byte("ready"), []byte("value")})
+			return
+		}
+		ch := make(chan struct{})
+		bs.blocked[id] = ch
+		bs.mu.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+		}
+		conn.WriteNullArray()
+	})
+	return startServer(t, srv)
+}
+
+func TestBLPopContext(t *testing.T) {
+	var bs blockingServer
+	cli := NewClient("tcp", bs.start(t))
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, _, err := cli.BLPop(ctx, 0, "empty"); err != context.DeadlineExceeded {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("BLPop took %s to be canceled", d)
+	}
+
+	key, value, err := cli.BLPop(context.Background(), time.Second, "ready", "empty")
+	if err != nil {
+		t.Fatal(err)
+	} else if key != "ready" || string(value) != "value" {
+		t.Fatalf("unexpected pop %s %q", key, value)
+	}
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	// The unblocked connection is reused
+	if len(bs.popIDs) != 2 || bs.popIDs[0] != bs.popIDs[1] {
+		t.Fatalf("expected the same connection for both pops, got %v", bs.popIDs)
+	}
+}
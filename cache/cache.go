@@ -0,0 +1,266 @@
+// Package cache implements a read-through cache on top of a Client.
+//
+// Once returns the cached value of a key or calls a loader to compute it.
+// Stampedes on a missing key are avoided at two levels: concurrent calls
+// in the process share a single load, and across processes a short lock
+// key lets a single caller run the loader while the others wait for the
+// value. Keys are also refreshed slightly before they expire using
+// probabilistic early expiration (XFetch) so a popular key is recomputed
+// by one caller while the others keep using the current value.
+//
+// http://www.vldb.org/pvldb/vol8/p886-vattani.pdf
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/samuel/go-redis"
+)
+
+const (
+	DefaultPrefix         = "cache:"
+	DefaultLockTimeout    = 10 * time.Second
+	DefaultLockRetryDelay = 50 * time.Millisecond
+	DefaultBeta           = 1.0
+
+	lockSuffix   = ":lock"
+	entryVersion = 1
+)
+
+var (
+	// ErrNotFound is returned by a loader when the value doesn't exist.
+	// It's cached for NegativeTTL.
+	ErrNotFound = errors.New("cache: not found")
+
+	ErrInvalidEntry = errors.New("cache: invalid cached entry")
+)
+
+// Loader computes the value of a key on a cache miss.
+type Loader func(ctx context.Context) (interface{}, error)
+
+type Cache struct {
+	// Prefix is prepended to keys.
+	Prefix string
+
+	// Codec encodes values. Defaults to JSON.
+	Codec redis.Codec
+
+	// LockTimeout is the expiration of the lock held while loading. It
+	// should be larger than the time the loader takes or concurrent
+	// callers may load the value too.
+	LockTimeout time.Duration
+
+	// LockRetryDelay is how often callers waiting on the lock check
+	// whether the value has been set.
+	LockRetryDelay time.Duration
+
+	// Beta scales the early expiration: values above 1 favor earlier
+	// recomputation. Zero disables early expiration.
+	Beta float64
+
+	// NegativeTTL is how long ErrNotFound from a loader is cached. Zero
+	// disables negative caching.
+	NegativeTTL time.Duration
+
+	cli   *redis.Client
+	group group
+}
+
+func New(cli *redis.Client) *Cache {
+	return &Cache{
+		Prefix:         DefaultPrefix,
+		Codec:          redis.JSONCodec{},
+		LockTimeout:    DefaultLockTimeout,
+		LockRetryDelay: DefaultLockRetryDelay,
+		Beta:           DefaultBeta,
+		cli:            cli,
+	}
+}
+
+// Once decodes the value of key into dst, calling loader to compute and
+// cache it for ttl if it's missing. It returns ErrNotFound if the loader
+// did (even if cached).
+func (c *Cache) Once(ctx context.Context, key string, ttl time.Duration, dst interface{}, loader Loader) error {
+	e, err := c.get(key)
+	if err != nil {
+		return err
+	}
+	if e != nil && !c.expireEarly(e) {
+		return c.decode(e, dst)
+	}
+	e, err = c.group.do(ctx, key, func() (*entry, error) {
+		return c.load(ctx, key, ttl, e, loader)
+	})
+	if err != nil {
+		return err
+	}
+	return c.decode(e, dst)
+}
+
+// Get decodes the cached value of key into dst. It returns false if the
+// key isn't cached.
+func (c *Cache) Get(key string, dst interface{}) (bool, error) {
+	e, err := c.get(key)
+	if err != nil || e == nil {
+		return false, err
+	}
+	return true, c.decode(e, dst)
+}
+
+func (c *Cache) Set(key string, v interface{}, ttl time.Duration) error {
+	b, err := c.Codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.set(key, &entry{payload: b}, ttl)
+}
+
+func (c *Cache) Delete(key string) error {
+	_, err := c.cli.Do("DEL", c.Prefix+key)
+	return err
+}
+
+func (c *Cache) load(ctx context.Context, key string, ttl time.Duration, stale *entry, loader Loader) (*entry, error) {
+	mu := redis.NewMutex(c.cli, c.Prefix+key+lockSuffix, c.LockTimeout)
+	for {
+		ok, err := mu.TryLock()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		// Someone else is refreshing the value
+		if stale != nil {
+			return stale, nil
+		}
+		t := time.NewTimer(c.LockRetryDelay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+		if e, err := c.get(key); err != nil || e != nil {
+			return e, err
+		}
+	}
+	// The lock expires if unlocking fails
+	defer mu.Unlock()
+
+	if stale == nil {
+		// The value may have been set between the miss and the lock
+		if e, err := c.get(key); err != nil || e != nil {
+			return e, err
+		}
+	}
+
+	start := time.Now()
+	v, err := loader(ctx)
+	e := &entry{delta: time.Since(start)}
+	switch {
+	case err == ErrNotFound:
+		if c.NegativeTTL <= 0 {
+			return nil, err
+		}
+		e.negative = true
+		ttl = c.NegativeTTL
+	case err != nil:
+		return nil, err
+	default:
+		if e.payload, err = c.Codec.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.set(key, e, ttl); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// expireEarly implements XFetch: the value is considered expired when
+// now - delta * beta * ln(rand) >= expiry. The closer to the expiry and
+// the longer the value took to compute, the likelier it is recomputed.
+func (c *Cache) expireEarly(e *entry) bool {
+	if c.Beta <= 0 || e.expires.IsZero() {
+		return false
+	}
+	gap := -float64(e.delta) * c.Beta * math.Log(1-rand.Float64())
+	return !time.Now().Add(time.Duration(gap)).Before(e.expires)
+}
+
+func (c *Cache) get(key string) (*entry, error) {
+	b, err := c.cli.Get(c.Prefix + key)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	return decodeEntry(b)
+}
+
+func (c *Cache) set(key string, e *entry, ttl time.Duration) error {
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+	return c.cli.Set(c.Prefix+key, e.encode(), ttl)
+}
+
+func (c *Cache) decode(e *entry, dst interface{}) error {
+	if e.negative {
+		return ErrNotFound
+	}
+	return c.Codec.Unmarshal(e.payload, dst)
+}
+
+// entry is a cached value with the metadata needed for early expiration.
+// It's stored as a version byte, a flags byte, the time it took to
+// compute in microseconds and the expiration time in Unix milliseconds
+// (both varints), followed by the encoded value.
+type entry struct {
+	negative bool
+	delta    time.Duration
+	expires  time.Time
+	payload  []byte
+}
+
+func (e *entry) encode() []byte {
+	b := make([]byte, 2, 2+2*binary.MaxVarintLen64+len(e.payload))
+	b[0] = entryVersion
+	if e.negative {
+		b[1] = 1
+	}
+	b = binary.AppendUvarint(b, uint64(e.delta/time.Microsecond))
+	var expires int64
+	if !e.expires.IsZero() {
+		expires = e.expires.UnixMilli()
+	}
+	b = binary.AppendVarint(b, expires)
+	return append(b, e.payload...)
+}
+
+func decodeEntry(b []byte) (*entry, error) {
+	if len(b) < 2 || b[0] != entryVersion {
+		return nil, ErrInvalidEntry
+	}
+	e := &entry{negative: b[1]&1 != 0}
+	b = b[2:]
+	delta, n := binary.Uvarint(b)
+	if n <= 0 {
+		return nil, ErrInvalidEntry
+	}
+	b = b[n:]
+	expires, n := binary.Varint(b)
+	if n <= 0 {
+		return nil, ErrInvalidEntry
+	}
+	e.delta = time.Duration(delta) * time.Microsecond
+	if expires != 0 {
+		e.expires = time.UnixMilli(expires)
+	}
+	e.payload = b[n:]
+	return e, nil
+}
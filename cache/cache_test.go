@@ -0,0 +1,215 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-redis"
+	"github.com/samuel/go-redis/redistest"
+)
+
+type user struct {
+	Name string
+}
+
+func newTestCache(t *testing.T) (*Cache, *redis.Client) {
+	s := redistest.NewServer()
+	t.Cleanup(s.Close)
+	cli := redis.NewClient("tcp", s.Addr())
+	t.Cleanup(func() { cli.Close() })
+	return New(cli), cli
+}
+
+func TestOnce(t *testing.T) {
+	c, _ := newTestCache(t)
+	var loads int32
+	loader := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		time.Sleep(20 * time.Millisecond)
+		return &user{Name: "alice"}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var u user
+			if err := c.Once(context.Background(), "user:1", time.Minute, &u, loader); err != nil {
+				t.Error(err)
+			} else if u.Name != "alice" {
+				t.Errorf("unexpected value %+v", u)
+			}
+		}()
+	}
+	wg.Wait()
+	var u user
+	if err := c.Once(context.Background(), "user:1", time.Minute, &u, loader); err != nil || u.Name != "alice" {
+		t.Fatalf("unexpected value %+v, %v", u, err)
+	}
+	if loads != 1 {
+		t.Fatalf("expected a single load, got %d", loads)
+	}
+}
+
+func TestOnceNegative(t *testing.T) {
+	c, _ := newTestCache(t)
+	c.NegativeTTL = time.Minute
+	var loads int
+	loader := func(ctx context.Context) (interface{}, error) {
+		loads++
+		return nil, ErrNotFound
+	}
+	for i := 0; i < 2; i++ {
+		var u user
+		if err := c.Once(context.Background(), "user:2", time.Minute, &u, loader); err != ErrNotFound {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("expected the miss to be cached, got %d loads", loads)
+	}
+}
+
+func TestOnceLocked(t *testing.T) {
+	c, cli := newTestCache(t)
+	c.LockRetryDelay = time.Millisecond
+	// Another process is loading the value
+	if err := cli.Set("cache:user:3:lock", []byte("x"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error, 1)
+	var u user
+	go func() {
+		errc <- c.Once(context.Background(), "user:3", time.Minute, &u, func(ctx context.Context) (interface{}, error) {
+			t.Error("loader called while locked")
+			return nil, nil
+		})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := New(cli).Set("user:3", &user{Name: "bob"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "bob" {
+		t.Fatalf("unexpected value %+v", u)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := cli.Set("cache:user:4:lock", []byte("x"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Once(ctx, "user:4", time.Minute, &u, nil); err != context.DeadlineExceeded {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestGroupCanceledLeader(t *testing.T) {
+	var g group
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	errc := make(chan error, 1)
+	go func() {
+		_, err := g.do(ctx, "k", func() (*entry, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		errc <- err
+	}()
+	<-started
+
+	res := make(chan *entry, 1)
+	go func() {
+		e, err := g.do(context.Background(), "k", func() (*entry, error) {
+			return &entry{payload: []byte("v")}, nil
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		res <- e
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("expected context.Canceled for the leader, got %v", err)
+	}
+	// The waiter loads the value itself instead of getting the error
+	if e := <-res; e == nil || string(e.payload) != "v" {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+}
+
+func TestOncePanic(t *testing.T) {
+	c, _ := newTestCache(t)
+	started := make(chan struct{})
+	var once sync.Once
+	loader := func(ctx context.Context) (interface{}, error) {
+		once.Do(func() { close(started) })
+		time.Sleep(10 * time.Millisecond)
+		panic("boom")
+	}
+	errc := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			var u user
+			errc <- c.Once(context.Background(), "user:5", time.Minute, &u, loader)
+		}()
+		if i == 0 {
+			<-started
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err == nil || !strings.Contains(err.Error(), "boom") {
+			t.Fatalf("expected the panic as an error, got %v", err)
+		}
+	}
+}
+
+func TestExpireEarly(t *testing.T) {
+	c := &Cache{Beta: 1}
+	if c.expireEarly(&entry{delta: time.Millisecond, expires: time.Now().Add(time.Hour)}) {
+		t.Fatal("expected far expiry to not expire early")
+	}
+	if !c.expireEarly(&entry{delta: time.Millisecond, expires: time.Now().Add(-time.Second)}) {
+		t.Fatal("expected past expiry to expire")
+	}
+	if c.expireEarly(&entry{delta: time.Hour}) {
+		t.Fatal("expected no expiry to never expire")
+	}
+}
+
+func TestEntry(t *testing.T) {
+	e := &entry{negative: true, delta: 1500 * time.Microsecond, expires: time.UnixMilli(1700000000123), payload: []byte("abc")}
+	d, err := decodeEntry(e.encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.negative != e.negative || d.delta != e.delta || !d.expires.Equal(e.expires) || string(d.payload) != "abc" {
+		t.Fatalf("expected %+v, got %+v", e, d)
+	}
+	if _, err := decodeEntry([]byte("plain value")); err != ErrInvalidEntry {
+		t.Fatalf("expected ErrInvalidEntry, got %v", err)
+	}
+}
+
+func TestCodecAliases(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec{}, GobCodec{}} {
+		c := &Cache{Codec: codec}
+		b, err := c.Codec.Marshal("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s string
+		if err := c.Codec.Unmarshal(b, &s); err != nil || s != "a" {
+			t.Fatalf("%T: round trip returned %q, %v", codec, s, err)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package cache
+
+import "github.com/samuel/go-redis"
+
+// The codecs moved to the redis package and are kept here for
+// compatibility.
+type (
+	Codec     = redis.Codec
+	JSONCodec = redis.JSONCodec
+	GobCodec  = redis.GobCodec
+)
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type call struct {
+	done chan struct{}
+	e    *entry
+	err  error
+
+	// canceled is set when the call failed after the context of the
+	// caller that ran it was done.
+	canceled bool
+}
+
+// group deduplicates concurrent loads of the same key in the process.
+type group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// do runs fn unless a call for key is in progress in which case it waits
+// for its result. Waiters return early if their ctx is done, and run fn
+// themselves if the call failed because the ctx of its caller was done. A
+// panic in fn is returned as an error.
+func (g *group) do(ctx context.Context, key string, fn func() (*entry, error)) (e *entry, err error) {
+	g.mu.Lock()
+	for {
+		c, ok := g.calls[key]
+		if !ok {
+			break
+		}
+		g.mu.Unlock()
+		select {
+		case <-c.done:
+			if !c.canceled {
+				return c.e, c.err
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		g.mu.Lock()
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	c := &call{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			c.e, c.err = nil, fmt.Errorf("cache: loader panic: %v", r)
+		}
+		c.canceled = c.err != nil && ctx.Err() != nil
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+		e, err = c.e, c.err
+	}()
+	c.e, c.err = fn()
+	return c.e, c.err
+}
@@ -2,11 +2,13 @@ package redis
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -29,9 +31,26 @@ type Client struct {
 	net, addr string
 	timeout   time.Duration
 
+	// Connection settings applied by initConnection (see clients.go)
+	username, password string
+	authGen            atomic.Int64
+	name               string
+	noEvict, noTouch   bool
+
 	maxIdleConn  int
 	idleConn     []*redisConnection
 	idleConnLock sync.Mutex
+	closed       bool
+
+	// Read routing (see readpolicy.go)
+	readLock   sync.RWMutex
+	readPolicy ReadPolicy
+	replicas   []*Client
+	readOnly   atomic.Bool
+	latency    int64
+	downUntil  int64
+
+	nearCache atomic.Pointer[nearCache]
 }
 
 func NewClient(net, addr string) *Client {
@@ -49,12 +68,47 @@ func NewClient(net, addr string) *Client {
 
 func (cli *Client) SetMaxIdleConncetions(maxIdle int) {
 	cli.maxIdleConn = maxIdle
+	cli.eachReplica(func(r *Client) { r.SetMaxIdleConncetions(maxIdle) })
 	// The connection should quickly end up closed as they're used so no
 	// need to proactively close them here.
 }
 
 func (cli *Client) SetTimeout(timeout time.Duration) {
 	cli.timeout = timeout
+	cli.eachReplica(func(r *Client) { r.SetTimeout(timeout) })
+}
+
+// SetAuth sets the credentials used to authenticate new connections. The
+// username may be empty to use the default user. Idle connections are
+// closed and those in use aren't pooled again so commands don't run as
+// the previous user.
+func (cli *Client) SetAuth(username, password string) {
+	cli.idleConnLock.Lock()
+	cli.username = username
+	cli.password = password
+	cli.authGen.Add(1)
+	for _, rc := range cli.idleConn {
+		rc.close()
+	}
+	cli.idleConn = cli.idleConn[:0]
+	cli.idleConnLock.Unlock()
+	cli.eachReplica(func(r *Client) { r.SetAuth(username, password) })
+}
+
+// Close closes all idle connections. Connections currently in use are
+// closed instead of pooled when they are returned.
+func (cli *Client) Close() error {
+	cli.idleConnLock.Lock()
+	defer cli.idleConnLock.Unlock()
+	cli.closed = true
+	var err error
+	for _, rc := range cli.idleConn {
+		if e := rc.close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	cli.idleConn = cli.idleConn[:0]
+	return err
 }
 
 func (cli *Client) Pipeline() (*Pipeline, error) {
@@ -69,47 +123,53 @@ func (cli *Client) Pipeline() (*Pipeline, error) {
 }
 
 func (cli *Client) statusRequest(cmd string, args ...interface{}) (status []byte, err error) {
-	err = cli.withConnection(func(c *redisConnection) error {
-		err := c.sendCommand(cmd, args...)
-		if err == nil {
-			err = c.flush()
-		}
-		if err == nil {
-			status, err = c.readStatusBytes()
-		}
-		return err
+	err = cli.withConnection(func(c *redisConnection) (err error) {
+		status, err = c.statusRequest(cmd, args...)
+		return
 	})
 	return
 }
 
+// okRequest sends a command that replies with an OK status.
+func (cli *Client) okRequest(cmd string, args ...interface{}) error {
+	status, err := cli.statusRequest(cmd, args...)
+	if err == nil && !bytes.Equal(status, okStatus) {
+		err = ErrInvalidStatus
+	}
+	return err
+}
+
 func (cli *Client) integerRequest(cmd string, args ...interface{}) (i int64, err error) {
-	err = cli.withConnection(func(c *redisConnection) error {
-		err := c.sendCommand(cmd, args...)
-		if err == nil {
-			err = c.flush()
-		}
-		if err == nil {
-			i, err = c.readInteger()
-		}
-		return err
+	err = cli.withConnection(func(c *redisConnection) (err error) {
+		i, err = c.integerRequest(cmd, args...)
+		return
 	})
 	return
 }
 
 func (cli *Client) bulkRequest(cmd string, args ...interface{}) (b []byte, err error) {
-	err = cli.withConnection(func(c *redisConnection) error {
-		err := c.sendCommand(cmd, args...)
-		if err == nil {
-			err = c.flush()
-		}
-		if err == nil {
-			b, err = c.readBulkBytes()
-		}
-		return err
+	err = cli.withConnection(func(c *redisConnection) (err error) {
+		b, err = c.bulkRequest(cmd, args...)
+		return
 	})
 	return
 }
 
+func (cli *Client) replyRequest(cmd string, args ...interface{}) (r interface{}, err error) {
+	err = cli.withConnection(func(c *redisConnection) (err error) {
+		r, err = c.replyRequest(cmd, args...)
+		return
+	})
+	return
+}
+
+// Do sends an arbitrary command. Status replies are returned as string,
+// bulk replies as []byte, integers as int64 and multi-bulk replies as
+// []interface{}. Error replies are returned as an ErrReply error.
+func (cli *Client) Do(cmd string, args ...interface{}) (interface{}, error) {
+	return cli.replyRequest(cmd, args...)
+}
+
 func (cli *Client) withConnection(fn func(c *redisConnection) error) error {
 	c, err := cli.popConnection()
 	if err != nil {
@@ -129,7 +189,10 @@ func (cli *Client) withConnection(fn func(c *redisConnection) error) error {
 func (cli *Client) pushConnection(rc *redisConnection) {
 	cli.idleConnLock.Lock()
 	defer cli.idleConnLock.Unlock()
-	if len(cli.idleConn) >= cli.maxIdleConn {
+	// Connections set up before the read-only mode or credentials changed
+	// are dropped
+	if cli.closed || len(cli.idleConn) >= cli.maxIdleConn || rc.readOnly != cli.readOnly.Load() ||
+		rc.authGen != cli.authGen.Load() {
 		rc.close()
 	} else {
 		cli.idleConn = append(cli.idleConn, rc)
@@ -153,10 +216,51 @@ func (cli *Client) newConnection() (*redisConnection, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &redisConnection{
+	rc := &redisConnection{
 		nc:      nc,
 		rw:      bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc)),
 		timeout: cli.timeout,
 		buf:     make([]byte, connectionBufferSize),
-	}, nil
+	}
+	if err := cli.initConnection(rc); err != nil {
+		rc.close()
+		return nil, err
+	}
+	return rc, nil
+}
+
+// initConnection prepares a new connection before it's first used.
+func (cli *Client) initConnection(rc *redisConnection) error {
+	rc.authGen = cli.authGen.Load()
+	if cli.password != "" {
+		args := []interface{}{cli.password}
+		if cli.username != "" {
+			args = []interface{}{cli.username, cli.password}
+		}
+		if _, err := rc.statusRequest("AUTH", args...); err != nil {
+			return err
+		}
+	}
+	if cli.readOnly.Load() {
+		if _, err := rc.statusRequest("READONLY"); err != nil {
+			return err
+		}
+		rc.readOnly = true
+	}
+	if cli.name != "" {
+		if _, err := rc.statusRequest("CLIENT", "SETNAME", cli.name); err != nil {
+			return err
+		}
+	}
+	if cli.noEvict {
+		if _, err := rc.statusRequest("CLIENT", "NO-EVICT", "on"); err != nil {
+			return err
+		}
+	}
+	if cli.noTouch {
+		if _, err := rc.statusRequest("CLIENT", "NO-TOUCH", "on"); err != nil {
+			return err
+		}
+	}
+	return nil
 }
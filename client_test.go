@@ -5,6 +5,8 @@ import (
 	"runtime"
 	"testing"
 	"time"
+
+	"github.com/samuel/go-redis/redistest"
 )
 
 func checkMallocs(t *testing.T, key string, count int, fn func(t *testing.T)) {
@@ -31,8 +33,9 @@ func checkMallocs2(t *testing.T, key string, count int, fn func(t *testing.T, co
 }
 
 func TestCommands(t *testing.T) {
-	// Use a non-standard port to avoid accidently clobbering
-	c := NewClient("tcp", "127.0.0.1:6999")
+	s := redistest.NewServer()
+	defer s.Close()
+	c := NewClient("tcp", s.Addr())
 	if err := c.Ping(); err != nil {
 		t.Fatalf("Ping failed with %+v", err)
 	}
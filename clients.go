@@ -0,0 +1,235 @@
+package redis
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNoKillFilter = errors.New("redis: CLIENT KILL needs a filter")
+
+// SetClientName sets the name (CLIENT SETNAME) of connections opened
+// afterwards, as shown by CLIENT LIST.
+func (cli *Client) SetClientName(name string) {
+	cli.name = name
+	cli.eachReplica(func(r *Client) { r.SetClientName(name) })
+}
+
+// SetNoEvict excludes connections opened afterwards from client eviction
+// (CLIENT NO-EVICT).
+func (cli *Client) SetNoEvict(noEvict bool) {
+	cli.noEvict = noEvict
+	cli.eachReplica(func(r *Client) { r.SetNoEvict(noEvict) })
+}
+
+// SetNoTouch makes commands on connections opened afterwards not alter the
+// LRU/LFU of the keys they access (CLIENT NO-TOUCH).
+func (cli *Client) SetNoTouch(noTouch bool) {
+	cli.noTouch = noTouch
+	cli.eachReplica(func(r *Client) { r.SetNoTouch(noTouch) })
+}
+
+// ClientInfo describes a connection as reported by CLIENT LIST and CLIENT
+// INFO.
+type ClientInfo struct {
+	ID      int64
+	Addr    string
+	LAddr   string
+	Name    string
+	User    string
+	LibName string
+	LibVer  string
+	DB      int
+	Age     time.Duration
+	Idle    time.Duration
+	Flags   string
+	// Cmd is the last command run, with the subcommand after a "|".
+	Cmd string
+	// Memory is the total memory used by the connection.
+	Memory int64
+	// Fields has all the fields as reported by the server.
+	Fields map[string]string
+}
+
+func parseClientInfo(line string) *ClientInfo {
+	info := &ClientInfo{Fields: make(map[string]string)}
+	for _, f := range strings.Fields(line) {
+		k, v, _ := strings.Cut(f, "=")
+		info.Fields[k] = v
+		switch k {
+		case "id":
+			info.ID, _ = strconv.ParseInt(v, 10, 64)
+		case "addr":
+			info.Addr = v
+		case "laddr":
+			info.LAddr = v
+		case "name":
+			info.Name = v
+		case "user":
+			info.User = v
+		case "lib-name":
+			info.LibName = v
+		case "lib-ver":
+			info.LibVer = v
+		case "db":
+			info.DB, _ = strconv.Atoi(v)
+		case "age":
+			s, _ := strconv.ParseInt(v, 10, 64)
+			info.Age = time.Duration(s) * time.Second
+		case "idle":
+			s, _ := strconv.ParseInt(v, 10, 64)
+			info.Idle = time.Duration(s) * time.Second
+		case "flags":
+			info.Flags = v
+		case "cmd":
+			info.Cmd = v
+		case "tot-mem":
+			info.Memory, _ = strconv.ParseInt(v, 10, 64)
+		}
+	}
+	return info
+}
+
+type ClientListOptions struct {
+	// Type is one of normal, master, replica or pubsub.
+	Type string
+	IDs  []int64
+}
+
+// ClientList returns the connections to the server matching opt which may
+// be nil.
+func (cli *Client) ClientList(opt *ClientListOptions) ([]*ClientInfo, error) {
+	args := []interface{}{"LIST"}
+	if opt != nil {
+		if opt.Type != "" {
+			args = append(args, "TYPE", opt.Type)
+		}
+		if len(opt.IDs) != 0 {
+			args = append(args, "ID", opt.IDs)
+		}
+	}
+	b, err := cli.bulkRequest("CLIENT", args...)
+	if err != nil {
+		return nil, err
+	}
+	var infos []*ClientInfo
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			infos = append(infos, parseClientInfo(line))
+		}
+	}
+	return infos, nil
+}
+
+// ClientInfo returns the details of one of the client's connections.
+func (cli *Client) ClientInfo() (*ClientInfo, error) {
+	b, err := cli.bulkRequest("CLIENT", "INFO")
+	if err != nil {
+		return nil, err
+	}
+	return parseClientInfo(string(b)), nil
+}
+
+// ClientKillFilter selects the connections killed by ClientKill. Only
+// connections matching all the set fields are killed.
+type ClientKillFilter struct {
+	ID    int64
+	Addr  string
+	LAddr string
+	// Type is one of normal, master, replica or pubsub.
+	Type string
+	User string
+	// MaxAge kills connections older than it.
+	MaxAge time.Duration
+	// KillMe also kills the connection sending the command.
+	KillMe bool
+}
+
+// ClientKill closes the connections matching f and returns their number.
+// It returns ErrNoKillFilter if f is nil or matches every connection.
+func (cli *Client) ClientKill(f *ClientKillFilter) (int64, error) {
+	if f == nil {
+		return 0, ErrNoKillFilter
+	}
+	args := []interface{}{"KILL"}
+	if f.ID != 0 {
+		args = append(args, "ID", f.ID)
+	}
+	if f.Addr != "" {
+		args = append(args, "ADDR", f.Addr)
+	}
+	if f.LAddr != "" {
+		args = append(args, "LADDR", f.LAddr)
+	}
+	if f.Type != "" {
+		args = append(args, "TYPE", f.Type)
+	}
+	if f.User != "" {
+		args = append(args, "USER", f.User)
+	}
+	if f.MaxAge > 0 {
+		args = append(args, "MAXAGE", int64(f.MaxAge/time.Second))
+	}
+	if len(args) == 1 {
+		return 0, ErrNoKillFilter
+	}
+	if f.KillMe {
+		args = append(args, "SKIPME", "no")
+	}
+	return cli.integerRequest("CLIENT", args...)
+}
+
+// ClientID returns the ID of one of the client's connections.
+func (cli *Client) ClientID() (id int64, err error) {
+	err = cli.withConnection(func(c *redisConnection) (err error) {
+		id, err = c.clientID()
+		return
+	})
+	return
+}
+
+func (rc *redisConnection) clientID() (int64, error) {
+	if rc.id == 0 {
+		id, err := rc.integerRequest("CLIENT", "ID")
+		if err != nil {
+			return 0, err
+		}
+		rc.id = id
+	}
+	return rc.id, nil
+}
+
+// ClientGetName returns the name of one of the client's connections. See
+// SetClientName.
+func (cli *Client) ClientGetName() (string, error) {
+	b, err := cli.bulkRequest("CLIENT", "GETNAME")
+	return string(b), err
+}
+
+// ClientPause suspends the commands of all clients, or only the ones that
+// may write if writeOnly is set, for d.
+func (cli *Client) ClientPause(d time.Duration, writeOnly bool) error {
+	mode := "ALL"
+	if writeOnly {
+		mode = "WRITE"
+	}
+	return cli.okRequest("CLIENT", "PAUSE", int64(d/time.Millisecond), mode)
+}
+
+func (cli *Client) ClientUnpause() error {
+	return cli.okRequest("CLIENT", "UNPAUSE")
+}
+
+// ClientUnblock unblocks the connection with the given ID if it's blocked
+// in a command such as BLPOP, which then returns as if it timed out or,
+// with withError, with an UNBLOCKED error. It returns false if the
+// connection wasn't blocked.
+func (cli *Client) ClientUnblock(id int64, withError bool) (bool, error) {
+	mode := "TIMEOUT"
+	if withError {
+		mode = "ERROR"
+	}
+	i, err := cli.integerRequest("CLIENT", "UNBLOCK", id, mode)
+	return i == 1, err
+}
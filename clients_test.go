@@ -0,0 +1,106 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseClientInfo(t *testing.T) {
+	info := parseClientInfo("id=3 addr=127.0.0.1:51234 laddr=127.0.0.1:6379 fd=8 name=worker age=12 idle=3 flags=N db=2 tot-mem=22298 cmd=client|list user=default lib-name=go-redis lib-ver=1.0")
+	if info.ID != 3 || info.Addr != "127.0.0.1:51234" || info.LAddr != "127.0.0.1:6379" {
+		t.Fatalf("unexpected info %+v", info)
+	}
+	if info.Name != "worker" || info.User != "default" || info.LibName != "go-redis" || info.LibVer != "1.0" {
+		t.Fatalf("unexpected info %+v", info)
+	}
+	if info.DB != 2 || info.Age != 12*time.Second || info.Idle != 3*time.Second || info.Memory != 22298 {
+		t.Fatalf("unexpected info %+v", info)
+	}
+	if info.Flags != "N" || info.Cmd != "client|list" || info.Fields["fd"] != "8" {
+		t.Fatalf("unexpected info %+v", info)
+	}
+}
+
+func TestClientCommands(t *testing.T) {
+	var cr commandRecorder
+	srv := NewServer()
+	srv.HandleFunc("client", func(ctx context.Context, conn *ServerConn, args [][]byte) {
+		var reply interface{} = "OK"
+		switch string(args[1]) {
+		case "LIST":
+			reply = []byte("id=1 addr=127.0.0.1:1 name=a\nid=2 addr=127.0.0.1:2 name=b\n")
+		case "KILL", "UNBLOCK":
+			reply = int64(1)
+		case "GETNAME":
+			reply = []byte("worker")
+		}
+		cr.reply(reply)(ctx, conn, args)
+	})
+	cli := NewClient("tcp", startServer(t, srv))
+	defer cli.Close()
+	cli.SetClientName("worker")
+	cli.SetNoTouch(true)
+
+	infos, err := cli.ClientList(&ClientListOptions{Type: "normal", IDs: []int64{1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(infos) != 2 || infos[0].Name != "a" || infos[1].ID != 2 {
+		t.Fatalf("unexpected client list %+v", infos)
+	}
+	if n, err := cli.ClientKill(&ClientKillFilter{Addr: "127.0.0.1:1", MaxAge: time.Minute, KillMe: true}); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("expected 1, got %d", n)
+	}
+	for _, f := range []*ClientKillFilter{nil, {}, {KillMe: true}} {
+		if _, err := cli.ClientKill(f); err != ErrNoKillFilter {
+			t.Fatalf("expected ErrNoKillFilter for %+v, got %v", f, err)
+		}
+	}
+	if name, err := cli.ClientGetName(); err != nil {
+		t.Fatal(err)
+	} else if name != "worker" {
+		t.Fatalf("expected worker, got %q", name)
+	}
+	if err := cli.ClientPause(time.Second, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.ClientUnpause(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := cli.ClientUnblock(5, true); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatal("expected ClientUnblock to return true")
+	}
+
+	cr.check(t, []string{
+		"CLIENT SETNAME worker",
+		"CLIENT NO-TOUCH on",
+		"CLIENT LIST TYPE normal ID 1 2",
+		"CLIENT KILL ADDR 127.0.0.1:1 MAXAGE 60 SKIPME no",
+		"CLIENT GETNAME",
+		"CLIENT PAUSE 1000 WRITE",
+		"CLIENT UNPAUSE",
+		"CLIENT UNBLOCK 5 ERROR",
+	})
+}
+
+func TestClientSettingsReachReplicas(t *testing.T) {
+	cli := NewClient("tcp", "127.0.0.1:1")
+	cli.SetReplicas("127.0.0.1:2")
+	cli.SetClientName("worker")
+	cli.SetNoEvict(true)
+	cli.SetNoTouch(true)
+	cli.SetAuth("admin", "secret")
+	cli.SetTimeout(time.Minute)
+	cli.SetMaxIdleConncetions(3)
+	r := cli.replicas[0]
+	if r.name != "worker" || !r.noEvict || !r.noTouch {
+		t.Fatalf("settings not applied to replica: name=%q noEvict=%v noTouch=%v", r.name, r.noEvict, r.noTouch)
+	}
+	if r.username != "admin" || r.password != "secret" || r.timeout != time.Minute || r.maxIdleConn != 3 {
+		t.Fatalf("settings not applied to replica: username=%q timeout=%s maxIdle=%d", r.username, r.timeout, r.maxIdleConn)
+	}
+}
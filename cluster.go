@@ -0,0 +1,735 @@
+package redis
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// http://redis.io/topics/cluster-spec
+
+const (
+	DefaultMaxRedirects = 5
+
+	clusterSlots = 16384
+)
+
+var (
+	ErrTooManyRedirects = errors.New("redis: too many cluster redirects")
+	ErrInvalidSlotMap   = errors.New("redis: invalid cluster slot map")
+	ErrSlotNotServed    = errors.New("redis: cluster slot not served by any node")
+	ErrNoReachableNodes = errors.New("redis: no reachable cluster nodes")
+	ErrInvalidRedirect  = errors.New("redis: invalid cluster redirect")
+)
+
+var crc16tab = makeCRC16Table()
+
+// makeCRC16Table returns the lookup table for CRC16-CCITT (XMODEM) which is
+// the variant used by Redis Cluster for key hashing.
+func makeCRC16Table() (tab [256]uint16) {
+	for i := range tab {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		tab[i] = crc
+	}
+	return
+}
+
+func crc16(key string) uint16 {
+	crc := uint16(0)
+	for i := 0; i < len(key); i++ {
+		crc = crc<<8 ^ crc16tab[byte(crc>>8)^key[i]]
+	}
+	return crc
+}
+
+// hashSlot returns the cluster slot for a key. If the key contains a
+// non-empty {hashtag} then only the hashtag is hashed.
+func hashSlot(key string) int {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			key = key[s+1 : s+1+e]
+		}
+	}
+	return int(crc16(key)) & (clusterSlots - 1)
+}
+
+type clusterShard struct {
+	master   string
+	replicas []string
+}
+
+type clusterSlotRange struct {
+	start, end int
+	shard      *clusterShard
+}
+
+// ClusterClient routes commands to the nodes of a Redis Cluster. It keeps
+// a Client per node and follows MOVED and ASK redirects, refreshing its
+// view of the slot map when the topology changes.
+type ClusterClient struct {
+	net          string
+	seeds        []string
+	timeout      time.Duration
+	maxIdleConn  int
+	maxRedirects int
+	readPolicy   ReadPolicy
+	username     string
+	password     string
+
+	mu    sync.RWMutex
+	slots []*clusterShard
+	nodes map[string]*Client
+
+	reloading int32
+}
+
+func NewClusterClient(net string, addrs ...string) *ClusterClient {
+	seeds := make([]string, len(addrs))
+	for i, addr := range addrs {
+		if !strings.Contains(addr, ":") {
+			addr = fmt.Sprintf("%s:%d", addr, DefaultPort)
+		}
+		seeds[i] = addr
+	}
+	return &ClusterClient{
+		net:          net,
+		seeds:        seeds,
+		timeout:      DefaultTimeout,
+		maxIdleConn:  DefaultMaxIdleConnections,
+		maxRedirects: DefaultMaxRedirects,
+		nodes:        make(map[string]*Client),
+	}
+}
+
+func (cc *ClusterClient) SetTimeout(timeout time.Duration) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.timeout = timeout
+	for _, n := range cc.nodes {
+		n.SetTimeout(timeout)
+	}
+}
+
+func (cc *ClusterClient) SetMaxIdleConnections(maxIdle int) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.maxIdleConn = maxIdle
+	for _, n := range cc.nodes {
+		n.SetMaxIdleConncetions(maxIdle)
+	}
+}
+
+// SetAuth sets the credentials used to authenticate with every node. The
+// username may be empty to use the default user.
+func (cc *ClusterClient) SetAuth(username, password string) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.username = username
+	cc.password = password
+	for _, n := range cc.nodes {
+		n.SetAuth(username, password)
+	}
+}
+
+func (cc *ClusterClient) SetMaxRedirects(maxRedirects int) {
+	cc.maxRedirects = maxRedirects
+}
+
+// Close closes the idle connections of every known node.
+func (cc *ClusterClient) Close() error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	var err error
+	for addr, n := range cc.nodes {
+		if e := n.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(cc.nodes, addr)
+	}
+	cc.slots = nil
+	return err
+}
+
+// ReloadSlots fetches the slot map from the first node that answers,
+// trying CLUSTER SHARDS and falling back to CLUSTER SLOTS for servers
+// older than Redis 7.
+func (cc *ClusterClient) ReloadSlots() error {
+	cc.mu.RLock()
+	addrs := make([]string, 0, len(cc.nodes)+len(cc.seeds))
+	for addr := range cc.nodes {
+		addrs = append(addrs, addr)
+	}
+	cc.mu.RUnlock()
+	addrs = append(addrs, cc.seeds...)
+
+	err := ErrNoReachableNodes
+	for _, addr := range addrs {
+		var ranges []clusterSlotRange
+		ranges, err = fetchClusterSlots(cc.node(addr), addr)
+		if err == nil {
+			cc.setSlots(ranges)
+			return nil
+		}
+	}
+	return err
+}
+
+func fetchClusterSlots(n *Client, addr string) ([]clusterSlotRange, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.replyRequest("CLUSTER", "SHARDS")
+	if _, ok := err.(ErrReply); ok {
+		if r, err = n.replyRequest("CLUSTER", "SLOTS"); err != nil {
+			return nil, err
+		}
+		return parseClusterSlots(r, host)
+	} else if err != nil {
+		return nil, err
+	}
+	return parseClusterShards(r, host)
+}
+
+// parseClusterSlots parses the reply of CLUSTER SLOTS. Each entry is
+// [start, end, [ip, port, id, ...], [replica ip, port, id, ...], ...].
+// An empty or unknown ip refers to the host that was asked.
+func parseClusterSlots(r interface{}, host string) ([]clusterSlotRange, error) {
+	entries, ok := r.([]interface{})
+	if !ok {
+		return nil, ErrInvalidSlotMap
+	}
+	ranges := make([]clusterSlotRange, 0, len(entries))
+	for _, e := range entries {
+		fields, ok := e.([]interface{})
+		if !ok || len(fields) < 3 {
+			return nil, ErrInvalidSlotMap
+		}
+		start, ok1 := fields[0].(int64)
+		end, ok2 := fields[1].(int64)
+		if !ok1 || !ok2 {
+			return nil, ErrInvalidSlotMap
+		}
+		shard := &clusterShard{}
+		for i, n := range fields[2:] {
+			node, ok := n.([]interface{})
+			if !ok || len(node) < 2 {
+				return nil, ErrInvalidSlotMap
+			}
+			port, ok := node[1].(int64)
+			if !ok {
+				return nil, ErrInvalidSlotMap
+			}
+			addr := nodeAddr(replyString(node[0]), host, port)
+			if i == 0 {
+				shard.master = addr
+			} else {
+				shard.replicas = append(shard.replicas, addr)
+			}
+		}
+		ranges = append(ranges, clusterSlotRange{int(start), int(end), shard})
+	}
+	return ranges, nil
+}
+
+// parseClusterShards parses the reply of CLUSTER SHARDS which is a list of
+// maps (flattened into arrays) with "slots" and "nodes" entries.
+func parseClusterShards(r interface{}, host string) ([]clusterSlotRange, error) {
+	entries, ok := r.([]interface{})
+	if !ok {
+		return nil, ErrInvalidSlotMap
+	}
+	var ranges []clusterSlotRange
+	for _, e := range entries {
+		m, ok := replyMap(e)
+		if !ok {
+			return nil, ErrInvalidSlotMap
+		}
+		slots, ok1 := m["slots"].([]interface{})
+		nodes, ok2 := m["nodes"].([]interface{})
+		if !ok1 || !ok2 || len(slots)%2 != 0 {
+			return nil, ErrInvalidSlotMap
+		}
+		shard := &clusterShard{}
+		for _, n := range nodes {
+			node, ok := replyMap(n)
+			if !ok {
+				return nil, ErrInvalidSlotMap
+			}
+			port, ok := node["port"].(int64)
+			if !ok {
+				// TLS only nodes don't report a plain port
+				continue
+			}
+			ip := replyString(node["endpoint"])
+			if ip == "" || ip == "?" {
+				ip = replyString(node["ip"])
+			}
+			addr := nodeAddr(ip, host, port)
+			switch replyString(node["role"]) {
+			case "master":
+				shard.master = addr
+			case "replica":
+				if replyString(node["health"]) == "online" {
+					shard.replicas = append(shard.replicas, addr)
+				}
+			}
+		}
+		if shard.master == "" {
+			continue
+		}
+		for i := 0; i < len(slots); i += 2 {
+			start, ok1 := slots[i].(int64)
+			end, ok2 := slots[i+1].(int64)
+			if !ok1 || !ok2 {
+				return nil, ErrInvalidSlotMap
+			}
+			ranges = append(ranges, clusterSlotRange{int(start), int(end), shard})
+		}
+	}
+	return ranges, nil
+}
+
+func nodeAddr(ip, host string, port int64) string {
+	if ip == "" || ip == "?" {
+		ip = host
+	}
+	return net.JoinHostPort(ip, strconv.FormatInt(port, 10))
+}
+
+// replyString returns the value of a status or bulk reply as a string.
+func replyString(r interface{}) string {
+	switch v := r.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return ""
+}
+
+// replyMap converts a multi-bulk reply of alternating keys and values
+// into a map.
+func replyMap(r interface{}) (map[string]interface{}, bool) {
+	a, ok := r.([]interface{})
+	if !ok || len(a)%2 != 0 {
+		return nil, false
+	}
+	m := make(map[string]interface{}, len(a)/2)
+	for i := 0; i < len(a); i += 2 {
+		m[replyString(a[i])] = a[i+1]
+	}
+	return m, true
+}
+
+func (cc *ClusterClient) setSlots(ranges []clusterSlotRange) {
+	slots := make([]*clusterShard, clusterSlots)
+	for _, r := range ranges {
+		for s := r.start; s <= r.end && s < clusterSlots; s++ {
+			slots[s] = r.shard
+		}
+	}
+	cc.mu.Lock()
+	cc.slots = slots
+	cc.mu.Unlock()
+}
+
+func (cc *ClusterClient) reloadSlotsAsync() {
+	if !atomic.CompareAndSwapInt32(&cc.reloading, 0, 1) {
+		return
+	}
+	go func() {
+		cc.ReloadSlots()
+		atomic.StoreInt32(&cc.reloading, 0)
+	}()
+}
+
+// node returns the client for a node, creating it if necessary.
+func (cc *ClusterClient) node(addr string) *Client {
+	cc.mu.RLock()
+	n := cc.nodes[addr]
+	cc.mu.RUnlock()
+	if n != nil {
+		return n
+	}
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if n = cc.nodes[addr]; n == nil {
+		n = NewClient(cc.net, addr)
+		n.SetTimeout(cc.timeout)
+		n.SetMaxIdleConncetions(cc.maxIdleConn)
+		n.SetAuth(cc.username, cc.password)
+		n.readOnly.Store(cc.readPolicy != ReadMaster)
+		cc.nodes[addr] = n
+	}
+	return n
+}
+
+func (cc *ClusterClient) slotShard(slot int) (*clusterShard, error) {
+	cc.mu.RLock()
+	loaded := cc.slots != nil
+	cc.mu.RUnlock()
+	if !loaded {
+		if err := cc.ReloadSlots(); err != nil {
+			return nil, err
+		}
+	}
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	if cc.slots == nil {
+		return nil, ErrNoReachableNodes
+	}
+	if shard := cc.slots[slot]; shard != nil {
+		return shard, nil
+	}
+	return nil, ErrSlotNotServed
+}
+
+func (cc *ClusterClient) slotAddr(slot int) (string, error) {
+	shard, err := cc.slotShard(slot)
+	if err != nil {
+		return "", err
+	}
+	return shard.master, nil
+}
+
+func (cc *ClusterClient) masters() ([]string, error) {
+	if _, err := cc.slotShard(0); err != nil && err != ErrSlotNotServed {
+		return nil, err
+	}
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	seen := make(map[*clusterShard]bool)
+	var addrs []string
+	for _, shard := range cc.slots {
+		if shard != nil && !seen[shard] {
+			seen[shard] = true
+			addrs = append(addrs, shard.master)
+		}
+	}
+	return addrs, nil
+}
+
+// redirect handles a MOVED or ASK error returned by the node at from. It
+// returns the address to retry at and whether ASKING must be sent first.
+func (cc *ClusterClient) redirect(e ErrReply, from string) (addr string, asking bool, err error) {
+	if e.tag != "MOVED" && e.tag != "ASK" {
+		return "", false, e
+	}
+	p := strings.SplitN(e.msg, " ", 2)
+	if len(p) != 2 {
+		return "", false, ErrInvalidRedirect
+	}
+	slot, err := strconv.Atoi(p[0])
+	if err != nil || slot < 0 || slot >= clusterSlots {
+		return "", false, ErrInvalidRedirect
+	}
+	addr = p[1]
+	if strings.HasPrefix(addr, ":") {
+		// An empty host means the same host as the node that replied
+		host, _, err := net.SplitHostPort(from)
+		if err != nil {
+			return "", false, err
+		}
+		addr = host + addr
+	}
+	if e.tag == "ASK" {
+		return addr, true, nil
+	}
+	cc.mu.Lock()
+	if cc.slots != nil {
+		cc.slots[slot] = &clusterShard{master: addr}
+	}
+	cc.mu.Unlock()
+	cc.reloadSlotsAsync()
+	return addr, false, nil
+}
+
+func (cc *ClusterClient) withKey(key string, fn func(c *redisConnection) error) error {
+	return cc.withSlot(hashSlot(key), fn)
+}
+
+func (cc *ClusterClient) withSlot(slot int, fn func(c *redisConnection) error) error {
+	addr, err := cc.slotAddr(slot)
+	if err != nil {
+		return err
+	}
+	return cc.withRedirects(addr, false, fn)
+}
+
+// withRedirects runs fn on a connection to addr following any redirects
+// returned by fn.
+func (cc *ClusterClient) withRedirects(addr string, asking bool, fn func(c *redisConnection) error) error {
+	for i := 0; i <= cc.maxRedirects; i++ {
+		err := cc.node(addr).withConnection(func(c *redisConnection) error {
+			if asking {
+				if _, err := c.statusRequest("ASKING"); err != nil {
+					return err
+				}
+			}
+			return fn(c)
+		})
+		e, ok := err.(ErrReply)
+		if !ok {
+			if err != nil {
+				cc.reloadSlotsAsync()
+			}
+			return err
+		}
+		if addr, asking, err = cc.redirect(e, addr); err != nil {
+			return err
+		}
+	}
+	return ErrTooManyRedirects
+}
+
+// isRedirect returns err if it's a MOVED or ASK error and nil otherwise.
+func isRedirect(err error) error {
+	if e, ok := err.(ErrReply); ok && (e.tag == "MOVED" || e.tag == "ASK") {
+		return e
+	}
+	return nil
+}
+
+func (cc *ClusterClient) Decr(key string) (i int64, err error) {
+	err = cc.withKey(key, func(c *redisConnection) (err error) {
+		i, err = c.integerRequest("DECR", key)
+		return
+	})
+	return
+}
+
+func (cc *ClusterClient) Get(key string) (b []byte, err error) {
+	err = cc.withReadKey(key, func(c *redisConnection) (err error) {
+		b, err = c.bulkRequest("GET", key)
+		return
+	})
+	return
+}
+
+func (cc *ClusterClient) Incr(key string) (i int64, err error) {
+	err = cc.withKey(key, func(c *redisConnection) (err error) {
+		i, err = c.integerRequest("INCR", key)
+		return
+	})
+	return
+}
+
+// MGet splits the keys by slot and issues one MGET per slot in parallel.
+// Like Get it follows the read policy.
+func (cc *ClusterClient) MGet(key ...string) ([][]byte, error) {
+	slots := make(map[int][]int)
+	for i, k := range key {
+		s := hashSlot(k)
+		slots[s] = append(slots[s], i)
+	}
+	if len(slots) == 1 {
+		var out [][]byte
+		err := cc.withReadKey(key[0], func(c *redisConnection) (err error) {
+			out, err = c.mget(key)
+			return
+		})
+		return out, err
+	}
+
+	out := make([][]byte, len(key))
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var err error
+	for s, idx := range slots {
+		keys := make([]string, len(idx))
+		for i, j := range idx {
+			keys[i] = key[j]
+		}
+		wg.Add(1)
+		go func(s int, keys []string, idx []int) {
+			defer wg.Done()
+			e := cc.withReadSlot(s, func(c *redisConnection) error {
+				vals, err := c.mget(keys)
+				if err != nil {
+					return err
+				}
+				for i, j := range idx {
+					out[j] = vals[i]
+				}
+				return nil
+			})
+			if e != nil {
+				errOnce.Do(func() { err = e })
+			}
+		}(s, keys, idx)
+	}
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Ping pings every master in the cluster.
+func (cc *ClusterClient) Ping() error {
+	addrs, err := cc.masters()
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if err := cc.node(addr).Ping(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cc *ClusterClient) Set(key string, value []byte, expireTime time.Duration) error {
+	_, err := cc.set(key, value, expireTime, false, false)
+	return err
+}
+
+func (cc *ClusterClient) SetNX(key string, value []byte, expireTime time.Duration) (bool, error) {
+	return cc.set(key, value, expireTime, true, false)
+}
+
+func (cc *ClusterClient) SetXX(key string, value []byte, expireTime time.Duration) (bool, error) {
+	return cc.set(key, value, expireTime, false, true)
+}
+
+func (cc *ClusterClient) set(key string, value []byte, expireTime time.Duration, nx, xx bool) (ok bool, err error) {
+	err = cc.withKey(key, func(c *redisConnection) error {
+		status, err := c.statusRequest("SET", setArgs(key, value, expireTime, nx, xx)...)
+		if err == nil && status != nil && !bytes.Equal(status, okStatus) {
+			err = ErrInvalidStatus
+		}
+		ok = status != nil
+		return err
+	})
+	return
+}
+
+// Pipeline
+
+type clusterCommand struct {
+	slot  int
+	cmd   string
+	args  []interface{}
+	reply Reply
+}
+
+// ClusterPipeline buffers commands until Flush which sends them to their
+// nodes in one batch per node.
+type ClusterPipeline struct {
+	cc   *ClusterClient
+	cmds []clusterCommand
+}
+
+func (cc *ClusterClient) Pipeline() *ClusterPipeline {
+	return &ClusterPipeline{cc: cc}
+}
+
+func (p *ClusterPipeline) Get(key string) *BulkReply {
+	r := &BulkReply{}
+	p.cmds = append(p.cmds, clusterCommand{hashSlot(key), "GET", []interface{}{key}, r})
+	return r
+}
+
+// Flush sends the buffered commands and returns the replies in the order
+// the commands were added. Commands that are redirected are retried
+// individually at their new node.
+func (p *ClusterPipeline) Flush() ([]Reply, error) {
+	if len(p.cmds) == 0 {
+		return nil, nil
+	}
+	byAddr := make(map[string][]int)
+	for i, c := range p.cmds {
+		addr, err := p.cc.slotAddr(c.slot)
+		if err != nil {
+			return nil, err
+		}
+		byAddr[addr] = append(byAddr[addr], i)
+	}
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var err error
+	for addr, idx := range byAddr {
+		wg.Add(1)
+		go func(addr string, idx []int) {
+			defer wg.Done()
+			if e := p.send(addr, idx); e != nil {
+				errOnce.Do(func() { err = e })
+			}
+		}(addr, idx)
+	}
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	for addr, idx := range byAddr {
+		for _, i := range idx {
+			c := p.cmds[i]
+			e, ok := isRedirect(c.reply.Err()).(ErrReply)
+			if !ok {
+				continue
+			}
+			to, asking, err := p.cc.redirect(e, addr)
+			if err != nil {
+				return nil, err
+			}
+			err = p.cc.withRedirects(to, asking, func(rc *redisConnection) error {
+				if err := rc.sendCommand(c.cmd, c.args...); err != nil {
+					return err
+				}
+				if err := rc.flush(); err != nil {
+					return err
+				}
+				if err := c.reply.read(rc); err != nil {
+					return err
+				}
+				return isRedirect(c.reply.Err())
+			})
+			if _, ok := err.(ErrReply); err != nil && !ok {
+				return nil, err
+			}
+		}
+	}
+
+	replies := make([]Reply, len(p.cmds))
+	for i, c := range p.cmds {
+		replies[i] = c.reply
+	}
+	p.cmds = nil
+	return replies, nil
+}
+
+func (p *ClusterPipeline) send(addr string, idx []int) error {
+	return p.cc.node(addr).withConnection(func(rc *redisConnection) error {
+		for _, i := range idx {
+			if err := rc.sendCommand(p.cmds[i].cmd, p.cmds[i].args...); err != nil {
+				return err
+			}
+		}
+		if err := rc.flush(); err != nil {
+			return err
+		}
+		for _, i := range idx {
+			if err := p.cmds[i].reply.read(rc); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,114 @@
+package redis
+
+import (
+	"testing"
+)
+
+func TestHashSlot(t *testing.T) {
+	cases := []struct {
+		key  string
+		slot int
+	}{
+		{"123456789", 0x31C3},
+		{"foo", 12182},
+		{"bar", 5061},
+		{"{user1000}.following", hashSlot("user1000")},
+		{"{user1000}.followers", hashSlot("user1000")},
+		{"foo{}{bar}", hashSlot("foo{}{bar}")},
+		{"foo{{bar}}zap", hashSlot("{bar")},
+		{"foo{bar}{zap}", hashSlot("bar")},
+	}
+	for _, c := range cases {
+		if s := hashSlot(c.key); s != c.slot {
+			t.Errorf("hashSlot(%q) = %d, expected %d", c.key, s, c.slot)
+		}
+	}
+	if hashSlot("foo{}{bar}") == hashSlot("bar") {
+		t.Error("hashSlot should hash the whole key for an empty hashtag")
+	}
+}
+
+func TestParseClusterSlots(t *testing.T) {
+	r := []interface{}{
+		[]interface{}{
+			int64(0), int64(5460),
+			[]interface{}{[]byte("10.0.0.1"), int64(7000), []byte("id1")},
+			[]interface{}{[]byte("10.0.0.2"), int64(7001), []byte("id2")},
+		},
+		[]interface{}{
+			int64(5461), int64(16383),
+			[]interface{}{[]byte(""), int64(7002), []byte("id3")},
+		},
+	}
+	ranges, err := parseClusterSlots(r, "10.0.0.9")
+	if err != nil {
+		t.Fatalf("parseClusterSlots failed with %+v", err)
+	}
+	if len(ranges) != 2 {
+		t.Fatalf("parseClusterSlots returned %d ranges instead of 2", len(ranges))
+	}
+	if s := ranges[0].shard; s.master != "10.0.0.1:7000" || len(s.replicas) != 1 || s.replicas[0] != "10.0.0.2:7001" {
+		t.Fatalf("parseClusterSlots returned wrong shard %+v", s)
+	}
+	if r := ranges[1]; r.start != 5461 || r.end != 16383 || r.shard.master != "10.0.0.9:7002" {
+		t.Fatalf("parseClusterSlots returned wrong range %+v", r)
+	}
+}
+
+func TestParseClusterShards(t *testing.T) {
+	node := func(ip string, port int64, role, health string) []interface{} {
+		return []interface{}{
+			[]byte("id"), []byte("abc"),
+			[]byte("port"), port,
+			[]byte("ip"), []byte(ip),
+			[]byte("endpoint"), []byte(ip),
+			[]byte("role"), []byte(role),
+			[]byte("replication-offset"), int64(72156),
+			[]byte("health"), []byte(health),
+		}
+	}
+	r := []interface{}{
+		[]interface{}{
+			[]byte("slots"), []interface{}{int64(0), int64(100), int64(200), int64(300)},
+			[]byte("nodes"), []interface{}{
+				node("10.0.0.1", 7000, "master", "online"),
+				node("10.0.0.2", 7001, "replica", "online"),
+				node("10.0.0.3", 7002, "replica", "loading"),
+			},
+		},
+	}
+	ranges, err := parseClusterShards(r, "10.0.0.9")
+	if err != nil {
+		t.Fatalf("parseClusterShards failed with %+v", err)
+	}
+	if len(ranges) != 2 || ranges[1].start != 200 || ranges[1].end != 300 {
+		t.Fatalf("parseClusterShards returned wrong ranges %+v", ranges)
+	}
+	if s := ranges[0].shard; s.master != "10.0.0.1:7000" || len(s.replicas) != 1 || s.replicas[0] != "10.0.0.2:7001" {
+		t.Fatalf("parseClusterShards returned wrong shard %+v", s)
+	}
+}
+
+func TestClusterRedirect(t *testing.T) {
+	cc := NewClusterClient("tcp", "10.0.0.1:7000")
+	cc.setSlots([]clusterSlotRange{{0, clusterSlots - 1, &clusterShard{master: "10.0.0.1:7000"}}})
+	cc.reloading = 1 // don't try to reload from a cluster that doesn't exist
+
+	addr, asking, err := cc.redirect(parseErrReply("ASK 3999 10.0.0.2:7001"), "10.0.0.1:7000")
+	if err != nil || !asking || addr != "10.0.0.2:7001" {
+		t.Fatalf("redirect for ASK returned %s %t %+v", addr, asking, err)
+	}
+	if a, _ := cc.slotAddr(3999); a != "10.0.0.1:7000" {
+		t.Fatal("ASK redirect should not update the slot map")
+	}
+	addr, asking, err = cc.redirect(parseErrReply("MOVED 3999 :7002"), "10.0.0.1:7000")
+	if err != nil || asking || addr != "10.0.0.1:7002" {
+		t.Fatalf("redirect for MOVED returned %s %t %+v", addr, asking, err)
+	}
+	if a, _ := cc.slotAddr(3999); a != "10.0.0.1:7002" {
+		t.Fatal("MOVED redirect should update the slot map")
+	}
+	if _, _, err := cc.redirect(parseErrReply("ERR foo"), "10.0.0.1:7000"); err == nil {
+		t.Fatal("redirect should fail for non-redirect errors")
+	}
+}
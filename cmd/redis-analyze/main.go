@@ -0,0 +1,151 @@
+// Command redis-analyze reports memory usage of a Redis dataset from an
+// RDB snapshot: key counts and estimated memory per key prefix, the
+// largest keys per type, the TTL distribution and the encodings used.
+//
+// Usage:
+//
+//	redis-analyze [-format text|csv|json] [-separator :] [-depth 1] [-top 10] dump.rdb
+//
+// Memory is estimated from the serialized size of each value plus a fixed
+// per-key overhead. It's meant for comparing prefixes and finding big
+// keys rather than predicting used_memory exactly.
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/samuel/go-redis/rdb"
+)
+
+func main() {
+	format := flag.String("format", "text", "output format: text, csv or json")
+	separator := flag.String("separator", ":", "separator between key prefix components")
+	depth := flag.Int("depth", 1, "number of key components in a prefix")
+	top := flag.Int("top", 10, "number of largest keys to list per type")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] dump.rdb\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fatal(err)
+	}
+	defer f.Close()
+
+	a := newAnalyzer(*separator, *depth, *top)
+	if err := rdb.Parse(f, a.handler()); err != nil {
+		fatal(err)
+	}
+	report := a.result()
+
+	w := bufio.NewWriter(os.Stdout)
+	switch *format {
+	case "text":
+		err = writeText(w, report)
+	case "csv":
+		err = writeCSV(w, report)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	default:
+		fatal(fmt.Errorf("unknown format %q", *format))
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "redis-analyze: %s\n", err)
+	os.Exit(1)
+}
+
+func writeText(w io.Writer, r *Report) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "Keys:\t%d\t\n", r.Keys)
+	fmt.Fprintf(tw, "Estimated memory:\t%s\t\n", formatBytes(r.Memory))
+
+	fmt.Fprintf(tw, "\nPREFIX\tKEYS\tMEMORY\t\n")
+	for _, p := range r.Prefixes {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t\n", p.Prefix, p.Keys, formatBytes(p.Memory))
+	}
+
+	fmt.Fprintf(tw, "\nTYPE\tKEY\tDB\tENCODING\tELEMENTS\tMEMORY\t\n")
+	for _, k := range r.Largest {
+		fmt.Fprintf(tw, "%s\t%q\t%d\t%s\t%d\t%s\t\n", k.Type, k.Key, k.DB, k.Encoding, k.Elements, formatBytes(k.Memory))
+	}
+
+	fmt.Fprintf(tw, "\nTTL\tKEYS\t\n")
+	for _, b := range r.TTL {
+		fmt.Fprintf(tw, "%s\t%d\t\n", b.Name, b.Keys)
+	}
+
+	fmt.Fprintf(tw, "\nTYPE\tENCODING\tKEYS\tMEMORY\t\n")
+	for _, e := range r.Encodings {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t\n", e.Type, e.Encoding, e.Keys, formatBytes(e.Memory))
+	}
+	return tw.Flush()
+}
+
+// writeCSV writes all sections as one table with the section in the
+// first column.
+func writeCSV(w io.Writer, r *Report) error {
+	cw := csv.NewWriter(w)
+	itoa := func(i int64) string { return strconv.FormatInt(i, 10) }
+	cw.Write([]string{"section", "name", "type", "encoding", "db", "elements", "keys", "memory"})
+	cw.Write([]string{"total", "", "", "", "", "", itoa(r.Keys), itoa(r.Memory)})
+	for _, p := range r.Prefixes {
+		cw.Write([]string{"prefix", p.Prefix, "", "", "", "", itoa(p.Keys), itoa(p.Memory)})
+	}
+	for _, k := range r.Largest {
+		cw.Write([]string{"largest", k.Key, k.Type, k.Encoding, strconv.Itoa(k.DB), itoa(k.Elements), "1", itoa(k.Memory)})
+	}
+	for _, b := range r.TTL {
+		cw.Write([]string{"ttl", b.Name, "", "", "", "", itoa(b.Keys), ""})
+	}
+	for _, e := range r.Encodings {
+		cw.Write([]string{"encoding", "", e.Type, e.Encoding, "", "", itoa(e.Keys), itoa(e.Memory)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatInt(n, 10) + " B"
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func parseUnix(b []byte) (time.Time, error) {
+	s, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(s, 0), nil
+}
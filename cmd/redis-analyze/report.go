@@ -0,0 +1,257 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/samuel/go-redis/rdb"
+)
+
+// Estimated per-key overhead of the main dictionary entry, key SDS and
+// value object on a 64-bit server, plus the entry in the expires
+// dictionary.
+const (
+	keyOverhead    = 56
+	expireOverhead = 32
+)
+
+type Report struct {
+	Keys      int64            `json:"keys"`
+	Memory    int64            `json:"memory"`
+	Prefixes  []*PrefixStats   `json:"prefixes"`
+	Largest   []*KeyStats      `json:"largest"`
+	TTL       []*TTLBucket     `json:"ttl"`
+	Encodings []*EncodingStats `json:"encodings"`
+}
+
+type PrefixStats struct {
+	Prefix string `json:"prefix"`
+	Keys   int64  `json:"keys"`
+	Memory int64  `json:"memory"`
+}
+
+type KeyStats struct {
+	DB       int    `json:"db"`
+	Key      string `json:"key"`
+	Type     string `json:"type"`
+	Encoding string `json:"encoding"`
+	Elements int64  `json:"elements"`
+	Memory   int64  `json:"memory"`
+}
+
+type TTLBucket struct {
+	Name string `json:"name"`
+	Keys int64  `json:"keys"`
+}
+
+type EncodingStats struct {
+	Type     string `json:"type"`
+	Encoding string `json:"encoding"`
+	Keys     int64  `json:"keys"`
+	Memory   int64  `json:"memory"`
+}
+
+var ttlBuckets = []struct {
+	name string
+	max  time.Duration
+}{
+	{"< 1m", time.Minute},
+	{"< 1h", time.Hour},
+	{"< 1d", 24 * time.Hour},
+	{"< 7d", 7 * 24 * time.Hour},
+	{"< 30d", 30 * 24 * time.Hour},
+	{">= 30d", 1<<63 - 1},
+}
+
+const (
+	noExpiry = "no expiry"
+	expired  = "expired"
+)
+
+// analyzer aggregates the entries of an RDB file into a Report.
+type analyzer struct {
+	separator string
+	depth     int
+	top       int
+	now       time.Time
+
+	report    Report
+	prefixes  map[string]*PrefixStats
+	largest   map[rdb.Type][]*KeyStats
+	ttl       map[string]int64
+	encodings map[[2]string]*EncodingStats
+}
+
+func newAnalyzer(separator string, depth, top int) *analyzer {
+	return &analyzer{
+		separator: separator,
+		depth:     depth,
+		top:       top,
+		prefixes:  make(map[string]*PrefixStats),
+		largest:   make(map[rdb.Type][]*KeyStats),
+		ttl:       make(map[string]int64),
+		encodings: make(map[[2]string]*EncodingStats),
+	}
+}
+
+func (a *analyzer) handler() *rdb.Handler {
+	return &rdb.Handler{
+		Aux: func(key, value []byte) error {
+			// TTLs are relative to the time the snapshot was taken
+			if string(key) == "ctime" && a.now.IsZero() {
+				if t, err := parseUnix(value); err == nil {
+					a.now = t
+				}
+			}
+			return nil
+		},
+		Entry: func(e *rdb.Entry) error {
+			a.add(e)
+			return nil
+		},
+	}
+}
+
+func (a *analyzer) add(e *rdb.Entry) {
+	mem := int64(len(e.Key)) + e.Size + keyOverhead
+	if !e.Expires.IsZero() {
+		mem += expireOverhead
+	}
+	a.report.Keys++
+	a.report.Memory += mem
+
+	prefix := a.prefix(string(e.Key))
+	ps := a.prefixes[prefix]
+	if ps == nil {
+		ps = &PrefixStats{Prefix: prefix}
+		a.prefixes[prefix] = ps
+	}
+	ps.Keys++
+	ps.Memory += mem
+
+	ek := [2]string{e.Type.String(), e.Encoding}
+	es := a.encodings[ek]
+	if es == nil {
+		es = &EncodingStats{Type: ek[0], Encoding: ek[1]}
+		a.encodings[ek] = es
+	}
+	es.Keys++
+	es.Memory += mem
+
+	a.ttl[a.ttlBucket(e.Expires)]++
+
+	if a.top > 0 {
+		ks := &KeyStats{
+			DB:       e.DB,
+			Key:      string(e.Key),
+			Type:     e.Type.String(),
+			Encoding: e.Encoding,
+			Elements: elements(e.Value),
+			Memory:   mem,
+		}
+		top := a.largest[e.Type]
+		i := sort.Search(len(top), func(i int) bool { return top[i].Memory < mem })
+		if i < a.top {
+			top = append(top, nil)
+			copy(top[i+1:], top[i:])
+			top[i] = ks
+			if len(top) > a.top {
+				top = top[:a.top]
+			}
+			a.largest[e.Type] = top
+		}
+	}
+}
+
+func (a *analyzer) prefix(key string) string {
+	if a.separator == "" || a.depth <= 0 {
+		return key
+	}
+	parts := strings.SplitN(key, a.separator, a.depth+1)
+	if len(parts) == 1 {
+		return "(no prefix)"
+	}
+	if len(parts) > a.depth {
+		parts = parts[:a.depth]
+	}
+	return strings.Join(parts, a.separator) + a.separator + "*"
+}
+
+func (a *analyzer) ttlBucket(expires time.Time) string {
+	if expires.IsZero() {
+		return noExpiry
+	}
+	now := a.now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	ttl := expires.Sub(now)
+	if ttl <= 0 {
+		return expired
+	}
+	for _, b := range ttlBuckets {
+		if ttl < b.max {
+			return b.name
+		}
+	}
+	return ttlBuckets[len(ttlBuckets)-1].name
+}
+
+// result returns the report with sections sorted by memory.
+func (a *analyzer) result() *Report {
+	r := a.report
+	r.Prefixes = r.Prefixes[:0]
+	for _, ps := range a.prefixes {
+		r.Prefixes = append(r.Prefixes, ps)
+	}
+	sort.Slice(r.Prefixes, func(i, j int) bool {
+		if r.Prefixes[i].Memory != r.Prefixes[j].Memory {
+			return r.Prefixes[i].Memory > r.Prefixes[j].Memory
+		}
+		return r.Prefixes[i].Prefix < r.Prefixes[j].Prefix
+	})
+
+	r.Largest = r.Largest[:0]
+	for t := rdb.TypeString; t <= rdb.TypeModule; t++ {
+		r.Largest = append(r.Largest, a.largest[t]...)
+	}
+
+	r.TTL = []*TTLBucket{
+		{Name: noExpiry, Keys: a.ttl[noExpiry]},
+		{Name: expired, Keys: a.ttl[expired]},
+	}
+	for _, b := range ttlBuckets {
+		r.TTL = append(r.TTL, &TTLBucket{Name: b.name, Keys: a.ttl[b.name]})
+	}
+
+	r.Encodings = r.Encodings[:0]
+	for _, es := range a.encodings {
+		r.Encodings = append(r.Encodings, es)
+	}
+	sort.Slice(r.Encodings, func(i, j int) bool {
+		if r.Encodings[i].Type != r.Encodings[j].Type {
+			return r.Encodings[i].Type < r.Encodings[j].Type
+		}
+		return r.Encodings[i].Encoding < r.Encodings[j].Encoding
+	})
+	return &r
+}
+
+// elements returns the length of a string or the number of elements of
+// a collection.
+func elements(v interface{}) int64 {
+	switch v := v.(type) {
+	case []byte:
+		return int64(len(v))
+	case [][]byte:
+		return int64(len(v))
+	case map[string][]byte:
+		return int64(len(v))
+	case []rdb.ZMember:
+		return int64(len(v))
+	case *rdb.Stream:
+		return int64(v.Length)
+	}
+	return 0
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-redis/rdb"
+)
+
+func TestAnalyzer(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	a := newAnalyzer(":", 1, 1)
+	a.now = now
+	entries := []*rdb.Entry{
+		{Key: []byte("user:1"), Type: rdb.TypeString, Encoding: "raw", Value: []byte("abc"), Size: 4},
+		{Key: []byte("user:2"), Type: rdb.TypeString, Encoding: "raw", Value: []byte("abcdefgh"), Size: 9, Expires: now.Add(30 * time.Second)},
+		{Key: []byte("session:1"), Type: rdb.TypeHash, Encoding: "listpack", Value: map[string][]byte{"a": nil, "b": nil}, Size: 20, Expires: now.Add(-time.Second)},
+		{Key: []byte("counter"), Type: rdb.TypeString, Encoding: "raw", Value: []byte("1"), Size: 2, Expires: now.Add(48 * time.Hour)},
+	}
+	for _, e := range entries {
+		a.add(e)
+	}
+	r := a.result()
+
+	if r.Keys != 4 {
+		t.Fatalf("expected 4 keys, got %d", r.Keys)
+	}
+	prefixes := map[string]int64{}
+	for _, p := range r.Prefixes {
+		prefixes[p.Prefix] = p.Keys
+	}
+	if prefixes["user:*"] != 2 || prefixes["session:*"] != 1 || prefixes["(no prefix)"] != 1 {
+		t.Fatalf("unexpected prefixes %+v", prefixes)
+	}
+	if len(r.Largest) != 2 || r.Largest[0].Key != "user:2" || r.Largest[1].Key != "session:1" || r.Largest[1].Elements != 2 {
+		t.Fatalf("unexpected largest keys %+v %+v", r.Largest[0], r.Largest[1])
+	}
+	ttl := map[string]int64{}
+	for _, b := range r.TTL {
+		ttl[b.Name] = b.Keys
+	}
+	if ttl[noExpiry] != 1 || ttl[expired] != 1 || ttl["< 1m"] != 1 || ttl["< 7d"] != 1 {
+		t.Fatalf("unexpected TTL distribution %+v", ttl)
+	}
+	if len(r.Encodings) != 2 || r.Encodings[0].Type != "hash" || r.Encodings[1].Keys != 3 {
+		t.Fatalf("unexpected encodings %+v", r.Encodings)
+	}
+
+	var buf bytes.Buffer
+	if err := writeCSV(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "prefix,user:*,,,,,2,") {
+		t.Fatalf("unexpected CSV output:\n%s", buf.String())
+	}
+	buf.Reset()
+	if err := writeText(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, s := range map[int64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KiB", 3 << 30: "3.0 GiB"} {
+		if f := formatBytes(n); f != s {
+			t.Errorf("formatBytes(%d) = %q, expected %q", n, f, s)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Command redis-monitor samples live traffic with MONITOR and reports the
+// number of commands per command name and per key prefix.
+//
+// Usage:
+//
+//	redis-monitor [-addr localhost:6379] [-duration 10s] [-sample 1] [-separator :] [-depth 1] [-top 20]
+//
+// MONITOR has a significant cost on busy servers so keep the duration
+// short. Sampling only reduces the work done by this command, the server
+// still streams every command. Rates are extrapolated from the sample.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/samuel/go-redis"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:6379", "address of the server to monitor")
+	duration := flag.Duration("duration", 10*time.Second, "how long to monitor")
+	sample := flag.Float64("sample", 1, "fraction of commands to count")
+	separator := flag.String("separator", ":", "separator between key prefix components")
+	depth := flag.Int("depth", 1, "number of key components in a prefix")
+	top := flag.Int("top", 20, "number of commands and prefixes to list")
+	flag.Parse()
+	if *sample <= 0 || *sample > 1 {
+		fatal(fmt.Errorf("sample must be in (0, 1]"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *duration)
+	defer cancel()
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	cli := redis.NewClient("tcp", *addr)
+	defer cli.Close()
+	m, err := cli.Monitor(ctx)
+	if err != nil {
+		fatal(err)
+	}
+	defer m.Close()
+
+	st := newStats(*separator, *depth, *sample)
+	start := time.Now()
+	for {
+		e, err := m.Next()
+		if err != nil {
+			if ctx.Err() == nil {
+				fatal(err)
+			}
+			break
+		}
+		st.add(e)
+	}
+	if err := st.write(os.Stdout, time.Since(start), *top); err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "redis-monitor: %s\n", err)
+	os.Exit(1)
+}
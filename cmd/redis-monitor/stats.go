@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/samuel/go-redis"
+)
+
+type stats struct {
+	separator string
+	depth     int
+	sample    float64
+	random    func() float64
+
+	total    int64
+	commands map[string]int64
+	prefixes map[string]int64
+}
+
+func newStats(separator string, depth int, sample float64) *stats {
+	return &stats{
+		separator: separator,
+		depth:     depth,
+		sample:    sample,
+		random:    rand.Float64,
+		commands:  make(map[string]int64),
+		prefixes:  make(map[string]int64),
+	}
+}
+
+func (s *stats) add(e *redis.MonitorEvent) {
+	if s.sample < 1 && s.random() >= s.sample {
+		return
+	}
+	s.total++
+	s.commands[e.Command]++
+	args := append([][]byte{[]byte(e.Command)}, e.Args...)
+	for _, key := range redis.CommandKeys(args) {
+		s.prefixes[s.prefix(string(key))]++
+	}
+}
+
+func (s *stats) prefix(key string) string {
+	if s.separator == "" || s.depth <= 0 {
+		return key
+	}
+	parts := strings.SplitN(key, s.separator, s.depth+1)
+	if len(parts) == 1 {
+		return "(no prefix)"
+	}
+	if len(parts) > s.depth {
+		parts = parts[:s.depth]
+	}
+	return strings.Join(parts, s.separator) + s.separator + "*"
+}
+
+type count struct {
+	name string
+	n    int64
+}
+
+func topCounts(m map[string]int64, top int) []count {
+	counts := make([]count, 0, len(m))
+	for name, n := range m {
+		counts = append(counts, count{name, n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].n != counts[j].n {
+			return counts[i].n > counts[j].n
+		}
+		return counts[i].name < counts[j].name
+	})
+	if top > 0 && len(counts) > top {
+		counts = counts[:top]
+	}
+	return counts
+}
+
+func (s *stats) write(w io.Writer, elapsed time.Duration, top int) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	rate := func(n int64) string {
+		if elapsed <= 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f", float64(n)/s.sample/elapsed.Seconds())
+	}
+	fmt.Fprintf(tw, "Sampled %d commands in %s (sample rate %g)\n", s.total, elapsed.Round(time.Millisecond), s.sample)
+	for _, section := range []struct {
+		title  string
+		counts map[string]int64
+	}{
+		{"Command", s.commands},
+		{"Prefix", s.prefixes},
+	} {
+		fmt.Fprintf(tw, "\n%s\tCount\tPer second\t\n", section.title)
+		for _, c := range topCounts(section.counts, top) {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t\n", c.name, c.n, rate(c.n))
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-redis"
+)
+
+func TestStats(t *testing.T) {
+	s := newStats(":", 1, 1)
+	for _, e := range []*redis.MonitorEvent{
+		{Command: "GET", Args: [][]byte{[]byte("user:1")}},
+		{Command: "MGET", Args: [][]byte{[]byte("user:2"), []byte("session:1")}},
+		{Command: "GET", Args: [][]byte{[]byte("counter")}},
+		{Command: "PING"},
+	} {
+		s.add(e)
+	}
+	if s.total != 4 || s.commands["GET"] != 2 || s.commands["PING"] != 1 {
+		t.Fatalf("unexpected commands %d %v", s.total, s.commands)
+	}
+	if s.prefixes["user:*"] != 2 || s.prefixes["session:*"] != 1 || s.prefixes["(no prefix)"] != 1 {
+		t.Fatalf("unexpected prefixes %v", s.prefixes)
+	}
+
+	var buf bytes.Buffer
+	if err := s.write(&buf, 2*time.Second, 1); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "GET") || !strings.Contains(out, "user:*") || strings.Contains(out, "PING") {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+
+	// Half the commands are skipped and rates are scaled
+	s = newStats(":", 1, 0.5)
+	n := 0
+	s.random = func() float64 {
+		n++
+		return float64(n%2) * 0.9
+	}
+	for i := 0; i < 4; i++ {
+		s.add(&redis.MonitorEvent{Command: "GET", Args: [][]byte{[]byte("k")}})
+	}
+	buf.Reset()
+	s.write(&buf, time.Second, 0)
+	if s.total != 2 || !strings.Contains(buf.String(), "4.0") {
+		t.Fatalf("unexpected sampled output:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,47 @@
+// Command redis-replay-aof replays an append-only file to a server.
+//
+// Usage:
+//
+//	redis-replay-aof [-addr localhost:6379] [-db n] [-pattern glob] [-batch 100] appendonlydir|appendonly.aof
+//
+// The path may be a legacy AOF file or a Redis 7 multi-part AOF directory
+// with a manifest.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/samuel/go-redis"
+	"github.com/samuel/go-redis/aof"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:6379", "address of the server to replay to")
+	db := flag.Int("db", -1, "only replay commands for this database")
+	pattern := flag.String("pattern", "", "only replay commands with a key matching this glob-style pattern")
+	batch := flag.Int("batch", aof.DefaultReplayBatchSize, "number of commands to pipeline")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] appendonlydir|appendonly.aof\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cli := redis.NewClient("tcp", *addr)
+	defer cli.Close()
+	rp := aof.NewReplayer(cli)
+	rp.DB = *db
+	rp.Pattern = *pattern
+	rp.BatchSize = *batch
+	err := rp.ReplayFile(flag.Arg(0))
+	fmt.Fprintf(os.Stderr, "replayed %d commands, skipped %d\n", rp.Commands, rp.Skipped)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "redis-replay-aof: %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,150 @@
+package redis
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"time"
+)
+
+// Codec encodes values stored in keys.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type GobCodec struct{}
+
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// ProtoMessage is implemented by generated protobuf messages that have
+// marshaling methods (e.g. gogo/protobuf). Messages of
+// google.golang.org/protobuf can use CodecFuncs with proto.Marshal.
+type ProtoMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+// ProtoCodec encodes values implementing ProtoMessage. Unmarshal must be
+// given a pointer implementing it. Use TypedKey[M] with the message type
+// rather than TypedKey[*M].
+type ProtoCodec struct{}
+
+func (ProtoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(ProtoMessage)
+	if !ok {
+		return nil, ErrInvalidArgumentType
+	}
+	return m.Marshal()
+}
+
+func (ProtoCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(ProtoMessage)
+	if !ok {
+		return ErrInvalidArgumentType
+	}
+	return m.Unmarshal(data)
+}
+
+// CodecFuncs adapts a pair of functions to a Codec. For instance msgpack
+// can be used with
+//
+//	redis.CodecFuncs{MarshalFunc: msgpack.Marshal, UnmarshalFunc: msgpack.Unmarshal}
+type CodecFuncs struct {
+	MarshalFunc   func(v interface{}) ([]byte, error)
+	UnmarshalFunc func(data []byte, v interface{}) error
+}
+
+func (c CodecFuncs) Marshal(v interface{}) ([]byte, error) {
+	return c.MarshalFunc(v)
+}
+
+func (c CodecFuncs) Unmarshal(data []byte, v interface{}) error {
+	return c.UnmarshalFunc(data, v)
+}
+
+// TypedKey reads and writes keys holding values of type T encoded with a
+// codec.
+type TypedKey[T any] struct {
+	// Prefix is prepended to keys.
+	Prefix string
+
+	cli   *Client
+	codec Codec
+}
+
+func NewTypedKey[T any](cli *Client, codec Codec) *TypedKey[T] {
+	return &TypedKey[T]{cli: cli, codec: codec}
+}
+
+// Get returns nil if the key doesn't exist.
+func (k *TypedKey[T]) Get(key string) (*T, error) {
+	b, err := k.cli.Get(k.Prefix + key)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	return k.decode(b)
+}
+
+func (k *TypedKey[T]) Set(key string, v T, expireTime time.Duration) error {
+	// A pointer so methods with a pointer receiver are found
+	b, err := k.codec.Marshal(&v)
+	if err != nil {
+		return err
+	}
+	return k.cli.Set(k.Prefix+key, b, expireTime)
+}
+
+// MGet returns the values in the order of keys with nil for the keys
+// that don't exist.
+func (k *TypedKey[T]) MGet(keys ...string) ([]*T, error) {
+	if k.Prefix != "" {
+		prefixed := make([]string, len(keys))
+		for i, key := range keys {
+			prefixed[i] = k.Prefix + key
+		}
+		keys = prefixed
+	}
+	values, err := k.cli.MGet(keys...)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*T, len(values))
+	for i, b := range values {
+		if b == nil {
+			continue
+		}
+		if out[i], err = k.decode(b); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (k *TypedKey[T]) decode(b []byte) (*T, error) {
+	v := new(T)
+	if err := k.codec.Unmarshal(b, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
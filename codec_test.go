@@ -0,0 +1,77 @@
+package redis
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/samuel/go-redis/redistest"
+)
+
+type testUser struct {
+	Name string
+	Age  int
+}
+
+// testMessage mimics a generated protobuf message.
+type testMessage struct {
+	s string
+}
+
+func (m *testMessage) Marshal() ([]byte, error) {
+	return []byte(m.s), nil
+}
+
+func (m *testMessage) Unmarshal(data []byte) error {
+	m.s = string(data)
+	return nil
+}
+
+func TestTypedKey(t *testing.T) {
+	s := redistest.NewServer()
+	defer s.Close()
+	cli := NewClient("tcp", s.Addr())
+	defer cli.Close()
+
+	for name, codec := range map[string]Codec{
+		"json": JSONCodec{},
+		"gob":  GobCodec{},
+		"funcs": CodecFuncs{
+			MarshalFunc:   json.Marshal,
+			UnmarshalFunc: json.Unmarshal,
+		},
+	} {
+		users := NewTypedKey[testUser](cli, codec)
+		users.Prefix = name + ":"
+		if err := users.Set("1", testUser{"alice", 30}, 0); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		u, err := users.Get("1")
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if u == nil || *u != (testUser{"alice", 30}) {
+			t.Fatalf("%s: unexpected value %+v", name, u)
+		}
+		if u, err := users.Get("2"); err != nil || u != nil {
+			t.Fatalf("%s: expected nil for a missing key, got %+v, %v", name, u, err)
+		}
+		all, err := users.MGet("2", "1")
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if len(all) != 2 || all[0] != nil || all[1] == nil || all[1].Name != "alice" {
+			t.Fatalf("%s: unexpected values %+v", name, all)
+		}
+	}
+
+	msgs := NewTypedKey[testMessage](cli, ProtoCodec{})
+	if err := msgs.Set("m", testMessage{"hello"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := msgs.Get("m"); err != nil || m.s != "hello" {
+		t.Fatalf("unexpected message %+v, %v", m, err)
+	}
+	if _, err := (ProtoCodec{}).Marshal(testUser{}); err != ErrInvalidArgumentType {
+		t.Fatalf("expected ErrInvalidArgumentType, got %v", err)
+	}
+}
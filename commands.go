@@ -14,49 +14,99 @@ func (cli *Client) Decr(key string) (int64, error) {
 	return cli.integerRequest("DECR", key)
 }
 
-func (cli *Client) Get(key string) ([]byte, error) {
-	return cli.bulkRequest("GET", key)
+func (cli *Client) Get(key string) (b []byte, err error) {
+	if nc := cli.nearCache.Load(); nc != nil {
+		return nc.get(cli, key)
+	}
+	err = cli.withReadConnection(func(c *redisConnection) (err error) {
+		b, err = c.bulkRequest("GET", key)
+		return
+	})
+	return
 }
 
-func (cli *Client) Incr(key string) (int64, error) {
-	return cli.integerRequest("INCR", key)
+func (cli *Client) HGetAll(key string) (m map[string][]byte, err error) {
+	if nc := cli.nearCache.Load(); nc != nil {
+		return nc.hgetall(cli, key)
+	}
+	err = cli.withReadConnection(func(c *redisConnection) (err error) {
+		m, err = c.hgetall(key)
+		return
+	})
+	return
 }
 
-func (cli *Client) MGet(key ...string) ([][]byte, error) {
-	var out [][]byte
-	err := cli.withConnection(func(c *redisConnection) error {
-		if err := c.writeArgumentCount(1 + len(key)); err != nil {
-			return err
-		}
-		if err := c.writeBulkString("MGET"); err != nil {
-			return err
+func (rc *redisConnection) hgetall(key string) (map[string][]byte, error) {
+	if err := rc.sendCommand("HGETALL", key); err != nil {
+		return nil, err
+	}
+	if err := rc.flush(); err != nil {
+		return nil, err
+	}
+	n, err := rc.readArgumentCount()
+	if err != nil {
+		return nil, err
+	}
+	if n%2 != 0 {
+		return nil, ErrInvalidValue
+	}
+	m := make(map[string][]byte, n/2)
+	for i := 0; i < n; i += 2 {
+		k, err := rc.readBulkString()
+		if err != nil {
+			return nil, err
 		}
-		for _, k := range key {
-			if err := c.writeBulkString(k); err != nil {
-				return err
-			}
+		if m[k], err = rc.readBulkBytes(); err != nil {
+			return nil, err
 		}
+	}
+	return m, nil
+}
 
-		err := c.flush()
-		if err == nil {
-			n, m, e := c.readI64()
-			if e != nil {
-				err = e
-			} else if m != multiBulkReplyMarker {
-				err = ErrInvalidReplyMarker
-			} else {
-				out = make([][]byte, n)
-				for i := int64(0); i < n; i++ {
-					out[i], err = c.readBulkBytes()
-					if err != nil {
-						break
-					}
-				}
-			}
-		}
-		return err
+func (cli *Client) Incr(key string) (int64, error) {
+	return cli.integerRequest("INCR", key)
+}
+
+func (cli *Client) MGet(key ...string) (out [][]byte, err error) {
+	if nc := cli.nearCache.Load(); nc != nil {
+		return nc.mget(cli, key)
+	}
+	err = cli.withReadConnection(func(c *redisConnection) (err error) {
+		out, err = c.mget(key)
+		return
 	})
-	return out, err
+	return
+}
+
+func (rc *redisConnection) mget(key []string) ([][]byte, error) {
+	if err := rc.writeArgumentCount(1 + len(key)); err != nil {
+		return nil, err
+	}
+	if err := rc.writeBulkString("MGET"); err != nil {
+		return nil, err
+	}
+	for _, k := range key {
+		if err := rc.writeBulkString(k); err != nil {
+			return nil, err
+		}
+	}
+	if err := rc.flush(); err != nil {
+		return nil, err
+	}
+	n, m, err := rc.readI64()
+	if err != nil {
+		return nil, err
+	} else if m != multiBulkReplyMarker {
+		return nil, ErrInvalidReplyMarker
+	}
+	out := make([][]byte, n)
+	for i := int64(0); i < n; i++ {
+		out[i], err = rc.readBulkBytes()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
 }
 
 func (cli *Client) Ping() error {
@@ -94,6 +144,14 @@ func (cli *Client) SetXX(key string, value []byte, expireTime time.Duration) (bo
 }
 
 func (cli *Client) set(key string, value []byte, expireTime time.Duration, nx, xx bool) (bool, error) {
+	status, err := cli.statusRequest("SET", setArgs(key, value, expireTime, nx, xx)...)
+	if err == nil && status != nil && !bytes.Equal(status, okStatus) {
+		err = ErrInvalidStatus
+	}
+	return status != nil, err
+}
+
+func setArgs(key string, value []byte, expireTime time.Duration, nx, xx bool) []interface{} {
 	args := []interface{}{
 		key, value,
 	}
@@ -110,9 +168,5 @@ func (cli *Client) set(key string, value []byte, expireTime time.Duration, nx, x
 	} else if xx {
 		args = append(args, "XX")
 	}
-	status, err := cli.statusRequest("SET", args...)
-	if err == nil && status != nil && !bytes.Equal(status, okStatus) {
-		err = ErrInvalidStatus
-	}
-	return status != nil, err
+	return args
 }
@@ -2,10 +2,15 @@ package redis
 
 import (
 	"bufio"
+	"bytes"
+	"encoding"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net"
+	"reflect"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -23,7 +28,10 @@ type ErrReply struct {
 }
 
 func parseErrReply(s string) ErrReply {
-	p := strings.SplitN(s, " ", 1)
+	p := strings.SplitN(s, " ", 2)
+	if len(p) == 1 {
+		return ErrReply{p[0], ""}
+	}
 	return ErrReply{p[0], p[1]}
 }
 
@@ -31,6 +39,15 @@ func (e ErrReply) Error() string {
 	return fmt.Sprintf("redis: server %s: %s", e.tag, e.msg)
 }
 
+// Message returns the error as sent by the server, e.g. "ERR unknown
+// command".
+func (e ErrReply) Message() string {
+	if e.msg == "" {
+		return e.tag
+	}
+	return e.tag + " " + e.msg
+}
+
 const (
 	statusReplyMarker    = '+' // e.g. "+OK\r\n"
 	errorReplyMarker     = '-' // e.g. "-ERR unknown command\r\n"
@@ -39,7 +56,22 @@ const (
 	multiBulkReplyMarker = '*' // e.g. "*2\r\n<other reply><other reply>" or "*-1" for NULL
 	eol                  = "\r\n"
 
+	// RESP3 (https://github.com/redis/redis-specifications/blob/master/protocol/RESP3.md)
+	nullReplyMarker      = '_' // e.g. "_\r\n"
+	doubleReplyMarker    = ',' // e.g. ",1.23\r\n"
+	booleanReplyMarker   = '#' // e.g. "#t\r\n"
+	bigNumberReplyMarker = '(' // e.g. "(3492890328409238509324850943850943825024385\r\n"
+	verbatimReplyMarker  = '=' // e.g. "=15\r\ntxt:Some string\r\n"
+	mapReplyMarker       = '%' // e.g. "%1\r\n<key><value>"
+	setReplyMarker       = '~' // e.g. "~2\r\n<other reply><other reply>"
+	pushReplyMarker      = '>' // e.g. ">2\r\n<other reply><other reply>"
+
 	connectionBufferSize = 1024
+
+	// Limits on the lengths read from the peer, as enforced by Redis
+	// for requests, so bad input can't allocate unbounded memory.
+	maxBulkLen     = 512 * 1024 * 1024
+	maxRequestArgs = 1024 * 1024
 )
 
 type redisConnection struct {
@@ -47,6 +79,20 @@ type redisConnection struct {
 	rw      *bufio.ReadWriter
 	timeout time.Duration
 	buf     []byte
+
+	// Whether READONLY was sent when the connection was set up.
+	readOnly bool
+
+	// Version of the client's credentials the connection authenticated
+	// with.
+	authGen int64
+
+	// Client ID of the connection once fetched by clientID.
+	id int64
+
+	// Client ID that invalidations are redirected to if CLIENT TRACKING
+	// was enabled on this connection.
+	trackingID int64
 }
 
 func (rc *redisConnection) flush() error {
@@ -98,17 +144,65 @@ func (rc *redisConnection) writeBulkBytes(v []byte) error {
 	return err
 }
 
-func (rc *redisConnection) writeStatus(status string) error {
-	if err := rc.rw.WriteByte(statusReplyMarker); err != nil {
+// writeBulkBuf writes b, which may be a slice of buf, as a bulk string.
+// Unlike writeBulkBytes the length isn't formatted into buf.
+func (rc *redisConnection) writeBulkBuf(b []byte) error {
+	var digits [20]byte
+	i := len(digits)
+	for n := len(b); ; n /= 10 {
+		i--
+		digits[i] = byte('0' + n%10)
+		if n < 10 {
+			break
+		}
+	}
+	if err := rc.rw.WriteByte(bulkReplyMarker); err != nil {
 		return err
 	}
-	if _, err := rc.rw.WriteString(status); err != nil {
+	for _, d := range digits[i:] {
+		rc.rw.WriteByte(d)
+	}
+	rc.rw.WriteString(eol)
+	if _, err := rc.rw.Write(b); err != nil {
 		return err
 	}
 	_, err := rc.rw.WriteString(eol)
 	return err
 }
 
+func (rc *redisConnection) writeBulkInt(i int64) error {
+	return rc.writeBulkBuf(itob64(i, rc.buf))
+}
+
+func (rc *redisConnection) writeLine(marker uint8, line string) error {
+	if err := rc.rw.WriteByte(marker); err != nil {
+		return err
+	}
+	if _, err := rc.rw.WriteString(line); err != nil {
+		return err
+	}
+	_, err := rc.rw.WriteString(eol)
+	return err
+}
+
+func (rc *redisConnection) writeStatus(status string) error {
+	return rc.writeLine(statusReplyMarker, status)
+}
+
+func (rc *redisConnection) writeError(msg string) error {
+	return rc.writeLine(errorReplyMarker, msg)
+}
+
+func (rc *redisConnection) writeNullBulk() error {
+	_, err := rc.rw.WriteString("$-1\r\n")
+	return err
+}
+
+func (rc *redisConnection) writeNullMultiBulk() error {
+	_, err := rc.rw.WriteString("*-1\r\n")
+	return err
+}
+
 func (rc *redisConnection) readI64() (int64, byte, error) {
 	marker, err := rc.rw.ReadByte()
 	if err != nil {
@@ -176,6 +270,9 @@ func (rc *redisConnection) readBulkString() (string, error) {
 	if marker != bulkReplyMarker {
 		return "", ErrInvalidReplyMarker
 	}
+	if n > maxBulkLen {
+		return "", ErrInvalidValue
+	}
 	// +2 for \r\n
 	b := rc.buf
 	if n+2 > int64(len(rc.buf)) {
@@ -200,6 +297,9 @@ func (rc *redisConnection) readBulkBytes() ([]byte, error) {
 	if marker != bulkReplyMarker {
 		return nil, ErrInvalidReplyMarker
 	}
+	if n > maxBulkLen {
+		return nil, ErrInvalidValue
+	}
 	// +2 for \r\n
 	b := make([]byte, n+2)
 	if _, err := io.ReadFull(rc.rw, b); err != nil {
@@ -236,70 +336,323 @@ func (rc *redisConnection) readStatusBytes() ([]byte, error) {
 	return nil, ErrInvalidReplyMarker
 }
 
+// readRequest reads a command sent by a client either as a multi-bulk
+// or as an inline command (e.g. "PING\r\n" typed into telnet).
+func (rc *redisConnection) readRequest() ([][]byte, error) {
+	mb, err := rc.rw.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if mb[0] != multiBulkReplyMarker {
+		line, isPrefix, err := rc.rw.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		if isPrefix {
+			return nil, ErrInvalidValue
+		}
+		fields := bytes.Fields(line)
+		args := make([][]byte, len(fields))
+		for i, f := range fields {
+			args[i] = append([]byte(nil), f...)
+		}
+		return args, nil
+	}
+	n, err := rc.readArgumentCount()
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n > maxRequestArgs {
+		return nil, ErrInvalidValue
+	}
+	args := make([][]byte, n)
+	for i := range args {
+		if args[i], err = rc.readBulkBytes(); err != nil {
+			return nil, err
+		} else if args[i] == nil {
+			return nil, ErrInvalidValue
+		}
+	}
+	return args, nil
+}
+
 func (rc *redisConnection) sendCommand(cmd string, args ...interface{}) error {
-	if err := rc.writeArgumentCount(1 + len(args)); err != nil {
+	// Arguments are checked before anything is written so an invalid one
+	// doesn't leave a partial command in the buffer.
+	n, err := argumentCount(args)
+	if err != nil {
+		return err
+	}
+	if err := rc.writeArgumentCount(1 + n); err != nil {
 		return err
 	}
 	if err := rc.writeBulkString(cmd); err != nil {
 		return err
 	}
 	for _, a := range args {
-		var err error
-		switch v := a.(type) {
-		case int:
-			err = rc.writeBulkBytes(itob64(int64(v), rc.buf))
-		case int64:
-			err = rc.writeBulkBytes(itob64(v, rc.buf))
-		case time.Duration:
-			err = rc.writeBulkBytes(itob64(int64(v), rc.buf))
-		case []byte:
-			err = rc.writeBulkBytes(v)
-		case string:
-			err = rc.writeBulkString(v)
+		if err := rc.writeArgument(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// argumentCount returns the number of arguments once slices and maps are
+// flattened.
+func argumentCount(args []interface{}) (int, error) {
+	n := 0
+	for _, a := range args {
+		if ok, err := isScalarArgument(a); err != nil {
+			return 0, err
+		} else if ok {
+			n++
+			continue
+		}
+		if s, ok := a.([]string); ok {
+			n += len(s)
+			continue
+		}
+		rv := reflect.ValueOf(a)
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				if ok, err := isScalarArgument(rv.Index(i).Interface()); !ok || err != nil {
+					return 0, argumentError(err)
+				}
+			}
+			n += rv.Len()
+		case reflect.Map:
+			iter := rv.MapRange()
+			for iter.Next() {
+				if ok, err := isScalarArgument(iter.Key().Interface()); !ok || err != nil {
+					return 0, argumentError(err)
+				}
+				if ok, err := isScalarArgument(iter.Value().Interface()); !ok || err != nil {
+					return 0, argumentError(err)
+				}
+			}
+			n += 2 * rv.Len()
 		default:
-			return ErrInvalidArgumentType
+			return 0, ErrInvalidArgumentType
 		}
+	}
+	return n, nil
+}
+
+func argumentError(err error) error {
+	if err == nil {
+		return ErrInvalidArgumentType
+	}
+	return err
+}
+
+// isScalarArgument returns true for the types written as a single
+// argument by writeScalarArgument.
+func isScalarArgument(a interface{}) (bool, error) {
+	switch v := a.(type) {
+	case nil, string, []byte, bool,
+		int, int8, int16, int32, int64, time.Duration,
+		uint, uint8, uint16, uint32, uint64,
+		encoding.BinaryMarshaler, fmt.Stringer:
+		return true, nil
+	case float32:
+		return !math.IsNaN(float64(v)), nanError(float64(v))
+	case float64:
+		return !math.IsNaN(v), nanError(v)
+	}
+	return false, nil
+}
+
+func nanError(f float64) error {
+	if math.IsNaN(f) {
+		return ErrInvalidValue
+	}
+	return nil
+}
+
+// writeArgument writes a scalar as a single argument, and slices and maps
+// (of scalars) as one argument per element or per key and value.
+func (rc *redisConnection) writeArgument(a interface{}) error {
+	if ok, err := isScalarArgument(a); err != nil {
+		return err
+	} else if ok {
+		return rc.writeScalarArgument(a)
+	}
+	if s, ok := a.([]string); ok {
+		for _, v := range s {
+			if err := rc.writeBulkString(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	rv := reflect.ValueOf(a)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := rc.writeScalarArgument(rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		iter := rv.MapRange()
+		for iter.Next() {
+			if err := rc.writeScalarArgument(iter.Key().Interface()); err != nil {
+				return err
+			}
+			if err := rc.writeScalarArgument(iter.Value().Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return ErrInvalidArgumentType
+}
+
+func (rc *redisConnection) writeScalarArgument(a interface{}) error {
+	switch v := a.(type) {
+	case string:
+		return rc.writeBulkString(v)
+	case []byte:
+		return rc.writeBulkBytes(v)
+	case int:
+		return rc.writeBulkInt(int64(v))
+	case int64:
+		return rc.writeBulkInt(v)
+	case time.Duration:
+		return rc.writeBulkInt(int64(v))
+	case int8:
+		return rc.writeBulkInt(int64(v))
+	case int16:
+		return rc.writeBulkInt(int64(v))
+	case int32:
+		return rc.writeBulkInt(int64(v))
+	case uint:
+		return rc.writeBulkBuf(strconv.AppendUint(rc.buf[:0], uint64(v), 10))
+	case uint8:
+		return rc.writeBulkInt(int64(v))
+	case uint16:
+		return rc.writeBulkInt(int64(v))
+	case uint32:
+		return rc.writeBulkInt(int64(v))
+	case uint64:
+		return rc.writeBulkBuf(strconv.AppendUint(rc.buf[:0], v, 10))
+	case float32:
+		return rc.writeBulkBuf(appendFloat(rc.buf[:0], float64(v), 32))
+	case float64:
+		return rc.writeBulkBuf(appendFloat(rc.buf[:0], v, 64))
+	case bool:
+		if v {
+			return rc.writeBulkString("1")
+		}
+		return rc.writeBulkString("0")
+	case nil:
+		return rc.writeBulkString("")
+	case encoding.BinaryMarshaler:
+		b, err := v.MarshalBinary()
 		if err != nil {
 			return err
 		}
+		return rc.writeBulkBytes(b)
+	case fmt.Stringer:
+		return rc.writeBulkString(v.String())
 	}
-	return nil
+	return ErrInvalidArgumentType
 }
 
-// func (rc *redisConnection) readReply() (interface{}, error) {
-// 	mb, err := rc.rw.Peek(1)
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	switch mb[0] {
-// 	case multiBulkReplyMarker:
-// 		n, _, err := rc.readI64()
-// 		if err != nil {
-// 			return nil, err
-// 		}
-// 		if n < 0 {
-// 			return nil, nil
-// 		}
-// 		res := make([]interface{}, n)
-// 		for i := int64(0); i < n; i++ {
-// 			res[i], err = rc.readReply()
-// 			if err != nil {
-// 				return nil, err
-// 			}
-// 		}
-// 		return res, err
-// 	case errorReplyMarker:
-// 		return nil, rc.readError(true)
-// 	case statusReplyMarker:
-// 		b, err := rc.readStatusBytes()
-// 		if err != nil {
-// 			return nil, err
-// 		}
-// 		return string(b), nil
-// 	case bulkReplyMarker:
-// 		return rc.readBulkBytes()
-// 	case integerReplyMarker:
-// 		return rc.readInteger()
-// 	}
-// 	return nil, ErrInvalidReplyMarker
-// }
+// appendFloat formats f the way Redis parses it, with "inf" and "-inf"
+// for infinities.
+func appendFloat(b []byte, f float64, bitSize int) []byte {
+	switch {
+	case math.IsInf(f, 1):
+		return append(b, "inf"...)
+	case math.IsInf(f, -1):
+		return append(b, "-inf"...)
+	}
+	return strconv.AppendFloat(b, f, 'f', -1, bitSize)
+}
+
+// readReply reads a reply of any type. Status replies are returned as
+// string, bulk replies as []byte, integers as int64, and multi-bulk
+// replies as []interface{}. Error replies nested in a multi-bulk reply
+// are returned as ErrReply values rather than aborting the read.
+func (rc *redisConnection) readReply() (interface{}, error) {
+	mb, err := rc.rw.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	switch mb[0] {
+	case multiBulkReplyMarker:
+		n, _, err := rc.readI64()
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		res := make([]interface{}, n)
+		for i := int64(0); i < n; i++ {
+			res[i], err = rc.readReply()
+			if e, ok := err.(ErrReply); ok {
+				res[i] = e
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case errorReplyMarker:
+		return nil, rc.readError(true)
+	case statusReplyMarker:
+		b, err := rc.readStatusBytes()
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case bulkReplyMarker:
+		return rc.readBulkBytes()
+	case integerReplyMarker:
+		return rc.readInteger()
+	}
+	return nil, ErrInvalidReplyMarker
+}
+
+func (rc *redisConnection) statusRequest(cmd string, args ...interface{}) ([]byte, error) {
+	if err := rc.sendCommand(cmd, args...); err != nil {
+		return nil, err
+	}
+	if err := rc.flush(); err != nil {
+		return nil, err
+	}
+	return rc.readStatusBytes()
+}
+
+func (rc *redisConnection) integerRequest(cmd string, args ...interface{}) (int64, error) {
+	if err := rc.sendCommand(cmd, args...); err != nil {
+		return 0, err
+	}
+	if err := rc.flush(); err != nil {
+		return 0, err
+	}
+	return rc.readInteger()
+}
+
+func (rc *redisConnection) bulkRequest(cmd string, args ...interface{}) ([]byte, error) {
+	if err := rc.sendCommand(cmd, args...); err != nil {
+		return nil, err
+	}
+	if err := rc.flush(); err != nil {
+		return nil, err
+	}
+	return rc.readBulkBytes()
+}
+
+func (rc *redisConnection) replyRequest(cmd string, args ...interface{}) (interface{}, error) {
+	if err := rc.sendCommand(cmd, args...); err != nil {
+		return nil, err
+	}
+	if err := rc.flush(); err != nil {
+		return nil, err
+	}
+	return rc.readReply()
+}
@@ -3,8 +3,10 @@ package redis
 import (
 	"bufio"
 	"bytes"
+	"math"
 	"strconv"
 	"testing"
+	"time"
 )
 
 func TestConnectionAllocations(t *testing.T) {
@@ -70,6 +72,13 @@ func TestConnectionAllocations(t *testing.T) {
 			t.Fatal("readBulkString returned wrong value")
 		}
 	})
+	checkMallocs(t, "sendCommand", 1000, func(t *testing.T) {
+		if err := c.sendCommand("INCRBY", "key", 123); err != nil {
+			t.Fatal(err)
+		}
+		c.rw.Flush()
+		b.Reset()
+	})
 }
 
 func TestBulkString(t *testing.T) {
@@ -122,6 +131,79 @@ func TestBulkBytes(t *testing.T) {
 	}
 }
 
+type testStringer struct{}
+
+func (testStringer) String() string { return "str" }
+
+func TestSendCommandArguments(t *testing.T) {
+	b := &bytes.Buffer{}
+	c := &redisConnection{
+		nc:  nil,
+		rw:  bufio.NewReadWriter(bufio.NewReader(b), bufio.NewWriter(b)),
+		buf: make([]byte, 24),
+	}
+	ts := time.Unix(0, 0).UTC()
+	tsb, _ := ts.MarshalBinary()
+	err := c.sendCommand("CMD", 3, int64(-1234567890123), 0, uint64(math.MaxUint64), uint8(7),
+		1.5, float32(0.25), math.Inf(1), math.Inf(-1), true, false, nil,
+		ts, testStringer{}, []string{"a", "b"}, []interface{}{1, "c"}, map[string]int{"k": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.rw.Flush()
+	args, err := c.readRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"CMD", "3", "-1234567890123", "0", "18446744073709551615", "7",
+		"1.5", "0.25", "inf", "-inf", "1", "0", "",
+		string(tsb), "str", "a", "b", "1", "c", "k", "2"}
+	if len(args) != len(expected) {
+		t.Fatalf("expected %q, got %q", expected, args)
+	}
+	for i, a := range args {
+		if string(a) != expected[i] {
+			t.Fatalf("argument %d: expected %q, got %q", i, expected[i], a)
+		}
+	}
+
+	for _, arg := range []interface{}{math.NaN(), struct{}{}, [][]string{{"a"}}, map[string][]int{"a": nil}} {
+		if err := c.sendCommand("CMD", "a", arg); err == nil {
+			t.Errorf("expected an error for %#v", arg)
+		}
+	}
+	c.rw.Flush()
+	if b.Len() != 0 {
+		t.Fatalf("invalid arguments wrote %q", b.String())
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	b := bytes.NewBufferString("*4\r\n+OK\r\n:12\r\n$3\r\nfoo\r\n-ERR bad thing\r\n-MOVED 1 :7000\r\n")
+	c := &redisConnection{
+		nc:  nil,
+		rw:  bufio.NewReadWriter(bufio.NewReader(b), bufio.NewWriter(b)),
+		buf: make([]byte, 24),
+	}
+	r, err := c.readReply()
+	if err != nil {
+		t.Fatalf("readReply failed with %+v", err)
+	}
+	a, ok := r.([]interface{})
+	if !ok || len(a) != 4 {
+		t.Fatalf("readReply returned %+v instead of a 4 element multi-bulk", r)
+	}
+	if a[0] != "OK" || a[1] != int64(12) || !bytes.Equal(a[2].([]byte), []byte("foo")) {
+		t.Fatalf("readReply returned wrong values %+v", a)
+	}
+	if e, ok := a[3].(ErrReply); !ok || e.tag != "ERR" || e.msg != "bad thing" {
+		t.Fatalf("readReply returned wrong nested error %+v", a[3])
+	}
+	if _, err := c.readReply(); err != (ErrReply{"MOVED", "1 :7000"}) {
+		t.Fatalf("readReply returned %+v instead of MOVED error", err)
+	}
+}
+
 func TestBtoi64(t *testing.T) {
 	if _, err := btoi64([]byte("")); err != ErrInvalidValue {
 		t.Fatal("btoi64 should return an error on empty string")
@@ -0,0 +1,303 @@
+package redis
+
+import "strconv"
+
+type GeoUnit string
+
+const (
+	Meters     GeoUnit = "m"
+	Kilometers GeoUnit = "km"
+	Miles      GeoUnit = "mi"
+	Feet       GeoUnit = "ft"
+)
+
+// GeoLocation is a member of a geo set. Dist and GeoHash are only set by
+// GeoSearch when requested.
+type GeoLocation struct {
+	Name      string
+	Longitude float64
+	Latitude  float64
+	Dist      float64
+	GeoHash   int64
+}
+
+type GeoAddOptions struct {
+	// NX only adds new members and XX only updates existing ones.
+	NX, XX bool
+	// CH counts updated members in the result along with added ones.
+	CH bool
+}
+
+// GeoAdd adds or updates locations in the geo set at key and returns the
+// number of members added. opt may be nil.
+func (cli *Client) GeoAdd(key string, opt *GeoAddOptions, locations ...GeoLocation) (int64, error) {
+	args := make([]interface{}, 0, 4+3*len(locations))
+	args = append(args, key)
+	if opt != nil {
+		if opt.NX {
+			args = append(args, "NX")
+		} else if opt.XX {
+			args = append(args, "XX")
+		}
+		if opt.CH {
+			args = append(args, "CH")
+		}
+	}
+	for _, l := range locations {
+		args = append(args, l.Longitude, l.Latitude, l.Name)
+	}
+	return cli.integerRequest("GEOADD", args...)
+}
+
+// GeoDist returns the distance between two members in unit. It returns
+// false if either member doesn't exist.
+func (cli *Client) GeoDist(key, member1, member2 string, unit GeoUnit) (float64, bool, error) {
+	if unit == "" {
+		unit = Meters
+	}
+	var b []byte
+	err := cli.withReadConnection(func(c *redisConnection) (err error) {
+		b, err = c.bulkRequest("GEODIST", key, member1, member2, string(unit))
+		return
+	})
+	if err != nil || b == nil {
+		return 0, false, err
+	}
+	f, err := parseGeoFloat(b)
+	return f, err == nil, err
+}
+
+// GeoHash returns the 11 character geohash of members, or an empty string
+// for members that don't exist.
+func (cli *Client) GeoHash(key string, members ...string) ([]string, error) {
+	a, err := cli.geoArray("GEOHASH", key, members)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(a))
+	for i, v := range a {
+		b, ok := v.([]byte)
+		if !ok {
+			return nil, ErrInvalidValue
+		}
+		hashes[i] = string(b)
+	}
+	return hashes, nil
+}
+
+// GeoPos returns the position of members, or nil for members that don't
+// exist.
+func (cli *Client) GeoPos(key string, members ...string) ([]*GeoLocation, error) {
+	a, err := cli.geoArray("GEOPOS", key, members)
+	if err != nil {
+		return nil, err
+	}
+	locations := make([]*GeoLocation, len(a))
+	for i, v := range a {
+		// Missing members are null arrays, or null bulks with RESP3
+		if b, ok := v.([]byte); v == nil || ok && b == nil {
+			continue
+		}
+		l := &GeoLocation{Name: members[i]}
+		if err := l.parseCoord(v); err != nil {
+			return nil, err
+		}
+		locations[i] = l
+	}
+	return locations, nil
+}
+
+// GeoSearchQuery selects members of a geo set around Member or, if it's
+// empty, around Longitude and Latitude, within Radius or, if it's zero, a
+// Width by Height box.
+type GeoSearchQuery struct {
+	Member    string
+	Longitude float64
+	Latitude  float64
+
+	Radius        float64
+	Width, Height float64
+	// Unit defaults to Meters.
+	Unit GeoUnit
+
+	// Sort is "ASC" or "DESC" by distance. Results are unsorted by default.
+	Sort string
+	// Count limits the number of results when not zero. With Any the
+	// search stops as soon as enough matches are found.
+	Count int
+	Any   bool
+
+	// WithCoord, WithDist and WithHash fill the corresponding fields of
+	// the results. They're ignored by GeoSearchStore.
+	WithCoord, WithDist, WithHash bool
+}
+
+func (q *GeoSearchQuery) args(args []interface{}) []interface{} {
+	if q.Member != "" {
+		args = append(args, "FROMMEMBER", q.Member)
+	} else {
+		args = append(args, "FROMLONLAT", q.Longitude, q.Latitude)
+	}
+	unit := q.Unit
+	if unit == "" {
+		unit = Meters
+	}
+	if q.Radius != 0 {
+		args = append(args, "BYRADIUS", q.Radius, string(unit))
+	} else {
+		args = append(args, "BYBOX", q.Width, q.Height, string(unit))
+	}
+	if q.Sort != "" {
+		args = append(args, q.Sort)
+	}
+	if q.Count > 0 {
+		args = append(args, "COUNT", q.Count)
+		if q.Any {
+			args = append(args, "ANY")
+		}
+	}
+	return args
+}
+
+// GeoSearch returns the members of the geo set at key matching q.
+func (cli *Client) GeoSearch(key string, q *GeoSearchQuery) ([]GeoLocation, error) {
+	args := q.args([]interface{}{key})
+	if q.WithCoord {
+		args = append(args, "WITHCOORD")
+	}
+	if q.WithDist {
+		args = append(args, "WITHDIST")
+	}
+	if q.WithHash {
+		args = append(args, "WITHHASH")
+	}
+	var r interface{}
+	err := cli.withReadConnection(func(c *redisConnection) (err error) {
+		r, err = c.replyRequest("GEOSEARCH", args...)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	a, ok := r.([]interface{})
+	if !ok {
+		return nil, ErrInvalidValue
+	}
+	locations := make([]GeoLocation, len(a))
+	for i, v := range a {
+		if err := locations[i].parseSearch(v, q); err != nil {
+			return nil, err
+		}
+	}
+	return locations, nil
+}
+
+// GeoSearchStore stores the members of the geo set at srcKey matching q in
+// destKey and returns their number. With storeDist the members are stored
+// in a sorted set with their distance as score instead.
+func (cli *Client) GeoSearchStore(destKey, srcKey string, q *GeoSearchQuery, storeDist bool) (int64, error) {
+	args := q.args([]interface{}{destKey, srcKey})
+	if storeDist {
+		args = append(args, "STOREDIST")
+	}
+	return cli.integerRequest("GEOSEARCHSTORE", args...)
+}
+
+func (cli *Client) geoArray(cmd, key string, members []string) (a []interface{}, err error) {
+	err = cli.withReadConnection(func(c *redisConnection) error {
+		r, err := c.replyRequest(cmd, key, members)
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if a, ok = r.([]interface{}); !ok || len(a) != len(members) {
+			return ErrInvalidValue
+		}
+		return nil
+	})
+	return
+}
+
+// parseSearch parses a GEOSEARCH result which is either the name alone or
+// an array of the name followed by the distance, hash and coordinates if
+// requested.
+func (l *GeoLocation) parseSearch(v interface{}, q *GeoSearchQuery) error {
+	if b, ok := v.([]byte); ok {
+		l.Name = string(b)
+		return nil
+	}
+	a, ok := v.([]interface{})
+	if !ok || len(a) == 0 {
+		return ErrInvalidValue
+	}
+	b, ok := a[0].([]byte)
+	if !ok {
+		return ErrInvalidValue
+	}
+	l.Name = string(b)
+	a = a[1:]
+	next := func() (interface{}, error) {
+		if len(a) == 0 {
+			return nil, ErrInvalidValue
+		}
+		v := a[0]
+		a = a[1:]
+		return v, nil
+	}
+	if q.WithDist {
+		v, err := next()
+		if err != nil {
+			return err
+		}
+		b, ok := v.([]byte)
+		if !ok {
+			return ErrInvalidValue
+		}
+		if l.Dist, err = parseGeoFloat(b); err != nil {
+			return err
+		}
+	}
+	if q.WithHash {
+		v, err := next()
+		if err != nil {
+			return err
+		}
+		if l.GeoHash, ok = v.(int64); !ok {
+			return ErrInvalidValue
+		}
+	}
+	if q.WithCoord {
+		v, err := next()
+		if err != nil {
+			return err
+		}
+		return l.parseCoord(v)
+	}
+	return nil
+}
+
+func (l *GeoLocation) parseCoord(v interface{}) error {
+	a, ok := v.([]interface{})
+	if !ok || len(a) != 2 {
+		return ErrInvalidValue
+	}
+	lon, ok1 := a[0].([]byte)
+	lat, ok2 := a[1].([]byte)
+	if !ok1 || !ok2 {
+		return ErrInvalidValue
+	}
+	var err error
+	if l.Longitude, err = parseGeoFloat(lon); err != nil {
+		return err
+	}
+	l.Latitude, err = parseGeoFloat(lat)
+	return err
+}
+
+func parseGeoFloat(b []byte) (float64, error) {
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return 0, ErrInvalidValue
+	}
+	return f, nil
+}
@@ -0,0 +1,128 @@
+package redis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	var cr commandRecorder
+	srv := NewServer()
+	srv.HandleFunc("pfadd", cr.reply(int64(1)))
+	srv.HandleFunc("pfcount", cr.reply(int64(42)))
+	srv.HandleFunc("pfmerge", cr.reply("OK"))
+	cli := NewClient("tcp", startServer(t, srv))
+	defer cli.Close()
+
+	if ok, err := cli.PFAdd("hll", "a", "b"); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatal("expected PFAdd to return true")
+	}
+	if n, err := cli.PFCount("hll", "hll2"); err != nil {
+		t.Fatal(err)
+	} else if n != 42 {
+		t.Fatalf("expected 42, got %d", n)
+	}
+	if err := cli.PFMerge("dst", "hll", "hll2"); err != nil {
+		t.Fatal(err)
+	}
+	cr.check(t, []string{
+		"PFADD hll a b",
+		"PFCOUNT hll hll2",
+		"PFMERGE dst hll hll2",
+	})
+}
+
+func TestGeo(t *testing.T) {
+	var cr commandRecorder
+	srv := NewServer()
+	srv.HandleFunc("geoadd", cr.reply(int64(2)))
+	srv.HandleFunc("geodist", cr.reply([]byte("166274.1516")))
+	srv.HandleFunc("geohash", cr.reply([]interface{}{[]byte("sqc8b49rny0"), []byte(nil)}))
+	srv.HandleFunc("geopos", cr.reply([]interface{}{
+		[]interface{}{[]byte("13.361389"), []byte("38.115556")},
+		nil,
+	}))
+	srv.HandleFunc("geosearch", cr.reply([]interface{}{
+		[]interface{}{
+			[]byte("Palermo"),
+			[]byte("190.4424"),
+			int64(3479099956230698),
+			[]interface{}{[]byte("13.361389"), []byte("38.115556")},
+		},
+	}))
+	srv.HandleFunc("geosearchstore", cr.reply(int64(1)))
+	cli := NewClient("tcp", startServer(t, srv))
+	defer cli.Close()
+
+	n, err := cli.GeoAdd("sicily", &GeoAddOptions{NX: true, CH: true},
+		GeoLocation{Name: "Palermo", Longitude: 13.361389, Latitude: 38.115556},
+		GeoLocation{Name: "Catania", Longitude: 15.087269, Latitude: 37.502669})
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Fatalf("expected 2, got %d", n)
+	}
+
+	if d, ok, err := cli.GeoDist("sicily", "Palermo", "Catania", ""); err != nil {
+		t.Fatal(err)
+	} else if !ok || d != 166274.1516 {
+		t.Fatalf("expected 166274.1516, got %f %t", d, ok)
+	}
+
+	if h, err := cli.GeoHash("sicily", "Palermo", "Rome"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(h, []string{"sqc8b49rny0", ""}) {
+		t.Fatalf("unexpected hashes %q", h)
+	}
+
+	pos, err := cli.GeoPos("sicily", "Palermo", "Rome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := &GeoLocation{Name: "Palermo", Longitude: 13.361389, Latitude: 38.115556}
+	if len(pos) != 2 || !reflect.DeepEqual(pos[0], exp) || pos[1] != nil {
+		t.Fatalf("unexpected positions %+v", pos)
+	}
+
+	res, err := cli.GeoSearch("sicily", &GeoSearchQuery{
+		Longitude: 15,
+		Latitude:  37,
+		Radius:    200,
+		Unit:      Kilometers,
+		Sort:      "ASC",
+		Count:     1,
+		WithCoord: true,
+		WithDist:  true,
+		WithHash:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.Dist = 190.4424
+	exp.GeoHash = 3479099956230698
+	if len(res) != 1 || !reflect.DeepEqual(res[0], *exp) {
+		t.Fatalf("unexpected search result %+v", res)
+	}
+
+	if n, err := cli.GeoSearchStore("dst", "sicily", &GeoSearchQuery{
+		Member: "Palermo",
+		Width:  400,
+		Height: 100.5,
+		Unit:   Kilometers,
+	}, true); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("expected 1, got %d", n)
+	}
+
+	cr.check(t, []string{
+		"GEOADD sicily NX CH 13.361389 38.115556 Palermo 15.087269 37.502669 Catania",
+		"GEODIST sicily Palermo Catania m",
+		"GEOHASH sicily Palermo Rome",
+		"GEOPOS sicily Palermo Rome",
+		"GEOSEARCH sicily FROMLONLAT 15 37 BYRADIUS 200 km ASC COUNT 1 WITHCOORD WITHDIST WITHHASH",
+		"GEOSEARCHSTORE dst sicily FROMMEMBER Palermo BYBOX 400 100.5 km STOREDIST",
+	})
+}
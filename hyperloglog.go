@@ -0,0 +1,29 @@
+package redis
+
+import "bytes"
+
+// PFAdd adds elements to the HyperLogLog at key and returns whether its
+// estimated cardinality changed.
+func (cli *Client) PFAdd(key string, elements ...string) (bool, error) {
+	i, err := cli.integerRequest("PFADD", key, elements)
+	return i == 1, err
+}
+
+// PFCount returns the estimated cardinality of the union of the
+// HyperLogLogs at keys.
+func (cli *Client) PFCount(keys ...string) (i int64, err error) {
+	err = cli.withReadConnection(func(c *redisConnection) (err error) {
+		i, err = c.integerRequest("PFCOUNT", keys)
+		return
+	})
+	return
+}
+
+// PFMerge stores the union of the HyperLogLogs at keys in destKey.
+func (cli *Client) PFMerge(destKey string, keys ...string) error {
+	status, err := cli.statusRequest("PFMERGE", destKey, keys)
+	if err == nil && !bytes.Equal(status, okStatus) {
+		err = ErrInvalidStatus
+	}
+	return err
+}
@@ -0,0 +1,117 @@
+package redis
+
+import (
+	"strings"
+)
+
+// Commands that don't take keys.
+var keylessCommands = map[string]bool{
+	"AUTH": true, "BGREWRITEAOF": true, "BGSAVE": true, "CLIENT": true,
+	"CLUSTER": true, "COMMAND": true, "CONFIG": true, "DBSIZE": true,
+	"DEBUG": true, "DISCARD": true, "ECHO": true, "EXEC": true,
+	"FLUSHALL": true, "FLUSHDB": true, "FUNCTION": true, "HELLO": true,
+	"INFO": true, "LASTSAVE": true, "MONITOR": true, "MULTI": true,
+	"PING": true, "PSUBSCRIBE": true, "PSYNC": true, "PUBLISH": true,
+	"PUNSUBSCRIBE": true, "QUIT": true, "RANDOMKEY": true, "READONLY": true,
+	"READWRITE": true, "REPLCONF": true, "SAVE": true, "SCAN": true,
+	"SCRIPT": true, "SELECT": true, "SHUTDOWN": true, "SUBSCRIBE": true,
+	"SWAPDB": true, "SYNC": true, "TIME": true, "UNSUBSCRIBE": true,
+	"UNWATCH": true, "WAIT": true,
+}
+
+// CommandKeys returns the keys of a command given as its name followed by
+// its arguments. Commands not known to be keyless or to take several keys
+// are assumed to take a single key as first argument.
+func CommandKeys(args [][]byte) [][]byte {
+	if len(args) < 2 {
+		return nil
+	}
+	cmd := strings.ToUpper(string(args[0]))
+	if keylessCommands[cmd] {
+		return nil
+	}
+	switch cmd {
+	case "DEL", "EXISTS", "MGET", "PFCOUNT", "SDIFF", "SINTER", "SUNION", "TOUCH", "UNLINK", "WATCH":
+		return args[1:]
+	case "MSET", "MSETNX":
+		keys := make([][]byte, 0, len(args)/2)
+		for i := 1; i < len(args); i += 2 {
+			keys = append(keys, args[i])
+		}
+		return keys
+	case "EVAL", "EVALSHA", "EVAL_RO", "EVALSHA_RO", "FCALL", "FCALL_RO":
+		return numKeys(args, 2)
+	case "LMPOP", "SINTERCARD", "ZDIFF", "ZINTER", "ZINTERCARD", "ZMPOP", "ZUNION":
+		return numKeys(args, 1)
+	case "BLMPOP", "BZMPOP":
+		// The timeout comes before the number of keys
+		return numKeys(args, 2)
+	case "ZDIFFSTORE", "ZINTERSTORE", "ZUNIONSTORE":
+		return append([][]byte{args[1]}, numKeys(args, 2)...)
+	case "XREAD", "XREADGROUP":
+		// Keys follow STREAMS and are followed by as many IDs
+		for i := 1; i < len(args); i++ {
+			if strings.EqualFold(string(args[i]), "STREAMS") {
+				rest := args[i+1:]
+				return rest[:len(rest)/2]
+			}
+		}
+		return nil
+	case "BITOP":
+		return args[2:]
+	case "GEOSEARCHSTORE", "LCS", "ZRANGESTORE":
+		if len(args) < 3 {
+			return args[1:]
+		}
+		return args[1:3]
+	case "GEORADIUS", "GEORADIUSBYMEMBER", "SORT":
+		// The result may be stored in another key
+		keys := [][]byte{args[1]}
+		for i := 2; i < len(args)-1; i++ {
+			if s := string(args[i]); strings.EqualFold(s, "STORE") || strings.EqualFold(s, "STOREDIST") {
+				keys = append(keys, args[i+1])
+			}
+		}
+		return keys
+	case "MEMORY", "OBJECT", "XGROUP", "XINFO":
+		// The key follows a subcommand
+		if len(args) < 3 {
+			return nil
+		}
+		return args[2:3]
+	case "MIGRATE":
+		// A single key or an empty string followed by KEYS
+		if len(args) < 4 {
+			return nil
+		}
+		for i := 6; i < len(args); i++ {
+			if strings.EqualFold(string(args[i]), "KEYS") {
+				return args[i+1:]
+			}
+		}
+		return args[3:4]
+	case "BLMOVE", "COPY", "LMOVE", "RENAME", "RENAMENX", "RPOPLPUSH", "SMOVE", "BRPOPLPUSH":
+		if len(args) < 3 {
+			return args[1:]
+		}
+		return args[1:3]
+	case "SDIFFSTORE", "SINTERSTORE", "SUNIONSTORE", "PFMERGE":
+		return args[1:]
+	case "BLPOP", "BRPOP", "BZPOPMIN", "BZPOPMAX":
+		// The last argument is the timeout
+		return args[1 : len(args)-1]
+	}
+	return args[1:2]
+}
+
+// numKeys returns the keys following a number of keys at args[i].
+func numKeys(args [][]byte, i int) [][]byte {
+	if len(args) <= i {
+		return nil
+	}
+	n, err := btoi64(args[i])
+	if err != nil || n < 0 || int64(i+1)+n > int64(len(args)) {
+		return nil
+	}
+	return args[i+1 : i+1+int(n)]
+}
@@ -0,0 +1,49 @@
+package redis
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommandKeys(t *testing.T) {
+	cases := []struct {
+		cmd  string
+		keys string
+	}{
+		{"PING", ""},
+		{"GET a", "a"},
+		{"MGET a b", "a b"},
+		{"MSET a 1 b 2", "a b"},
+		{"EVAL script 2 a b arg", "a b"},
+		{"EVAL script 3 a b", ""},
+		{"BLPOP a b 0", "a b"},
+		{"ZUNIONSTORE d 2 a b WEIGHTS 1 2", "d a b"},
+		{"ZINTER 2 a b WITHSCORES", "a b"},
+		{"SINTERCARD 2 a b LIMIT 1", "a b"},
+		{"LMPOP 2 a b LEFT", "a b"},
+		{"BZMPOP 0 2 a b MIN", "a b"},
+		{"XREAD COUNT 2 STREAMS a b 0 0", "a b"},
+		{"XREADGROUP GROUP g c BLOCK 0 streams a >", "a"},
+		{"BITOP AND d a b", "d a b"},
+		{"ZRANGESTORE d a 0 -1", "d a"},
+		{"GEORADIUS a 0 0 1 km STORE d", "a d"},
+		{"SORT a BY w GET o STORE d", "a d"},
+		{"OBJECT ENCODING a", "a"},
+		{"XINFO STREAM a", "a"},
+		{"MIGRATE h 6379 a 0 100", "a"},
+		{"MIGRATE h 6379 \"\" 0 100 COPY KEYS a b", "a b"},
+	}
+	for _, c := range cases {
+		var args [][]byte
+		for _, a := range strings.Fields(c.cmd) {
+			args = append(args, []byte(a))
+		}
+		var keys []string
+		for _, k := range CommandKeys(args) {
+			keys = append(keys, string(k))
+		}
+		if s := strings.Join(keys, " "); s != c.keys {
+			t.Errorf("%s: expected keys %q, got %q", c.cmd, c.keys, s)
+		}
+	}
+}
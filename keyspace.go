@@ -0,0 +1,185 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// KeyEvent is the name of the event of a keyspace notification.
+type KeyEvent string
+
+const (
+	KeyEventDel        KeyEvent = "del"
+	KeyEventRenameFrom KeyEvent = "rename_from"
+	KeyEventRenameTo   KeyEvent = "rename_to"
+	KeyEventCopyTo     KeyEvent = "copy_to"
+	KeyEventMoveFrom   KeyEvent = "move_from"
+	KeyEventMoveTo     KeyEvent = "move_to"
+	KeyEventExpire     KeyEvent = "expire"
+	KeyEventPersist    KeyEvent = "persist"
+	KeyEventExpired    KeyEvent = "expired"
+	KeyEventEvicted    KeyEvent = "evicted"
+	KeyEventNew        KeyEvent = "new"
+	KeyEventSet        KeyEvent = "set"
+	KeyEventSetRange   KeyEvent = "setrange"
+	KeyEventIncrBy     KeyEvent = "incrby"
+	KeyEventAppend     KeyEvent = "append"
+	KeyEventLPush      KeyEvent = "lpush"
+	KeyEventRPush      KeyEvent = "rpush"
+	KeyEventLPop       KeyEvent = "lpop"
+	KeyEventRPop       KeyEvent = "rpop"
+	KeyEventLSet       KeyEvent = "lset"
+	KeyEventLTrim      KeyEvent = "ltrim"
+	KeyEventSAdd       KeyEvent = "sadd"
+	KeyEventSRem       KeyEvent = "srem"
+	KeyEventSPop       KeyEvent = "spop"
+	KeyEventHSet       KeyEvent = "hset"
+	KeyEventHDel       KeyEvent = "hdel"
+	KeyEventHIncrBy    KeyEvent = "hincrby"
+	KeyEventHExpired   KeyEvent = "hexpired"
+	KeyEventZAdd       KeyEvent = "zadd"
+	KeyEventZIncr      KeyEvent = "zincr"
+	KeyEventZRem       KeyEvent = "zrem"
+	KeyEventXAdd       KeyEvent = "xadd"
+	KeyEventXTrim      KeyEvent = "xtrim"
+	KeyEventXDel       KeyEvent = "xdel"
+	KeyEventXSetID     KeyEvent = "xsetid"
+	KeyEventXGroupNew  KeyEvent = "xgroup-create"
+)
+
+// KeyspaceNotification is a keyspace or keyevent notification decoded
+// into the key and its event.
+type KeyspaceNotification struct {
+	DB    int
+	Key   string
+	Event KeyEvent
+}
+
+type KeyspaceOptions struct {
+	// DB limits notifications to a database. Use -1 for all databases.
+	DB int
+
+	// Config, if not empty, is set as notify-keyspace-events before
+	// subscribing (e.g. "Ex" for expirations). It replaces the flags
+	// configured on the server which affects every client.
+	Config string
+
+	// Events subscribes to the keyevent channels of the given events
+	// only. When empty the keyspace channels of the keys matching
+	// Pattern are used and every event is received.
+	Events []KeyEvent
+
+	// Pattern is the glob-style pattern of keys when Events is empty.
+	// Defaults to "*".
+	Pattern string
+}
+
+// KeyspaceNotifications is a dedicated connection subscribed to keyspace
+// notifications. Notifications are fire and forget: the ones published
+// while not connected are lost.
+type KeyspaceNotifications struct {
+	sub  *subscription
+	ctx  context.Context
+	done chan struct{}
+}
+
+// KeyspaceNotifications subscribes to keyspace notifications on a new
+// connection. The connection is closed when ctx is done or Close is
+// called.
+func (cli *Client) KeyspaceNotifications(ctx context.Context, opt KeyspaceOptions) (*KeyspaceNotifications, error) {
+	sub, err := cli.newSubscription()
+	if err != nil {
+		return nil, err
+	}
+	if opt.Config != "" {
+		if _, err := sub.rc.statusRequest("CONFIG", "SET", "notify-keyspace-events", opt.Config); err != nil {
+			sub.close()
+			return nil, err
+		}
+	}
+	db := "*"
+	if opt.DB >= 0 {
+		db = strconv.Itoa(opt.DB)
+	}
+	var patterns []string
+	if len(opt.Events) > 0 {
+		for _, ev := range opt.Events {
+			patterns = append(patterns, "__keyevent@"+db+"__:"+string(ev))
+		}
+	} else {
+		pattern := opt.Pattern
+		if pattern == "" {
+			pattern = "*"
+		}
+		patterns = append(patterns, "__keyspace@"+db+"__:"+pattern)
+	}
+	if err := sub.subscribe("PSUBSCRIBE", patterns...); err != nil {
+		sub.close()
+		return nil, err
+	}
+
+	kn := &KeyspaceNotifications{sub: sub, ctx: ctx, done: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-kn.done:
+		}
+		sub.close()
+	}()
+	return kn, nil
+}
+
+// Next blocks until the next notification is received.
+func (kn *KeyspaceNotifications) Next() (*KeyspaceNotification, error) {
+	for {
+		m, err := kn.sub.receive()
+		if err != nil {
+			if e := kn.ctx.Err(); e != nil {
+				return nil, e
+			}
+			return nil, err
+		}
+		if n, ok := parseKeyspaceNotification(m.channel, replyString(m.data)); ok {
+			return n, nil
+		}
+	}
+}
+
+func (kn *KeyspaceNotifications) Close() error {
+	select {
+	case <-kn.done:
+	default:
+		close(kn.done)
+	}
+	return nil
+}
+
+// parseKeyspaceNotification decodes "__keyspace@<db>__:<key>" with the
+// event as the message, or "__keyevent@<db>__:<event>" with the key as
+// the message.
+func parseKeyspaceNotification(channel, data string) (*KeyspaceNotification, bool) {
+	var keyspace bool
+	switch {
+	case strings.HasPrefix(channel, "__keyspace@"):
+		keyspace = true
+	case strings.HasPrefix(channel, "__keyevent@"):
+	default:
+		return nil, false
+	}
+	db, name, ok := strings.Cut(channel[len("__keyspace@"):], "__:")
+	if !ok {
+		return nil, false
+	}
+	n := &KeyspaceNotification{}
+	var err error
+	if n.DB, err = strconv.Atoi(db); err != nil {
+		return nil, false
+	}
+	if keyspace {
+		n.Key, n.Event = name, KeyEvent(data)
+	} else {
+		n.Key, n.Event = data, KeyEvent(name)
+	}
+	return n, true
+}
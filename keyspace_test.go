@@ -0,0 +1,77 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-redis/redistest"
+)
+
+func TestParseKeyspaceNotification(t *testing.T) {
+	n, ok := parseKeyspaceNotification("__keyspace@2__:user:1", "hset")
+	if !ok || n.DB != 2 || n.Key != "user:1" || n.Event != KeyEventHSet {
+		t.Fatalf("unexpected notification %+v", n)
+	}
+	n, ok = parseKeyspaceNotification("__keyevent@0__:expired", "session:__:1")
+	if !ok || n.DB != 0 || n.Key != "session:__:1" || n.Event != KeyEventExpired {
+		t.Fatalf("unexpected notification %+v", n)
+	}
+	for _, ch := range []string{"other", "__keyspace@x__:a", "__keyevent@0"} {
+		if _, ok := parseKeyspaceNotification(ch, "del"); ok {
+			t.Errorf("%q: expected invalid notification", ch)
+		}
+	}
+}
+
+func TestKeyspaceNotifications(t *testing.T) {
+	s := redistest.NewServer()
+	defer s.Close()
+	cli := NewClient("tcp", s.Addr())
+	defer cli.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	kn, err := cli.KeyspaceNotifications(ctx, KeyspaceOptions{DB: 0, Events: []KeyEvent{KeyEventExpired, KeyEventEvicted}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The test server doesn't generate notifications
+	for _, m := range [][2]string{
+		{"__keyevent@1__:expired", "other"},
+		{"__keyevent@0__:del", "other"},
+		{"__keyevent@0__:expired", "session:1"},
+		{"__keyevent@0__:evicted", "session:2"},
+	} {
+		if _, err := cli.Do("PUBLISH", m[0], m[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, expected := range []KeyspaceNotification{
+		{DB: 0, Key: "session:1", Event: KeyEventExpired},
+		{DB: 0, Key: "session:2", Event: KeyEventEvicted},
+	} {
+		n, err := kn.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *n != expected {
+			t.Fatalf("expected %+v, got %+v", expected, n)
+		}
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := kn.Next()
+		errc <- err
+	}()
+	cancel()
+	select {
+	case err := <-errc:
+		if err != context.Canceled {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Next didn't return after cancel")
+	}
+}
@@ -0,0 +1,296 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	mrand "math/rand"
+	"sync"
+	"time"
+)
+
+// http://redis.io/topics/distlock
+
+const (
+	DefaultLockRetryDelay    = 10 * time.Millisecond
+	DefaultLockMaxRetryDelay = 500 * time.Millisecond
+
+	// Redlock accounts for clock drift between servers by subtracting 1%
+	// of the TTL plus 2 milliseconds from the validity time.
+	lockClockDriftFactor = 0.01
+	lockClockDriftMin    = 2 * time.Millisecond
+)
+
+var (
+	ErrLockNotHeld = errors.New("redis: lock not held")
+)
+
+var (
+	unlockScript = NewScript(`
+		if redis.call("GET", KEYS[1]) == ARGV[1] then
+			return redis.call("DEL", KEYS[1])
+		end
+		return 0`)
+	extendScript = NewScript(`
+		if redis.call("GET", KEYS[1]) == ARGV[1] then
+			return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+		end
+		return 0`)
+)
+
+// lockRetry holds the backoff between attempts to acquire a lock.
+type lockRetry struct {
+	minDelay, maxDelay time.Duration
+}
+
+// SetRetryDelay sets the initial and maximum delay between attempts in
+// Lock. The delay doubles after every attempt and is jittered.
+func (r *lockRetry) SetRetryDelay(min, max time.Duration) {
+	r.minDelay, r.maxDelay = min, max
+}
+
+func (r *lockRetry) retry(ctx context.Context, try func() (bool, error)) error {
+	delay := r.minDelay
+	for {
+		ok, err := try()
+		if err != nil || ok {
+			return err
+		}
+		// Random delay in [delay/2, delay) so competing clients spread out
+		d := delay/2 + time.Duration(mrand.Int63n(int64(delay/2)+1))
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		if delay *= 2; delay > r.maxDelay {
+			delay = r.maxDelay
+		}
+	}
+}
+
+func lockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Mutex is a lock held on a single server. It's identified by a random
+// token so only the holder can release or extend it.
+type Mutex struct {
+	lockRetry
+	cli   *Client
+	key   string
+	ttl   time.Duration
+	token string
+}
+
+func NewMutex(cli *Client, key string, ttl time.Duration) *Mutex {
+	return &Mutex{
+		lockRetry: lockRetry{DefaultLockRetryDelay, DefaultLockMaxRetryDelay},
+		cli:       cli,
+		key:       key,
+		ttl:       ttl,
+	}
+}
+
+// Token returns the token of the current holder or an empty string if the
+// lock isn't held.
+func (m *Mutex) Token() string {
+	return m.token
+}
+
+// TryLock makes a single attempt to acquire the lock.
+func (m *Mutex) TryLock() (bool, error) {
+	token, err := lockToken()
+	if err != nil {
+		return false, err
+	}
+	ok, err := m.cli.SetNX(m.key, []byte(token), m.ttl)
+	if ok && err == nil {
+		m.token = token
+	}
+	return ok, err
+}
+
+// Lock retries acquiring the lock until it succeeds or ctx is done.
+func (m *Mutex) Lock(ctx context.Context) error {
+	return m.retry(ctx, m.TryLock)
+}
+
+// Unlock releases the lock if it's still held by this mutex. The token is
+// kept when the server couldn't be reached so Unlock may be retried.
+func (m *Mutex) Unlock() error {
+	if m.token == "" {
+		return ErrLockNotHeld
+	}
+	ok, err := releaseLock(m.cli, m.key, m.token)
+	if err != nil {
+		return err
+	}
+	m.token = ""
+	if !ok {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Extend resets the expiration of the lock to ttl if it's still held.
+func (m *Mutex) Extend(ttl time.Duration) error {
+	if m.token == "" {
+		return ErrLockNotHeld
+	}
+	ok, err := extendLock(m.cli, m.key, m.token, ttl)
+	if err == nil && !ok {
+		err = ErrLockNotHeld
+	}
+	return err
+}
+
+func releaseLock(cli *Client, key, token string) (bool, error) {
+	r, err := unlockScript.Run(cli, []string{key}, token)
+	return r == int64(1), err
+}
+
+func extendLock(cli *Client, key, token string, ttl time.Duration) (bool, error) {
+	r, err := extendScript.Run(cli, []string{key}, token, int64(ttl/time.Millisecond))
+	return r == int64(1), err
+}
+
+// Redlock is a lock held on a majority of N independent servers.
+type Redlock struct {
+	lockRetry
+	clients    []*Client
+	key        string
+	ttl        time.Duration
+	quorum     int
+	token      string
+	validUntil time.Time
+}
+
+func NewRedlock(clients []*Client, key string, ttl time.Duration) *Redlock {
+	return &Redlock{
+		lockRetry: lockRetry{DefaultLockRetryDelay, DefaultLockMaxRetryDelay},
+		clients:   clients,
+		key:       key,
+		ttl:       ttl,
+		quorum:    len(clients)/2 + 1,
+	}
+}
+
+func (r *Redlock) Token() string {
+	return r.token
+}
+
+// ValidUntil returns the time until which the lock is guaranteed to be
+// held, taking the time spent acquiring it and clock drift into account.
+func (r *Redlock) ValidUntil() time.Time {
+	return r.validUntil
+}
+
+// TryLock makes a single attempt to acquire the lock on a quorum of the
+// servers. If that fails the lock is released on all of them. It returns
+// the errors of the servers when too few of them replied for a quorum.
+func (r *Redlock) TryLock() (bool, error) {
+	token, err := lockToken()
+	if err != nil {
+		return false, err
+	}
+	start := time.Now()
+	n, err := r.each(func(cli *Client) (bool, error) {
+		return cli.SetNX(r.key, []byte(token), r.ttl)
+	})
+	if validity := r.ttl - time.Since(start) - lockDrift(r.ttl); n >= r.quorum && validity > 0 {
+		r.token = token
+		r.validUntil = start.Add(r.ttl - lockDrift(r.ttl))
+		return true, nil
+	}
+	r.each(func(cli *Client) (bool, error) {
+		return releaseLock(cli, r.key, token)
+	})
+	return false, err
+}
+
+// Lock retries acquiring the lock until it succeeds or ctx is done.
+func (r *Redlock) Lock(ctx context.Context) error {
+	return r.retry(ctx, r.TryLock)
+}
+
+// Unlock releases the lock on all servers.
+func (r *Redlock) Unlock() error {
+	if r.token == "" {
+		return ErrLockNotHeld
+	}
+	n, err := r.each(func(cli *Client) (bool, error) {
+		return releaseLock(cli, r.key, r.token)
+	})
+	if err != nil {
+		// Too few servers replied so the token is kept to retry
+		return err
+	}
+	r.token = ""
+	r.validUntil = time.Time{}
+	if n < r.quorum {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Extend resets the expiration of the lock to ttl. It fails if the lock
+// is no longer held on a quorum of the servers.
+func (r *Redlock) Extend(ttl time.Duration) error {
+	if r.token == "" {
+		return ErrLockNotHeld
+	}
+	start := time.Now()
+	n, err := r.each(func(cli *Client) (bool, error) {
+		return extendLock(cli, r.key, r.token, ttl)
+	})
+	if err != nil {
+		return err
+	}
+	if validity := ttl - time.Since(start) - lockDrift(ttl); n < r.quorum || validity <= 0 {
+		return ErrLockNotHeld
+	}
+	r.validUntil = start.Add(ttl - lockDrift(ttl))
+	return nil
+}
+
+// each runs fn on every server in parallel and returns how many
+// succeeded. Errors count as failures since the other servers may still
+// form a quorum. They're only returned when fewer than a quorum of the
+// servers replied.
+func (r *Redlock) each(fn func(cli *Client) (bool, error)) (int, error) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+	n := 0
+	for _, cli := range r.clients {
+		wg.Add(1)
+		go func(cli *Client) {
+			defer wg.Done()
+			ok, err := fn(cli)
+			mu.Lock()
+			if err != nil {
+				errs = append(errs, err)
+			} else if ok {
+				n++
+			}
+			mu.Unlock()
+		}(cli)
+	}
+	wg.Wait()
+	if len(r.clients)-len(errs) < r.quorum {
+		return n, errors.Join(errs...)
+	}
+	return n, nil
+}
+
+func lockDrift(ttl time.Duration) time.Duration {
+	return time.Duration(float64(ttl)*lockClockDriftFactor) + lockClockDriftMin
+}
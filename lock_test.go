@@ -0,0 +1,220 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockServer implements SET NX and the lock scripts on a Server.
+type lockServer struct {
+	mu   sync.Mutex
+	data map[string]string
+	ttl  map[string]string
+}
+
+func startLockServer(t *testing.T) (*lockServer, string) {
+	ls := &lockServer{data: make(map[string]string), ttl: make(map[string]string)}
+	srv := NewServer()
+	srv.HandleFunc("set", func(ctx context.Context, conn *ServerConn, args [][]byte) {
+		ls.mu.Lock()
+		defer ls.mu.Unlock()
+		key := string(args[1])
+		if _, ok := ls.data[key]; ok {
+			conn.WriteNull()
+			return
+		}
+		ls.data[key] = string(args[2])
+		ls.ttl[key] = string(args[4])
+		conn.WriteOK()
+	})
+	srv.HandleFunc("evalsha", func(ctx context.Context, conn *ServerConn, args [][]byte) {
+		ls.mu.Lock()
+		defer ls.mu.Unlock()
+		key, token := string(args[3]), string(args[4])
+		if ls.data[key] != token {
+			conn.WriteInteger(0)
+			return
+		}
+		switch string(args[1]) {
+		case unlockScript.Hash():
+			delete(ls.data, key)
+		case extendScript.Hash():
+			ls.ttl[key] = string(args[5])
+		}
+		conn.WriteInteger(1)
+	})
+	return ls, startServer(t, srv)
+}
+
+func (ls *lockServer) get(key string) (string, string) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return ls.data[key], ls.ttl[key]
+}
+
+func (ls *lockServer) set(key, value string) {
+	ls.mu.Lock()
+	ls.data[key] = value
+	ls.mu.Unlock()
+}
+
+func TestLockToken(t *testing.T) {
+	a, err := lockToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := lockToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 32 || a == b {
+		t.Fatalf("lockToken should return unique 32 character tokens: %s %s", a, b)
+	}
+}
+
+func TestRedlockQuorum(t *testing.T) {
+	clients := []*Client{
+		NewClient("tcp", "127.0.0.1:1"),
+		NewClient("tcp", "127.0.0.1:1"),
+		NewClient("tcp", "127.0.0.1:1"),
+	}
+	r := NewRedlock(clients, "lock", time.Second)
+	if r.quorum != 2 {
+		t.Fatalf("quorum for 3 servers should be 2 instead of %d", r.quorum)
+	}
+	if ok, err := r.TryLock(); ok || err == nil {
+		t.Fatalf("TryLock should return an error without reachable servers: %t %+v", ok, err)
+	}
+	if r.Token() != "" {
+		t.Fatal("Token should be empty when the lock isn't held")
+	}
+	if err := r.Unlock(); err != ErrLockNotHeld {
+		t.Fatalf("Unlock should fail when the lock isn't held: %+v", err)
+	}
+
+	r.token = "token"
+	if err := r.Unlock(); err == nil || err == ErrLockNotHeld {
+		t.Fatalf("Unlock should return the connection errors: %+v", err)
+	}
+	if r.Token() != "token" {
+		t.Fatal("Unlock should keep the token when a quorum couldn't be reached")
+	}
+}
+
+func TestMutex(t *testing.T) {
+	ls, addr := startLockServer(t)
+	cli := NewClient("tcp", addr)
+	defer cli.Close()
+
+	m := NewMutex(cli, "lock", time.Second)
+	if ok, err := m.TryLock(); err != nil || !ok {
+		t.Fatalf("TryLock failed: %t %+v", ok, err)
+	}
+	if v, ttl := ls.get("lock"); v != m.Token() || ttl != "1000" {
+		t.Fatalf("lock stored as %q with ttl %s", v, ttl)
+	}
+	m2 := NewMutex(cli, "lock", time.Second)
+	if ok, err := m2.TryLock(); err != nil || ok {
+		t.Fatalf("TryLock should fail while the lock is held: %t %+v", ok, err)
+	}
+
+	if err := m.Extend(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, ttl := ls.get("lock"); ttl != "5000" {
+		t.Fatalf("Extend set the ttl to %s", ttl)
+	}
+	if err := m.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := ls.get("lock"); v != "" || m.Token() != "" {
+		t.Fatalf("Unlock left %q with token %q", v, m.Token())
+	}
+
+	m2.SetRetryDelay(time.Millisecond, 5*time.Millisecond)
+	if err := m2.Lock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Another holder takes over once the lock expires
+	ls.set("lock", "other")
+	if err := m2.Extend(time.Second); err != ErrLockNotHeld {
+		t.Fatalf("Extend should fail on a token mismatch: %+v", err)
+	}
+	if err := m2.Unlock(); err != ErrLockNotHeld {
+		t.Fatalf("Unlock should fail on a token mismatch: %+v", err)
+	}
+	if v, _ := ls.get("lock"); v != "other" {
+		t.Fatalf("Unlock deleted the lock of another holder: %q", v)
+	}
+}
+
+func TestMutexUnlockError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	m := NewMutex(NewClient("tcp", l.Addr().String()), "lock", time.Second)
+	m.token = "token"
+	if err := m.Unlock(); err == nil || err == ErrLockNotHeld {
+		t.Fatalf("Unlock should return the connection error: %+v", err)
+	}
+	if m.Token() != "token" {
+		t.Fatal("Unlock should keep the token when the server couldn't be reached")
+	}
+}
+
+func TestRedlock(t *testing.T) {
+	var servers []*lockServer
+	var clients []*Client
+	for i := 0; i < 3; i++ {
+		ls, addr := startLockServer(t)
+		servers = append(servers, ls)
+		clients = append(clients, NewClient("tcp", addr))
+	}
+	// One unreachable server still leaves a quorum
+	clients[2] = NewClient("tcp", "127.0.0.1:1")
+
+	r := NewRedlock(clients, "lock", time.Second)
+	r.SetRetryDelay(time.Millisecond, 5*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := r.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !r.ValidUntil().After(time.Now()) {
+		t.Fatalf("ValidUntil should be in the future: %s", r.ValidUntil())
+	}
+	for _, ls := range servers[:2] {
+		if v, _ := ls.get("lock"); v != r.Token() {
+			t.Fatalf("lock stored as %q instead of %q", v, r.Token())
+		}
+	}
+	if err := r.Extend(2 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// Losing the lock on one server drops below quorum
+	servers[1].set("lock", "other")
+	if err := r.Extend(time.Second); err != ErrLockNotHeld {
+		t.Fatalf("Extend should fail below quorum: %+v", err)
+	}
+	if err := r.Unlock(); err != ErrLockNotHeld {
+		t.Fatalf("Unlock should fail below quorum: %+v", err)
+	}
+	if v, _ := servers[0].get("lock"); v != "" {
+		t.Fatalf("Unlock should release the lock where it's held: %q", v)
+	}
+	if v, _ := servers[1].get("lock"); v != "other" {
+		t.Fatalf("Unlock deleted the lock of another holder: %q", v)
+	}
+}
+
+func TestLockDrift(t *testing.T) {
+	if d := lockDrift(10 * time.Second); d != 102*time.Millisecond {
+		t.Fatalf("lockDrift(10s) should be 102ms instead of %s", d)
+	}
+}
@@ -0,0 +1,199 @@
+package redis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidMonitorLine = errors.New("redis: invalid MONITOR line")
+)
+
+// MonitorEvent is a command processed by the server as reported by
+// MONITOR. Addr is the address of the client, "lua" for commands run by
+// scripts, or "unix:<path>" for unix socket clients.
+type MonitorEvent struct {
+	Time    time.Time
+	DB      int
+	Addr    string
+	Command string
+	Args    [][]byte
+}
+
+// Monitor is a dedicated connection streaming the commands processed by
+// the server.
+type Monitor struct {
+	rc   *redisConnection
+	ctx  context.Context
+	done chan struct{}
+}
+
+// Monitor issues MONITOR on a new connection. The connection is closed
+// when ctx is done or Close is called. Note that MONITOR has a
+// significant performance cost on busy servers.
+func (cli *Client) Monitor(ctx context.Context) (*Monitor, error) {
+	rc, err := cli.newConnection()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rc.statusRequest("MONITOR"); err != nil {
+		rc.close()
+		return nil, err
+	}
+	m := &Monitor{rc: rc, ctx: ctx, done: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-m.done:
+		}
+		rc.close()
+	}()
+	return m, nil
+}
+
+// Next blocks until the next command is received.
+func (m *Monitor) Next() (*MonitorEvent, error) {
+	marker, err := m.rc.rw.ReadByte()
+	if err != nil {
+		return nil, m.err(err)
+	}
+	// Lines can be larger than the buffer with big arguments
+	line, err := m.rc.rw.ReadBytes('\n')
+	if err != nil {
+		return nil, m.err(err)
+	}
+	line = bytes.TrimSuffix(line, []byte(eol))
+	switch marker {
+	case statusReplyMarker:
+		return parseMonitorLine(line)
+	case errorReplyMarker:
+		return nil, parseErrReply(string(line))
+	}
+	return nil, ErrInvalidReplyMarker
+}
+
+func (m *Monitor) err(err error) error {
+	if e := m.ctx.Err(); e != nil {
+		return e
+	}
+	return err
+}
+
+func (m *Monitor) Close() error {
+	select {
+	case <-m.done:
+	default:
+		close(m.done)
+	}
+	return nil
+}
+
+// parseMonitorLine parses a line such as
+//
+//	1339518083.107412 [0 127.0.0.1:60866] "set" "foo" "bar\x00"
+func parseMonitorLine(line []byte) (*MonitorEvent, error) {
+	sp := bytes.IndexByte(line, ' ')
+	if sp < 0 {
+		return nil, ErrInvalidMonitorLine
+	}
+	e := &MonitorEvent{}
+	ts := string(line[:sp])
+	sec, usec, _ := strings.Cut(ts, ".")
+	s, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidMonitorLine
+	}
+	us, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil && usec != "" {
+		return nil, ErrInvalidMonitorLine
+	}
+	e.Time = time.Unix(s, us*int64(time.Microsecond))
+
+	line = line[sp+1:]
+	if len(line) == 0 || line[0] != '[' {
+		return nil, ErrInvalidMonitorLine
+	}
+	end := bytes.IndexByte(line, ']')
+	if end < 0 {
+		return nil, ErrInvalidMonitorLine
+	}
+	db, addr, ok := strings.Cut(string(line[1:end]), " ")
+	if !ok {
+		return nil, ErrInvalidMonitorLine
+	}
+	if e.DB, err = strconv.Atoi(db); err != nil {
+		return nil, ErrInvalidMonitorLine
+	}
+	e.Addr = addr
+
+	line = line[end+1:]
+	for {
+		line = bytes.TrimLeft(line, " ")
+		if len(line) == 0 {
+			break
+		}
+		var arg []byte
+		if arg, line, err = unquoteMonitorArg(line); err != nil {
+			return nil, err
+		}
+		e.Args = append(e.Args, arg)
+	}
+	if len(e.Args) == 0 {
+		return nil, ErrInvalidMonitorLine
+	}
+	e.Command = strings.ToUpper(string(e.Args[0]))
+	e.Args = e.Args[1:]
+	return e, nil
+}
+
+// unquoteMonitorArg unquotes an argument escaped by the server with
+// sdscatrepr and returns the rest of the line.
+func unquoteMonitorArg(line []byte) ([]byte, []byte, error) {
+	if line[0] != '"' {
+		return nil, nil, ErrInvalidMonitorLine
+	}
+	var arg []byte
+	for i := 1; i < len(line); i++ {
+		c := line[i]
+		switch c {
+		case '"':
+			return arg, line[i+1:], nil
+		case '\\':
+			i++
+			if i >= len(line) {
+				return nil, nil, ErrInvalidMonitorLine
+			}
+			switch line[i] {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'a':
+				c = '\a'
+			case 'b':
+				c = '\b'
+			case 'x':
+				if i+2 >= len(line) {
+					return nil, nil, ErrInvalidMonitorLine
+				}
+				h, err := strconv.ParseUint(string(line[i+1:i+3]), 16, 8)
+				if err != nil {
+					return nil, nil, ErrInvalidMonitorLine
+				}
+				c = byte(h)
+				i += 2
+			default:
+				// \\ and \"
+				c = line[i]
+			}
+		}
+		arg = append(arg, c)
+	}
+	return nil, nil, ErrInvalidMonitorLine
+}
@@ -0,0 +1,81 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMonitorLine(t *testing.T) {
+	e, err := parseMonitorLine([]byte(`1339518083.107412 [3 127.0.0.1:60866] "set" "foo \"x\"" "a\\b\r\n\x00\xff"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.Time.Equal(time.Unix(1339518083, 107412000)) {
+		t.Fatalf("unexpected time %s", e.Time)
+	}
+	if e.DB != 3 || e.Addr != "127.0.0.1:60866" || e.Command != "SET" {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	if len(e.Args) != 2 || string(e.Args[0]) != `foo "x"` || string(e.Args[1]) != "a\\b\r\n\x00\xff" {
+		t.Fatalf("unexpected args %q", e.Args)
+	}
+
+	e, err = parseMonitorLine([]byte(`1339518083.107412 [0 lua] "incr" "counter"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Addr != "lua" || e.Command != "INCR" {
+		t.Fatalf("unexpected event %+v", e)
+	}
+
+	for _, line := range []string{
+		``,
+		`1339518083.107412`,
+		`1339518083.107412 [0 lua]`,
+		`1339518083.107412 [0 lua] "unterminated`,
+		`1339518083.107412 [0 lua] "bad\x0"`,
+		`1339518083.107412 [x lua] "get"`,
+	} {
+		if _, err := parseMonitorLine([]byte(line)); err != ErrInvalidMonitorLine {
+			t.Errorf("%q: expected ErrInvalidMonitorLine, got %v", line, err)
+		}
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	srv := NewServer()
+	srv.HandleFunc("monitor", func(ctx context.Context, conn *ServerConn, args [][]byte) {
+		conn.WriteOK()
+		conn.WriteStatus(`1700000000.000001 [0 127.0.0.1:1234] "get" "` + strings.Repeat("x", 5000) + `"`)
+		conn.WriteStatus(`1700000000.000002 [1 127.0.0.1:1234] "del" "a"`)
+	})
+	defer srv.Close()
+	cli := NewClient("tcp", startServer(t, srv))
+	defer cli.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m, err := cli.Monitor(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := m.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Command != "GET" || len(e.Args) != 1 || len(e.Args[0]) != 5000 {
+		t.Fatalf("unexpected event %s %d", e.Command, len(e.Args))
+	}
+	if e, err = m.Next(); err != nil {
+		t.Fatal(err)
+	} else if e.Command != "DEL" || e.DB != 1 {
+		t.Fatalf("unexpected event %+v", e)
+	}
+
+	cancel()
+	if _, err := m.Next(); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
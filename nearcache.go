@@ -0,0 +1,353 @@
+package redis
+
+import (
+	"container/list"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// http://redis.io/docs/manual/client-side-caching/
+
+const (
+	DefaultNearCacheSize = 10000
+
+	invalidateChannel = "__redis__:invalidate"
+)
+
+var (
+	ErrNearCacheEnabled = errors.New("redis: near cache already enabled")
+)
+
+type NearCacheOptions struct {
+	// Maximum number of cached keys. The least recently used key is
+	// evicted when full. Defaults to DefaultNearCacheSize.
+	Size int
+	// BCast enables broadcasting mode where the server sends
+	// invalidations for every modified key matching Prefixes instead of
+	// remembering the keys each connection read. Only keys matching
+	// Prefixes are cached in this mode.
+	BCast    bool
+	Prefixes []string
+}
+
+type NearCacheStats struct {
+	Hits          uint64
+	Misses        uint64
+	Invalidations uint64
+	Entries       int
+}
+
+type nearCacheKind int
+
+const (
+	nearCacheString nearCacheKind = iota
+	nearCacheHash
+)
+
+type nearCacheEntry struct {
+	key   string
+	kind  nearCacheKind
+	value interface{}
+}
+
+// nearCache is an in-process LRU kept consistent with the server through
+// CLIENT TRACKING. Invalidations are redirected to a dedicated connection
+// subscribed to __redis__:invalidate.
+type nearCache struct {
+	id       int64
+	bcast    bool
+	prefixes []string
+	size     int
+	sub      *subscription
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	// seq is incremented for every invalidation. A value read from the
+	// server is only cached if no invalidation arrived in the meantime
+	// since it might otherwise be stale.
+	seq uint64
+
+	hits          uint64
+	misses        uint64
+	invalidations uint64
+}
+
+// EnableNearCache caches the results of Get, MGet and HGetAll in process
+// using server assisted client side caching (CLIENT TRACKING) to drop
+// keys as soon as they're modified. Cache misses are always read from
+// the master. If the invalidation connection is lost the cache is
+// flushed and disabled.
+func (cli *Client) EnableNearCache(opt NearCacheOptions) error {
+	if opt.Size <= 0 {
+		opt.Size = DefaultNearCacheSize
+	}
+	sub, err := cli.newSubscription()
+	if err != nil {
+		return err
+	}
+	id, err := sub.rc.integerRequest("CLIENT", "ID")
+	if err == nil && opt.BCast {
+		// In broadcast mode the server doesn't need to know which keys
+		// a connection read so tracking is only enabled once, on the
+		// invalidation connection itself.
+		args := []interface{}{"TRACKING", "on", "REDIRECT", id, "BCAST"}
+		for _, p := range opt.Prefixes {
+			args = append(args, "PREFIX", p)
+		}
+		_, err = sub.rc.statusRequest("CLIENT", args...)
+	}
+	if err == nil {
+		err = sub.subscribe("SUBSCRIBE", invalidateChannel)
+	}
+	if err != nil {
+		sub.close()
+		return err
+	}
+	nc := &nearCache{
+		id:       id,
+		bcast:    opt.BCast,
+		prefixes: opt.Prefixes,
+		size:     opt.Size,
+		sub:      sub,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+	if !cli.nearCache.CompareAndSwap(nil, nc) {
+		sub.close()
+		return ErrNearCacheEnabled
+	}
+	go cli.invalidate(nc)
+	return nil
+}
+
+// DisableNearCache flushes and disables the near cache.
+func (cli *Client) DisableNearCache() {
+	if nc := cli.nearCache.Swap(nil); nc != nil {
+		nc.sub.close()
+		nc.flush()
+	}
+}
+
+// NearCacheStats returns the counters of the near cache or zero if it's
+// not enabled.
+func (cli *Client) NearCacheStats() NearCacheStats {
+	nc := cli.nearCache.Load()
+	if nc == nil {
+		return NearCacheStats{}
+	}
+	nc.mu.Lock()
+	n := nc.lru.Len()
+	nc.mu.Unlock()
+	return NearCacheStats{
+		Hits:          atomic.LoadUint64(&nc.hits),
+		Misses:        atomic.LoadUint64(&nc.misses),
+		Invalidations: atomic.LoadUint64(&nc.invalidations),
+		Entries:       n,
+	}
+}
+
+func (cli *Client) invalidate(nc *nearCache) {
+	for {
+		m, err := nc.sub.receive()
+		if err != nil {
+			if cli.nearCache.CompareAndSwap(nc, nil) {
+				nc.sub.close()
+			}
+			nc.flush()
+			return
+		}
+		if m.channel != invalidateChannel {
+			continue
+		}
+		switch keys := m.data.(type) {
+		case nil:
+			// Sent on FLUSHALL/FLUSHDB
+			nc.flush()
+		case []interface{}:
+			for _, k := range keys {
+				nc.invalidate(replyString(k))
+			}
+		}
+	}
+}
+
+// track enables tracking on a connection before it reads a key that is
+// going to be cached.
+func (nc *nearCache) track(rc *redisConnection) error {
+	if nc.bcast || rc.trackingID == nc.id {
+		return nil
+	}
+	if _, err := rc.statusRequest("CLIENT", "TRACKING", "on", "REDIRECT", nc.id); err != nil {
+		return err
+	}
+	rc.trackingID = nc.id
+	return nil
+}
+
+func (nc *nearCache) cacheable(key string) bool {
+	if !nc.bcast || len(nc.prefixes) == 0 {
+		return true
+	}
+	for _, p := range nc.prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (nc *nearCache) load(key string, kind nearCacheKind) (interface{}, bool) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if el := nc.entries[key]; el != nil {
+		if e := el.Value.(*nearCacheEntry); e.kind == kind {
+			nc.lru.MoveToFront(el)
+			atomic.AddUint64(&nc.hits, 1)
+			return e.value, true
+		}
+	}
+	atomic.AddUint64(&nc.misses, 1)
+	return nil, false
+}
+
+func (nc *nearCache) sequence() uint64 {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	return nc.seq
+}
+
+// store caches a value read after sequence returned seq.
+func (nc *nearCache) store(key string, kind nearCacheKind, value interface{}, seq uint64) {
+	if !nc.cacheable(key) {
+		return
+	}
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if nc.seq != seq {
+		return
+	}
+	e := &nearCacheEntry{key, kind, value}
+	if el := nc.entries[key]; el != nil {
+		el.Value = e
+		nc.lru.MoveToFront(el)
+		return
+	}
+	nc.entries[key] = nc.lru.PushFront(e)
+	for nc.lru.Len() > nc.size {
+		el := nc.lru.Back()
+		nc.lru.Remove(el)
+		delete(nc.entries, el.Value.(*nearCacheEntry).key)
+	}
+}
+
+func (nc *nearCache) invalidate(key string) {
+	atomic.AddUint64(&nc.invalidations, 1)
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	nc.seq++
+	if el := nc.entries[key]; el != nil {
+		nc.lru.Remove(el)
+		delete(nc.entries, key)
+	}
+}
+
+func (nc *nearCache) flush() {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	nc.seq++
+	nc.entries = make(map[string]*list.Element)
+	nc.lru.Init()
+}
+
+func (nc *nearCache) get(cli *Client, key string) ([]byte, error) {
+	if v, ok := nc.load(key, nearCacheString); ok {
+		return copyBytes(v.([]byte)), nil
+	}
+	seq := nc.sequence()
+	var b []byte
+	err := cli.withConnection(func(c *redisConnection) (err error) {
+		if err = nc.track(c); err == nil {
+			b, err = c.bulkRequest("GET", key)
+		}
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	nc.store(key, nearCacheString, b, seq)
+	return copyBytes(b), nil
+}
+
+func (nc *nearCache) mget(cli *Client, keys []string) ([][]byte, error) {
+	out := make([][]byte, len(keys))
+	var missing []string
+	var idx []int
+	for i, k := range keys {
+		if v, ok := nc.load(k, nearCacheString); ok {
+			out[i] = copyBytes(v.([]byte))
+		} else {
+			missing = append(missing, k)
+			idx = append(idx, i)
+		}
+	}
+	if len(missing) == 0 {
+		return out, nil
+	}
+	seq := nc.sequence()
+	var vals [][]byte
+	err := cli.withConnection(func(c *redisConnection) (err error) {
+		if err = nc.track(c); err == nil {
+			vals, err = c.mget(missing)
+		}
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, j := range idx {
+		nc.store(missing[i], nearCacheString, vals[i], seq)
+		out[j] = copyBytes(vals[i])
+	}
+	return out, nil
+}
+
+func (nc *nearCache) hgetall(cli *Client, key string) (map[string][]byte, error) {
+	if v, ok := nc.load(key, nearCacheHash); ok {
+		return copyHash(v.(map[string][]byte)), nil
+	}
+	seq := nc.sequence()
+	var m map[string][]byte
+	err := cli.withConnection(func(c *redisConnection) (err error) {
+		if err = nc.track(c); err == nil {
+			m, err = c.hgetall(key)
+		}
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	nc.store(key, nearCacheHash, m, seq)
+	return copyHash(m), nil
+}
+
+// Cached values are shared so callers get a copy they're free to modify.
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
+
+func copyHash(m map[string][]byte) map[string][]byte {
+	c := make(map[string][]byte, len(m))
+	for k, v := range m {
+		c[k] = copyBytes(v)
+	}
+	return c
+}
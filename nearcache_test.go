@@ -0,0 +1,77 @@
+package redis
+
+import (
+	"bytes"
+	"container/list"
+	"testing"
+)
+
+func newTestNearCache(size int) *nearCache {
+	return &nearCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func TestNearCacheLRU(t *testing.T) {
+	nc := newTestNearCache(2)
+	nc.store("a", nearCacheString, []byte("1"), nc.sequence())
+	nc.store("b", nearCacheString, []byte("2"), nc.sequence())
+	if _, ok := nc.load("a", nearCacheString); !ok {
+		t.Fatal("expected a to be cached")
+	}
+	nc.store("c", nearCacheString, []byte("3"), nc.sequence())
+	if _, ok := nc.load("b", nearCacheString); ok {
+		t.Fatal("expected b to be evicted as least recently used")
+	}
+	if v, ok := nc.load("a", nearCacheString); !ok || !bytes.Equal(v.([]byte), []byte("1")) {
+		t.Fatalf("expected a to still be cached: %+v", v)
+	}
+	if _, ok := nc.load("a", nearCacheHash); ok {
+		t.Fatal("load should miss for a different kind")
+	}
+	if nc.hits != 2 || nc.misses != 2 {
+		t.Fatalf("expected 2 hits and 2 misses instead of %d and %d", nc.hits, nc.misses)
+	}
+}
+
+func TestNearCacheInvalidation(t *testing.T) {
+	nc := newTestNearCache(10)
+	nc.store("a", nearCacheString, []byte("1"), nc.sequence())
+	nc.invalidate("a")
+	if _, ok := nc.load("a", nearCacheString); ok {
+		t.Fatal("expected a to be invalidated")
+	}
+
+	// A value read before an invalidation must not be cached
+	seq := nc.sequence()
+	nc.invalidate("b")
+	nc.store("b", nearCacheString, []byte("stale"), seq)
+	if _, ok := nc.load("b", nearCacheString); ok {
+		t.Fatal("stale value should not be cached")
+	}
+
+	nc.store("c", nearCacheString, nil, nc.sequence())
+	nc.flush()
+	if nc.lru.Len() != 0 || len(nc.entries) != 0 {
+		t.Fatal("flush should empty the cache")
+	}
+	if nc.invalidations != 2 {
+		t.Fatalf("expected 2 invalidations instead of %d", nc.invalidations)
+	}
+}
+
+func TestNearCacheBCastPrefixes(t *testing.T) {
+	nc := newTestNearCache(10)
+	nc.bcast = true
+	nc.prefixes = []string{"user:"}
+	nc.store("user:1", nearCacheString, []byte("1"), nc.sequence())
+	nc.store("order:1", nearCacheString, []byte("1"), nc.sequence())
+	if _, ok := nc.load("user:1", nearCacheString); !ok {
+		t.Fatal("expected user:1 to be cached")
+	}
+	if _, ok := nc.load("order:1", nearCacheString); ok {
+		t.Fatal("keys not matching a prefix should not be cached in BCAST mode")
+	}
+}
@@ -5,16 +5,49 @@ type Pipeline struct {
 	cn          *redisConnection
 	replies     []Reply
 	transaction bool
+	// err is the first error sending a command, returned by Flush
+	err error
 }
 
 func (p *Pipeline) Get(key string) *BulkReply {
 	r := &BulkReply{}
-	p.replies = append(p.replies, r)
-	p.cn.sendCommand("GET", key)
+	p.send(r, "GET", key)
+	return r
+}
+
+// Do queues an arbitrary command. See Client.Do for the reply types.
+func (p *Pipeline) Do(cmd string, args ...interface{}) *GenericReply {
+	r := &GenericReply{}
+	p.send(r, cmd, args...)
+	return r
+}
+
+func (p *Pipeline) integer(cmd string, args ...interface{}) *IntegerReply {
+	r := &IntegerReply{}
+	p.send(r, cmd, args...)
 	return r
 }
 
+// send writes a command and queues its reply. Nothing is sent after an
+// error as the connection can't be used anymore.
+func (p *Pipeline) send(r Reply, cmd string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	if err := p.cn.sendCommand(cmd, args...); err != nil {
+		p.err = err
+		return
+	}
+	p.replies = append(p.replies, r)
+}
+
 func (p *Pipeline) Flush() ([]Reply, error) {
+	if p.err != nil {
+		p.cn.close()
+		p.cn = nil
+		p.cli = nil
+		return nil, p.err
+	}
 	p.cn.flush()
 	for _, r := range p.replies {
 		if err := r.read(p.cn); err != nil {
@@ -3,11 +3,14 @@ package redis
 import (
 	"bytes"
 	"testing"
+
+	"github.com/samuel/go-redis/redistest"
 )
 
 func TestPipeline(t *testing.T) {
-	// Use a non-standard port to avoid accidently clobbering
-	c := NewClient("tcp", "127.0.0.1:6999")
+	s := redistest.NewServer()
+	defer s.Close()
+	c := NewClient("tcp", s.Addr())
 	if err := c.Ping(); err != nil {
 		t.Fatalf("Ping failed with %+v", err)
 	}
@@ -19,6 +22,9 @@ func TestPipeline(t *testing.T) {
 	const count = 100
 
 	by := []byte{1, 2}
+	if err := c.Set("test", by, 0); err != nil {
+		t.Fatalf("Set failed with %+v", err)
+	}
 
 	checkMallocs2(t, "Pipeline.GET", count, func(t *testing.T, count int) {
 		pipe, err := c.Pipeline()
@@ -47,3 +53,24 @@ func TestPipeline(t *testing.T) {
 		}
 	})
 }
+
+func TestPipelineSendError(t *testing.T) {
+	s := redistest.NewServer()
+	defer s.Close()
+	c := NewClient("tcp", s.Addr())
+	defer c.Close()
+
+	p, err := c.Pipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Do("SET", "a", "1")
+	p.Do("SET", "k", struct{}{})
+	p.Do("SET", "b", "2")
+	if _, err := p.Flush(); err != ErrInvalidArgumentType {
+		t.Fatalf("expected ErrInvalidArgumentType, got %v", err)
+	}
+	if b, err := c.Get("a"); err != nil || b != nil {
+		t.Fatalf("expected nothing to be sent, got %q, %v", b, err)
+	}
+}
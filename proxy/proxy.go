@@ -0,0 +1,297 @@
+// Package proxy implements a Redis protocol proxy that forwards commands
+// to upstream servers with guardrails: a deny-list of commands, routing by
+// key prefix, per-client rate limits and request logging.
+//
+// Commands that depend on connection state (AUTH, SELECT, MULTI, WATCH,
+// SUBSCRIBE, ...) can't be forwarded over pooled upstream connections and
+// are rejected. Forwarding AUTH or RESET in particular would change the
+// user of a connection shared with other clients. HELLO is answered by
+// the proxy itself and rejects AUTH.
+package proxy
+
+import (
+	"context"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samuel/go-redis"
+)
+
+// DefaultDeniedCommands are denied by New. Use Allow to permit them.
+var DefaultDeniedCommands = []string{
+	"CONFIG", "DEBUG", "FLUSHALL", "FLUSHDB", "KEYS", "SHUTDOWN",
+}
+
+// Commands that need a dedicated upstream connection.
+var statefulCommands = map[string]bool{
+	"AUTH": true, "BLPOP": true, "BRPOP": true, "BRPOPLPUSH": true,
+	"BLMOVE": true, "BZPOPMIN": true, "BZPOPMAX": true, "CLIENT": true,
+	"DISCARD": true, "EXEC": true, "MONITOR": true, "MULTI": true,
+	"PSUBSCRIBE": true, "PSYNC": true, "PUNSUBSCRIBE": true, "READONLY": true,
+	"READWRITE": true, "RESET": true, "SELECT": true, "SUBSCRIBE": true,
+	"SYNC": true, "UNSUBSCRIBE": true, "UNWATCH": true, "WAIT": true,
+	"WATCH": true,
+}
+
+const (
+	msgDenied      = "ERR command not allowed by proxy"
+	msgUnsupported = "ERR command not supported by proxy"
+	msgCrossRoute  = "CROSSSLOT Keys in request don't route to the same backend"
+	msgRateLimited = "ERR rate limit exceeded"
+
+	bucketPruneInterval = time.Minute
+)
+
+// Proxy forwards commands from clients to upstream Clients.
+type Proxy struct {
+	srv *redis.Server
+
+	mu        sync.RWMutex
+	backend   *redis.Client
+	routes    []route
+	denied    map[string]bool
+	logger    *log.Logger
+	rate      float64
+	burst     int
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+type route struct {
+	prefix  string
+	backend *redis.Client
+}
+
+// New returns a proxy sending all commands to backend unless a route
+// matches.
+func New(backend *redis.Client) *Proxy {
+	p := &Proxy{
+		srv:     redis.NewServer(),
+		backend: backend,
+		denied:  make(map[string]bool),
+		buckets: make(map[string]*bucket),
+	}
+	p.Deny(DefaultDeniedCommands...)
+	p.srv.NotFound = p.handle
+	return p
+}
+
+// Server returns the underlying server which can be used to configure
+// connection limits and timeouts.
+func (p *Proxy) Server() *redis.Server {
+	return p.srv
+}
+
+func (p *Proxy) ListenAndServe(network, addr string) error {
+	return p.srv.ListenAndServe(network, addr)
+}
+
+func (p *Proxy) Serve(l net.Listener) error {
+	return p.srv.Serve(l)
+}
+
+func (p *Proxy) Shutdown(ctx context.Context) error {
+	return p.srv.Shutdown(ctx)
+}
+
+func (p *Proxy) Close() error {
+	return p.srv.Close()
+}
+
+// Deny rejects the given commands.
+func (p *Proxy) Deny(cmds ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range cmds {
+		p.denied[strings.ToUpper(c)] = true
+	}
+}
+
+// Allow removes commands from the deny-list.
+func (p *Proxy) Allow(cmds ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range cmds {
+		delete(p.denied, strings.ToUpper(c))
+	}
+}
+
+// Route sends commands on keys starting with prefix to backend. The
+// longest matching prefix wins. All keys of a multi-key command must
+// route to the same backend.
+func (p *Proxy) Route(prefix string, backend *redis.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.routes = append(p.routes, route{prefix, backend})
+	sort.SliceStable(p.routes, func(i, j int) bool {
+		return len(p.routes[i].prefix) > len(p.routes[j].prefix)
+	})
+}
+
+// SetRateLimit limits every client host to perSecond commands with bursts
+// of up to burst commands. A rate of zero disables the limit.
+func (p *Proxy) SetRateLimit(perSecond float64, burst int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if burst < 1 {
+		burst = 1
+	}
+	p.rate = perSecond
+	p.burst = burst
+	p.buckets = make(map[string]*bucket)
+}
+
+// SetLogger logs every request to l. A nil logger disables logging.
+func (p *Proxy) SetLogger(l *log.Logger) {
+	p.mu.Lock()
+	p.logger = l
+	p.mu.Unlock()
+}
+
+func (p *Proxy) handle(ctx context.Context, conn *redis.ServerConn, args [][]byte) {
+	start := time.Now()
+	cmd := strings.ToUpper(string(args[0]))
+	var err error
+	if msg := p.check(conn, cmd); msg != "" {
+		conn.WriteError(msg)
+		err = errString(msg)
+	} else if backend, ok := p.backendFor(args); !ok {
+		conn.WriteError(msgCrossRoute)
+		err = errString(msgCrossRoute)
+	} else {
+		cmdArgs := make([]interface{}, len(args)-1)
+		for i, a := range args[1:] {
+			cmdArgs[i] = a
+		}
+		var r interface{}
+		r, err = backend.Do(string(args[0]), cmdArgs...)
+		if e, ok := err.(redis.ErrReply); ok {
+			conn.WriteReply(e)
+		} else if err != nil {
+			conn.WriteError("ERR proxy: " + err.Error())
+		} else {
+			conn.WriteReply(r)
+		}
+	}
+
+	p.mu.RLock()
+	logger := p.logger
+	p.mu.RUnlock()
+	if logger != nil {
+		key := ""
+		if keys := redis.CommandKeys(args); len(keys) > 0 {
+			key = string(keys[0])
+		}
+		status := "ok"
+		if err != nil {
+			status = err.Error()
+		}
+		logger.Printf("%s %s %q %s %s", conn.RemoteAddr(), cmd, key, time.Since(start), status)
+	}
+}
+
+// check returns an error message if the command must be rejected.
+func (p *Proxy) check(conn *redis.ServerConn, cmd string) string {
+	p.mu.RLock()
+	denied := p.denied[cmd]
+	p.mu.RUnlock()
+	if denied {
+		return msgDenied
+	}
+	if statefulCommands[cmd] {
+		return msgUnsupported
+	}
+	if !p.allow(conn.RemoteAddr()) {
+		return msgRateLimited
+	}
+	return ""
+}
+
+// backendFor returns the backend for a command and false if its keys
+// route to different backends.
+func (p *Proxy) backendFor(args [][]byte) (*redis.Client, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if len(p.routes) == 0 {
+		return p.backend, true
+	}
+	// Keyless commands go to the default backend
+	var backend *redis.Client
+	for _, k := range redis.CommandKeys(args) {
+		b := p.route(string(k))
+		if backend != nil && b != backend {
+			return nil, false
+		}
+		backend = b
+	}
+	if backend == nil {
+		backend = p.backend
+	}
+	return backend, true
+}
+
+func (p *Proxy) route(key string) *redis.Client {
+	for _, r := range p.routes {
+		if strings.HasPrefix(key, r.prefix) {
+			return r.backend
+		}
+	}
+	return p.backend
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// allow takes a token from the client's bucket.
+func (p *Proxy) allow(addr net.Addr) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.rate <= 0 {
+		return true
+	}
+	host := addr.String()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	now := time.Now()
+	if now.Sub(p.lastPrune) > bucketPruneInterval {
+		// Buckets that have refilled are the same as new ones
+		for h, b := range p.buckets {
+			if b.refill(now, p.rate, p.burst) >= float64(p.burst) {
+				delete(p.buckets, h)
+			}
+		}
+		p.lastPrune = now
+	}
+	b := p.buckets[host]
+	if b == nil {
+		b = &bucket{tokens: float64(p.burst), last: now}
+		p.buckets[host] = b
+	}
+	if b.refill(now, p.rate, p.burst) < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *bucket) refill(now time.Time, rate float64, burst int) float64 {
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > float64(burst) {
+		b.tokens = float64(burst)
+	}
+	b.last = now
+	return b.tokens
+}
+
+type errString string
+
+func (e errString) Error() string {
+	return string(e)
+}
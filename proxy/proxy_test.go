@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/samuel/go-redis"
+	"github.com/samuel/go-redis/redistest"
+)
+
+func startProxy(t *testing.T, p *Proxy) *redis.Client {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.Serve(l)
+	return redis.NewClient("tcp", l.Addr().String())
+}
+
+func TestProxyRouting(t *testing.T) {
+	s1 := redistest.NewServer()
+	defer s1.Close()
+	s2 := redistest.NewServer()
+	defer s2.Close()
+	b1 := redis.NewClient("tcp", s1.Addr())
+	defer b1.Close()
+	b2 := redis.NewClient("tcp", s2.Addr())
+	defer b2.Close()
+
+	p := New(b1)
+	p.Route("session:", b2)
+	defer p.Close()
+	cli := startProxy(t, p)
+	defer cli.Close()
+
+	if err := cli.Set("user:1", []byte("a"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Set("session:1", []byte("b"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := b1.Get("user:1"); err != nil || string(b) != "a" {
+		t.Fatalf("expected user:1 on default backend, got %q, %v", b, err)
+	}
+	if b, err := b2.Get("session:1"); err != nil || string(b) != "b" {
+		t.Fatalf("expected session:1 on routed backend, got %q, %v", b, err)
+	}
+	if b, err := b1.Get("session:1"); err != nil || b != nil {
+		t.Fatalf("expected session:1 to not be on default backend, got %q, %v", b, err)
+	}
+	if out, err := cli.MGet("session:1", "session:2"); err != nil || string(out[0]) != "b" || out[1] != nil {
+		t.Fatalf("MGet returned %q, %v", out, err)
+	}
+	if _, err := cli.MGet("user:1", "session:1"); err == nil || !strings.Contains(err.Error(), "CROSSSLOT") {
+		t.Fatalf("expected cross route error, got %v", err)
+	}
+	if r, err := cli.Do("HSET", "user:h", "f", "v"); err != nil || r != int64(1) {
+		t.Fatalf("HSET returned %v, %v", r, err)
+	}
+	if _, err := cli.Incr("user:1"); err == nil {
+		t.Fatal("expected upstream error to be forwarded")
+	}
+}
+
+func TestProxyGuardrails(t *testing.T) {
+	s := redistest.NewServer()
+	defer s.Close()
+	b := redis.NewClient("tcp", s.Addr())
+	defer b.Close()
+
+	var logs bytes.Buffer
+	p := New(b)
+	p.SetLogger(log.New(&logs, "", 0))
+	p.SetRateLimit(0.001, 3)
+	defer p.Close()
+	cli := startProxy(t, p)
+	defer cli.Close()
+
+	if _, err := cli.Do("FLUSHALL"); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Fatalf("expected FLUSHALL to be denied, got %v", err)
+	}
+	if err := cli.Select(1); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Fatalf("expected SELECT to be rejected, got %v", err)
+	}
+	if err := cli.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Ping(); err == nil || !strings.Contains(err.Error(), "rate limit") {
+		t.Fatalf("expected rate limit error, got %v", err)
+	}
+	if !strings.Contains(logs.String(), "FLUSHALL") || strings.Count(logs.String(), "\n") != 6 {
+		t.Fatalf("unexpected log output:\n%s", logs.String())
+	}
+}
+
+func TestProxyConnectionState(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	srv := redis.NewServer()
+	srv.NotFound = func(ctx context.Context, conn *redis.ServerConn, args [][]byte) {
+		mu.Lock()
+		received = append(received, string(args[0]))
+		mu.Unlock()
+		conn.WriteOK()
+	}
+	defer srv.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	b := redis.NewClient("tcp", l.Addr().String())
+	defer b.Close()
+
+	p := New(b)
+	defer p.Close()
+	cli := startProxy(t, p)
+	defer cli.Close()
+
+	for _, cmd := range [][]interface{}{
+		{"AUTH", "admin", "secret"},
+		{"RESET"},
+		{"READONLY"},
+		{"READWRITE"},
+		{"SELECT", 1},
+	} {
+		if _, err := cli.Do(cmd[0].(string), cmd[1:]...); err == nil || !strings.Contains(err.Error(), "not supported") {
+			t.Fatalf("expected %s to be rejected, got %v", cmd[0], err)
+		}
+	}
+	if _, err := cli.Do("HELLO", 2, "AUTH", "admin", "secret"); err == nil {
+		t.Fatal("expected HELLO with AUTH to be rejected")
+	}
+	if _, err := cli.Do("SET", "a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 || received[0] != "SET" {
+		t.Fatalf("backend received %q", received)
+	}
+}
@@ -0,0 +1,86 @@
+package redis
+
+import (
+	"errors"
+)
+
+var (
+	ErrInvalidMessage = errors.New("redis: invalid pub/sub message")
+)
+
+type pubsubMessage struct {
+	kind    string // "message" or "pmessage"
+	pattern string
+	channel string
+	data    interface{}
+}
+
+// subscription is a dedicated connection in subscribed state. It's never
+// returned to the pool.
+type subscription struct {
+	rc *redisConnection
+}
+
+func (cli *Client) newSubscription() (*subscription, error) {
+	rc, err := cli.newConnection()
+	if err != nil {
+		return nil, err
+	}
+	return &subscription{rc: rc}, nil
+}
+
+// subscribe sends SUBSCRIBE or PSUBSCRIBE (given by cmd) and waits for
+// the confirmation of every channel.
+func (s *subscription) subscribe(cmd string, channels ...string) error {
+	args := make([]interface{}, len(channels))
+	for i, ch := range channels {
+		args[i] = ch
+	}
+	if err := s.rc.sendCommand(cmd, args...); err != nil {
+		return err
+	}
+	if err := s.rc.flush(); err != nil {
+		return err
+	}
+	for range channels {
+		r, err := s.rc.readReply()
+		if err != nil {
+			return err
+		}
+		if a, ok := r.([]interface{}); !ok || len(a) != 3 {
+			return ErrInvalidMessage
+		}
+	}
+	return nil
+}
+
+// receive returns the next message or pmessage, skipping subscription
+// confirmations.
+func (s *subscription) receive() (pubsubMessage, error) {
+	for {
+		r, err := s.rc.readReply()
+		if err != nil {
+			return pubsubMessage{}, err
+		}
+		a, ok := r.([]interface{})
+		if !ok || len(a) < 3 {
+			return pubsubMessage{}, ErrInvalidMessage
+		}
+		switch kind := replyString(a[0]); kind {
+		case "message":
+			return pubsubMessage{kind: kind, channel: replyString(a[1]), data: a[2]}, nil
+		case "pmessage":
+			if len(a) != 4 {
+				return pubsubMessage{}, ErrInvalidMessage
+			}
+			return pubsubMessage{kind: kind, pattern: replyString(a[1]), channel: replyString(a[2]), data: a[3]}, nil
+		case "subscribe", "unsubscribe", "psubscribe", "punsubscribe":
+		default:
+			return pubsubMessage{}, ErrInvalidMessage
+		}
+	}
+}
+
+func (s *subscription) close() error {
+	return s.rc.close()
+}
@@ -0,0 +1,260 @@
+//go:build integration
+
+package queue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-redis"
+)
+
+// The integration tests run the scripts on the Redis server at
+// $REDIS_ADDR (127.0.0.1:6379 by default):
+//
+//	go test -tags integration ./queue
+
+func integrationQueue(t *testing.T) *Queue {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "127.0.0.1:6379"
+	}
+	cli := redis.NewClient("tcp", addr)
+	t.Cleanup(func() { cli.Close() })
+	if err := cli.Ping(); err != nil {
+		t.Fatalf("no Redis server at %s: %v", addr, err)
+	}
+	q := New(cli, "test-"+strconv.FormatInt(time.Now().UnixNano(), 36))
+	q.Backoff = func(int) time.Duration { return time.Minute }
+	t.Cleanup(func() {
+		cli.Do("DEL", q.keys.jobs, q.keys.pending, q.keys.scheduled, q.keys.processing,
+			q.keys.active, q.keys.attempts, q.keys.errors, q.keys.dead, q.keys.stats, q.keys.unique+"user:1")
+	})
+	return q
+}
+
+func TestQueue(t *testing.T) {
+	q := integrationQueue(t)
+	maxRetries := 1
+	if _, err := q.Enqueue([]byte("a"), &EnqueueOptions{ID: "1", MaxRetries: &maxRetries}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue([]byte("b"), &EnqueueOptions{ID: "2", Delay: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := q.Dequeue(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil || job.ID != "1" || job.Attempts != 1 {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if err := q.Heartbeat(job); err != nil {
+		t.Fatal(err)
+	}
+
+	// First failure is retried later
+	if err := q.Fail(job, errors.New("boom")); err != nil {
+		t.Fatal(err)
+	}
+	st, err := q.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *st != (Stats{Scheduled: 2, Enqueued: 2, Failed: 1, Retried: 1}) {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	// Make the retry due and deliver it again
+	if _, err := q.cli.Do("ZADD", q.keys.scheduled, 0, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Maintain(); err != nil {
+		t.Fatal(err)
+	}
+	job, err = q.Dequeue(0)
+	if err != nil || job == nil || job.ID != "1" || job.Attempts != 2 || job.LastError != "boom" {
+		t.Fatalf("unexpected job %+v, %v", job, err)
+	}
+
+	// Second failure exhausts the retries
+	if err := q.Fail(job, errors.New("boom again")); err != nil {
+		t.Fatal(err)
+	}
+	dead, err := q.DeadJobs(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].ID != "1" || dead[0].LastError != "boom again" || dead[0].Attempts != 2 {
+		t.Fatalf("unexpected dead jobs %+v", dead)
+	}
+
+	if ok, err := q.RetryDead("1"); err != nil || !ok {
+		t.Fatalf("RetryDead returned %v, %v", ok, err)
+	}
+	if ok, err := q.RetryDead("1"); err != nil || ok {
+		t.Fatalf("expected job to not be dead anymore, got %v, %v", ok, err)
+	}
+	job, err = q.Dequeue(0)
+	if err != nil || job == nil || job.ID != "1" || job.Attempts != 1 {
+		t.Fatalf("unexpected job %+v, %v", job, err)
+	}
+	if err := q.Ack(job); err != nil {
+		t.Fatal(err)
+	}
+	st, err = q.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *st != (Stats{Scheduled: 1, Enqueued: 2, Processed: 1, Failed: 2, Retried: 1, DeadTotal: 1}) {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestQueueUnique(t *testing.T) {
+	q := integrationQueue(t)
+	if _, err := q.Enqueue(nil, &EnqueueOptions{Unique: "user:1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue(nil, &EnqueueOptions{Unique: "user:1"}); err != ErrDuplicate {
+		t.Fatalf("expected ErrDuplicate, got %v", err)
+	}
+	job, err := q.Dequeue(0)
+	if err != nil || job == nil {
+		t.Fatalf("expected a job, got %v", err)
+	}
+	if err := q.Ack(job); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue(nil, &EnqueueOptions{Unique: "user:1"}); err != nil {
+		t.Fatalf("expected unique key to be released, got %v", err)
+	}
+}
+
+func TestQueueOwnership(t *testing.T) {
+	q := integrationQueue(t)
+	q.VisibilityTimeout = time.Millisecond
+	if _, err := q.Enqueue([]byte("a"), nil); err != nil {
+		t.Fatal(err)
+	}
+	first, err := q.Dequeue(0)
+	if err != nil || first == nil {
+		t.Fatalf("expected a job, got %v", err)
+	}
+
+	// The deadline passes and the job goes to another worker
+	time.Sleep(10 * time.Millisecond)
+	q.VisibilityTimeout = time.Minute
+	if err := q.Maintain(); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Heartbeat(first); err != ErrNotOwner {
+		t.Fatalf("expected ErrNotOwner between deliveries, got %v", err)
+	}
+	second, err := q.Dequeue(0)
+	if err != nil || second == nil || second.ID != first.ID || second.Attempts != 2 {
+		t.Fatalf("expected the job again, got %+v, %v", second, err)
+	}
+
+	for name, err := range map[string]error{
+		"Heartbeat": q.Heartbeat(first),
+		"Ack":       q.Ack(first),
+		"Fail":      q.Fail(first, errors.New("late")),
+	} {
+		if err != ErrNotOwner {
+			t.Fatalf("expected %s of the first delivery to return ErrNotOwner, got %v", name, err)
+		}
+	}
+	st, err := q.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *st != (Stats{Active: 1, Enqueued: 1}) {
+		t.Fatalf("unexpected stats after late calls %+v", st)
+	}
+	if err := q.Heartbeat(second); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Ack(second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessLostJob(t *testing.T) {
+	q := integrationQueue(t)
+	q.VisibilityTimeout = 30 * time.Millisecond
+	if _, err := q.Enqueue([]byte("a"), nil); err != nil {
+		t.Fatal(err)
+	}
+	job, err := q.Dequeue(0)
+	if err != nil || job == nil {
+		t.Fatalf("expected a job, got %v", err)
+	}
+	err = q.process(context.Background(), job, func(ctx context.Context, job *Job) error {
+		// Another worker takes the job
+		if _, err := q.cli.Do("HINCRBY", q.keys.attempts, job.ID, 1); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+			return errors.New("handler wasn't canceled")
+		}
+	})
+	if err != ErrNotOwner {
+		t.Fatalf("expected ErrNotOwner, got %v", err)
+	}
+	st, err := q.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Failed != 0 || st.Processed != 0 || st.Active != 1 {
+		t.Fatalf("expected the job to be left to its new owner, got %+v", st)
+	}
+}
+
+func TestWork(t *testing.T) {
+	q := integrationQueue(t)
+	q.PollInterval = 10 * time.Millisecond
+	q.Backoff = func(int) time.Duration { return 0 }
+	// The ok job is retried until the others are dead
+	for p, maxRetries := range map[string]int{"fail": 1, "panic": 1, "ok": 100} {
+		if _, err := q.Enqueue([]byte(p), &EnqueueOptions{MaxRetries: &maxRetries}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	runs := make(map[string]int)
+	q.Work(ctx, 1, func(ctx context.Context, job *Job) error {
+		runs[string(job.Payload)]++
+		switch string(job.Payload) {
+		case "fail":
+			return errors.New("failed")
+		case "panic":
+			panic("oops")
+		}
+		if runs["fail"] < 2 || runs["panic"] < 2 {
+			return errors.New("not yet")
+		}
+		// Successful jobs are acknowledged even if ctx is done
+		cancel()
+		return nil
+	}, func(err error) { t.Error(err) })
+	if ctx.Err() != context.Canceled {
+		t.Fatalf("expected retries to be promoted by Maintain, got runs %v", runs)
+	}
+	st, err := q.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Processed != 1 || st.Dead != 2 || st.Active != 0 || st.Pending != 0 || st.Scheduled != 0 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
@@ -0,0 +1,446 @@
+// Package queue implements a job queue with at-least-once delivery.
+//
+// A queue named "mail" uses the following keys, all sharing the hash tag
+// of the name so they live on the same cluster slot:
+//
+//	queue:{mail}:jobs        hash of job ID to encoded job
+//	queue:{mail}:pending     list of IDs ready to run
+//	queue:{mail}:scheduled   sorted set of IDs by time to run (delays and retries)
+//	queue:{mail}:processing  list of IDs taken by workers
+//	queue:{mail}:active      sorted set of IDs by visibility deadline
+//	queue:{mail}:attempts    hash of ID to number of deliveries
+//	queue:{mail}:errors      hash of ID to the last error
+//	queue:{mail}:dead        list of IDs that exhausted their retries
+//	queue:{mail}:stats       hash of counters
+//	queue:{mail}:unique:<k>  ID of the queued job with unique key k
+//
+// Workers atomically move an ID from pending to processing and set a
+// visibility deadline which they extend while the job runs. Jobs of
+// crashed workers are returned to pending once their deadline passes so
+// a job may run more than once and handlers should be idempotent. A
+// worker owns a job until it's delivered again: heartbeats, Ack and Fail
+// from the previous delivery then return ErrNotOwner.
+package queue
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	mrand "math/rand"
+	"strconv"
+	"time"
+
+	"github.com/samuel/go-redis"
+)
+
+const (
+	DefaultPrefix            = "queue:"
+	DefaultVisibilityTimeout = 30 * time.Second
+	DefaultMaxRetries        = 5
+	DefaultPollInterval      = time.Second
+
+	maintenanceBatchSize = 100
+)
+
+var (
+	ErrDuplicate    = errors.New("queue: a job with the same unique key is queued")
+	ErrInvalidReply = errors.New("queue: invalid reply")
+	ErrNotOwner     = errors.New("queue: job was delivered again or removed")
+)
+
+type Job struct {
+	ID         string    `json:"id"`
+	Payload    []byte    `json:"payload"`
+	MaxRetries int       `json:"max_retries"`
+	Unique     string    `json:"unique,omitempty"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+
+	// Attempts is the number of times the job has been delivered
+	// including the current one.
+	Attempts int `json:"-"`
+
+	// LastError is the error of the previous attempt.
+	LastError string `json:"-"`
+}
+
+type EnqueueOptions struct {
+	// ID defaults to a random ID.
+	ID string
+
+	// Delay postpones the job.
+	Delay time.Duration
+
+	// MaxRetries overrides the queue's MaxRetries when not nil.
+	MaxRetries *int
+
+	// Unique prevents enqueueing another job with the same key until the
+	// job succeeds, is dead-lettered, or UniqueTTL passes.
+	Unique    string
+	UniqueTTL time.Duration
+}
+
+type Stats struct {
+	Pending   int64
+	Scheduled int64
+	Active    int64
+	Dead      int64
+
+	// Counters since the queue was created
+	Enqueued  int64
+	Processed int64
+	Failed    int64
+	Retried   int64
+	DeadTotal int64
+}
+
+type Queue struct {
+	// VisibilityTimeout is how long a job is invisible to other workers
+	// without a heartbeat before it's delivered again.
+	VisibilityTimeout time.Duration
+
+	// MaxRetries is the default number of retries after the first
+	// attempt before a job is moved to the dead-letter list.
+	MaxRetries int
+
+	// Backoff returns the delay before retrying after the given attempt.
+	Backoff func(attempt int) time.Duration
+
+	// PollInterval is how long workers block waiting for a job and how
+	// often scheduled and expired jobs are moved to pending.
+	PollInterval time.Duration
+
+	name string
+	cli  *redis.Client
+	keys struct {
+		jobs, pending, scheduled, processing, active, attempts, errors, dead, stats, unique string
+	}
+}
+
+func New(cli *redis.Client, name string) *Queue {
+	q := &Queue{
+		VisibilityTimeout: DefaultVisibilityTimeout,
+		MaxRetries:        DefaultMaxRetries,
+		Backoff:           DefaultBackoff,
+		PollInterval:      DefaultPollInterval,
+		name:              name,
+		cli:               cli,
+	}
+	p := DefaultPrefix + "{" + name + "}:"
+	q.keys.jobs = p + "jobs"
+	q.keys.pending = p + "pending"
+	q.keys.scheduled = p + "scheduled"
+	q.keys.processing = p + "processing"
+	q.keys.active = p + "active"
+	q.keys.attempts = p + "attempts"
+	q.keys.errors = p + "errors"
+	q.keys.dead = p + "dead"
+	q.keys.stats = p + "stats"
+	q.keys.unique = p + "unique:"
+	return q
+}
+
+// DefaultBackoff doubles the delay after every attempt starting at a
+// second up to an hour, jittered so retries spread out.
+func DefaultBackoff(attempt int) time.Duration {
+	d := time.Hour
+	if attempt < 13 {
+		d = min(time.Second<<(attempt-1), time.Hour)
+	}
+	return d/2 + time.Duration(mrand.Int63n(int64(d/2)+1))
+}
+
+func (q *Queue) Name() string {
+	return q.name
+}
+
+// Enqueue adds a job. It returns ErrDuplicate if opt.Unique is set and a
+// job with the same key is queued.
+func (q *Queue) Enqueue(payload []byte, opt *EnqueueOptions) (*Job, error) {
+	if opt == nil {
+		opt = &EnqueueOptions{}
+	}
+	job := &Job{
+		ID:         opt.ID,
+		Payload:    payload,
+		MaxRetries: q.MaxRetries,
+		Unique:     opt.Unique,
+		EnqueuedAt: time.Now(),
+	}
+	if opt.MaxRetries != nil {
+		job.MaxRetries = *opt.MaxRetries
+	}
+	if job.ID == "" {
+		var err error
+		if job.ID, err = newID(); err != nil {
+			return nil, err
+		}
+	}
+	b, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	if job.Unique != "" {
+		ok, err := q.cli.SetNX(q.keys.unique+job.Unique, []byte(job.ID), opt.UniqueTTL)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrDuplicate
+		}
+	}
+
+	cmds := [][]interface{}{
+		{"HSET", q.keys.jobs, job.ID, b},
+		{"HINCRBY", q.keys.stats, "enqueued", 1},
+	}
+	if opt.Delay > 0 {
+		cmds = append(cmds, []interface{}{"ZADD", q.keys.scheduled, timeMs(job.EnqueuedAt.Add(opt.Delay)), job.ID})
+	} else {
+		cmds = append(cmds, []interface{}{"LPUSH", q.keys.pending, job.ID})
+	}
+	if _, err := q.multi(cmds...); err != nil {
+		if job.Unique != "" {
+			q.cli.Do("DEL", q.keys.unique+job.Unique)
+		}
+		return nil, err
+	}
+	return job, nil
+}
+
+// Dequeue takes the next job, waiting up to timeout for one if the queue
+// is empty. It returns nil if there's no job. The job must be passed to
+// Ack or Fail before the visibility timeout, or extended with Heartbeat.
+func (q *Queue) Dequeue(timeout time.Duration) (*Job, error) {
+	r, err := q.cli.Do("LMOVE", q.keys.pending, q.keys.processing, "RIGHT", "LEFT")
+	if err == nil && r == nil && timeout > 0 {
+		r, err = q.cli.Do("BLMOVE", q.keys.pending, q.keys.processing, "RIGHT", "LEFT",
+			strconv.FormatFloat(timeout.Seconds(), 'f', -1, 64))
+	}
+	if err != nil || r == nil {
+		return nil, err
+	}
+	id, ok := r.([]byte)
+	if !ok {
+		return nil, ErrInvalidReply
+	}
+	// A crash before the deadline is set is recovered by Maintain
+	res, err := q.multi(
+		[]interface{}{"ZADD", q.keys.active, q.deadline(), id},
+		[]interface{}{"HINCRBY", q.keys.attempts, id, 1},
+		[]interface{}{"HGET", q.keys.jobs, id},
+		[]interface{}{"HGET", q.keys.errors, id},
+	)
+	if err != nil {
+		return nil, err
+	}
+	attempts, _ := res[1].(int64)
+	b, _ := res[2].([]byte)
+	if b == nil {
+		// The job was deleted
+		_, err := q.multi(
+			[]interface{}{"ZREM", q.keys.active, id},
+			[]interface{}{"LREM", q.keys.processing, 1, id},
+			[]interface{}{"HDEL", q.keys.attempts, id},
+		)
+		return nil, err
+	}
+	job := &Job{}
+	if err := json.Unmarshal(b, job); err != nil {
+		return nil, err
+	}
+	job.Attempts = int(attempts)
+	if e, ok := res[3].([]byte); ok {
+		job.LastError = string(e)
+	}
+	return job, nil
+}
+
+// Heartbeat extends the visibility deadline of a job being processed. It
+// returns ErrNotOwner if the job was delivered again or removed since it
+// was dequeued.
+func (q *Queue) Heartbeat(job *Job) error {
+	return owned(heartbeatScript.Run(q.cli, []string{q.keys.active, q.keys.attempts},
+		job.ID, job.Attempts, q.deadline()))
+}
+
+// Ack removes a job that was processed successfully. It returns
+// ErrNotOwner and leaves the job alone if it was delivered again or
+// removed since it was dequeued.
+func (q *Queue) Ack(job *Job) error {
+	keys := []string{q.keys.active, q.keys.attempts, q.keys.processing, q.keys.jobs, q.keys.errors, q.keys.stats}
+	if job.Unique != "" {
+		keys = append(keys, q.keys.unique+job.Unique)
+	}
+	return owned(ackScript.Run(q.cli, keys, job.ID, job.Attempts))
+}
+
+// Fail schedules a retry of a job after Backoff, or moves it to the
+// dead-letter list once it exhausted its retries. Like Ack it returns
+// ErrNotOwner if the job isn't owned by the caller anymore.
+func (q *Queue) Fail(job *Job, jobErr error) error {
+	msg := "unknown error"
+	if jobErr != nil {
+		msg = jobErr.Error()
+	}
+	keys := []string{q.keys.active, q.keys.attempts, q.keys.processing, q.keys.errors,
+		q.keys.stats, q.keys.scheduled, q.keys.dead}
+	retryAt := ""
+	if job.Attempts > job.MaxRetries {
+		if job.Unique != "" {
+			keys = append(keys, q.keys.unique+job.Unique)
+		}
+	} else {
+		retryAt = strconv.FormatInt(timeMs(time.Now().Add(q.Backoff(job.Attempts))), 10)
+	}
+	return owned(failScript.Run(q.cli, keys, job.ID, job.Attempts, msg, retryAt))
+}
+
+// owned converts the reply of an ownership checking script.
+func owned(r interface{}, err error) error {
+	if err != nil {
+		return err
+	}
+	if r != int64(1) {
+		return ErrNotOwner
+	}
+	return nil
+}
+
+// Maintain moves scheduled jobs that are due to pending and returns jobs
+// whose visibility deadline passed to pending. Workers call it every
+// PollInterval.
+func (q *Queue) Maintain() error {
+	now := timeMs(time.Now())
+	if _, err := promoteScript.Run(q.cli, []string{q.keys.scheduled, q.keys.pending}, now, maintenanceBatchSize); err != nil {
+		return err
+	}
+	_, err := requeueScript.Run(q.cli, []string{q.keys.active, q.keys.processing, q.keys.pending},
+		now, maintenanceBatchSize, timeMs(time.Now().Add(q.VisibilityTimeout)))
+	return err
+}
+
+// DeadJobs returns up to n jobs of the dead-letter list, most recent
+// first.
+func (q *Queue) DeadJobs(n int) ([]*Job, error) {
+	r, err := q.cli.Do("LRANGE", q.keys.dead, 0, n-1)
+	if err != nil {
+		return nil, err
+	}
+	ids, _ := r.([]interface{})
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	res, err := q.multi(append([]interface{}{"HMGET", q.keys.jobs}, ids...),
+		append([]interface{}{"HMGET", q.keys.errors}, ids...),
+		append([]interface{}{"HMGET", q.keys.attempts}, ids...))
+	if err != nil {
+		return nil, err
+	}
+	values, _ := res[0].([]interface{})
+	errs, _ := res[1].([]interface{})
+	attempts, _ := res[2].([]interface{})
+	if len(values) != len(ids) || len(errs) != len(ids) || len(attempts) != len(ids) {
+		return nil, ErrInvalidReply
+	}
+	jobs := make([]*Job, 0, len(ids))
+	for i, v := range values {
+		b, ok := v.([]byte)
+		if !ok {
+			continue
+		}
+		job := &Job{}
+		if err := json.Unmarshal(b, job); err != nil {
+			return nil, err
+		}
+		if e, ok := errs[i].([]byte); ok {
+			job.LastError = string(e)
+		}
+		if a, ok := attempts[i].([]byte); ok {
+			job.Attempts, _ = strconv.Atoi(string(a))
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// RetryDead moves a job from the dead-letter list back to pending with
+// its attempts reset. It returns false if the job isn't dead.
+func (q *Queue) RetryDead(id string) (bool, error) {
+	r, err := retryDeadScript.Run(q.cli, []string{q.keys.dead, q.keys.pending, q.keys.attempts}, id)
+	return r == int64(1), err
+}
+
+func (q *Queue) Stats() (*Stats, error) {
+	res, err := q.multi(
+		[]interface{}{"LLEN", q.keys.pending},
+		[]interface{}{"ZCARD", q.keys.scheduled},
+		[]interface{}{"ZCARD", q.keys.active},
+		[]interface{}{"LLEN", q.keys.dead},
+		[]interface{}{"HMGET", q.keys.stats, "enqueued", "processed", "failed", "retried", "dead"},
+	)
+	if err != nil {
+		return nil, err
+	}
+	st := &Stats{}
+	for i, p := range []*int64{&st.Pending, &st.Scheduled, &st.Active, &st.Dead} {
+		*p, _ = res[i].(int64)
+	}
+	counters, _ := res[4].([]interface{})
+	for i, p := range []*int64{&st.Enqueued, &st.Processed, &st.Failed, &st.Retried, &st.DeadTotal} {
+		if i < len(counters) {
+			if b, ok := counters[i].([]byte); ok {
+				*p, _ = strconv.ParseInt(string(b), 10, 64)
+			}
+		}
+	}
+	return st, nil
+}
+
+// multi runs commands in a transaction and returns the reply of EXEC.
+func (q *Queue) multi(cmds ...[]interface{}) ([]interface{}, error) {
+	p, err := q.cli.Pipeline()
+	if err != nil {
+		return nil, err
+	}
+	p.Do("MULTI")
+	for _, c := range cmds {
+		p.Do(c[0].(string), c[1:]...)
+	}
+	exec := p.Do("EXEC")
+	replies, err := p.Flush()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range replies {
+		if err := r.Err(); err != nil {
+			return nil, err
+		}
+	}
+	res, ok := exec.Value().([]interface{})
+	if !ok || len(res) != len(cmds) {
+		return nil, ErrInvalidReply
+	}
+	for _, v := range res {
+		if err, ok := v.(error); ok {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (q *Queue) deadline() int64 {
+	return timeMs(time.Now().Add(q.VisibilityTimeout))
+}
+
+func timeMs(t time.Time) int64 {
+	return t.UnixMilli()
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,65 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samuel/go-redis"
+	"github.com/samuel/go-redis/redistest"
+)
+
+// Ack, Fail, Heartbeat and Maintain run scripts which the test server
+// doesn't support and are covered by the integration tests.
+
+func newTestQueue(t *testing.T) *Queue {
+	s := redistest.NewServer()
+	t.Cleanup(s.Close)
+	cli := redis.NewClient("tcp", s.Addr())
+	t.Cleanup(func() { cli.Close() })
+	q := New(cli, "test")
+	q.Backoff = func(int) time.Duration { return time.Minute }
+	return q
+}
+
+func TestEnqueueDequeue(t *testing.T) {
+	q := newTestQueue(t)
+	maxRetries := 1
+	if _, err := q.Enqueue([]byte("a"), &EnqueueOptions{ID: "1", MaxRetries: &maxRetries}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue([]byte("b"), &EnqueueOptions{ID: "2", Delay: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue(nil, &EnqueueOptions{ID: "3", Unique: "user:1", Delay: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue(nil, &EnqueueOptions{Unique: "user:1"}); err != ErrDuplicate {
+		t.Fatalf("expected ErrDuplicate, got %v", err)
+	}
+
+	job, err := q.Dequeue(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil || job.ID != "1" || string(job.Payload) != "a" || job.Attempts != 1 || job.MaxRetries != 1 {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if job, err := q.Dequeue(0); err != nil || job != nil {
+		t.Fatalf("expected no ready job, got %+v, %v", job, err)
+	}
+	st, err := q.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *st != (Stats{Scheduled: 2, Active: 1, Enqueued: 3}) {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestDefaultBackoff(t *testing.T) {
+	for attempt, max := range map[int]time.Duration{1: time.Second, 3: 4 * time.Second, 20: time.Hour, 100: time.Hour} {
+		if d := DefaultBackoff(attempt); d < max/2 || d > max {
+			t.Errorf("attempt %d: expected delay in [%s, %s], got %s", attempt, max/2, max, d)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package queue
+
+import "github.com/samuel/go-redis"
+
+var (
+	// KEYS scheduled, pending; ARGV now, limit
+	promoteScript = redis.NewScript(`
+		local ids = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+		if #ids > 0 then
+			redis.call("ZREM", KEYS[1], unpack(ids))
+			redis.call("LPUSH", KEYS[2], unpack(ids))
+		end
+		return #ids`)
+
+	// KEYS active, processing, pending; ARGV now, limit, deadline
+	//
+	// Jobs past their deadline go back to the front of pending. Jobs in
+	// processing without a deadline were taken by a worker that died
+	// before setting it, or are about to get one, so they're given a
+	// deadline to be requeued later if nobody claims them.
+	requeueScript = redis.NewScript(`
+		local ids = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+		for _, id in ipairs(ids) do
+			redis.call("ZREM", KEYS[1], id)
+			redis.call("LREM", KEYS[2], 1, id)
+			redis.call("RPUSH", KEYS[3], id)
+		end
+		for _, id in ipairs(redis.call("LRANGE", KEYS[2], 0, -1)) do
+			if not redis.call("ZSCORE", KEYS[1], id) then
+				redis.call("ZADD", KEYS[1], ARGV[3], id)
+			end
+		end
+		return #ids`)
+
+	// KEYS active, attempts; ARGV id, attempts, deadline
+	//
+	// A job is owned by the worker that took it as long as it's active and
+	// hasn't been delivered again since, which bumps its attempts.
+	heartbeatScript = redis.NewScript(`
+		if not redis.call("ZSCORE", KEYS[1], ARGV[1]) or redis.call("HGET", KEYS[2], ARGV[1]) ~= ARGV[2] then
+			return 0
+		end
+		redis.call("ZADD", KEYS[1], "XX", ARGV[3], ARGV[1])
+		return 1`)
+
+	// KEYS active, attempts, processing, jobs, errors, stats[, unique];
+	// ARGV id, attempts
+	ackScript = redis.NewScript(`
+		if not redis.call("ZSCORE", KEYS[1], ARGV[1]) or redis.call("HGET", KEYS[2], ARGV[1]) ~= ARGV[2] then
+			return 0
+		end
+		redis.call("ZREM", KEYS[1], ARGV[1])
+		redis.call("LREM", KEYS[3], 1, ARGV[1])
+		redis.call("HDEL", KEYS[4], ARGV[1])
+		redis.call("HDEL", KEYS[2], ARGV[1])
+		redis.call("HDEL", KEYS[5], ARGV[1])
+		redis.call("HINCRBY", KEYS[6], "processed", 1)
+		if KEYS[7] then
+			redis.call("DEL", KEYS[7])
+		end
+		return 1`)
+
+	// KEYS active, attempts, processing, errors, stats, scheduled, dead[, unique];
+	// ARGV id, attempts, error, time to retry or "" to dead-letter
+	failScript = redis.NewScript(`
+		if not redis.call("ZSCORE", KEYS[1], ARGV[1]) or redis.call("HGET", KEYS[2], ARGV[1]) ~= ARGV[2] then
+			return 0
+		end
+		redis.call("ZREM", KEYS[1], ARGV[1])
+		redis.call("LREM", KEYS[3], 1, ARGV[1])
+		redis.call("HSET", KEYS[4], ARGV[1], ARGV[3])
+		redis.call("HINCRBY", KEYS[5], "failed", 1)
+		if ARGV[4] == "" then
+			redis.call("LPUSH", KEYS[7], ARGV[1])
+			redis.call("HINCRBY", KEYS[5], "dead", 1)
+			if KEYS[8] then
+				redis.call("DEL", KEYS[8])
+			end
+		else
+			redis.call("ZADD", KEYS[6], ARGV[4], ARGV[1])
+			redis.call("HINCRBY", KEYS[5], "retried", 1)
+		end
+		return 1`)
+
+	// KEYS dead, pending, attempts; ARGV id
+	retryDeadScript = redis.NewScript(`
+		if redis.call("LREM", KEYS[1], 1, ARGV[1]) == 0 then
+			return 0
+		end
+		redis.call("HDEL", KEYS[3], ARGV[1])
+		redis.call("LPUSH", KEYS[2], ARGV[1])
+		return 1`)
+)
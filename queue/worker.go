@@ -0,0 +1,121 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Handler processes a job. Returning an error retries the job.
+type Handler func(ctx context.Context, job *Job) error
+
+// Work runs concurrency workers processing jobs with h until ctx is done,
+// and waits for the running handlers to return. Jobs interrupted by ctx
+// are neither acknowledged nor failed and are delivered again after the
+// visibility timeout. Errors talking to the server are passed to onError
+// if not nil and the worker retries after PollInterval. A job that's
+// delivered again while its handler runs has the handler's context
+// canceled and ErrNotOwner passed to onError.
+func (q *Queue) Work(ctx context.Context, concurrency int, h Handler, onError func(error)) {
+	report := func(err error) {
+		if onError != nil {
+			onError(err)
+		}
+	}
+	sleep := func() {
+		t := time.NewTimer(q.PollInterval)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+		case <-t.C:
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for ctx.Err() == nil {
+			if err := q.Maintain(); err != nil {
+				report(err)
+			}
+			sleep()
+		}
+	}()
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				job, err := q.Dequeue(q.PollInterval)
+				if err != nil {
+					report(err)
+					sleep()
+					continue
+				}
+				if job != nil {
+					if err := q.process(ctx, job, h); err != nil {
+						report(err)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// process runs a job while extending its deadline and acknowledges or
+// fails it with the outcome.
+func (q *Queue) process(ctx context.Context, job *Job, h Handler) error {
+	// Delivered again after a crash or timeouts with no retry left
+	if job.Attempts > job.MaxRetries+1 {
+		return q.Fail(job, fmt.Errorf("queue: job timed out %d times", job.Attempts-1))
+	}
+
+	// The handler is canceled once the job was delivered again
+	hctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	defer close(done)
+	lost := make(chan struct{})
+	go func() {
+		t := time.NewTicker(q.VisibilityTimeout / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if q.Heartbeat(job) == ErrNotOwner {
+					close(lost)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	err := q.run(hctx, job, h)
+	select {
+	case <-lost:
+		return ErrNotOwner
+	default:
+	}
+	if err == nil {
+		return q.Ack(job)
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return q.Fail(job, err)
+}
+
+func (q *Queue) run(ctx context.Context, job *Job, h Handler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("queue: handler panic: %v", r)
+		}
+	}()
+	return h(ctx, job)
+}
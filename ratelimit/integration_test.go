@@ -0,0 +1,78 @@
+//go:build integration
+
+package ratelimit
+
+import (
+	"os"
+	"testing"
+
+	"github.com/samuel/go-redis"
+)
+
+// The integration tests run the scripts on the Redis server at
+// $REDIS_ADDR (127.0.0.1:6379 by default):
+//
+//	go test -tags integration ./ratelimit
+
+func integrationClient(t *testing.T) *redis.Client {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "127.0.0.1:6379"
+	}
+	cli := redis.NewClient("tcp", addr)
+	t.Cleanup(func() { cli.Close() })
+	if err := cli.Ping(); err != nil {
+		t.Fatalf("no Redis server at %s: %v", addr, err)
+	}
+	return cli
+}
+
+func TestLimitersIntegration(t *testing.T) {
+	cli := integrationClient(t)
+	for name, newLimiter := range map[string]func(*redis.Client, Limit) *Limiter{
+		"gcra":          NewGCRA,
+		"slidinglog":    NewSlidingLog,
+		"fixedwindow":   NewFixedWindow,
+		"slidingwindow": NewSlidingWindow,
+	} {
+		t.Run(name, func(t *testing.T) {
+			l := newLimiter(cli, PerHour(3))
+			l.Prefix = "ratelimit-test:"
+			const key = "key"
+			if err := l.Reset(key); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { l.Reset(key) })
+
+			for i := int64(2); i >= 0; i-- {
+				r, err := l.Allow(key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !r.Allowed || r.Remaining != i || r.RetryAfter != 0 || r.ResetAfter <= 0 {
+					t.Fatalf("request %d: unexpected result %+v", 3-i, r)
+				}
+			}
+			r, err := l.Allow(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Allowed || r.Remaining != 0 || r.RetryAfter <= 0 {
+				t.Fatalf("request over the limit: unexpected result %+v", r)
+			}
+			if r, err := l.AllowN(key, 4); err != nil || r.Allowed || r.RetryAfter != -1 {
+				t.Fatalf("request larger than the limit: unexpected result %+v, %v", r, err)
+			}
+			if r, err := l.Peek(key); err != nil || r.Remaining != 0 {
+				t.Fatalf("Peek: unexpected result %+v, %v", r, err)
+			}
+
+			if err := l.Reset(key); err != nil {
+				t.Fatal(err)
+			}
+			if r, err := l.AllowN(key, 3); err != nil || !r.Allowed || r.Remaining != 0 {
+				t.Fatalf("request after reset: unexpected result %+v, %v", r, err)
+			}
+		})
+	}
+}
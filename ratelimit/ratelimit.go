@@ -0,0 +1,211 @@
+// Package ratelimit implements rate limiters stored in Redis. Every check
+// is a single Lua script so concurrent clients can't race between reading
+// and updating the counters, and time is taken from the server so client
+// clocks don't need to agree.
+//
+// Four algorithms are available:
+//
+//   - GCRA (generic cell rate algorithm) is a token bucket refilled at
+//     Rate per Period holding up to Burst requests. It stores a single
+//     timestamp per key.
+//   - Sliding log stores the time of every request in a sorted set. It's
+//     exact but uses memory proportional to Rate.
+//   - Fixed window counts requests in windows of Period aligned on the
+//     server clock. Up to twice the rate can pass around a boundary.
+//   - Sliding window weights the count of the previous window by how much
+//     of it overlaps the last Period which approximates a sliding log
+//     with two counters.
+package ratelimit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/samuel/go-redis"
+)
+
+const DefaultPrefix = "ratelimit:"
+
+var (
+	ErrInvalidLimit = errors.New("ratelimit: rate, period and burst must be positive")
+	ErrInvalidCount = errors.New("ratelimit: number of requests must be positive")
+	ErrInvalidReply = errors.New("ratelimit: invalid reply from script")
+)
+
+// Limit is a number of requests allowed per period.
+type Limit struct {
+	Rate   int
+	Period time.Duration
+
+	// Burst is the number of requests that can be made at once. It's only
+	// used by GCRA and defaults to Rate.
+	Burst int
+}
+
+func PerSecond(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Second, Burst: rate}
+}
+
+func PerMinute(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Minute, Burst: rate}
+}
+
+func PerHour(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Hour, Burst: rate}
+}
+
+// Result is the outcome of a check.
+type Result struct {
+	Allowed bool
+
+	// Remaining is the number of requests that would be allowed right
+	// after this one.
+	Remaining int64
+
+	// RetryAfter is how long to wait before the same request is allowed.
+	// It's zero when allowed and -1 when the request can never be
+	// allowed because it's larger than the limit.
+	RetryAfter time.Duration
+
+	// ResetAfter is how long until the limiter is back to its initial
+	// state for the key.
+	ResetAfter time.Duration
+}
+
+type Limiter struct {
+	// Prefix is prepended to keys.
+	Prefix string
+
+	cli    *redis.Client
+	script *redis.Script
+	args   argsFunc
+	limit  Limit
+}
+
+// argsFunc returns the arguments of a script to check n requests.
+type argsFunc func(limit Limit, n int) ([]interface{}, error)
+
+func newLimiter(cli *redis.Client, script *redis.Script, args argsFunc, limit Limit) *Limiter {
+	if limit.Burst == 0 {
+		limit.Burst = limit.Rate
+	}
+	return &Limiter{
+		Prefix: DefaultPrefix,
+		cli:    cli,
+		script: script,
+		args:   args,
+		limit:  limit,
+	}
+}
+
+func NewGCRA(cli *redis.Client, limit Limit) *Limiter {
+	return newLimiter(cli, gcraScript, limitArgs, limit)
+}
+
+func NewSlidingLog(cli *redis.Client, limit Limit) *Limiter {
+	return newLimiter(cli, slidingLogScript, slidingLogArgs, limit)
+}
+
+func NewFixedWindow(cli *redis.Client, limit Limit) *Limiter {
+	return newLimiter(cli, fixedWindowScript, limitArgs, limit)
+}
+
+func NewSlidingWindow(cli *redis.Client, limit Limit) *Limiter {
+	return newLimiter(cli, slidingWindowScript, limitArgs, limit)
+}
+
+func limitArgs(limit Limit, n int) ([]interface{}, error) {
+	return []interface{}{limit.Rate, limit.Period.Microseconds(), limit.Burst, n}, nil
+}
+
+// slidingLogArgs adds a random token that makes sorted set members unique
+// across clients.
+func slidingLogArgs(limit Limit, n int) ([]interface{}, error) {
+	token, err := requestToken()
+	if err != nil {
+		return nil, err
+	}
+	args, _ := limitArgs(limit, n)
+	return append(args, token), nil
+}
+
+func (l *Limiter) Limit() Limit {
+	return l.limit
+}
+
+func (l *Limiter) Allow(key string) (*Result, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN checks whether n requests are allowed and counts them if so. A
+// denied request isn't counted.
+func (l *Limiter) AllowN(key string, n int) (*Result, error) {
+	if n <= 0 {
+		return nil, ErrInvalidCount
+	}
+	return l.run(key, n)
+}
+
+// Peek returns the state of the limiter for key without counting a
+// request.
+func (l *Limiter) Peek(key string) (*Result, error) {
+	return l.run(key, 0)
+}
+
+func (l *Limiter) run(key string, n int) (*Result, error) {
+	if l.limit.Rate <= 0 || l.limit.Period <= 0 || l.limit.Burst <= 0 {
+		return nil, ErrInvalidLimit
+	}
+	args, err := l.args(l.limit, n)
+	if err != nil {
+		return nil, err
+	}
+	r, err := l.script.Run(l.cli, []string{l.Prefix + key}, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseResult(r)
+}
+
+// Reset forgets the requests made for key.
+func (l *Limiter) Reset(key string) error {
+	_, err := l.cli.Do("DEL", l.Prefix+key)
+	return err
+}
+
+// parseResult converts the reply of the scripts which is
+// {allowed, remaining, retry_after, reset_after} with durations in
+// microseconds.
+func parseResult(r interface{}) (*Result, error) {
+	a, ok := r.([]interface{})
+	if !ok || len(a) != 4 {
+		return nil, ErrInvalidReply
+	}
+	var v [4]int64
+	for i, x := range a {
+		if v[i], ok = x.(int64); !ok {
+			return nil, ErrInvalidReply
+		}
+	}
+	res := &Result{
+		Allowed:    v[0] == 1,
+		Remaining:  v[1],
+		RetryAfter: time.Duration(v[2]) * time.Microsecond,
+		ResetAfter: time.Duration(v[3]) * time.Microsecond,
+	}
+	if v[2] < 0 {
+		res.RetryAfter = -1
+	}
+	return res, nil
+}
+
+// requestToken makes sorted set members unique across clients.
+func requestToken() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
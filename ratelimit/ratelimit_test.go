@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-redis"
+)
+
+// startServer returns a client connected to a server that doesn't know
+// any script and replies to EVAL with reply.
+func startServer(t *testing.T, reply interface{}, evals chan<- []string) *redis.Client {
+	srv := redis.NewServer()
+	srv.HandleFunc("evalsha", func(ctx context.Context, conn *redis.ServerConn, args [][]byte) {
+		conn.WriteError("NOSCRIPT No matching script. Please use EVAL.")
+	})
+	srv.HandleFunc("eval", func(ctx context.Context, conn *redis.ServerConn, args [][]byte) {
+		a := make([]string, len(args)-2)
+		for i, b := range args[2:] {
+			a[i] = string(b)
+		}
+		evals <- a
+		conn.WriteReply(reply)
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	cli := redis.NewClient("tcp", l.Addr().String())
+	t.Cleanup(func() { cli.Close() })
+	return cli
+}
+
+func TestLimiter(t *testing.T) {
+	evals := make(chan []string, 1)
+	cli := startServer(t, []interface{}{int64(0), int64(2), int64(1500), int64(250000)}, evals)
+
+	l := NewSlidingLog(cli, Limit{Rate: 10, Period: time.Minute})
+	l.Prefix = "rl:"
+	r, err := l.AllowN("user:1", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Allowed || r.Remaining != 2 || r.RetryAfter != 1500*time.Microsecond || r.ResetAfter != 250*time.Millisecond {
+		t.Fatalf("unexpected result %+v", r)
+	}
+	args := <-evals
+	// numkeys, key, rate, period, burst, n, token
+	if len(args) != 7 || strings.Join(args[:6], " ") != "1 rl:user:1 10 60000000 10 3" || len(args[6]) != 16 {
+		t.Fatalf("unexpected arguments %q", args)
+	}
+
+	l = NewFixedWindow(cli, PerSecond(5))
+	if _, err := l.Peek("user:1"); err != nil {
+		t.Fatal(err)
+	}
+	// numkeys, key, rate, period, burst, n
+	if args := <-evals; strings.Join(args, " ") != "1 ratelimit:user:1 5 1000000 5 0" {
+		t.Fatalf("unexpected arguments %q", args)
+	}
+	for _, n := range []int{0, -1} {
+		if _, err := l.AllowN("user:1", n); err != ErrInvalidCount {
+			t.Fatalf("AllowN(%d): expected ErrInvalidCount, got %v", n, err)
+		}
+	}
+
+	if _, err := NewGCRA(cli, Limit{Rate: 10}).Allow("user:1"); err != ErrInvalidLimit {
+		t.Fatalf("expected ErrInvalidLimit, got %v", err)
+	}
+}
+
+func TestParseResult(t *testing.T) {
+	r, err := parseResult([]interface{}{int64(1), int64(4), int64(0), int64(1000000)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Allowed || r.Remaining != 4 || r.RetryAfter != 0 || r.ResetAfter != time.Second {
+		t.Fatalf("unexpected result %+v", r)
+	}
+	r, err = parseResult([]interface{}{int64(0), int64(0), int64(-1), int64(0)})
+	if err != nil || r.RetryAfter != -1 {
+		t.Fatalf("expected RetryAfter -1, got %+v, %v", r, err)
+	}
+	for _, reply := range []interface{}{nil, []interface{}{int64(1)}, []interface{}{int64(1), "a", int64(0), int64(0)}} {
+		if _, err := parseResult(reply); err != ErrInvalidReply {
+			t.Errorf("%v: expected ErrInvalidReply, got %v", reply, err)
+		}
+	}
+}
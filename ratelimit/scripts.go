@@ -0,0 +1,155 @@
+package ratelimit
+
+import "github.com/samuel/go-redis"
+
+// The scripts take KEYS[1] and ARGV rate, period (in microseconds), burst
+// and n, followed by a random token for the sliding log. They return
+// {allowed, remaining, retry_after, reset_after} with durations in
+// microseconds.
+
+const scriptPrelude = `
+	if redis.replicate_commands then
+		redis.replicate_commands()
+	end
+	local t = redis.call("TIME")
+	local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+	local rate = tonumber(ARGV[1])
+	local period = tonumber(ARGV[2])
+	local burst = tonumber(ARGV[3])
+	local n = tonumber(ARGV[4])
+	-- tostring uses an exponent for large numbers
+	local function fmt(x)
+		return string.format("%.0f", x)
+	end
+	local function ms(us)
+		return math.max(1, math.ceil(us / 1000))
+	end
+`
+
+var (
+	// The key holds the theoretical arrival time (TAT) of the next
+	// request. A request is allowed if the TAT isn't more than burst
+	// emission intervals in the future.
+	gcraScript = redis.NewScript(scriptPrelude + `
+	local interval = period / rate
+	local dvt = interval * burst
+	local tat = tonumber(redis.call("GET", KEYS[1]) or 0)
+	if tat < now then
+		tat = now
+	end
+	local new_tat = tat + interval * n
+	local diff = now - (new_tat - dvt)
+	if diff < 0 then
+		local retry = -diff
+		if n > burst then
+			retry = -1
+		end
+		local remaining = math.max(0, math.floor((now - (tat - dvt)) / interval + 1e-6))
+		return {0, remaining, math.ceil(retry), math.ceil(tat - now)}
+	end
+	if n > 0 then
+		redis.call("SET", KEYS[1], fmt(new_tat), "PX", ms(new_tat - now))
+	end
+	return {1, math.floor(diff / interval + 1e-6), 0, math.ceil(new_tat - now)}`)
+
+	// The key is a sorted set of requests scored by time.
+	slidingLogScript = redis.NewScript(scriptPrelude + `
+	local function reset()
+		local last = redis.call("ZRANGE", KEYS[1], -1, -1, "WITHSCORES")
+		if #last == 0 then
+			return 0
+		end
+		return tonumber(last[2]) + period - now
+	end
+	redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", fmt(now - period))
+	local count = redis.call("ZCARD", KEYS[1])
+	if count + n > rate then
+		local retry = -1
+		if n <= rate then
+			-- Wait for enough of the oldest requests to expire
+			local i = count + n - rate - 1
+			local e = redis.call("ZRANGE", KEYS[1], i, i, "WITHSCORES")
+			retry = tonumber(e[2]) + period - now
+		end
+		return {0, math.max(0, rate - count), retry, reset()}
+	end
+	for i = 1, n do
+		redis.call("ZADD", KEYS[1], fmt(now), fmt(now) .. ":" .. ARGV[5] .. ":" .. i)
+	end
+	if n > 0 then
+		redis.call("PEXPIRE", KEYS[1], ms(period))
+	end
+	return {1, rate - count - n, 0, reset()}`)
+
+	// The key is a hash of the window index (w) and its count (c). The
+	// index protects from counting in the wrong window if the key
+	// expires late.
+	fixedWindowScript = redis.NewScript(scriptPrelude + `
+	local idx = math.floor(now / period)
+	local h = redis.call("HMGET", KEYS[1], "w", "c")
+	local count = 0
+	if tonumber(h[1]) == idx then
+		count = tonumber(h[2]) or 0
+	end
+	local reset = (idx + 1) * period - now
+	if count + n > rate then
+		local retry = reset
+		if n > rate then
+			retry = -1
+		end
+		return {0, math.max(0, rate - count), retry, reset}
+	end
+	if n > 0 then
+		redis.call("HSET", KEYS[1], "w", fmt(idx), "c", count + n)
+		redis.call("PEXPIRE", KEYS[1], ms(reset))
+	end
+	if count + n == 0 then
+		reset = 0
+	end
+	return {1, rate - count - n, 0, reset}`)
+
+	// The key is a hash of the current window index (w), its count (c)
+	// and the count of the previous window (p). The count of the last
+	// period is estimated as p weighted by the part of the previous
+	// window still in the period, plus c.
+	slidingWindowScript = redis.NewScript(scriptPrelude + `
+	local idx = math.floor(now / period)
+	local h = redis.call("HMGET", KEYS[1], "w", "c", "p")
+	local w = tonumber(h[1])
+	local cur, prev = 0, 0
+	if w == idx then
+		cur, prev = tonumber(h[2]) or 0, tonumber(h[3]) or 0
+	elseif w == idx - 1 then
+		prev = tonumber(h[2]) or 0
+	end
+	local elapsed = now - idx * period
+	local count = prev * (period - elapsed) / period + cur
+	local function reset(c)
+		if c > 0 then
+			return math.ceil(2 * period - elapsed)
+		elseif prev > 0 then
+			return math.ceil(period - elapsed)
+		end
+		return 0
+	end
+	if count + n > rate then
+		local retry = -1
+		if n <= rate then
+			if cur + n <= rate then
+				-- Wait for the previous window to weigh less
+				retry = period * (1 - (rate - cur - n) / prev) - elapsed
+			else
+				-- Wait for the next window where the current one is
+				-- the previous
+				retry = period - elapsed + period * (1 - (rate - n) / cur)
+			end
+			retry = math.ceil(retry)
+		end
+		return {0, math.max(0, math.floor(rate - count + 1e-6)), retry, reset(cur)}
+	end
+	if n > 0 then
+		redis.call("HSET", KEYS[1], "w", fmt(idx), "c", cur + n, "p", prev)
+		redis.call("PEXPIRE", KEYS[1], ms(2 * period - elapsed))
+	end
+	return {1, math.max(0, math.floor(rate - count - n + 1e-6)), 0, reset(cur + n)}`)
+)
@@ -0,0 +1,338 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"strconv"
+)
+
+// Compact encodings stored as strings in the RDB file.
+
+// parseZiplist decodes a ziplist used for small lists, hashes and sorted
+// sets before Redis 7.
+func parseZiplist(b []byte) ([][]byte, error) {
+	if len(b) < 11 {
+		return nil, ErrInvalidEncoding
+	}
+	n := int(binary.LittleEndian.Uint16(b[8:10]))
+	items := make([][]byte, 0, n)
+	b = b[10:]
+	for {
+		if len(b) == 0 {
+			return nil, ErrInvalidEncoding
+		}
+		if b[0] == 0xff {
+			return items, nil
+		}
+		// Skip the length of the previous entry
+		if b[0] < 254 {
+			b = b[1:]
+		} else if len(b) >= 5 {
+			b = b[5:]
+		} else {
+			return nil, ErrInvalidEncoding
+		}
+		if len(b) == 0 {
+			return nil, ErrInvalidEncoding
+		}
+
+		var (
+			v      []byte
+			header = b[0]
+			size   int
+			length = -1
+		)
+		switch header >> 6 {
+		case 0:
+			length, size = int(header&0x3f), 1
+		case 1:
+			if len(b) < 2 {
+				return nil, ErrInvalidEncoding
+			}
+			length, size = int(header&0x3f)<<8|int(b[1]), 2
+		case 2:
+			if len(b) < 5 {
+				return nil, ErrInvalidEncoding
+			}
+			length, size = int(binary.BigEndian.Uint32(b[1:5])), 5
+		}
+		if length >= 0 {
+			if length > len(b)-size {
+				return nil, ErrInvalidEncoding
+			}
+			v = append([]byte(nil), b[size:size+length]...)
+			b = b[size+length:]
+		} else {
+			var i int64
+			switch header {
+			case 0xc0:
+				if len(b) < 3 {
+					return nil, ErrInvalidEncoding
+				}
+				i, size = int64(int16(binary.LittleEndian.Uint16(b[1:]))), 3
+			case 0xd0:
+				if len(b) < 5 {
+					return nil, ErrInvalidEncoding
+				}
+				i, size = int64(int32(binary.LittleEndian.Uint32(b[1:]))), 5
+			case 0xe0:
+				if len(b) < 9 {
+					return nil, ErrInvalidEncoding
+				}
+				i, size = int64(binary.LittleEndian.Uint64(b[1:])), 9
+			case 0xf0:
+				if len(b) < 4 {
+					return nil, ErrInvalidEncoding
+				}
+				// 24 bit integer shifted to the top to sign extend it
+				i, size = int64(int32(uint32(b[1])<<8|uint32(b[2])<<16|uint32(b[3])<<24)>>8), 4
+			case 0xfe:
+				if len(b) < 2 {
+					return nil, ErrInvalidEncoding
+				}
+				i, size = int64(int8(b[1])), 2
+			default:
+				if header < 0xf1 || header > 0xfd {
+					return nil, ErrInvalidEncoding
+				}
+				i, size = int64(header&0x0f)-1, 1
+			}
+			v = strconv.AppendInt(nil, i, 10)
+			b = b[size:]
+		}
+		items = append(items, v)
+	}
+}
+
+// parseListpack decodes a listpack used for small lists, hashes, sets and
+// sorted sets since Redis 7.
+func parseListpack(b []byte) ([][]byte, error) {
+	if len(b) < 7 {
+		return nil, ErrInvalidEncoding
+	}
+	n := int(binary.LittleEndian.Uint16(b[4:6]))
+	items := make([][]byte, 0, n)
+	b = b[6:]
+	for {
+		if len(b) == 0 {
+			return nil, ErrInvalidEncoding
+		}
+		header := b[0]
+		if header == 0xff {
+			return items, nil
+		}
+
+		var (
+			v      []byte
+			size   int
+			length = -1
+			i      int64
+		)
+		switch {
+		case header&0x80 == 0:
+			i, size = int64(header&0x7f), 1
+		case header&0xc0 == 0x80:
+			length, size = int(header&0x3f), 1
+		case header&0xe0 == 0xc0:
+			if len(b) < 2 {
+				return nil, ErrInvalidEncoding
+			}
+			u := int64(header&0x1f)<<8 | int64(b[1])
+			if u >= 1<<12 {
+				u -= 1 << 13
+			}
+			i, size = u, 2
+		case header&0xf0 == 0xe0:
+			if len(b) < 2 {
+				return nil, ErrInvalidEncoding
+			}
+			length, size = int(header&0x0f)<<8|int(b[1]), 2
+		case header == 0xf0:
+			if len(b) < 5 {
+				return nil, ErrInvalidEncoding
+			}
+			length, size = int(binary.LittleEndian.Uint32(b[1:5])), 5
+		case header == 0xf1:
+			if len(b) < 3 {
+				return nil, ErrInvalidEncoding
+			}
+			i, size = int64(int16(binary.LittleEndian.Uint16(b[1:]))), 3
+		case header == 0xf2:
+			if len(b) < 4 {
+				return nil, ErrInvalidEncoding
+			}
+			i, size = int64(int32(uint32(b[1])<<8|uint32(b[2])<<16|uint32(b[3])<<24)>>8), 4
+		case header == 0xf3:
+			if len(b) < 5 {
+				return nil, ErrInvalidEncoding
+			}
+			i, size = int64(int32(binary.LittleEndian.Uint32(b[1:]))), 5
+		case header == 0xf4:
+			if len(b) < 9 {
+				return nil, ErrInvalidEncoding
+			}
+			i, size = int64(binary.LittleEndian.Uint64(b[1:])), 9
+		default:
+			return nil, ErrInvalidEncoding
+		}
+		if length >= 0 {
+			if length > len(b)-size {
+				return nil, ErrInvalidEncoding
+			}
+			v = append([]byte(nil), b[size:size+length]...)
+			size += length
+		} else {
+			v = strconv.AppendInt(nil, i, 10)
+		}
+		// Skip the entry and its back length
+		size += backlenSize(size)
+		if size > len(b) {
+			return nil, ErrInvalidEncoding
+		}
+		b = b[size:]
+		items = append(items, v)
+	}
+}
+
+// backlenSize returns the number of bytes used to store the length of an
+// entry at its end.
+func backlenSize(l int) int {
+	switch {
+	case l <= 127:
+		return 1
+	case l < 16383:
+		return 2
+	case l < 2097151:
+		return 3
+	case l < 268435455:
+		return 4
+	}
+	return 5
+}
+
+// parseIntset decodes a sorted array of integers used for small sets of
+// integers.
+func parseIntset(b []byte) ([][]byte, error) {
+	if len(b) < 8 {
+		return nil, ErrInvalidEncoding
+	}
+	enc := int(binary.LittleEndian.Uint32(b[0:4]))
+	n := int(binary.LittleEndian.Uint32(b[4:8]))
+	b = b[8:]
+	if enc != 2 && enc != 4 && enc != 8 || n > len(b)/enc {
+		return nil, ErrInvalidEncoding
+	}
+	items := make([][]byte, n)
+	for j := range items {
+		var i int64
+		switch enc {
+		case 2:
+			i = int64(int16(binary.LittleEndian.Uint16(b)))
+		case 4:
+			i = int64(int32(binary.LittleEndian.Uint32(b)))
+		case 8:
+			i = int64(binary.LittleEndian.Uint64(b))
+		}
+		items[j] = strconv.AppendInt(nil, i, 10)
+		b = b[enc:]
+	}
+	return items, nil
+}
+
+// parseZipmap decodes the hash encoding used before Redis 2.6 into
+// alternating fields and values.
+func parseZipmap(b []byte) ([][]byte, error) {
+	if len(b) < 1 {
+		return nil, ErrInvalidEncoding
+	}
+	b = b[1:]
+	var items [][]byte
+	for {
+		// Field
+		if len(b) == 0 {
+			return nil, ErrInvalidEncoding
+		}
+		if b[0] == 0xff {
+			return items, nil
+		}
+		l, n := zipmapLength(b)
+		if n == 0 || l > len(b)-n {
+			return nil, ErrInvalidEncoding
+		}
+		items = append(items, append([]byte(nil), b[n:n+l]...))
+		b = b[n+l:]
+
+		// Value followed by unused free space
+		l, n = zipmapLength(b)
+		if n == 0 || len(b) < n+1 {
+			return nil, ErrInvalidEncoding
+		}
+		free := int(b[n])
+		b = b[n+1:]
+		if l+free > len(b) {
+			return nil, ErrInvalidEncoding
+		}
+		items = append(items, append([]byte(nil), b[:l]...))
+		b = b[l+free:]
+	}
+}
+
+func zipmapLength(b []byte) (int, int) {
+	if len(b) == 0 || b[0] == 0xff {
+		return 0, 0
+	}
+	if b[0] < 254 {
+		return int(b[0]), 1
+	}
+	if len(b) < 5 {
+		return 0, 0
+	}
+	return int(binary.LittleEndian.Uint32(b[1:5])), 5
+}
+
+// lzfDecompress decompresses data compressed with LZF.
+func lzfDecompress(in []byte, outLen int) ([]byte, error) {
+	if outLen < 0 || outLen > len(in)*lzfMaxExpansion {
+		return nil, ErrInvalidEncoding
+	}
+	out := make([]byte, 0, outLen)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 32 {
+			// Literal run
+			l := ctrl + 1
+			if i+l > len(in) || len(out)+l > outLen {
+				return nil, ErrInvalidEncoding
+			}
+			out = append(out, in[i:i+l]...)
+			i += l
+			continue
+		}
+		// Back reference
+		l := ctrl >> 5
+		if l == 7 {
+			if i >= len(in) {
+				return nil, ErrInvalidEncoding
+			}
+			l += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, ErrInvalidEncoding
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		l += 2
+		if ref < 0 || len(out)+l > outLen {
+			return nil, ErrInvalidEncoding
+		}
+		// Byte by byte since the reference may overlap the output
+		for j := 0; j < l; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != outLen {
+		return nil, ErrInvalidEncoding
+	}
+	return out, nil
+}
@@ -0,0 +1,884 @@
+// Package rdb parses Redis RDB snapshot files (dump.rdb).
+//
+// Parse streams a file and calls the functions of a Handler for aux
+// fields, databases and every key. Values use the same conventions as the
+// redis package: strings are []byte, lists and sets are [][]byte, hashes
+// are map[string][]byte and sorted sets are []ZMember. Integers stored in
+// compact encodings are returned as their decimal representation.
+//
+// Stream entries and module values aren't decoded. They're skipped and
+// reported with their metadata and serialized size. The trailing CRC64
+// checksum isn't verified.
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	MinVersion = 1
+	MaxVersion = 11
+)
+
+var (
+	ErrInvalidHeader      = errors.New("rdb: invalid header")
+	ErrUnsupportedVersion = errors.New("rdb: unsupported version")
+	ErrUnsupportedType    = errors.New("rdb: unsupported value type")
+	ErrInvalidEncoding    = errors.New("rdb: invalid encoding")
+)
+
+// Type is the type of a value as returned by the TYPE command.
+type Type int
+
+const (
+	TypeString Type = iota
+	TypeList
+	TypeSet
+	TypeZSet
+	TypeHash
+	TypeStream
+	TypeModule
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeString:
+		return "string"
+	case TypeList:
+		return "list"
+	case TypeSet:
+		return "set"
+	case TypeZSet:
+		return "zset"
+	case TypeHash:
+		return "hash"
+	case TypeStream:
+		return "stream"
+	case TypeModule:
+		return "module"
+	}
+	return "unknown"
+}
+
+// Entry is a key and its value.
+type Entry struct {
+	DB       int
+	Key      []byte
+	Type     Type
+	Encoding string    // e.g. "raw", "ziplist", "listpack", "intset", "quicklist"
+	Expires  time.Time // zero if the key doesn't expire
+	Idle     int64     // LRU idle time in seconds or -1 if not stored
+	Freq     int       // LFU frequency or -1 if not stored
+	Value    interface{}
+	Size     int64 // size of the serialized value in bytes
+}
+
+// ZMember is a member of a sorted set.
+type ZMember struct {
+	Member []byte
+	Score  float64
+}
+
+// Stream is the metadata of a stream. Entries aren't decoded.
+type Stream struct {
+	Length uint64
+	LastID string
+	Groups []StreamGroup
+}
+
+type StreamGroup struct {
+	Name      []byte
+	LastID    string
+	Pending   uint64
+	Consumers int
+}
+
+// Handler receives the contents of an RDB file. Nil functions are
+// skipped. Returning an error from any function stops parsing and the
+// error is returned by Parse. The Entry passed to Entry is only valid
+// during the call but its Key and Value may be retained.
+type Handler struct {
+	Start    func(version int) error
+	Aux      func(key, value []byte) error
+	Database func(db int) error
+	ResizeDB func(size, expiresSize uint64) error
+	Entry    func(e *Entry) error
+	End      func() error
+}
+
+const (
+	opFunctionPreGA = 0xf6
+	opFunction2     = 0xf5
+	opModuleAux     = 0xf7
+	opIdle          = 0xf8
+	opFreq          = 0xf9
+	opAux           = 0xfa
+	opResizeDB      = 0xfb
+	opExpireTimeMs  = 0xfc
+	opExpireTime    = 0xfd
+	opSelectDB      = 0xfe
+	opEOF           = 0xff
+)
+
+const (
+	typeString          = 0
+	typeList            = 1
+	typeSet             = 2
+	typeZSet            = 3
+	typeHash            = 4
+	typeZSet2           = 5
+	typeModule          = 6
+	typeModule2         = 7
+	typeHashZipmap      = 9
+	typeListZiplist     = 10
+	typeSetIntset       = 11
+	typeZSetZiplist     = 12
+	typeHashZiplist     = 13
+	typeListQuicklist   = 14
+	typeStreamListpacks = 15
+	typeHashListpack    = 16
+	typeZSetListpack    = 17
+	typeListQuicklist2  = 18
+	typeStreamListpack2 = 19
+	typeSetListpack     = 20
+	typeStreamListpack3 = 21
+)
+
+const (
+	encInt8  = 0
+	encInt16 = 1
+	encInt32 = 2
+	encLZF   = 3
+)
+
+const (
+	moduleOpcodeEOF    = 0
+	moduleOpcodeSInt   = 1
+	moduleOpcodeUInt   = 2
+	moduleOpcodeFloat  = 3
+	moduleOpcodeDouble = 4
+	moduleOpcodeString = 5
+)
+
+const (
+	quicklistNodePlain  = 1
+	quicklistNodePacked = 2
+)
+
+const (
+	readChunkSize = 64 * 1024
+
+	// LZF output is at most 264 bytes for every 3 bytes of input.
+	lzfMaxExpansion = 88
+)
+
+type decoder struct {
+	r       *bufio.Reader
+	h       *Handler
+	n       int64
+	buf     [16]byte
+	version int
+}
+
+// Parse reads an RDB file from r and calls h for its contents. If r is a
+// *bufio.Reader nothing past the end of the RDB file is consumed which
+// allows reading data that follows it such as in an AOF file with an RDB
+// preamble.
+func Parse(r io.Reader, h *Handler) error {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	d := &decoder{r: br, h: h}
+	return d.parse()
+}
+
+func (d *decoder) parse() error {
+	header := d.buf[:9]
+	if err := d.readFull(header); err != nil {
+		return err
+	}
+	if string(header[:5]) != "REDIS" {
+		return ErrInvalidHeader
+	}
+	version, err := strconv.Atoi(string(header[5:]))
+	if err != nil {
+		return ErrInvalidHeader
+	}
+	if version < MinVersion || version > MaxVersion {
+		return ErrUnsupportedVersion
+	}
+	d.version = version
+	if d.h.Start != nil {
+		if err := d.h.Start(version); err != nil {
+			return err
+		}
+	}
+
+	e := Entry{Idle: -1, Freq: -1}
+	for {
+		op, err := d.readByte()
+		if err != nil {
+			return err
+		}
+		switch op {
+		case opEOF:
+			if d.version >= 5 {
+				if err := d.readFull(d.buf[:8]); err != nil {
+					return err
+				}
+			}
+			if d.h.End != nil {
+				return d.h.End()
+			}
+			return nil
+		case opSelectDB:
+			db, err := d.readLength()
+			if err != nil {
+				return err
+			}
+			e.DB = int(db)
+			if d.h.Database != nil {
+				if err := d.h.Database(e.DB); err != nil {
+					return err
+				}
+			}
+		case opResizeDB:
+			size, err := d.readLength()
+			if err != nil {
+				return err
+			}
+			expiresSize, err := d.readLength()
+			if err != nil {
+				return err
+			}
+			if d.h.ResizeDB != nil {
+				if err := d.h.ResizeDB(size, expiresSize); err != nil {
+					return err
+				}
+			}
+		case opAux:
+			key, err := d.readString()
+			if err != nil {
+				return err
+			}
+			value, err := d.readString()
+			if err != nil {
+				return err
+			}
+			if d.h.Aux != nil {
+				if err := d.h.Aux(key, value); err != nil {
+					return err
+				}
+			}
+		case opExpireTime:
+			if err := d.readFull(d.buf[:4]); err != nil {
+				return err
+			}
+			e.Expires = time.Unix(int64(binary.LittleEndian.Uint32(d.buf[:4])), 0)
+		case opExpireTimeMs:
+			ms, err := d.readUint64()
+			if err != nil {
+				return err
+			}
+			e.Expires = time.UnixMilli(int64(ms))
+		case opFreq:
+			f, err := d.readByte()
+			if err != nil {
+				return err
+			}
+			e.Freq = int(f)
+		case opIdle:
+			idle, err := d.readLength()
+			if err != nil {
+				return err
+			}
+			e.Idle = int64(idle)
+		case opModuleAux:
+			// Module ID. The "when" field that follows is written as a
+			// regular UINT opcode so it's skipped with the value.
+			if _, err := d.readLength(); err != nil {
+				return err
+			}
+			if err := d.skipModuleValue(); err != nil {
+				return err
+			}
+		case opFunction2:
+			if _, err := d.readString(); err != nil {
+				return err
+			}
+		case opFunctionPreGA:
+			return ErrUnsupportedType
+		default:
+			if e.Key, err = d.readString(); err != nil {
+				return err
+			}
+			start := d.n
+			if err := d.readValue(op, &e); err != nil {
+				return err
+			}
+			e.Size = d.n - start
+			if d.h.Entry != nil {
+				if err := d.h.Entry(&e); err != nil {
+					return err
+				}
+			}
+			e = Entry{DB: e.DB, Idle: -1, Freq: -1}
+		}
+	}
+}
+
+func (d *decoder) readValue(t byte, e *Entry) error {
+	var err error
+	e.Encoding = "raw"
+	switch t {
+	case typeString:
+		e.Type = TypeString
+		e.Value, err = d.readString()
+	case typeList, typeSet:
+		e.Type = TypeList
+		e.Encoding = "linkedlist"
+		if t == typeSet {
+			e.Type = TypeSet
+			e.Encoding = "hashtable"
+		}
+		e.Value, err = d.readStrings()
+	case typeZSet, typeZSet2:
+		e.Type = TypeZSet
+		e.Encoding = "skiplist"
+		e.Value, err = d.readZSet(t == typeZSet2)
+	case typeHash:
+		e.Type = TypeHash
+		e.Encoding = "hashtable"
+		e.Value, err = d.readHash()
+	case typeHashZipmap:
+		e.Type = TypeHash
+		e.Encoding = "zipmap"
+		var items [][]byte
+		if items, err = d.readEncoded(parseZipmap); err == nil {
+			e.Value, err = hashFromPairs(items)
+		}
+	case typeListZiplist, typeListQuicklist, typeListQuicklist2:
+		e.Type = TypeList
+		switch t {
+		case typeListZiplist:
+			e.Encoding = "ziplist"
+			e.Value, err = d.readEncoded(parseZiplist)
+		case typeListQuicklist:
+			e.Encoding = "quicklist"
+			e.Value, err = d.readQuicklist(false)
+		default:
+			e.Encoding = "quicklist"
+			e.Value, err = d.readQuicklist(true)
+		}
+	case typeSetIntset:
+		e.Type = TypeSet
+		e.Encoding = "intset"
+		e.Value, err = d.readEncoded(parseIntset)
+	case typeSetListpack:
+		e.Type = TypeSet
+		e.Encoding = "listpack"
+		e.Value, err = d.readEncoded(parseListpack)
+	case typeZSetZiplist, typeZSetListpack:
+		e.Type = TypeZSet
+		parse := parseZiplist
+		e.Encoding = "ziplist"
+		if t == typeZSetListpack {
+			parse = parseListpack
+			e.Encoding = "listpack"
+		}
+		var items [][]byte
+		if items, err = d.readEncoded(parse); err == nil {
+			e.Value, err = zsetFromPairs(items)
+		}
+	case typeHashZiplist, typeHashListpack:
+		e.Type = TypeHash
+		parse := parseZiplist
+		e.Encoding = "ziplist"
+		if t == typeHashListpack {
+			parse = parseListpack
+			e.Encoding = "listpack"
+		}
+		var items [][]byte
+		if items, err = d.readEncoded(parse); err == nil {
+			e.Value, err = hashFromPairs(items)
+		}
+	case typeStreamListpacks, typeStreamListpack2, typeStreamListpack3:
+		e.Type = TypeStream
+		e.Encoding = "stream"
+		e.Value, err = d.readStream(t)
+	case typeModule2:
+		e.Type = TypeModule
+		e.Encoding = "module"
+		if _, err = d.readLength(); err == nil {
+			err = d.skipModuleValue()
+		}
+	default:
+		// Module values in the old format can't be skipped without the
+		// module.
+		return ErrUnsupportedType
+	}
+	return err
+}
+
+func (d *decoder) readStrings() ([][]byte, error) {
+	n, err := d.readLength()
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, 0, capHint(n))
+	for i := uint64(0); i < n; i++ {
+		v, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func (d *decoder) readZSet(binaryScores bool) ([]ZMember, error) {
+	n, err := d.readLength()
+	if err != nil {
+		return nil, err
+	}
+	members := make([]ZMember, 0, capHint(n))
+	for i := uint64(0); i < n; i++ {
+		m, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		var score float64
+		if binaryScores {
+			var u uint64
+			u, err = d.readUint64()
+			score = math.Float64frombits(u)
+		} else {
+			score, err = d.readDouble()
+		}
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, ZMember{m, score})
+	}
+	return members, nil
+}
+
+func (d *decoder) readHash() (map[string][]byte, error) {
+	n, err := d.readLength()
+	if err != nil {
+		return nil, err
+	}
+	h := make(map[string][]byte, capHint(n))
+	for i := uint64(0); i < n; i++ {
+		k, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		h[string(k)] = v
+	}
+	return h, nil
+}
+
+// readEncoded reads a string holding a compact encoding and decodes it.
+func (d *decoder) readEncoded(parse func([]byte) ([][]byte, error)) ([][]byte, error) {
+	b, err := d.readString()
+	if err != nil {
+		return nil, err
+	}
+	return parse(b)
+}
+
+func (d *decoder) readQuicklist(v2 bool) ([][]byte, error) {
+	n, err := d.readLength()
+	if err != nil {
+		return nil, err
+	}
+	var items [][]byte
+	for i := uint64(0); i < n; i++ {
+		container := uint64(quicklistNodePacked)
+		if v2 {
+			if container, err = d.readLength(); err != nil {
+				return nil, err
+			}
+		}
+		b, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case container == quicklistNodePlain:
+			items = append(items, b)
+		case container != quicklistNodePacked:
+			return nil, ErrInvalidEncoding
+		case v2:
+			node, err := parseListpack(b)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, node...)
+		default:
+			node, err := parseZiplist(b)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, node...)
+		}
+	}
+	return items, nil
+}
+
+func (d *decoder) readStream(t byte) (*Stream, error) {
+	n, err := d.readLength()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < n; i++ {
+		// Master ID and listpack with the entries
+		if _, err := d.readString(); err != nil {
+			return nil, err
+		}
+		if _, err := d.readString(); err != nil {
+			return nil, err
+		}
+	}
+	s := &Stream{}
+	if s.Length, err = d.readLength(); err != nil {
+		return nil, err
+	}
+	if s.LastID, err = d.readStreamID(); err != nil {
+		return nil, err
+	}
+	if t >= typeStreamListpack2 {
+		// First ID, max deleted ID and entries added
+		if _, err := d.readStreamID(); err != nil {
+			return nil, err
+		}
+		if _, err := d.readStreamID(); err != nil {
+			return nil, err
+		}
+		if _, err := d.readLength(); err != nil {
+			return nil, err
+		}
+	}
+	groups, err := d.readLength()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < groups; i++ {
+		var g StreamGroup
+		if g.Name, err = d.readString(); err != nil {
+			return nil, err
+		}
+		if g.LastID, err = d.readStreamID(); err != nil {
+			return nil, err
+		}
+		if t >= typeStreamListpack2 {
+			// Entries read
+			if _, err := d.readLength(); err != nil {
+				return nil, err
+			}
+		}
+		if g.Pending, err = d.readLength(); err != nil {
+			return nil, err
+		}
+		for j := uint64(0); j < g.Pending; j++ {
+			// Raw ID and delivery time
+			if err := d.readFull(d.buf[:16]); err != nil {
+				return nil, err
+			}
+			if err := d.readFull(d.buf[:8]); err != nil {
+				return nil, err
+			}
+			if _, err := d.readLength(); err != nil {
+				return nil, err
+			}
+		}
+		consumers, err := d.readLength()
+		if err != nil {
+			return nil, err
+		}
+		g.Consumers = int(consumers)
+		for j := uint64(0); j < consumers; j++ {
+			if _, err := d.readString(); err != nil {
+				return nil, err
+			}
+			// Seen time and active time
+			if err := d.readFull(d.buf[:8]); err != nil {
+				return nil, err
+			}
+			if t >= typeStreamListpack3 {
+				if err := d.readFull(d.buf[:8]); err != nil {
+					return nil, err
+				}
+			}
+			pending, err := d.readLength()
+			if err != nil {
+				return nil, err
+			}
+			for k := uint64(0); k < pending; k++ {
+				if err := d.readFull(d.buf[:16]); err != nil {
+					return nil, err
+				}
+			}
+		}
+		s.Groups = append(s.Groups, g)
+	}
+	return s, nil
+}
+
+func (d *decoder) readStreamID() (string, error) {
+	ms, err := d.readLength()
+	if err != nil {
+		return "", err
+	}
+	seq, err := d.readLength()
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(ms, 10) + "-" + strconv.FormatUint(seq, 10), nil
+}
+
+// skipModuleValue skips a value serialized by a module with the typed
+// opcodes introduced in RDB version 8.
+func (d *decoder) skipModuleValue() error {
+	for {
+		op, err := d.readLength()
+		if err != nil {
+			return err
+		}
+		switch op {
+		case moduleOpcodeEOF:
+			return nil
+		case moduleOpcodeSInt, moduleOpcodeUInt:
+			_, err = d.readLength()
+		case moduleOpcodeFloat:
+			err = d.readFull(d.buf[:4])
+		case moduleOpcodeDouble:
+			err = d.readFull(d.buf[:8])
+		case moduleOpcodeString:
+			_, err = d.readString()
+		default:
+			return ErrInvalidEncoding
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (d *decoder) readByte() (byte, error) {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	d.n++
+	return b, nil
+}
+
+func (d *decoder) readFull(b []byte) error {
+	n, err := io.ReadFull(d.r, b)
+	d.n += int64(n)
+	return unexpectedEOF(err)
+}
+
+// readBytes reads a string of n bytes. Long strings are read in chunks so
+// that a corrupt length fails at the end of the input instead of
+// allocating it all up front.
+func (d *decoder) readBytes(n uint64) ([]byte, error) {
+	if n > math.MaxInt {
+		return nil, ErrInvalidEncoding
+	}
+	if n <= readChunkSize {
+		b := make([]byte, n)
+		return b, d.readFull(b)
+	}
+	b := make([]byte, 0, readChunkSize)
+	for uint64(len(b)) < n {
+		c := n - uint64(len(b))
+		if c > readChunkSize {
+			c = readChunkSize
+		}
+		b = append(b, make([]byte, c)...)
+		if err := d.readFull(b[len(b)-int(c):]); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (d *decoder) readUint64() (uint64, error) {
+	if err := d.readFull(d.buf[:8]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(d.buf[:8]), nil
+}
+
+// readLengthEncoding returns a length or, if encoded is true, the type of
+// a specially encoded string.
+func (d *decoder) readLengthEncoding() (length uint64, encoded bool, err error) {
+	b, err := d.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3f), false, nil
+	case 1:
+		b2, err := d.readByte()
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(b&0x3f)<<8 | uint64(b2), false, nil
+	case 2:
+		switch b {
+		case 0x80:
+			if err := d.readFull(d.buf[:4]); err != nil {
+				return 0, false, err
+			}
+			return uint64(binary.BigEndian.Uint32(d.buf[:4])), false, nil
+		case 0x81:
+			if err := d.readFull(d.buf[:8]); err != nil {
+				return 0, false, err
+			}
+			return binary.BigEndian.Uint64(d.buf[:8]), false, nil
+		}
+		return 0, false, ErrInvalidEncoding
+	}
+	return uint64(b & 0x3f), true, nil
+}
+
+func (d *decoder) readLength() (uint64, error) {
+	n, encoded, err := d.readLengthEncoding()
+	if err == nil && encoded {
+		err = ErrInvalidEncoding
+	}
+	return n, err
+}
+
+func (d *decoder) readString() ([]byte, error) {
+	n, encoded, err := d.readLengthEncoding()
+	if err != nil {
+		return nil, err
+	}
+	if !encoded {
+		return d.readBytes(n)
+	}
+	switch n {
+	case encInt8:
+		b, err := d.readByte()
+		if err != nil {
+			return nil, err
+		}
+		return strconv.AppendInt(nil, int64(int8(b)), 10), nil
+	case encInt16:
+		if err := d.readFull(d.buf[:2]); err != nil {
+			return nil, err
+		}
+		return strconv.AppendInt(nil, int64(int16(binary.LittleEndian.Uint16(d.buf[:2]))), 10), nil
+	case encInt32:
+		if err := d.readFull(d.buf[:4]); err != nil {
+			return nil, err
+		}
+		return strconv.AppendInt(nil, int64(int32(binary.LittleEndian.Uint32(d.buf[:4]))), 10), nil
+	case encLZF:
+		clen, err := d.readLength()
+		if err != nil {
+			return nil, err
+		}
+		ulen, err := d.readLength()
+		if err != nil {
+			return nil, err
+		}
+		c, err := d.readBytes(clen)
+		if err != nil {
+			return nil, err
+		}
+		if ulen > uint64(len(c))*lzfMaxExpansion {
+			return nil, ErrInvalidEncoding
+		}
+		return lzfDecompress(c, int(ulen))
+	}
+	return nil, ErrInvalidEncoding
+}
+
+// readDouble reads a score in the string format used before RDB version 8.
+func (d *decoder) readDouble() (float64, error) {
+	n, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	var b []byte
+	if int(n) <= len(d.buf) {
+		b = d.buf[:n]
+	} else {
+		b = make([]byte, n)
+	}
+	if err := d.readFull(b); err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return 0, ErrInvalidEncoding
+	}
+	return f, nil
+}
+
+func zsetFromPairs(items [][]byte) ([]ZMember, error) {
+	if len(items)%2 != 0 {
+		return nil, ErrInvalidEncoding
+	}
+	members := make([]ZMember, 0, len(items)/2)
+	for i := 0; i < len(items); i += 2 {
+		score, err := strconv.ParseFloat(string(items[i+1]), 64)
+		if err != nil {
+			return nil, ErrInvalidEncoding
+		}
+		members = append(members, ZMember{items[i], score})
+	}
+	return members, nil
+}
+
+func hashFromPairs(items [][]byte) (map[string][]byte, error) {
+	if len(items)%2 != 0 {
+		return nil, ErrInvalidEncoding
+	}
+	h := make(map[string][]byte, len(items)/2)
+	for i := 0; i < len(items); i += 2 {
+		h[string(items[i])] = items[i+1]
+	}
+	return h, nil
+}
+
+// capHint limits preallocation from lengths read from untrusted input.
+func capHint(n uint64) int {
+	if n > 1024 {
+		return 1024
+	}
+	return int(n)
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,278 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Helpers to build RDB files with short lengths (< 64)
+
+func str(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+func listpack(entries ...interface{}) []byte {
+	var body []byte
+	for _, e := range entries {
+		switch v := e.(type) {
+		case string:
+			body = append(body, 0x80|byte(len(v)))
+			body = append(body, v...)
+			body = append(body, byte(1+len(v)))
+		case int:
+			body = append(body, byte(v), 1)
+		}
+	}
+	b := make([]byte, 6, 7+len(body))
+	binary.LittleEndian.PutUint32(b, uint32(7+len(body)))
+	binary.LittleEndian.PutUint16(b[4:], uint16(len(entries)))
+	b = append(b, body...)
+	return append(b, 0xff)
+}
+
+func ziplist(entries ...interface{}) []byte {
+	var body []byte
+	prev := 0
+	for _, e := range entries {
+		start := len(body)
+		body = append(body, byte(prev))
+		switch v := e.(type) {
+		case string:
+			body = append(body, byte(len(v)))
+			body = append(body, v...)
+		case int:
+			body = append(body, 0xf0|byte(v+1))
+		}
+		prev = len(body) - start
+	}
+	b := make([]byte, 10, 11+len(body))
+	binary.LittleEndian.PutUint32(b, uint32(11+len(body)))
+	binary.LittleEndian.PutUint16(b[8:], uint16(len(entries)))
+	b = append(b, body...)
+	return append(b, 0xff)
+}
+
+func TestParse(t *testing.T) {
+	var f bytes.Buffer
+	f.WriteString("REDIS0011")
+	f.WriteByte(opAux)
+	f.Write(str("redis-ver"))
+	f.Write(str("7.2.0"))
+	f.WriteByte(opAux)
+	f.Write(str("ctime"))
+	f.Write([]byte{0xc2, 0x00, 0xe1, 0xf5, 0x05}) // int32 100000000
+	f.WriteByte(opSelectDB)
+	f.WriteByte(0)
+	f.WriteByte(opResizeDB)
+	f.Write([]byte{7, 1})
+
+	// String with expiry and LFU info
+	f.WriteByte(opExpireTimeMs)
+	binary.Write(&f, binary.LittleEndian, uint64(1700000000123))
+	f.WriteByte(opFreq)
+	f.WriteByte(5)
+	f.WriteByte(typeString)
+	f.Write(str("str"))
+	f.Write(str("hello"))
+
+	// Integer and LZF compressed strings
+	f.WriteByte(typeString)
+	f.Write(str("int"))
+	f.Write([]byte{0xc0, 0xf6}) // int8 -10
+	f.WriteByte(opIdle)
+	f.WriteByte(42)
+	f.WriteByte(typeString)
+	f.Write(str("lzf"))
+	f.Write([]byte{0xc3, 6, 9, 0x02, 'a', 'b', 'c', 0x80, 0x02})
+
+	// List as a quicklist of listpacks and a plain node
+	f.WriteByte(typeListQuicklist2)
+	f.Write(str("list"))
+	f.Write([]byte{2, quicklistNodePacked})
+	lp := listpack("a", 7)
+	f.Write(str(string(lp)))
+	f.WriteByte(quicklistNodePlain)
+	f.Write(str("big"))
+
+	// Intset
+	f.WriteByte(typeSetIntset)
+	f.Write(str("intset"))
+	is := []byte{2, 0, 0, 0, 2, 0, 0, 0, 0xff, 0xff, 3, 0}
+	f.Write(str(string(is)))
+
+	// Hash as a ziplist
+	f.WriteByte(typeHashZiplist)
+	f.Write(str("hash"))
+	f.Write(str(string(ziplist("f1", "v1", "f2", 3))))
+
+	// Sorted set with binary scores
+	f.WriteByte(typeZSet2)
+	f.Write(str("zset"))
+	f.WriteByte(2)
+	f.Write(str("m1"))
+	binary.Write(&f, binary.LittleEndian, math.Float64bits(1.5))
+	f.Write(str("m2"))
+	binary.Write(&f, binary.LittleEndian, math.Float64bits(math.Inf(-1)))
+
+	f.WriteByte(opSelectDB)
+	f.WriteByte(3)
+	f.WriteByte(typeSetListpack)
+	f.Write(str("set"))
+	f.Write(str(string(listpack("x", "y"))))
+
+	f.WriteByte(opEOF)
+	f.Write(make([]byte, 8))
+	data := f.Bytes()
+
+	var (
+		version int
+		aux     = map[string]string{}
+		dbs     []int
+		entries []Entry
+		ended   bool
+	)
+	err := Parse(bytes.NewReader(data), &Handler{
+		Start: func(v int) error {
+			version = v
+			return nil
+		},
+		Aux: func(k, v []byte) error {
+			aux[string(k)] = string(v)
+			return nil
+		},
+		Database: func(db int) error {
+			dbs = append(dbs, db)
+			return nil
+		},
+		Entry: func(e *Entry) error {
+			entries = append(entries, *e)
+			return nil
+		},
+		End: func() error {
+			ended = true
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 11 || !ended {
+		t.Fatalf("version %d, ended %v", version, ended)
+	}
+	if !reflect.DeepEqual(aux, map[string]string{"redis-ver": "7.2.0", "ctime": "100000000"}) {
+		t.Fatalf("unexpected aux fields %+v", aux)
+	}
+	if !reflect.DeepEqual(dbs, []int{0, 3}) {
+		t.Fatalf("unexpected databases %+v", dbs)
+	}
+
+	expected := []Entry{
+		{Key: []byte("str"), Type: TypeString, Encoding: "raw", Expires: time.UnixMilli(1700000000123), Idle: -1, Freq: 5, Value: []byte("hello"), Size: 6},
+		{Key: []byte("int"), Type: TypeString, Encoding: "raw", Idle: -1, Freq: -1, Value: []byte("-10"), Size: 2},
+		{Key: []byte("lzf"), Type: TypeString, Encoding: "raw", Idle: 42, Freq: -1, Value: []byte("abcabcabc"), Size: 9},
+		{Key: []byte("list"), Type: TypeList, Encoding: "quicklist", Idle: -1, Freq: -1, Value: [][]byte{[]byte("a"), []byte("7"), []byte("big")}},
+		{Key: []byte("intset"), Type: TypeSet, Encoding: "intset", Idle: -1, Freq: -1, Value: [][]byte{[]byte("-1"), []byte("3")}},
+		{Key: []byte("hash"), Type: TypeHash, Encoding: "ziplist", Idle: -1, Freq: -1, Value: map[string][]byte{"f1": []byte("v1"), "f2": []byte("3")}},
+		{Key: []byte("zset"), Type: TypeZSet, Encoding: "skiplist", Idle: -1, Freq: -1, Value: []ZMember{{[]byte("m1"), 1.5}, {[]byte("m2"), math.Inf(-1)}}},
+		{DB: 3, Key: []byte("set"), Type: TypeSet, Encoding: "listpack", Idle: -1, Freq: -1, Value: [][]byte{[]byte("x"), []byte("y")}},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %d", len(expected), len(entries))
+	}
+	for i, e := range entries {
+		x := expected[i]
+		if x.Size == 0 {
+			x.Size = e.Size
+		}
+		if !reflect.DeepEqual(e, x) {
+			t.Errorf("entry %d:\nexpected %+v\n     got %+v", i, x, e)
+		}
+	}
+
+	// Truncated files
+	for _, n := range []int{5, 12, len(data) - 20, len(data) - 1} {
+		if err := Parse(bytes.NewReader(data[:n]), &Handler{}); err != io.ErrUnexpectedEOF {
+			t.Errorf("truncated at %d: expected ErrUnexpectedEOF, got %v", n, err)
+		}
+	}
+	if err := Parse(bytes.NewReader([]byte("REDIS0099")), &Handler{}); err != ErrUnsupportedVersion {
+		t.Errorf("expected ErrUnsupportedVersion, got %v", err)
+	}
+	if err := Parse(bytes.NewReader([]byte("NOTREDIS!")), &Handler{}); err != ErrInvalidHeader {
+		t.Errorf("expected ErrInvalidHeader, got %v", err)
+	}
+}
+
+func TestParseListpackIntegers(t *testing.T) {
+	lp := []byte{0, 0, 0, 0, 4, 0,
+		0xdf, 0xff, 2, // 13 bit -1
+		0xf1, 0x00, 0x80, 3, // int16 -32768
+		0xf3, 0x40, 0x42, 0x0f, 0x00, 5, // int32 1000000
+		0xf2, 0xff, 0xff, 0xff, 4, // int24 -1
+		0xff}
+	items, err := parseListpack(lp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]byte{[]byte("-1"), []byte("-32768"), []byte("1000000"), []byte("-1")}
+	if !reflect.DeepEqual(items, expected) {
+		t.Fatalf("expected %q, got %q", expected, items)
+	}
+}
+
+func TestParseZipmapHash(t *testing.T) {
+	// Field f1 with value v1 followed by a byte of free space
+	zm := []byte{1, 2, 'f', '1', 2, 1, 'v', '1', 0, 0xff}
+	data := append([]byte("REDIS0003"), typeHashZipmap)
+	data = append(data, str("h")...)
+	data = append(data, str(string(zm))...)
+	data = append(data, opEOF)
+	var e Entry
+	err := Parse(bytes.NewReader(data), &Handler{Entry: func(en *Entry) error {
+		e = *en
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]byte{"f1": []byte("v1")}
+	if e.Type != TypeHash || e.Encoding != "zipmap" || !reflect.DeepEqual(e.Value, expected) {
+		t.Fatalf("expected hash %q, got %+v", expected, e)
+	}
+}
+
+func TestParseCorruptLengths(t *testing.T) {
+	bigLen := func(n uint64) []byte {
+		b := []byte{0x81, 0, 0, 0, 0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint64(b[1:], n)
+		return b
+	}
+	cases := []struct {
+		value []byte
+		err   error
+	}{
+		{bigLen(1 << 62), io.ErrUnexpectedEOF},
+		{bigLen(math.MaxUint64), ErrInvalidEncoding},
+		// LZF with an uncompressed length the input can't expand to
+		{append(append([]byte{0xc3, 1}, bigLen(1<<40)...), 0), ErrInvalidEncoding},
+		{append(append([]byte{0xc3, 1}, bigLen(math.MaxUint64)...), 0), ErrInvalidEncoding},
+	}
+	for i, c := range cases {
+		data := append([]byte("REDIS0011\x00"), str("k")...)
+		data = append(data, c.value...)
+		if err := Parse(bytes.NewReader(data), &Handler{}); err != c.err {
+			t.Errorf("case %d: expected %v, got %v", i, c.err, err)
+		}
+	}
+	if _, err := lzfDecompress([]byte{0}, -1); err != ErrInvalidEncoding {
+		t.Errorf("lzfDecompress should reject a negative length: %v", err)
+	}
+	if _, err := lzfDecompress([]byte{0, 'a'}, 1000); err != ErrInvalidEncoding {
+		t.Errorf("lzfDecompress should reject an impossible length: %v", err)
+	}
+}
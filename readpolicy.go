@@ -0,0 +1,222 @@
+package redis
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ReadPolicy controls where read-only commands (GET, MGET) are sent.
+type ReadPolicy int
+
+const (
+	// ReadMaster sends all reads to the master.
+	ReadMaster ReadPolicy = iota
+	// ReadPreferReplica sends reads to the first available replica in
+	// the order they were configured.
+	ReadPreferReplica
+	// ReadRandomReplica sends reads to a random available replica.
+	ReadRandomReplica
+	// ReadLowestLatency sends reads to the available node, master
+	// included, with the lowest observed latency.
+	ReadLowestLatency
+)
+
+// How long a node that failed a read is skipped before it's tried again.
+const replicaRetryInterval = time.Second
+
+func (p ReadPolicy) String() string {
+	switch p {
+	case ReadMaster:
+		return "master"
+	case ReadPreferReplica:
+		return "prefer-replica"
+	case ReadRandomReplica:
+		return "random-replica"
+	case ReadLowestLatency:
+		return "lowest-latency"
+	}
+	return fmt.Sprintf("ReadPolicy(%d)", int(p))
+}
+
+// SetReplicas sets the addresses of the replicas of the server the client
+// talks to. Reads are only sent to them if the read policy isn't
+// ReadMaster. The master is always used when no replica is available.
+// Replicas share the client's settings, including those changed later.
+func (cli *Client) SetReplicas(addrs ...string) {
+	replicas := make([]*Client, len(addrs))
+	for i, addr := range addrs {
+		if !strings.Contains(addr, ":") {
+			addr = fmt.Sprintf("%s:%d", addr, DefaultPort)
+		}
+		replicas[i] = NewClient(cli.net, addr)
+		replicas[i].SetTimeout(cli.timeout)
+		replicas[i].SetMaxIdleConncetions(cli.maxIdleConn)
+		replicas[i].SetAuth(cli.username, cli.password)
+		replicas[i].name = cli.name
+		replicas[i].noEvict = cli.noEvict
+		replicas[i].noTouch = cli.noTouch
+	}
+	cli.readLock.Lock()
+	old := cli.replicas
+	cli.replicas = replicas
+	cli.readLock.Unlock()
+	for _, r := range old {
+		r.Close()
+	}
+}
+
+// eachReplica applies a setting changed on the client to its replicas.
+func (cli *Client) eachReplica(fn func(r *Client)) {
+	cli.readLock.RLock()
+	defer cli.readLock.RUnlock()
+	for _, r := range cli.replicas {
+		fn(r)
+	}
+}
+
+func (cli *Client) SetReadPolicy(policy ReadPolicy) {
+	cli.readLock.Lock()
+	cli.readPolicy = policy
+	cli.readLock.Unlock()
+}
+
+// withReadConnection runs fn on a connection chosen by the read policy,
+// falling back to the next candidate if a node can't be reached.
+func (cli *Client) withReadConnection(fn func(c *redisConnection) error) error {
+	return cli.withReadNode(func(n *Client) error {
+		return n.withConnection(fn)
+	})
+}
+
+// withReadNode runs fn with the nodes chosen by the read policy until one
+// succeeds.
+func (cli *Client) withReadNode(fn func(n *Client) error) error {
+	cli.readLock.RLock()
+	policy, replicas := cli.readPolicy, cli.replicas
+	cli.readLock.RUnlock()
+	if policy == ReadMaster || len(replicas) == 0 {
+		return fn(cli)
+	}
+	return readFrom(policy, cli, replicas, fn)
+}
+
+// readFrom calls fn with each candidate node in the order given by policy
+// until one succeeds. Nodes that fail are skipped for a while by later
+// reads. The master is always the last resort.
+func readFrom(policy ReadPolicy, master *Client, replicas []*Client, fn func(n *Client) error) error {
+	var err error
+	for _, n := range readCandidates(policy, master, replicas) {
+		start := time.Now()
+		err = fn(n)
+		if _, ok := err.(ErrReply); err == nil || ok {
+			n.observeLatency(time.Since(start))
+			return err
+		}
+		if n != master {
+			n.markDown()
+		}
+	}
+	return err
+}
+
+func readCandidates(policy ReadPolicy, master *Client, replicas []*Client) []*Client {
+	nodes := make([]*Client, 0, len(replicas)+1)
+	if policy != ReadMaster {
+		for _, r := range replicas {
+			if r.available() {
+				nodes = append(nodes, r)
+			}
+		}
+	}
+	switch policy {
+	case ReadRandomReplica:
+		for i := len(nodes) - 1; i > 0; i-- {
+			j := rand.Intn(i + 1)
+			nodes[i], nodes[j] = nodes[j], nodes[i]
+		}
+	case ReadLowestLatency:
+		nodes = append(nodes, master)
+		sort.SliceStable(nodes, func(i, j int) bool {
+			return atomic.LoadInt64(&nodes[i].latency) < atomic.LoadInt64(&nodes[j].latency)
+		})
+		return nodes
+	}
+	return append(nodes, master)
+}
+
+func (cli *Client) available() bool {
+	return atomic.LoadInt64(&cli.downUntil) <= time.Now().UnixNano()
+}
+
+func (cli *Client) markDown() {
+	atomic.StoreInt64(&cli.downUntil, time.Now().Add(replicaRetryInterval).UnixNano())
+}
+
+// observeLatency records the duration of a read in an exponentially
+// weighted moving average.
+func (cli *Client) observeLatency(d time.Duration) {
+	old := atomic.LoadInt64(&cli.latency)
+	if old == 0 {
+		atomic.StoreInt64(&cli.latency, int64(d))
+	} else {
+		atomic.StoreInt64(&cli.latency, (old*7+int64(d))/8)
+	}
+}
+
+// SetReadPolicy sets where reads are sent in the cluster. Any policy
+// other than ReadMaster sends READONLY on node connections so that
+// replicas accept reads for the slots of their master. Pooled connections
+// set up for the previous policy are replaced.
+func (cc *ClusterClient) SetReadPolicy(policy ReadPolicy) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.readPolicy = policy
+	for _, n := range cc.nodes {
+		n.setReadOnly(policy != ReadMaster)
+	}
+}
+
+// setReadOnly sets whether new connections send READONLY. Idle connections
+// set up in the other mode are closed.
+func (cli *Client) setReadOnly(readOnly bool) {
+	cli.idleConnLock.Lock()
+	defer cli.idleConnLock.Unlock()
+	cli.readOnly.Store(readOnly)
+	idle := cli.idleConn[:0]
+	for _, rc := range cli.idleConn {
+		if rc.readOnly == readOnly {
+			idle = append(idle, rc)
+		} else {
+			rc.close()
+		}
+	}
+	cli.idleConn = idle
+}
+
+func (cc *ClusterClient) withReadKey(key string, fn func(c *redisConnection) error) error {
+	return cc.withReadSlot(hashSlot(key), fn)
+}
+
+func (cc *ClusterClient) withReadSlot(slot int, fn func(c *redisConnection) error) error {
+	shard, err := cc.slotShard(slot)
+	if err != nil {
+		return err
+	}
+	cc.mu.RLock()
+	policy := cc.readPolicy
+	cc.mu.RUnlock()
+	if policy == ReadMaster || len(shard.replicas) == 0 {
+		return cc.withRedirects(shard.master, false, fn)
+	}
+	replicas := make([]*Client, len(shard.replicas))
+	for i, addr := range shard.replicas {
+		replicas[i] = cc.node(addr)
+	}
+	return readFrom(policy, cc.node(shard.master), replicas, func(n *Client) error {
+		return cc.withRedirects(n.addr, false, fn)
+	})
+}
@@ -0,0 +1,94 @@
+package redis
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReadCandidates(t *testing.T) {
+	master := NewClient("tcp", "10.0.0.1")
+	r1 := NewClient("tcp", "10.0.0.2")
+	r2 := NewClient("tcp", "10.0.0.3")
+	replicas := []*Client{r1, r2}
+
+	if n := readCandidates(ReadMaster, master, replicas); len(n) != 1 || n[0] != master {
+		t.Fatalf("ReadMaster should only return the master: %+v", n)
+	}
+	if n := readCandidates(ReadPreferReplica, master, replicas); len(n) != 3 || n[0] != r1 || n[1] != r2 || n[2] != master {
+		t.Fatalf("ReadPreferReplica should return replicas in order then the master: %+v", n)
+	}
+	if n := readCandidates(ReadRandomReplica, master, replicas); len(n) != 3 || n[2] != master {
+		t.Fatalf("ReadRandomReplica should return the master last: %+v", n)
+	}
+
+	master.observeLatency(time.Millisecond)
+	r1.observeLatency(3 * time.Millisecond)
+	r2.observeLatency(2 * time.Millisecond)
+	if n := readCandidates(ReadLowestLatency, master, replicas); len(n) != 3 || n[0] != master || n[1] != r2 || n[2] != r1 {
+		t.Fatalf("ReadLowestLatency should order by latency: %+v", n)
+	}
+
+	r1.markDown()
+	if n := readCandidates(ReadPreferReplica, master, replicas); len(n) != 2 || n[0] != r2 {
+		t.Fatalf("readCandidates should skip replicas that are down: %+v", n)
+	}
+}
+
+func TestReadFromFallback(t *testing.T) {
+	master := NewClient("tcp", "10.0.0.1")
+	r1 := NewClient("tcp", "10.0.0.2")
+	errDown := errors.New("down")
+
+	var tried []*Client
+	err := readFrom(ReadPreferReplica, master, []*Client{r1}, func(n *Client) error {
+		tried = append(tried, n)
+		if n == r1 {
+			return errDown
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("readFrom should fall back to the master: %+v", err)
+	}
+	if len(tried) != 2 || tried[0] != r1 || tried[1] != master {
+		t.Fatalf("readFrom tried the wrong nodes: %+v", tried)
+	}
+	if r1.available() {
+		t.Fatal("readFrom should mark a failing replica down")
+	}
+
+	tried = nil
+	err = readFrom(ReadPreferReplica, master, []*Client{NewClient("tcp", "10.0.0.3")}, func(n *Client) error {
+		tried = append(tried, n)
+		return ErrReply{"ERR", "wrong type"}
+	})
+	if _, ok := err.(ErrReply); !ok || len(tried) != 1 {
+		t.Fatalf("readFrom should not fall back on error replies: %+v %d", err, len(tried))
+	}
+}
+
+func TestSetReadOnlyDropsIdleConnections(t *testing.T) {
+	cr := &commandRecorder{}
+	srv := NewServer()
+	srv.HandleFunc("ping", cr.reply("PONG"))
+	srv.HandleFunc("readonly", cr.reply("OK"))
+	cli := NewClient("tcp", startServer(t, srv))
+	defer cli.Close()
+
+	if err := cli.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	cli.setReadOnly(true)
+	if err := cli.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	cli.setReadOnly(false)
+	if err := cli.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	cr.check(t, []string{"PING", "READONLY", "PING", "PING", "PING"})
+}
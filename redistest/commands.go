@@ -0,0 +1,769 @@
+package redistest
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	flagWrite  = 1 << iota // modifies its keys, used by WATCH
+	flagPubSub             // allowed while subscribed
+	flagTx                 // runs immediately inside MULTI
+)
+
+type command struct {
+	fn    func(c *conn, args [][]byte)
+	arity int // like Redis: exact if positive, minimum if negative
+	flags int
+
+	// Position of the keys in the arguments as in COMMAND INFO. A
+	// negative lastKey counts from the end.
+	firstKey, lastKey, step int
+}
+
+func (cmd *command) keys(args [][]byte) []string {
+	if cmd.firstKey == 0 {
+		return nil
+	}
+	last := cmd.lastKey
+	if last < 0 {
+		last += len(args)
+	}
+	var keys []string
+	for i := cmd.firstKey; i <= last && i < len(args); i += cmd.step {
+		keys = append(keys, string(args[i]))
+	}
+	return keys
+}
+
+var commands map[string]*command
+
+func init() {
+	commands = map[string]*command{
+		// Connection and server
+		"auth":     {cmdAuth, -2, 0, 0, 0, 0},
+		"client":   {cmdClient, -2, 0, 0, 0, 0},
+		"dbsize":   {cmdDBSize, 1, 0, 0, 0, 0},
+		"echo":     {cmdEcho, 2, 0, 0, 0, 0},
+		"flushall": {cmdFlushAll, -1, flagWrite, 0, 0, 0},
+		"flushdb":  {cmdFlushDB, -1, flagWrite, 0, 0, 0},
+		"ping":     {cmdPing, -1, flagPubSub, 0, 0, 0},
+		"quit":     {cmdQuit, 1, flagPubSub | flagTx, 0, 0, 0},
+		"select":   {cmdSelect, 2, 0, 0, 0, 0},
+		"time":     {cmdTime, 1, 0, 0, 0, 0},
+
+		// Keys
+		"del":       {cmdDel, -2, flagWrite, 1, -1, 1},
+		"exists":    {cmdExists, -2, 0, 1, -1, 1},
+		"expire":    {cmdExpire, -3, flagWrite, 1, 1, 1},
+		"expireat":  {cmdExpireAt, -3, flagWrite, 1, 1, 1},
+		"keys":      {cmdKeys, 2, 0, 0, 0, 0},
+		"persist":   {cmdPersist, 2, flagWrite, 1, 1, 1},
+		"pexpire":   {cmdPExpire, -3, flagWrite, 1, 1, 1},
+		"pexpireat": {cmdPExpireAt, -3, flagWrite, 1, 1, 1},
+		"pttl":      {cmdPTTL, 2, 0, 1, 1, 1},
+		"rename":    {cmdRename, 3, flagWrite, 1, 2, 1},
+		"renamenx":  {cmdRenameNX, 3, flagWrite, 1, 2, 1},
+		"scan":      {cmdScan, -2, 0, 0, 0, 0},
+		"ttl":       {cmdTTL, 2, 0, 1, 1, 1},
+		"type":      {cmdType, 2, 0, 1, 1, 1},
+		"unlink":    {cmdDel, -2, flagWrite, 1, -1, 1},
+
+		// Strings
+		"append":      {cmdAppend, 3, flagWrite, 1, 1, 1},
+		"decr":        {cmdDecr, 2, flagWrite, 1, 1, 1},
+		"decrby":      {cmdDecrBy, 3, flagWrite, 1, 1, 1},
+		"get":         {cmdGet, 2, 0, 1, 1, 1},
+		"getdel":      {cmdGetDel, 2, flagWrite, 1, 1, 1},
+		"getrange":    {cmdGetRange, 4, 0, 1, 1, 1},
+		"getset":      {cmdGetSet, 3, flagWrite, 1, 1, 1},
+		"incr":        {cmdIncr, 2, flagWrite, 1, 1, 1},
+		"incrby":      {cmdIncrBy, 3, flagWrite, 1, 1, 1},
+		"incrbyfloat": {cmdIncrByFloat, 3, flagWrite, 1, 1, 1},
+		"mget":        {cmdMGet, -2, 0, 1, -1, 1},
+		"mset":        {cmdMSet, -3, flagWrite, 1, -1, 2},
+		"msetnx":      {cmdMSetNX, -3, flagWrite, 1, -1, 2},
+		"psetex":      {cmdPSetEx, 4, flagWrite, 1, 1, 1},
+		"set":         {cmdSet, -3, flagWrite, 1, 1, 1},
+		"setex":       {cmdSetEx, 4, flagWrite, 1, 1, 1},
+		"setnx":       {cmdSetNX, 3, flagWrite, 1, 1, 1},
+		"strlen":      {cmdStrlen, 2, 0, 1, 1, 1},
+
+		// Hashes
+		"hdel":         {cmdHDel, -3, flagWrite, 1, 1, 1},
+		"hexists":      {cmdHExists, 3, 0, 1, 1, 1},
+		"hget":         {cmdHGet, 3, 0, 1, 1, 1},
+		"hgetall":      {cmdHGetAll, 2, 0, 1, 1, 1},
+		"hincrby":      {cmdHIncrBy, 4, flagWrite, 1, 1, 1},
+		"hincrbyfloat": {cmdHIncrByFloat, 4, flagWrite, 1, 1, 1},
+		"hkeys":        {cmdHKeys, 2, 0, 1, 1, 1},
+		"hlen":         {cmdHLen, 2, 0, 1, 1, 1},
+		"hmget":        {cmdHMGet, -3, 0, 1, 1, 1},
+		"hmset":        {cmdHMSet, -4, flagWrite, 1, 1, 1},
+		"hset":         {cmdHSet, -4, flagWrite, 1, 1, 1},
+		"hsetnx":       {cmdHSetNX, 4, flagWrite, 1, 1, 1},
+		"hvals":        {cmdHVals, 2, 0, 1, 1, 1},
+
+		// Lists
+		"lindex":    {cmdLIndex, 3, 0, 1, 1, 1},
+		"llen":      {cmdLLen, 2, 0, 1, 1, 1},
+		"lmove":     {cmdLMove, 5, flagWrite, 1, 2, 1},
+		"lpop":      {cmdLPop, -2, flagWrite, 1, 1, 1},
+		"lpush":     {cmdLPush, -3, flagWrite, 1, 1, 1},
+		"lpushx":    {cmdLPushX, -3, flagWrite, 1, 1, 1},
+		"lrange":    {cmdLRange, 4, 0, 1, 1, 1},
+		"lrem":      {cmdLRem, 4, flagWrite, 1, 1, 1},
+		"lset":      {cmdLSet, 4, flagWrite, 1, 1, 1},
+		"ltrim":     {cmdLTrim, 4, flagWrite, 1, 1, 1},
+		"rpop":      {cmdRPop, -2, flagWrite, 1, 1, 1},
+		"rpoplpush": {cmdRPopLPush, 3, flagWrite, 1, 2, 1},
+		"rpush":     {cmdRPush, -3, flagWrite, 1, 1, 1},
+		"rpushx":    {cmdRPushX, -3, flagWrite, 1, 1, 1},
+
+		// Sets
+		"sadd":        {cmdSAdd, -3, flagWrite, 1, 1, 1},
+		"scard":       {cmdSCard, 2, 0, 1, 1, 1},
+		"sdiff":       {cmdSDiff, -2, 0, 1, -1, 1},
+		"sinter":      {cmdSInter, -2, 0, 1, -1, 1},
+		"sismember":   {cmdSIsMember, 3, 0, 1, 1, 1},
+		"smembers":    {cmdSMembers, 2, 0, 1, 1, 1},
+		"smismember":  {cmdSMIsMember, -3, 0, 1, 1, 1},
+		"smove":       {cmdSMove, 4, flagWrite, 1, 2, 1},
+		"spop":        {cmdSPop, -2, flagWrite, 1, 1, 1},
+		"srandmember": {cmdSRandMember, -2, 0, 1, 1, 1},
+		"srem":        {cmdSRem, -3, flagWrite, 1, 1, 1},
+		"sunion":      {cmdSUnion, -2, 0, 1, -1, 1},
+
+		// Sorted sets
+		"zadd":             {cmdZAdd, -4, flagWrite, 1, 1, 1},
+		"zcard":            {cmdZCard, 2, 0, 1, 1, 1},
+		"zcount":           {cmdZCount, 4, 0, 1, 1, 1},
+		"zincrby":          {cmdZIncrBy, 4, flagWrite, 1, 1, 1},
+		"zmscore":          {cmdZMScore, -3, 0, 1, 1, 1},
+		"zpopmax":          {cmdZPopMax, -2, flagWrite, 1, 1, 1},
+		"zpopmin":          {cmdZPopMin, -2, flagWrite, 1, 1, 1},
+		"zrange":           {cmdZRange, -4, 0, 1, 1, 1},
+		"zrangebyscore":    {cmdZRangeByScore, -4, 0, 1, 1, 1},
+		"zrank":            {cmdZRank, 3, 0, 1, 1, 1},
+		"zrem":             {cmdZRem, -3, flagWrite, 1, 1, 1},
+		"zremrangebyrank":  {cmdZRemRangeByRank, 4, flagWrite, 1, 1, 1},
+		"zremrangebyscore": {cmdZRemRangeByScore, 4, flagWrite, 1, 1, 1},
+		"zrevrange":        {cmdZRevRange, -4, 0, 1, 1, 1},
+		"zrevrangebyscore": {cmdZRevRangeByScore, -4, 0, 1, 1, 1},
+		"zrevrank":         {cmdZRevRank, 3, 0, 1, 1, 1},
+		"zscore":           {cmdZScore, 3, 0, 1, 1, 1},
+
+		// Transactions
+		"discard": {cmdDiscard, 1, flagTx, 0, 0, 0},
+		"exec":    {cmdExec, 1, flagTx, 0, 0, 0},
+		"multi":   {cmdMulti, 1, flagTx, 0, 0, 0},
+		"unwatch": {cmdUnwatch, 1, flagTx, 0, 0, 0},
+		"watch":   {cmdWatch, -2, flagTx, 0, 0, 0},
+
+		// Pub/Sub
+		"psubscribe":   {cmdPSubscribe, -2, flagPubSub | flagTx, 0, 0, 0},
+		"publish":      {cmdPublish, 3, 0, 0, 0, 0},
+		"punsubscribe": {cmdPUnsubscribe, -1, flagPubSub | flagTx, 0, 0, 0},
+		"subscribe":    {cmdSubscribe, -2, flagPubSub | flagTx, 0, 0, 0},
+		"unsubscribe":  {cmdUnsubscribe, -1, flagPubSub | flagTx, 0, 0, 0},
+	}
+}
+
+// Connection and server
+
+func cmdAuth(c *conn, args [][]byte) {
+	c.writeError("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+}
+
+func cmdClient(c *conn, args [][]byte) {
+	switch strings.ToLower(string(args[0])) {
+	case "id":
+		c.writeInt(c.id)
+	case "getname":
+		if c.name == "" {
+			c.writeNull()
+		} else {
+			c.writeBulkString(c.name)
+		}
+	case "setname":
+		if len(args) != 2 {
+			c.writeError(msgSyntax)
+			return
+		}
+		c.name = string(args[1])
+		c.writeOK()
+	default:
+		c.writeError("ERR unknown subcommand '" + string(args[0]) + "'")
+	}
+}
+
+func cmdDBSize(c *conn, args [][]byte) {
+	c.writeInt(int64(len(c.database().keys(c.s.now()))))
+}
+
+func cmdEcho(c *conn, args [][]byte) {
+	c.writeBulk(args[0])
+}
+
+func cmdFlushAll(c *conn, args [][]byte) {
+	c.s.flushAll()
+	c.writeOK()
+}
+
+func cmdFlushDB(c *conn, args [][]byte) {
+	c.s.dbs[c.db] = newDatabase()
+	c.s.epoch++
+	c.writeOK()
+}
+
+func cmdPing(c *conn, args [][]byte) {
+	if c.subscribed() {
+		// Subscribed clients get a multi-bulk like any other message
+		msg := []byte{}
+		if len(args) > 0 {
+			msg = args[0]
+		}
+		c.writeBulks([][]byte{[]byte("pong"), msg})
+		return
+	}
+	if len(args) > 0 {
+		c.writeBulk(args[0])
+		return
+	}
+	c.writeStatus("PONG")
+}
+
+func cmdQuit(c *conn, args [][]byte) {
+	c.quit = true
+	c.writeOK()
+}
+
+func cmdSelect(c *conn, args [][]byte) {
+	i, ok := parseInt(args[0])
+	if !ok {
+		c.writeError(msgNotInt)
+		return
+	}
+	if i < 0 || i >= numDatabases {
+		c.writeError(msgInvalidDB)
+		return
+	}
+	c.db = int(i)
+	c.writeOK()
+}
+
+func cmdTime(c *conn, args [][]byte) {
+	now := c.s.now()
+	c.writeStrings([]string{
+		strconv.FormatInt(now.Unix(), 10),
+		strconv.Itoa(now.Nanosecond() / 1000),
+	})
+}
+
+// Keys
+
+func cmdDel(c *conn, args [][]byte) {
+	n := 0
+	for _, k := range args {
+		if c.lookup(string(k)) != nil && c.database().del(string(k)) {
+			n++
+		}
+	}
+	c.writeInt(int64(n))
+}
+
+func cmdExists(c *conn, args [][]byte) {
+	n := 0
+	for _, k := range args {
+		if c.lookup(string(k)) != nil {
+			n++
+		}
+	}
+	c.writeInt(int64(n))
+}
+
+func cmdExpire(c *conn, args [][]byte) {
+	c.expire(args, time.Second, false)
+}
+
+func cmdExpireAt(c *conn, args [][]byte) {
+	c.expire(args, time.Second, true)
+}
+
+func cmdPExpire(c *conn, args [][]byte) {
+	c.expire(args, time.Millisecond, false)
+}
+
+func cmdPExpireAt(c *conn, args [][]byte) {
+	c.expire(args, time.Millisecond, true)
+}
+
+// expire implements EXPIRE, PEXPIRE, EXPIREAT and PEXPIREAT with the NX,
+// XX, GT and LT options.
+func (c *conn) expire(args [][]byte, unit time.Duration, at bool) {
+	key := string(args[0])
+	n, ok := parseInt(args[1])
+	if !ok {
+		c.writeError(msgNotInt)
+		return
+	}
+	var nx, xx, gt, lt bool
+	for _, a := range args[2:] {
+		switch strings.ToLower(string(a)) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "gt":
+			gt = true
+		case "lt":
+			lt = true
+		default:
+			c.writeError("ERR Unsupported option " + string(a))
+			return
+		}
+	}
+	if c.lookup(key) == nil {
+		c.writeInt(0)
+		return
+	}
+	var t time.Time
+	if at {
+		t = time.Unix(0, 0).Add(time.Duration(n) * unit)
+	} else {
+		t = c.s.now().Add(time.Duration(n) * unit)
+	}
+	cur, hasTTL := c.database().expires[key]
+	switch {
+	case nx && hasTTL, xx && !hasTTL,
+		gt && (!hasTTL || !t.After(cur)),
+		lt && hasTTL && !t.Before(cur):
+		c.writeInt(0)
+		return
+	}
+	c.expireAt(key, t)
+	c.writeInt(1)
+}
+
+func (c *conn) expireAt(key string, t time.Time) {
+	if !t.After(c.s.now()) {
+		c.database().del(key)
+	} else {
+		c.database().expires[key] = t
+	}
+}
+
+func cmdKeys(c *conn, args [][]byte) {
+	var keys []string
+	for _, k := range c.database().keys(c.s.now()) {
+		if match(string(args[0]), k) {
+			keys = append(keys, k)
+		}
+	}
+	c.writeStrings(keys)
+}
+
+func cmdPersist(c *conn, args [][]byte) {
+	key := string(args[0])
+	if c.lookup(key) == nil {
+		c.writeInt(0)
+		return
+	}
+	_, ok := c.database().expires[key]
+	delete(c.database().expires, key)
+	c.writeBool(ok)
+}
+
+func cmdPTTL(c *conn, args [][]byte) {
+	c.ttl(string(args[0]), time.Millisecond)
+}
+
+func cmdTTL(c *conn, args [][]byte) {
+	c.ttl(string(args[0]), time.Second)
+}
+
+func (c *conn) ttl(key string, unit time.Duration) {
+	if c.lookup(key) == nil {
+		c.writeInt(-2)
+		return
+	}
+	t, ok := c.database().expires[key]
+	if !ok {
+		c.writeInt(-1)
+		return
+	}
+	// Round to the nearest unit like Redis
+	d := t.Sub(c.s.now())
+	c.writeInt(int64((d + unit/2) / unit))
+}
+
+func cmdRename(c *conn, args [][]byte) {
+	c.rename(string(args[0]), string(args[1]), false)
+}
+
+func cmdRenameNX(c *conn, args [][]byte) {
+	c.rename(string(args[0]), string(args[1]), true)
+}
+
+func (c *conn) rename(from, to string, nx bool) {
+	v := c.lookup(from)
+	if v == nil {
+		c.writeError(msgNoSuchKey)
+		return
+	}
+	if nx && c.lookup(to) != nil {
+		c.writeInt(0)
+		return
+	}
+	d := c.database()
+	t, hasTTL := d.expires[from]
+	d.del(from)
+	d.set(to, v)
+	if hasTTL {
+		d.expires[to] = t
+	}
+	if nx {
+		c.writeInt(1)
+	} else {
+		c.writeOK()
+	}
+}
+
+// cmdScan iterates over the sorted key space using the position as the
+// cursor. Unlike Redis keys added during the iteration may shift the
+// cursor, which is fine for tests.
+func cmdScan(c *conn, args [][]byte) {
+	cursor, ok := parseInt(args[0])
+	if !ok || cursor < 0 {
+		c.writeError("ERR invalid cursor")
+		return
+	}
+	pattern, typ, count := "*", "", int64(10)
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			c.writeError(msgSyntax)
+			return
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			pattern = string(args[i+1])
+		case "count":
+			if count, ok = parseInt(args[i+1]); !ok || count < 1 {
+				c.writeError(msgSyntax)
+				return
+			}
+		case "type":
+			typ = strings.ToLower(string(args[i+1]))
+		default:
+			c.writeError(msgSyntax)
+			return
+		}
+	}
+	keys := c.database().keys(c.s.now())
+	var out []string
+	i := int(cursor)
+	for ; i < len(keys) && int64(len(out)) < count; i++ {
+		k := keys[i]
+		if match(pattern, k) && (typ == "" || typeName(c.lookup(k)) == typ) {
+			out = append(out, k)
+		}
+	}
+	if i >= len(keys) {
+		i = 0
+	}
+	c.writeArray(2)
+	c.writeBulkString(strconv.Itoa(i))
+	c.writeStrings(out)
+}
+
+func cmdType(c *conn, args [][]byte) {
+	c.writeStatus(typeName(c.lookup(string(args[0]))))
+}
+
+// Strings
+
+func cmdAppend(c *conn, args [][]byte) {
+	key := string(args[0])
+	v, ok := c.str(key)
+	if !ok {
+		return
+	}
+	v = append(append([]byte{}, v...), args[1]...)
+	c.database().data[key] = v
+	c.writeInt(int64(len(v)))
+}
+
+func cmdDecr(c *conn, args [][]byte) {
+	c.incrBy(string(args[0]), -1)
+}
+
+func cmdDecrBy(c *conn, args [][]byte) {
+	n, ok := parseInt(args[1])
+	if !ok || n == math.MinInt64 {
+		c.writeError(msgNotInt)
+		return
+	}
+	c.incrBy(string(args[0]), -n)
+}
+
+func cmdIncr(c *conn, args [][]byte) {
+	c.incrBy(string(args[0]), 1)
+}
+
+func cmdIncrBy(c *conn, args [][]byte) {
+	n, ok := parseInt(args[1])
+	if !ok {
+		c.writeError(msgNotInt)
+		return
+	}
+	c.incrBy(string(args[0]), n)
+}
+
+func (c *conn) incrBy(key string, by int64) {
+	v, ok := c.str(key)
+	if !ok {
+		return
+	}
+	i := int64(0)
+	if v != nil {
+		if i, ok = parseInt(v); !ok {
+			c.writeError(msgNotInt)
+			return
+		}
+	}
+	if by > 0 && i > math.MaxInt64-by || by < 0 && i < math.MinInt64-by {
+		c.writeError(msgOverflow)
+		return
+	}
+	i += by
+	c.database().data[key] = []byte(strconv.FormatInt(i, 10))
+	c.writeInt(i)
+}
+
+func cmdIncrByFloat(c *conn, args [][]byte) {
+	key := string(args[0])
+	by, ok := parseFloat(args[1])
+	if !ok {
+		c.writeError(msgNotFloat)
+		return
+	}
+	v, ok := c.str(key)
+	if !ok {
+		return
+	}
+	f := 0.0
+	if v != nil {
+		if f, ok = parseFloat(v); !ok {
+			c.writeError(msgNotFloat)
+			return
+		}
+	}
+	f += by
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		c.writeError("ERR increment would produce NaN or Infinity")
+		return
+	}
+	s := formatFloat(f)
+	c.database().data[key] = []byte(s)
+	c.writeBulkString(s)
+}
+
+func cmdGet(c *conn, args [][]byte) {
+	if v, ok := c.str(string(args[0])); ok {
+		c.writeBulk(v)
+	}
+}
+
+func cmdGetDel(c *conn, args [][]byte) {
+	key := string(args[0])
+	if v, ok := c.str(key); ok {
+		c.database().del(key)
+		c.writeBulk(v)
+	}
+}
+
+func cmdGetRange(c *conn, args [][]byte) {
+	start, ok1 := parseInt(args[1])
+	end, ok2 := parseInt(args[2])
+	if !ok1 || !ok2 {
+		c.writeError(msgNotInt)
+		return
+	}
+	v, ok := c.str(string(args[0]))
+	if !ok {
+		return
+	}
+	if s, e, ok := normalizeRange(start, end, len(v)); ok {
+		c.writeBulk(v[s:e])
+	} else {
+		c.writeBulk([]byte{})
+	}
+}
+
+func cmdGetSet(c *conn, args [][]byte) {
+	key := string(args[0])
+	if v, ok := c.str(key); ok {
+		c.database().set(key, args[1])
+		c.writeBulk(v)
+	}
+}
+
+func cmdMGet(c *conn, args [][]byte) {
+	c.writeArray(len(args))
+	for _, k := range args {
+		v, _ := c.lookup(string(k)).([]byte)
+		c.writeBulk(v)
+	}
+}
+
+func cmdMSet(c *conn, args [][]byte) {
+	if len(args)%2 != 0 {
+		c.writeError("ERR wrong number of arguments for 'mset' command")
+		return
+	}
+	for i := 0; i < len(args); i += 2 {
+		c.database().set(string(args[i]), args[i+1])
+	}
+	c.writeOK()
+}
+
+func cmdMSetNX(c *conn, args [][]byte) {
+	if len(args)%2 != 0 {
+		c.writeError("ERR wrong number of arguments for 'msetnx' command")
+		return
+	}
+	for i := 0; i < len(args); i += 2 {
+		if c.lookup(string(args[i])) != nil {
+			c.writeInt(0)
+			return
+		}
+	}
+	for i := 0; i < len(args); i += 2 {
+		c.database().set(string(args[i]), args[i+1])
+	}
+	c.writeInt(1)
+}
+
+func cmdPSetEx(c *conn, args [][]byte) {
+	c.setEx(args, time.Millisecond)
+}
+
+func cmdSetEx(c *conn, args [][]byte) {
+	c.setEx(args, time.Second)
+}
+
+func (c *conn) setEx(args [][]byte, unit time.Duration) {
+	n, ok := parseInt(args[1])
+	if !ok {
+		c.writeError(msgNotInt)
+		return
+	}
+	if n <= 0 {
+		c.writeError("ERR invalid expire time in 'setex' command")
+		return
+	}
+	key := string(args[0])
+	c.database().set(key, args[2])
+	c.expireAt(key, c.s.now().Add(time.Duration(n)*unit))
+	c.writeOK()
+}
+
+func cmdSet(c *conn, args [][]byte) {
+	key, value := string(args[0]), args[1]
+	var nx, xx, get, keepTTL bool
+	var expireAt time.Time
+	for i := 2; i < len(args); i++ {
+		opt := strings.ToLower(string(args[i]))
+		switch opt {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "get":
+			get = true
+		case "keepttl":
+			keepTTL = true
+		case "ex", "px", "exat", "pxat":
+			if i+1 >= len(args) || !expireAt.IsZero() {
+				c.writeError(msgSyntax)
+				return
+			}
+			i++
+			n, ok := parseInt(args[i])
+			if !ok {
+				c.writeError(msgNotInt)
+				return
+			}
+			if n <= 0 {
+				c.writeError("ERR invalid expire time in 'set' command")
+				return
+			}
+			switch opt {
+			case "ex":
+				expireAt = c.s.now().Add(time.Duration(n) * time.Second)
+			case "px":
+				expireAt = c.s.now().Add(time.Duration(n) * time.Millisecond)
+			case "exat":
+				expireAt = time.Unix(n, 0)
+			case "pxat":
+				expireAt = time.Unix(0, n*int64(time.Millisecond))
+			}
+		default:
+			c.writeError(msgSyntax)
+			return
+		}
+	}
+	if nx && xx || keepTTL && !expireAt.IsZero() {
+		c.writeError(msgSyntax)
+		return
+	}
+
+	var old []byte
+	if get {
+		var ok bool
+		if old, ok = c.str(key); !ok {
+			return
+		}
+	}
+	exists := c.lookup(key) != nil
+	if nx && exists || xx && !exists {
+		if get {
+			c.writeBulk(old)
+		} else {
+			c.writeNull()
+		}
+		return
+	}
+	d := c.database()
+	t, hasTTL := d.expires[key]
+	d.set(key, value)
+	if keepTTL && hasTTL {
+		d.expires[key] = t
+	}
+	if !expireAt.IsZero() {
+		c.expireAt(key, expireAt)
+	}
+	if get {
+		c.writeBulk(old)
+	} else {
+		c.writeOK()
+	}
+}
+
+func cmdSetNX(c *conn, args [][]byte) {
+	key := string(args[0])
+	if c.lookup(key) != nil {
+		c.writeInt(0)
+		return
+	}
+	c.database().set(key, args[1])
+	c.writeInt(1)
+}
+
+func cmdStrlen(c *conn, args [][]byte) {
+	if v, ok := c.str(string(args[0])); ok {
+		c.writeInt(int64(len(v)))
+	}
+}
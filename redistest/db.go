@@ -0,0 +1,321 @@
+package redistest
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	msgWrongType  = "WRONGTYPE Operation against a key holding the wrong kind of value"
+	msgNotInt     = "ERR value is not an integer or out of range"
+	msgNotFloat   = "ERR value is not a valid float"
+	msgSyntax     = "ERR syntax error"
+	msgNoSuchKey  = "ERR no such key"
+	msgOutOfRange = "ERR index out of range"
+	msgOverflow   = "ERR increment or decrement would overflow"
+	msgInvalidDB  = "ERR DB index is out of range"
+)
+
+// Values are stored as []byte for strings, hash, *list, set and *zset.
+type (
+	hash map[string][]byte
+	set  map[string]struct{}
+	list struct{ items [][]byte }
+	zset struct{ scores map[string]float64 }
+)
+
+type database struct {
+	data    map[string]interface{}
+	expires map[string]time.Time
+}
+
+func newDatabase() *database {
+	return &database{
+		data:    make(map[string]interface{}),
+		expires: make(map[string]time.Time),
+	}
+}
+
+// get returns the value of key, removing it first if it has expired.
+func (d *database) get(key string, now time.Time) interface{} {
+	if t, ok := d.expires[key]; ok && !now.Before(t) {
+		d.del(key)
+		return nil
+	}
+	return d.data[key]
+}
+
+func (d *database) del(key string) bool {
+	_, ok := d.data[key]
+	delete(d.data, key)
+	delete(d.expires, key)
+	return ok
+}
+
+// set replaces the value of key and clears its expiration.
+func (d *database) set(key string, v interface{}) {
+	d.data[key] = v
+	delete(d.expires, key)
+}
+
+// keys returns all keys that haven't expired.
+func (d *database) keys(now time.Time) []string {
+	keys := make([]string, 0, len(d.data))
+	for k := range d.data {
+		if d.get(k, now) != nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case []byte:
+		return "string"
+	case hash:
+		return "hash"
+	case *list:
+		return "list"
+	case set:
+		return "set"
+	case *zset:
+		return "zset"
+	}
+	return "none"
+}
+
+func (c *conn) lookup(key string) interface{} {
+	return c.database().get(key, c.s.now())
+}
+
+// The typed lookups write a WRONGTYPE error and return false if the key
+// holds a different type. A missing key returns nil (or a new empty value
+// if create is true) and true.
+
+func (c *conn) str(key string) ([]byte, bool) {
+	switch v := c.lookup(key).(type) {
+	case nil:
+		return nil, true
+	case []byte:
+		return v, true
+	}
+	c.writeError(msgWrongType)
+	return nil, false
+}
+
+func (c *conn) hash(key string, create bool) (hash, bool) {
+	switch v := c.lookup(key).(type) {
+	case nil:
+		if create {
+			h := make(hash)
+			c.database().set(key, h)
+			return h, true
+		}
+		return nil, true
+	case hash:
+		return v, true
+	}
+	c.writeError(msgWrongType)
+	return nil, false
+}
+
+func (c *conn) list(key string, create bool) (*list, bool) {
+	switch v := c.lookup(key).(type) {
+	case nil:
+		if create {
+			l := &list{}
+			c.database().set(key, l)
+			return l, true
+		}
+		return nil, true
+	case *list:
+		return v, true
+	}
+	c.writeError(msgWrongType)
+	return nil, false
+}
+
+func (c *conn) set(key string, create bool) (set, bool) {
+	switch v := c.lookup(key).(type) {
+	case nil:
+		if create {
+			s := make(set)
+			c.database().set(key, s)
+			return s, true
+		}
+		return nil, true
+	case set:
+		return v, true
+	}
+	c.writeError(msgWrongType)
+	return nil, false
+}
+
+func (c *conn) zset(key string, create bool) (*zset, bool) {
+	switch v := c.lookup(key).(type) {
+	case nil:
+		if create {
+			z := &zset{scores: make(map[string]float64)}
+			c.database().set(key, z)
+			return z, true
+		}
+		return nil, true
+	case *zset:
+		return v, true
+	}
+	c.writeError(msgWrongType)
+	return nil, false
+}
+
+// removeIfEmpty deletes a key holding an empty container since Redis
+// never keeps empty hashes, lists, sets or sorted sets.
+func (c *conn) removeIfEmpty(key string) {
+	empty := false
+	switch v := c.database().data[key].(type) {
+	case hash:
+		empty = len(v) == 0
+	case *list:
+		empty = len(v.items) == 0
+	case set:
+		empty = len(v) == 0
+	case *zset:
+		empty = len(v.scores) == 0
+	}
+	if empty {
+		c.database().del(key)
+	}
+}
+
+func parseInt(b []byte) (int64, bool) {
+	i, err := strconv.ParseInt(string(b), 10, 64)
+	return i, err == nil
+}
+
+func parseFloat(b []byte) (float64, bool) {
+	s := strings.ToLower(string(b))
+	switch s {
+	case "inf", "+inf":
+		return math.Inf(1), true
+	case "-inf":
+		return math.Inf(-1), true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil && !math.IsNaN(f)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// normalizeRange converts a start/stop pair that may contain negative
+// indexes into a slice range over n elements. ok is false if the range
+// is empty.
+func normalizeRange(start, stop int64, n int) (int, int, bool) {
+	if start < 0 {
+		start += int64(n)
+	}
+	if stop < 0 {
+		stop += int64(n)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= int64(n) {
+		stop = int64(n) - 1
+	}
+	if start > stop || start >= int64(n) {
+		return 0, 0, false
+	}
+	return int(start), int(stop) + 1, true
+}
+
+// match reports whether s matches the glob-style pattern used by KEYS,
+// SCAN and PSUBSCRIBE.
+func match(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if match(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				// No closing bracket so it's a literal '['
+				if s[0] != '[' {
+					return false
+				}
+				s = s[1:]
+				pattern = pattern[1:]
+				continue
+			}
+			class := pattern[1 : end+1]
+			not := len(class) > 0 && class[0] == '^'
+			if not {
+				class = class[1:]
+			}
+			matched := false
+			for i := 0; i < len(class); i++ {
+				if class[i] == '\\' && i+1 < len(class) {
+					i++
+					matched = matched || class[i] == s[0]
+				} else if i+2 < len(class) && class[i+1] == '-' {
+					lo, hi := class[i], class[i+2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+					matched = matched || s[0] >= lo && s[0] <= hi
+					i += 2
+				} else {
+					matched = matched || class[i] == s[0]
+				}
+			}
+			if matched == not {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[end+2:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(s) == 0
+}
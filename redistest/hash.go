@@ -0,0 +1,196 @@
+package redistest
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+func cmdHDel(c *conn, args [][]byte) {
+	key := string(args[0])
+	h, ok := c.hash(key, false)
+	if !ok {
+		return
+	}
+	n := 0
+	for _, f := range args[1:] {
+		if _, ok := h[string(f)]; ok {
+			delete(h, string(f))
+			n++
+		}
+	}
+	c.removeIfEmpty(key)
+	c.writeInt(int64(n))
+}
+
+func cmdHExists(c *conn, args [][]byte) {
+	if h, ok := c.hash(string(args[0]), false); ok {
+		_, exists := h[string(args[1])]
+		c.writeBool(exists)
+	}
+}
+
+func cmdHGet(c *conn, args [][]byte) {
+	if h, ok := c.hash(string(args[0]), false); ok {
+		c.writeBulk(h[string(args[1])])
+	}
+}
+
+func cmdHGetAll(c *conn, args [][]byte) {
+	h, ok := c.hash(string(args[0]), false)
+	if !ok {
+		return
+	}
+	fields := h.fields()
+	c.writeArray(len(fields) * 2)
+	for _, f := range fields {
+		c.writeBulkString(f)
+		c.writeBulk(h[f])
+	}
+}
+
+func cmdHIncrBy(c *conn, args [][]byte) {
+	by, ok := parseInt(args[2])
+	if !ok {
+		c.writeError(msgNotInt)
+		return
+	}
+	h, ok := c.hash(string(args[0]), true)
+	if !ok {
+		return
+	}
+	f := string(args[1])
+	i := int64(0)
+	if v, exists := h[f]; exists {
+		if i, ok = parseInt(v); !ok {
+			c.writeError("ERR hash value is not an integer")
+			return
+		}
+	}
+	if by > 0 && i > math.MaxInt64-by || by < 0 && i < math.MinInt64-by {
+		c.writeError(msgOverflow)
+		return
+	}
+	i += by
+	h[f] = []byte(strconv.FormatInt(i, 10))
+	c.writeInt(i)
+}
+
+func cmdHIncrByFloat(c *conn, args [][]byte) {
+	by, ok := parseFloat(args[2])
+	if !ok {
+		c.writeError(msgNotFloat)
+		return
+	}
+	h, ok := c.hash(string(args[0]), true)
+	if !ok {
+		return
+	}
+	f := string(args[1])
+	v := 0.0
+	if b, exists := h[f]; exists {
+		if v, ok = parseFloat(b); !ok {
+			c.writeError("ERR hash value is not a float")
+			return
+		}
+	}
+	v += by
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		c.writeError("ERR increment would produce NaN or Infinity")
+		return
+	}
+	s := formatFloat(v)
+	h[f] = []byte(s)
+	c.writeBulkString(s)
+}
+
+func cmdHKeys(c *conn, args [][]byte) {
+	if h, ok := c.hash(string(args[0]), false); ok {
+		c.writeStrings(h.fields())
+	}
+}
+
+func cmdHLen(c *conn, args [][]byte) {
+	if h, ok := c.hash(string(args[0]), false); ok {
+		c.writeInt(int64(len(h)))
+	}
+}
+
+func cmdHMGet(c *conn, args [][]byte) {
+	h, ok := c.hash(string(args[0]), false)
+	if !ok {
+		return
+	}
+	c.writeArray(len(args) - 1)
+	for _, f := range args[1:] {
+		c.writeBulk(h[string(f)])
+	}
+}
+
+func cmdHMSet(c *conn, args [][]byte) {
+	if c.hset(args) >= 0 {
+		c.writeOK()
+	}
+}
+
+func cmdHSet(c *conn, args [][]byte) {
+	if n := c.hset(args); n >= 0 {
+		c.writeInt(int64(n))
+	}
+}
+
+// hset sets the field value pairs and returns the number of new fields
+// or -1 if an error was written.
+func (c *conn) hset(args [][]byte) int {
+	if len(args)%2 != 1 {
+		c.writeError("ERR wrong number of arguments for 'hset' command")
+		return -1
+	}
+	h, ok := c.hash(string(args[0]), true)
+	if !ok {
+		return -1
+	}
+	n := 0
+	for i := 1; i < len(args); i += 2 {
+		if _, exists := h[string(args[i])]; !exists {
+			n++
+		}
+		h[string(args[i])] = args[i+1]
+	}
+	return n
+}
+
+func cmdHSetNX(c *conn, args [][]byte) {
+	h, ok := c.hash(string(args[0]), true)
+	if !ok {
+		return
+	}
+	if _, exists := h[string(args[1])]; exists {
+		c.writeInt(0)
+		return
+	}
+	h[string(args[1])] = args[2]
+	c.writeInt(1)
+}
+
+func cmdHVals(c *conn, args [][]byte) {
+	h, ok := c.hash(string(args[0]), false)
+	if !ok {
+		return
+	}
+	fields := h.fields()
+	c.writeArray(len(fields))
+	for _, f := range fields {
+		c.writeBulk(h[f])
+	}
+}
+
+// fields returns the sorted fields so replies are deterministic.
+func (h hash) fields() []string {
+	fields := make([]string, 0, len(h))
+	for f := range h {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
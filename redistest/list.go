@@ -0,0 +1,288 @@
+package redistest
+
+import (
+	"bytes"
+	"strings"
+)
+
+func cmdLIndex(c *conn, args [][]byte) {
+	i, ok := parseInt(args[1])
+	if !ok {
+		c.writeError(msgNotInt)
+		return
+	}
+	l, ok := c.list(string(args[0]), false)
+	if !ok {
+		return
+	}
+	if l == nil {
+		c.writeNull()
+		return
+	}
+	if i < 0 {
+		i += int64(len(l.items))
+	}
+	if i < 0 || i >= int64(len(l.items)) {
+		c.writeNull()
+		return
+	}
+	c.writeBulk(l.items[i])
+}
+
+func cmdLLen(c *conn, args [][]byte) {
+	if l, ok := c.list(string(args[0]), false); ok {
+		if l == nil {
+			c.writeInt(0)
+		} else {
+			c.writeInt(int64(len(l.items)))
+		}
+	}
+}
+
+func cmdLMove(c *conn, args [][]byte) {
+	from, to := strings.ToLower(string(args[2])), strings.ToLower(string(args[3]))
+	if from != "left" && from != "right" || to != "left" && to != "right" {
+		c.writeError(msgSyntax)
+		return
+	}
+	c.lmove(string(args[0]), string(args[1]), from == "left", to == "left")
+}
+
+func cmdRPopLPush(c *conn, args [][]byte) {
+	c.lmove(string(args[0]), string(args[1]), false, true)
+}
+
+func (c *conn) lmove(src, dst string, fromLeft, toLeft bool) {
+	sl, ok := c.list(src, false)
+	if !ok {
+		return
+	}
+	if sl == nil {
+		c.writeNull()
+		return
+	}
+	// Check the type of the destination before modifying the source
+	if _, ok := c.list(dst, false); !ok {
+		return
+	}
+	v := sl.pop(fromLeft)
+	c.removeIfEmpty(src)
+	dl, _ := c.list(dst, true)
+	dl.push(toLeft, v)
+	c.writeBulk(v)
+}
+
+func cmdLPop(c *conn, args [][]byte) {
+	c.pop(args, true)
+}
+
+func cmdRPop(c *conn, args [][]byte) {
+	c.pop(args, false)
+}
+
+func (c *conn) pop(args [][]byte, left bool) {
+	key := string(args[0])
+	count := int64(-1)
+	if len(args) > 2 {
+		c.writeError(msgSyntax)
+		return
+	} else if len(args) == 2 {
+		var ok bool
+		if count, ok = parseInt(args[1]); !ok || count < 0 {
+			c.writeError("ERR value is out of range, must be positive")
+			return
+		}
+	}
+	l, ok := c.list(key, false)
+	if !ok {
+		return
+	}
+	if l == nil {
+		if count < 0 {
+			c.writeNull()
+		} else {
+			c.writeNullArray()
+		}
+		return
+	}
+	if count < 0 {
+		c.writeBulk(l.pop(left))
+	} else {
+		if count > int64(len(l.items)) {
+			count = int64(len(l.items))
+		}
+		c.writeArray(int(count))
+		for i := int64(0); i < count; i++ {
+			c.writeBulk(l.pop(left))
+		}
+	}
+	c.removeIfEmpty(key)
+}
+
+func cmdLPush(c *conn, args [][]byte) {
+	c.push(args, true, true)
+}
+
+func cmdLPushX(c *conn, args [][]byte) {
+	c.push(args, true, false)
+}
+
+func cmdRPush(c *conn, args [][]byte) {
+	c.push(args, false, true)
+}
+
+func cmdRPushX(c *conn, args [][]byte) {
+	c.push(args, false, false)
+}
+
+func (c *conn) push(args [][]byte, left, create bool) {
+	l, ok := c.list(string(args[0]), create)
+	if !ok {
+		return
+	}
+	if l == nil {
+		c.writeInt(0)
+		return
+	}
+	for _, v := range args[1:] {
+		l.push(left, v)
+	}
+	c.writeInt(int64(len(l.items)))
+}
+
+func cmdLRange(c *conn, args [][]byte) {
+	start, ok1 := parseInt(args[1])
+	stop, ok2 := parseInt(args[2])
+	if !ok1 || !ok2 {
+		c.writeError(msgNotInt)
+		return
+	}
+	l, ok := c.list(string(args[0]), false)
+	if !ok {
+		return
+	}
+	if l == nil {
+		c.writeArray(0)
+		return
+	}
+	s, e, ok := normalizeRange(start, stop, len(l.items))
+	if !ok {
+		c.writeArray(0)
+		return
+	}
+	c.writeBulks(l.items[s:e])
+}
+
+func cmdLRem(c *conn, args [][]byte) {
+	key := string(args[0])
+	count, ok := parseInt(args[1])
+	if !ok {
+		c.writeError(msgNotInt)
+		return
+	}
+	l, ok := c.list(key, false)
+	if !ok {
+		return
+	}
+	if l == nil {
+		c.writeInt(0)
+		return
+	}
+	removed := int64(0)
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	items := l.items
+	keep := make([][]byte, 0, len(items))
+	if count >= 0 {
+		for _, v := range items {
+			if bytes.Equal(v, args[2]) && (limit == 0 || removed < limit) {
+				removed++
+			} else {
+				keep = append(keep, v)
+			}
+		}
+	} else {
+		// Remove from the tail
+		for i := len(items) - 1; i >= 0; i-- {
+			if bytes.Equal(items[i], args[2]) && removed < limit {
+				removed++
+			} else {
+				keep = append(keep, items[i])
+			}
+		}
+		for i, j := 0, len(keep)-1; i < j; i, j = i+1, j-1 {
+			keep[i], keep[j] = keep[j], keep[i]
+		}
+	}
+	l.items = keep
+	c.removeIfEmpty(key)
+	c.writeInt(removed)
+}
+
+func cmdLSet(c *conn, args [][]byte) {
+	i, ok := parseInt(args[1])
+	if !ok {
+		c.writeError(msgNotInt)
+		return
+	}
+	l, ok := c.list(string(args[0]), false)
+	if !ok {
+		return
+	}
+	if l == nil {
+		c.writeError(msgNoSuchKey)
+		return
+	}
+	if i < 0 {
+		i += int64(len(l.items))
+	}
+	if i < 0 || i >= int64(len(l.items)) {
+		c.writeError(msgOutOfRange)
+		return
+	}
+	l.items[i] = args[2]
+	c.writeOK()
+}
+
+func cmdLTrim(c *conn, args [][]byte) {
+	key := string(args[0])
+	start, ok1 := parseInt(args[1])
+	stop, ok2 := parseInt(args[2])
+	if !ok1 || !ok2 {
+		c.writeError(msgNotInt)
+		return
+	}
+	l, ok := c.list(key, false)
+	if !ok {
+		return
+	}
+	if l != nil {
+		if s, e, ok := normalizeRange(start, stop, len(l.items)); ok {
+			l.items = append([][]byte{}, l.items[s:e]...)
+		} else {
+			l.items = nil
+		}
+		c.removeIfEmpty(key)
+	}
+	c.writeOK()
+}
+
+func (l *list) push(left bool, v []byte) {
+	if left {
+		l.items = append([][]byte{v}, l.items...)
+	} else {
+		l.items = append(l.items, v)
+	}
+}
+
+func (l *list) pop(left bool) []byte {
+	var v []byte
+	if left {
+		v, l.items = l.items[0], l.items[1:]
+	} else {
+		v, l.items = l.items[len(l.items)-1], l.items[:len(l.items)-1]
+	}
+	return v
+}
@@ -0,0 +1,145 @@
+package redistest
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const maxBulkLen = 512 * 1024 * 1024
+
+type protocolError string
+
+func (e protocolError) Error() string {
+	return "redistest: protocol error: " + string(e)
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// readCommand reads a command as a multi-bulk request or an inline
+// command as sent by telnet.
+func readCommand(r *bufio.Reader) ([][]byte, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		fields := strings.Fields(line)
+		args := make([][]byte, len(fields))
+		for i, f := range fields {
+			args[i] = []byte(f)
+		}
+		return args, nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > 1024*1024 {
+		return nil, protocolError("invalid multibulk length")
+	}
+	args := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			return nil, protocolError("expected '$', got an empty line")
+		}
+		if line[0] != '$' {
+			return nil, protocolError("expected '$', got '" + line[:1] + "'")
+		}
+		l, err := strconv.Atoi(line[1:])
+		if err != nil || l < 0 || l > maxBulkLen {
+			return nil, protocolError("invalid bulk length")
+		}
+		b := make([]byte, l+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args = append(args, b[:l])
+	}
+	return args, nil
+}
+
+func (c *conn) writeLine(marker byte, s string) {
+	c.w.WriteByte(marker)
+	c.w.WriteString(s)
+	c.w.WriteString("\r\n")
+}
+
+func (c *conn) writeStatus(s string) {
+	c.writeLine('+', s)
+}
+
+func (c *conn) writeOK() {
+	c.writeStatus("OK")
+}
+
+func (c *conn) writeError(s string) {
+	c.writeLine('-', s)
+}
+
+func (c *conn) writeInt(i int64) {
+	c.writeLine(':', strconv.FormatInt(i, 10))
+}
+
+func (c *conn) writeBool(b bool) {
+	if b {
+		c.writeInt(1)
+	} else {
+		c.writeInt(0)
+	}
+}
+
+// writeBulk writes b as a bulk reply or a null bulk reply if b is nil.
+func (c *conn) writeBulk(b []byte) {
+	if b == nil {
+		c.writeNull()
+		return
+	}
+	c.writeLine('$', strconv.Itoa(len(b)))
+	c.w.Write(b)
+	c.w.WriteString("\r\n")
+}
+
+func (c *conn) writeBulkString(s string) {
+	c.writeLine('$', strconv.Itoa(len(s)))
+	c.w.WriteString(s)
+	c.w.WriteString("\r\n")
+}
+
+func (c *conn) writeNull() {
+	c.w.WriteString("$-1\r\n")
+}
+
+func (c *conn) writeArray(n int) {
+	c.writeLine('*', strconv.Itoa(n))
+}
+
+func (c *conn) writeNullArray() {
+	c.w.WriteString("*-1\r\n")
+}
+
+func (c *conn) writeBulks(values [][]byte) {
+	c.writeArray(len(values))
+	for _, v := range values {
+		c.writeBulk(v)
+	}
+}
+
+func (c *conn) writeStrings(values []string) {
+	c.writeArray(len(values))
+	for _, v := range values {
+		c.writeBulkString(v)
+	}
+}
+
+func (c *conn) writeFloat(f float64) {
+	c.writeBulkString(formatFloat(f))
+}
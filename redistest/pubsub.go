@@ -0,0 +1,159 @@
+package redistest
+
+func (c *conn) subscribed() bool {
+	return len(c.channels) > 0 || len(c.patterns) > 0
+}
+
+func (c *conn) subscriptions() int64 {
+	return int64(len(c.channels) + len(c.patterns))
+}
+
+func cmdSubscribe(c *conn, args [][]byte) {
+	if c.channels == nil {
+		c.channels = make(map[string]bool)
+	}
+	for _, ch := range args {
+		name := string(ch)
+		c.channels[name] = true
+		subs := c.s.channels[name]
+		if subs == nil {
+			subs = make(map[*conn]bool)
+			c.s.channels[name] = subs
+		}
+		subs[c] = true
+		c.writeSubscription("subscribe", name)
+	}
+}
+
+func cmdPSubscribe(c *conn, args [][]byte) {
+	if c.patterns == nil {
+		c.patterns = make(map[string]bool)
+	}
+	for _, p := range args {
+		name := string(p)
+		c.patterns[name] = true
+		subs := c.s.patterns[name]
+		if subs == nil {
+			subs = make(map[*conn]bool)
+			c.s.patterns[name] = subs
+		}
+		subs[c] = true
+		c.writeSubscription("psubscribe", name)
+	}
+}
+
+func cmdUnsubscribe(c *conn, args [][]byte) {
+	names := make([]string, len(args))
+	for i, ch := range args {
+		names[i] = string(ch)
+	}
+	if len(names) == 0 {
+		for ch := range c.channels {
+			names = append(names, ch)
+		}
+		if len(names) == 0 {
+			c.writeArray(3)
+			c.writeBulkString("unsubscribe")
+			c.writeNull()
+			c.writeInt(c.subscriptions())
+			return
+		}
+	}
+	for _, ch := range names {
+		c.unsubscribe(ch)
+		c.writeSubscription("unsubscribe", ch)
+	}
+}
+
+func cmdPUnsubscribe(c *conn, args [][]byte) {
+	names := make([]string, len(args))
+	for i, p := range args {
+		names[i] = string(p)
+	}
+	if len(names) == 0 {
+		for p := range c.patterns {
+			names = append(names, p)
+		}
+		if len(names) == 0 {
+			c.writeArray(3)
+			c.writeBulkString("punsubscribe")
+			c.writeNull()
+			c.writeInt(c.subscriptions())
+			return
+		}
+	}
+	for _, p := range names {
+		c.punsubscribe(p)
+		c.writeSubscription("punsubscribe", p)
+	}
+}
+
+func (c *conn) writeSubscription(kind, name string) {
+	c.writeArray(3)
+	c.writeBulkString(kind)
+	c.writeBulkString(name)
+	c.writeInt(c.subscriptions())
+}
+
+func (c *conn) unsubscribe(ch string) {
+	delete(c.channels, ch)
+	if subs := c.s.channels[ch]; subs != nil {
+		delete(subs, c)
+		if len(subs) == 0 {
+			delete(c.s.channels, ch)
+		}
+	}
+}
+
+func (c *conn) punsubscribe(p string) {
+	delete(c.patterns, p)
+	if subs := c.s.patterns[p]; subs != nil {
+		delete(subs, c)
+		if len(subs) == 0 {
+			delete(c.s.patterns, p)
+		}
+	}
+}
+
+func (c *conn) unsubscribeAll() {
+	for ch := range c.channels {
+		c.unsubscribe(ch)
+	}
+	for p := range c.patterns {
+		c.punsubscribe(p)
+	}
+}
+
+// cmdPublish writes the message directly to the subscribers since the
+// caller holds the server lock.
+func cmdPublish(c *conn, args [][]byte) {
+	ch, msg := string(args[0]), args[1]
+	n := 0
+	for sub := range c.s.channels[ch] {
+		sub.writeArray(3)
+		sub.writeBulkString("message")
+		sub.writeBulkString(ch)
+		sub.writeBulk(msg)
+		if sub != c {
+			sub.w.Flush()
+		}
+		n++
+	}
+	for p, subs := range c.s.patterns {
+		if !match(p, ch) {
+			continue
+		}
+		for sub := range subs {
+			sub.writeArray(4)
+			sub.writeBulkString("pmessage")
+			sub.writeBulkString(p)
+			sub.writeBulkString(ch)
+			sub.writeBulk(msg)
+			if sub != c {
+				sub.w.Flush()
+			}
+			n++
+		}
+	}
+	c.writeInt(int64(n))
+}
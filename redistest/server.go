@@ -0,0 +1,236 @@
+// Package redistest provides an in-memory Redis server for tests.
+//
+// The server speaks the Redis protocol on a random localhost port and
+// implements strings, keys with expiration, hashes, lists, sets, sorted
+// sets, transactions (MULTI/EXEC/WATCH) and pub/sub. Commands are run one
+// at a time like on a real server.
+package redistest
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const numDatabases = 16
+
+// Server is an in-memory Redis server. Use NewServer to start one.
+type Server struct {
+	l net.Listener
+
+	// mu is held while running a command which makes every command
+	// atomic.
+	mu       sync.Mutex
+	dbs      [numDatabases]*database
+	offset   time.Duration
+	conns    map[*conn]bool
+	channels map[string]map[*conn]bool
+	patterns map[string]map[*conn]bool
+	versions map[string]uint64
+	epoch    uint64
+	nextID   int64
+	closed   bool
+
+	wg sync.WaitGroup
+}
+
+// NewServer starts a server listening on a random port on localhost. It
+// panics if it can't listen, like httptest.NewServer.
+func NewServer() *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("redistest: failed to listen on a port: " + err.Error())
+	}
+	s := &Server{
+		l:        l,
+		conns:    make(map[*conn]bool),
+		channels: make(map[string]map[*conn]bool),
+		patterns: make(map[string]map[*conn]bool),
+		versions: make(map[string]uint64),
+	}
+	for i := range s.dbs {
+		s.dbs[i] = newDatabase()
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Addr returns the address the server listens on in host:port form.
+func (s *Server) Addr() string {
+	return s.l.Addr().String()
+}
+
+// Close stops the server and closes all client connections.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.conns {
+		c.nc.Close()
+	}
+	s.mu.Unlock()
+	s.l.Close()
+	s.wg.Wait()
+}
+
+// FastForward moves the clock of the server forward which expires keys
+// without having to sleep in tests.
+func (s *Server) FastForward(d time.Duration) {
+	s.mu.Lock()
+	s.offset += d
+	s.mu.Unlock()
+}
+
+// FlushAll removes all keys from all databases.
+func (s *Server) FlushAll() {
+	s.mu.Lock()
+	s.flushAll()
+	s.mu.Unlock()
+}
+
+func (s *Server) flushAll() {
+	for i := range s.dbs {
+		s.dbs[i] = newDatabase()
+	}
+	s.epoch++
+}
+
+func (s *Server) now() time.Time {
+	return time.Now().Add(s.offset)
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			nc.Close()
+			return
+		}
+		s.nextID++
+		c := &conn{
+			s:  s,
+			nc: nc,
+			r:  bufio.NewReader(nc),
+			w:  bufio.NewWriter(nc),
+			id: s.nextID,
+		}
+		s.conns[c] = true
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go c.serve()
+	}
+}
+
+// conn is the state of a client connection. All fields are guarded by
+// Server.mu.
+type conn struct {
+	s  *Server
+	nc net.Conn
+	r  *bufio.Reader
+	w  *bufio.Writer
+
+	id   int64
+	db   int
+	name string
+	quit bool
+
+	multi    bool
+	multiErr bool
+	queued   [][][]byte
+	watched  map[string]uint64
+	epoch    uint64
+
+	channels map[string]bool
+	patterns map[string]bool
+}
+
+func (c *conn) serve() {
+	defer c.s.wg.Done()
+	defer c.close()
+	for {
+		args, err := readCommand(c.r)
+		if err != nil {
+			if perr, ok := err.(protocolError); ok {
+				c.s.mu.Lock()
+				c.writeError("ERR Protocol error: " + string(perr))
+				c.w.Flush()
+				c.s.mu.Unlock()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		c.s.mu.Lock()
+		c.exec(args)
+		quit := c.quit
+		if c.r.Buffered() == 0 || quit {
+			// Replies to pipelined commands are written in one go
+			c.w.Flush()
+		}
+		c.s.mu.Unlock()
+		if quit {
+			return
+		}
+	}
+}
+
+func (c *conn) close() {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	c.unsubscribeAll()
+	delete(c.s.conns, c)
+	c.nc.Close()
+}
+
+func (c *conn) database() *database {
+	return c.s.dbs[c.db]
+}
+
+// exec runs a command or queues it inside a transaction.
+func (c *conn) exec(args [][]byte) {
+	name := strings.ToLower(string(args[0]))
+	cmd, ok := commands[name]
+	if !ok {
+		c.multiErr = c.multi
+		c.writeError("ERR unknown command '" + string(args[0]) + "'")
+		return
+	}
+	if cmd.arity > 0 && len(args) != cmd.arity || cmd.arity < 0 && len(args) < -cmd.arity {
+		c.multiErr = c.multi
+		c.writeError("ERR wrong number of arguments for '" + name + "' command")
+		return
+	}
+	if c.subscribed() && cmd.flags&flagPubSub == 0 {
+		c.writeError("ERR Can't execute '" + name + "': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context")
+		return
+	}
+	if c.multi && cmd.flags&flagTx == 0 {
+		c.queued = append(c.queued, args)
+		c.writeStatus("QUEUED")
+		return
+	}
+	c.call(cmd, args)
+}
+
+func (c *conn) call(cmd *command, args [][]byte) {
+	cmd.fn(c, args[1:])
+	if cmd.flags&flagWrite != 0 {
+		for _, k := range cmd.keys(args) {
+			c.s.versions[c.versionKey(k)]++
+		}
+	}
+}
+
+func (c *conn) versionKey(key string) string {
+	return strconv.Itoa(c.db) + ":" + key
+}
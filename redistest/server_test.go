@@ -0,0 +1,321 @@
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testClient struct {
+	t  *testing.T
+	nc net.Conn
+	r  *bufio.Reader
+}
+
+func dial(t *testing.T, s *Server) *testClient {
+	nc, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testClient{t, nc, bufio.NewReader(nc)}
+}
+
+func (c *testClient) send(args ...string) {
+	b := fmt.Sprintf("*%d\r\n", len(args))
+	for _, a := range args {
+		b += fmt.Sprintf("$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := c.nc.Write([]byte(b)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// read returns a reply formatted like redis-cli without the type hints.
+func (c *testClient) read() string {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '+', '-', ':':
+		return line
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return "nil"
+		}
+		b := make([]byte, n+2)
+		if _, err := c.r.Read(b); err != nil {
+			c.t.Fatal(err)
+		}
+		return string(b[:n])
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return "nil"
+		}
+		items := make([]string, n)
+		for i := range items {
+			items[i] = c.read()
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	}
+	c.t.Fatalf("invalid reply %q", line)
+	return ""
+}
+
+func (c *testClient) do(args ...string) string {
+	c.send(args...)
+	return c.read()
+}
+
+func (c *testClient) expect(reply string, args ...string) {
+	c.t.Helper()
+	if r := c.do(args...); r != reply {
+		c.t.Fatalf("%s returned %s instead of %s", strings.Join(args, " "), r, reply)
+	}
+}
+
+func TestStrings(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	c := dial(t, s)
+
+	c.expect("+PONG", "PING")
+	c.expect("nil", "GET", "foo")
+	c.expect("+OK", "SET", "foo", "bar")
+	c.expect("bar", "GET", "foo")
+	c.expect("nil", "SET", "foo", "baz", "NX")
+	c.expect("bar", "SET", "foo", "baz", "XX", "GET")
+	c.expect(":1", "INCR", "n")
+	c.expect(":11", "INCRBY", "n", "10")
+	c.expect(":10", "DECR", "n")
+	c.expect("1.5", "INCRBYFLOAT", "f", "1.5")
+	c.expect("-ERR value is not an integer or out of range", "INCR", "foo")
+	c.expect("+OK", "MSET", "a", "1", "b", "2")
+	c.expect("[1 nil 2]", "MGET", "a", "missing", "b")
+	c.expect(":6", "APPEND", "foo", "zap")
+	c.expect("bazzap", "GET", "foo")
+	c.expect("-ERR wrong number of arguments for 'get' command", "GET")
+	c.expect("-ERR unknown command 'FOO'", "FOO")
+}
+
+func TestKeys(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	c := dial(t, s)
+
+	c.expect("+OK", "SET", "foo", "bar", "EX", "10")
+	c.expect(":10", "TTL", "foo")
+	c.expect(":-2", "TTL", "missing")
+	c.expect("+OK", "SET", "baz", "1")
+	c.expect(":-1", "TTL", "baz")
+	c.expect("[baz foo]", "KEYS", "*")
+	c.expect("[foo]", "KEYS", "f?[o-z]")
+	c.expect("+string", "TYPE", "foo")
+	s.FastForward(11 * time.Second)
+	c.expect("nil", "GET", "foo")
+	c.expect(":1", "EXISTS", "baz", "foo")
+	c.expect(":1", "PEXPIRE", "baz", "100")
+	c.expect(":1", "PERSIST", "baz")
+	c.expect("+OK", "RENAME", "baz", "qux")
+	c.expect(":1", "DEL", "qux", "missing")
+	c.expect(":0", "DBSIZE")
+
+	c.expect("+OK", "SELECT", "1")
+	c.expect("+OK", "SET", "foo", "1")
+	c.expect("+OK", "SELECT", "0")
+	c.expect("nil", "GET", "foo")
+
+	for i := 0; i < 15; i++ {
+		c.expect("+OK", "SET", fmt.Sprintf("k%02d", i), "v")
+	}
+	c.expect("[10 [k00 k01 k02 k03 k04 k05 k06 k07 k08 k09]]", "SCAN", "0")
+	c.expect("[0 [k10 k11 k12 k13 k14]]", "SCAN", "10")
+}
+
+func TestHashes(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	c := dial(t, s)
+
+	c.expect(":2", "HSET", "h", "a", "1", "b", "2")
+	c.expect("1", "HGET", "h", "a")
+	c.expect("[a 1 b 2]", "HGETALL", "h")
+	c.expect(":12", "HINCRBY", "h", "a", "11")
+	c.expect("[12 nil]", "HMGET", "h", "a", "c")
+	c.expect(":1", "HDEL", "h", "a")
+	c.expect(":1", "HLEN", "h")
+	c.expect("-WRONGTYPE Operation against a key holding the wrong kind of value", "GET", "h")
+	c.expect(":1", "HDEL", "h", "b")
+	c.expect(":0", "EXISTS", "h")
+}
+
+func TestLists(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	c := dial(t, s)
+
+	c.expect(":3", "RPUSH", "l", "a", "b", "c")
+	c.expect(":4", "LPUSH", "l", "z")
+	c.expect("[z a b c]", "LRANGE", "l", "0", "-1")
+	c.expect("c", "LMOVE", "l", "l2", "RIGHT", "LEFT")
+	c.expect("[c]", "LRANGE", "l2", "0", "-1")
+	c.expect("z", "LPOP", "l")
+	c.expect("[a b]", "LPOP", "l", "5")
+	c.expect(":0", "LLEN", "l")
+	c.expect(":4", "RPUSH", "r", "x", "y", "x", "x")
+	c.expect(":2", "LREM", "r", "-2", "x")
+	c.expect("[x y]", "LRANGE", "r", "0", "-1")
+}
+
+func TestSets(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	c := dial(t, s)
+
+	c.expect(":3", "SADD", "s", "a", "b", "c")
+	c.expect(":0", "SADD", "s", "a")
+	c.expect(":2", "SADD", "t", "b", "d")
+	c.expect("[a b c]", "SMEMBERS", "s")
+	c.expect("[b]", "SINTER", "s", "t")
+	c.expect("[a b c d]", "SUNION", "s", "t")
+	c.expect("[a c]", "SDIFF", "s", "t")
+	c.expect(":1", "SISMEMBER", "s", "a")
+	c.expect(":1", "SREM", "s", "a")
+	c.expect(":2", "SCARD", "s")
+}
+
+func TestSortedSets(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	c := dial(t, s)
+
+	c.expect(":3", "ZADD", "z", "1", "a", "2", "b", "3", "c")
+	c.expect("[a 1 b 2]", "ZRANGE", "z", "0", "1", "WITHSCORES")
+	c.expect("[c b]", "ZREVRANGE", "z", "0", "1")
+	c.expect("[b c]", "ZRANGEBYSCORE", "z", "(1", "+inf")
+	c.expect("[c]", "ZRANGE", "z", "+inf", "2", "BYSCORE", "REV", "LIMIT", "0", "1")
+	c.expect("4.5", "ZINCRBY", "z", "2.5", "b")
+	c.expect(":2", "ZRANK", "z", "b")
+	c.expect(":1", "ZADD", "z", "CH", "GT", "5", "a", "0", "c")
+	c.expect("[c 3 b 4.5 a 5]", "ZRANGE", "z", "0", "-1", "WITHSCORES")
+	c.expect(":2", "ZCOUNT", "z", "4", "inf")
+	c.expect("[c 3]", "ZPOPMIN", "z")
+	c.expect(":1", "ZREMRANGEBYSCORE", "z", "-inf", "(5")
+	c.expect(":1", "ZCARD", "z")
+}
+
+func TestTransactions(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	c := dial(t, s)
+	c2 := dial(t, s)
+
+	c.expect("+OK", "MULTI")
+	c.expect("+QUEUED", "SET", "a", "1")
+	c.expect("+QUEUED", "INCR", "a")
+	c.expect("[+OK :2]", "EXEC")
+
+	c.expect("+OK", "WATCH", "a")
+	c2.expect("+OK", "SET", "a", "5")
+	c.expect("+OK", "MULTI")
+	c.expect("+QUEUED", "INCR", "a")
+	c.expect("nil", "EXEC")
+	c.expect("5", "GET", "a")
+
+	c.expect("+OK", "MULTI")
+	c.expect("-ERR unknown command 'NOPE'", "NOPE")
+	c.expect("-EXECABORT Transaction discarded because of previous errors.", "EXEC")
+}
+
+func TestPubSub(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	sub := dial(t, s)
+	pub := dial(t, s)
+
+	sub.expect("[subscribe news :1]", "SUBSCRIBE", "news")
+	sub.expect("[psubscribe n* :2]", "PSUBSCRIBE", "n*")
+	sub.expect("-ERR Can't execute 'get': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", "GET", "foo")
+	pub.expect(":2", "PUBLISH", "news", "hello")
+	if m := sub.read(); m != "[message news hello]" {
+		t.Fatalf("subscriber received %s", m)
+	}
+	if m := sub.read(); m != "[pmessage n* news hello]" {
+		t.Fatalf("subscriber received %s", m)
+	}
+	sub.expect("[unsubscribe news :1]", "UNSUBSCRIBE")
+	pub.expect(":0", "PUBLISH", "other", "hello")
+}
+
+func TestPipelining(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	c := dial(t, s)
+	c.send("SET", "a", "1")
+	c.send("INCR", "a")
+	c.send("GET", "a")
+	for _, r := range []string{"+OK", ":2", "2"} {
+		if got := c.read(); got != r {
+			t.Fatalf("pipelined reply %s instead of %s", got, r)
+		}
+	}
+	if _, err := c.nc.Write([]byte("PING\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if r := c.read(); r != "+PONG" {
+		t.Fatalf("inline PING returned %s", r)
+	}
+}
+
+func TestReadCommand(t *testing.T) {
+	if args, err := readCommand(bufio.NewReader(strings.NewReader("*2\r\n$3\r\nGET\r\n$1\r\na\r\n"))); err != nil {
+		t.Fatal(err)
+	} else if len(args) != 2 || string(args[0]) != "GET" || string(args[1]) != "a" {
+		t.Fatalf("readCommand returned %q", args)
+	}
+	for _, req := range []string{
+		"*-1\r\n",
+		"*1\r\n\r\n",
+		"*1\r\n+GET\r\n",
+		"*1\r\n$-1\r\n",
+		"*1\r\n$9223372036854775000\r\n",
+	} {
+		if _, err := readCommand(bufio.NewReader(strings.NewReader(req))); err == nil {
+			t.Errorf("readCommand should fail for %q", req)
+		} else if _, ok := err.(protocolError); !ok {
+			t.Errorf("readCommand returned %+v instead of a protocol error for %q", err, req)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"*", "anything", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "heeeello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"__keyspace@0__:*", "__keyspace@0__:foo", true},
+	}
+	for _, c := range cases {
+		if m := match(c.pattern, c.s); m != c.match {
+			t.Errorf("match(%q, %q) = %t", c.pattern, c.s, m)
+		}
+	}
+}
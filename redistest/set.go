@@ -0,0 +1,217 @@
+package redistest
+
+import (
+	"sort"
+)
+
+func cmdSAdd(c *conn, args [][]byte) {
+	s, ok := c.set(string(args[0]), true)
+	if !ok {
+		return
+	}
+	n := 0
+	for _, m := range args[1:] {
+		if _, exists := s[string(m)]; !exists {
+			s[string(m)] = struct{}{}
+			n++
+		}
+	}
+	c.writeInt(int64(n))
+}
+
+func cmdSCard(c *conn, args [][]byte) {
+	if s, ok := c.set(string(args[0]), false); ok {
+		c.writeInt(int64(len(s)))
+	}
+}
+
+func cmdSDiff(c *conn, args [][]byte) {
+	c.setOp(args, func(acc, s set) set {
+		for m := range s {
+			delete(acc, m)
+		}
+		return acc
+	})
+}
+
+func cmdSInter(c *conn, args [][]byte) {
+	c.setOp(args, func(acc, s set) set {
+		for m := range acc {
+			if _, ok := s[m]; !ok {
+				delete(acc, m)
+			}
+		}
+		return acc
+	})
+}
+
+func cmdSUnion(c *conn, args [][]byte) {
+	c.setOp(args, func(acc, s set) set {
+		for m := range s {
+			acc[m] = struct{}{}
+		}
+		return acc
+	})
+}
+
+// setOp folds the sets at the keys in args with op starting with a copy of
+// the first set.
+func (c *conn) setOp(args [][]byte, op func(acc, s set) set) {
+	sets := make([]set, len(args))
+	for i, k := range args {
+		var ok bool
+		if sets[i], ok = c.set(string(k), false); !ok {
+			return
+		}
+	}
+	acc := make(set)
+	for m := range sets[0] {
+		acc[m] = struct{}{}
+	}
+	for _, s := range sets[1:] {
+		acc = op(acc, s)
+	}
+	c.writeStrings(acc.members())
+}
+
+func cmdSIsMember(c *conn, args [][]byte) {
+	if s, ok := c.set(string(args[0]), false); ok {
+		_, exists := s[string(args[1])]
+		c.writeBool(exists)
+	}
+}
+
+func cmdSMembers(c *conn, args [][]byte) {
+	if s, ok := c.set(string(args[0]), false); ok {
+		c.writeStrings(s.members())
+	}
+}
+
+func cmdSMIsMember(c *conn, args [][]byte) {
+	s, ok := c.set(string(args[0]), false)
+	if !ok {
+		return
+	}
+	c.writeArray(len(args) - 1)
+	for _, m := range args[1:] {
+		_, exists := s[string(m)]
+		c.writeBool(exists)
+	}
+}
+
+func cmdSMove(c *conn, args [][]byte) {
+	src, dst, m := string(args[0]), string(args[1]), string(args[2])
+	ss, ok := c.set(src, false)
+	if !ok {
+		return
+	}
+	if _, ok := c.set(dst, false); !ok {
+		return
+	}
+	if _, exists := ss[m]; !exists {
+		c.writeInt(0)
+		return
+	}
+	delete(ss, m)
+	c.removeIfEmpty(src)
+	ds, _ := c.set(dst, true)
+	ds[m] = struct{}{}
+	c.writeInt(1)
+}
+
+// cmdSPop pops members in sorted order rather than randomly so tests are
+// deterministic.
+func cmdSPop(c *conn, args [][]byte) {
+	key := string(args[0])
+	count := int64(-1)
+	if len(args) > 1 {
+		var ok bool
+		if count, ok = parseInt(args[1]); !ok || count < 0 {
+			c.writeError("ERR value is out of range, must be positive")
+			return
+		}
+	}
+	s, ok := c.set(key, false)
+	if !ok {
+		return
+	}
+	members := s.members()
+	if count < 0 {
+		if len(members) == 0 {
+			c.writeNull()
+			return
+		}
+		delete(s, members[0])
+		c.removeIfEmpty(key)
+		c.writeBulkString(members[0])
+		return
+	}
+	if count > int64(len(members)) {
+		count = int64(len(members))
+	}
+	for _, m := range members[:count] {
+		delete(s, m)
+	}
+	c.removeIfEmpty(key)
+	c.writeStrings(members[:count])
+}
+
+func cmdSRandMember(c *conn, args [][]byte) {
+	s, ok := c.set(string(args[0]), false)
+	if !ok {
+		return
+	}
+	members := s.members()
+	if len(args) == 1 {
+		if len(members) == 0 {
+			c.writeNull()
+		} else {
+			c.writeBulkString(members[0])
+		}
+		return
+	}
+	count, ok := parseInt(args[1])
+	if !ok {
+		c.writeError(msgNotInt)
+		return
+	}
+	if count < 0 {
+		// Negative counts may repeat members
+		out := make([]string, 0, -count)
+		for i := int64(0); i < -count && len(members) > 0; i++ {
+			out = append(out, members[int(i)%len(members)])
+		}
+		c.writeStrings(out)
+		return
+	}
+	if count > int64(len(members)) {
+		count = int64(len(members))
+	}
+	c.writeStrings(members[:count])
+}
+
+func cmdSRem(c *conn, args [][]byte) {
+	key := string(args[0])
+	s, ok := c.set(key, false)
+	if !ok {
+		return
+	}
+	n := 0
+	for _, m := range args[1:] {
+		if _, exists := s[string(m)]; exists {
+			delete(s, string(m))
+			n++
+		}
+	}
+	c.removeIfEmpty(key)
+	c.writeInt(int64(n))
+}
+
+func (s set) members() []string {
+	members := make([]string, 0, len(s))
+	for m := range s {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return members
+}
@@ -0,0 +1,93 @@
+package redistest
+
+import (
+	"strings"
+)
+
+func cmdMulti(c *conn, args [][]byte) {
+	if c.multi {
+		c.writeError("ERR MULTI calls can not be nested")
+		return
+	}
+	c.multi = true
+	c.multiErr = false
+	c.queued = nil
+	c.writeOK()
+}
+
+func cmdDiscard(c *conn, args [][]byte) {
+	if !c.multi {
+		c.writeError("ERR DISCARD without MULTI")
+		return
+	}
+	c.resetTx()
+	c.writeOK()
+}
+
+func cmdExec(c *conn, args [][]byte) {
+	if !c.multi {
+		c.writeError("ERR EXEC without MULTI")
+		return
+	}
+	queued, failed, dirty := c.queued, c.multiErr, c.dirty()
+	c.resetTx()
+	if failed {
+		c.writeError("EXECABORT Transaction discarded because of previous errors.")
+		return
+	}
+	if dirty {
+		c.writeNullArray()
+		return
+	}
+	c.writeArray(len(queued))
+	for _, args := range queued {
+		c.call(commands[strings.ToLower(string(args[0]))], args)
+	}
+}
+
+func cmdWatch(c *conn, args [][]byte) {
+	if c.multi {
+		c.writeError("ERR WATCH inside MULTI is not allowed")
+		return
+	}
+	if c.watched == nil {
+		c.watched = make(map[string]uint64)
+		c.epoch = c.s.epoch
+	}
+	for _, k := range args {
+		vk := c.versionKey(string(k))
+		if _, ok := c.watched[vk]; !ok {
+			c.watched[vk] = c.s.versions[vk]
+		}
+	}
+	c.writeOK()
+}
+
+func cmdUnwatch(c *conn, args [][]byte) {
+	c.watched = nil
+	c.writeOK()
+}
+
+// dirty reports whether a watched key was modified or the database was
+// flushed since WATCH.
+func (c *conn) dirty() bool {
+	if c.watched == nil {
+		return false
+	}
+	if c.epoch != c.s.epoch {
+		return true
+	}
+	for k, v := range c.watched {
+		if c.s.versions[k] != v {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *conn) resetTx() {
+	c.multi = false
+	c.multiErr = false
+	c.queued = nil
+	c.watched = nil
+}
@@ -0,0 +1,566 @@
+package redistest
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+type zmember struct {
+	member string
+	score  float64
+}
+
+// sorted returns the members ordered by score and then lexicographically.
+func (z *zset) sorted() []zmember {
+	members := make([]zmember, 0, len(z.scores))
+	for m, s := range z.scores {
+		members = append(members, zmember{m, s})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].score != members[j].score {
+			return members[i].score < members[j].score
+		}
+		return members[i].member < members[j].member
+	})
+	return members
+}
+
+func (z *zset) rank(member string) int {
+	for i, m := range z.sorted() {
+		if m.member == member {
+			return i
+		}
+	}
+	return -1
+}
+
+// scoreBound is one end of a score range like "(1.5" or "-inf".
+type scoreBound struct {
+	value     float64
+	exclusive bool
+}
+
+func parseScoreBound(b []byte) (scoreBound, bool) {
+	exclusive := len(b) > 0 && b[0] == '('
+	if exclusive {
+		b = b[1:]
+	}
+	f, ok := parseFloat(b)
+	return scoreBound{f, exclusive}, ok
+}
+
+func inScoreRange(score float64, min, max scoreBound) bool {
+	if score < min.value || min.exclusive && score == min.value {
+		return false
+	}
+	if score > max.value || max.exclusive && score == max.value {
+		return false
+	}
+	return true
+}
+
+func (c *conn) writeZMembers(members []zmember, withScores bool) {
+	if withScores {
+		c.writeArray(len(members) * 2)
+	} else {
+		c.writeArray(len(members))
+	}
+	for _, m := range members {
+		c.writeBulkString(m.member)
+		if withScores {
+			c.writeFloat(m.score)
+		}
+	}
+}
+
+func cmdZAdd(c *conn, args [][]byte) {
+	key := string(args[0])
+	var nx, xx, gt, lt, ch, incr bool
+	i := 1
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "gt":
+			gt = true
+		case "lt":
+			lt = true
+		case "ch":
+			ch = true
+		case "incr":
+			incr = true
+		default:
+			break options
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		c.writeError(msgSyntax)
+		return
+	}
+	if nx && xx {
+		c.writeError("ERR XX and NX options at the same time are not compatible")
+		return
+	}
+	if gt && lt || nx && (gt || lt) {
+		c.writeError("ERR GT, LT, and/or NX options at the same time are not compatible")
+		return
+	}
+	if incr && len(pairs) != 2 {
+		c.writeError("ERR INCR option supports a single increment-element pair")
+		return
+	}
+	scores := make([]float64, len(pairs)/2)
+	for j := range scores {
+		var ok bool
+		if scores[j], ok = parseFloat(pairs[j*2]); !ok {
+			c.writeError(msgNotFloat)
+			return
+		}
+	}
+	z, ok := c.zset(key, !xx)
+	if !ok {
+		return
+	}
+	if z == nil {
+		if incr {
+			c.writeNull()
+		} else {
+			c.writeInt(0)
+		}
+		return
+	}
+	added, changed := 0, 0
+	for j, score := range scores {
+		m := string(pairs[j*2+1])
+		cur, exists := z.scores[m]
+		if incr && exists {
+			score += cur
+		}
+		if nx && exists || xx && !exists ||
+			exists && (gt && score <= cur || lt && score >= cur) {
+			if incr {
+				c.removeIfEmpty(key)
+				c.writeNull()
+				return
+			}
+			continue
+		}
+		if math.IsNaN(score) {
+			c.writeError("ERR resulting score is not a number (NaN)")
+			return
+		}
+		z.scores[m] = score
+		if !exists {
+			added++
+		} else if cur != score {
+			changed++
+		}
+		if incr {
+			c.writeFloat(score)
+			return
+		}
+	}
+	c.removeIfEmpty(key)
+	if ch {
+		c.writeInt(int64(added + changed))
+	} else {
+		c.writeInt(int64(added))
+	}
+}
+
+func cmdZCard(c *conn, args [][]byte) {
+	if z, ok := c.zset(string(args[0]), false); ok {
+		if z == nil {
+			c.writeInt(0)
+		} else {
+			c.writeInt(int64(len(z.scores)))
+		}
+	}
+}
+
+func cmdZCount(c *conn, args [][]byte) {
+	min, ok1 := parseScoreBound(args[1])
+	max, ok2 := parseScoreBound(args[2])
+	if !ok1 || !ok2 {
+		c.writeError("ERR min or max is not a float")
+		return
+	}
+	z, ok := c.zset(string(args[0]), false)
+	if !ok {
+		return
+	}
+	n := 0
+	if z != nil {
+		for _, s := range z.scores {
+			if inScoreRange(s, min, max) {
+				n++
+			}
+		}
+	}
+	c.writeInt(int64(n))
+}
+
+func cmdZIncrBy(c *conn, args [][]byte) {
+	by, ok := parseFloat(args[1])
+	if !ok {
+		c.writeError(msgNotFloat)
+		return
+	}
+	z, ok := c.zset(string(args[0]), true)
+	if !ok {
+		return
+	}
+	s := z.scores[string(args[2])] + by
+	if math.IsNaN(s) {
+		c.writeError("ERR resulting score is not a number (NaN)")
+		return
+	}
+	z.scores[string(args[2])] = s
+	c.writeFloat(s)
+}
+
+func cmdZMScore(c *conn, args [][]byte) {
+	z, ok := c.zset(string(args[0]), false)
+	if !ok {
+		return
+	}
+	c.writeArray(len(args) - 1)
+	for _, m := range args[1:] {
+		if s, exists := z.lookup(string(m)); exists {
+			c.writeFloat(s)
+		} else {
+			c.writeNull()
+		}
+	}
+}
+
+func cmdZScore(c *conn, args [][]byte) {
+	z, ok := c.zset(string(args[0]), false)
+	if !ok {
+		return
+	}
+	if s, exists := z.lookup(string(args[1])); exists {
+		c.writeFloat(s)
+	} else {
+		c.writeNull()
+	}
+}
+
+func (z *zset) lookup(member string) (float64, bool) {
+	if z == nil {
+		return 0, false
+	}
+	s, ok := z.scores[member]
+	return s, ok
+}
+
+func cmdZPopMax(c *conn, args [][]byte) {
+	c.zpop(args, true)
+}
+
+func cmdZPopMin(c *conn, args [][]byte) {
+	c.zpop(args, false)
+}
+
+func (c *conn) zpop(args [][]byte, max bool) {
+	key := string(args[0])
+	count := int64(1)
+	if len(args) > 2 {
+		c.writeError(msgSyntax)
+		return
+	} else if len(args) == 2 {
+		var ok bool
+		if count, ok = parseInt(args[1]); !ok || count < 0 {
+			c.writeError("ERR value is out of range, must be positive")
+			return
+		}
+	}
+	z, ok := c.zset(key, false)
+	if !ok {
+		return
+	}
+	if z == nil {
+		c.writeArray(0)
+		return
+	}
+	members := z.sorted()
+	if max {
+		reverse(members)
+	}
+	if count > int64(len(members)) {
+		count = int64(len(members))
+	}
+	members = members[:count]
+	for _, m := range members {
+		delete(z.scores, m.member)
+	}
+	c.removeIfEmpty(key)
+	c.writeZMembers(members, true)
+}
+
+func cmdZRange(c *conn, args [][]byte) {
+	var byScore, rev, withScores bool
+	offset, count := int64(0), int64(-1)
+	for i := 3; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "byscore":
+			byScore = true
+		case "rev":
+			rev = true
+		case "withscores":
+			withScores = true
+		case "limit":
+			if i+2 >= len(args) {
+				c.writeError(msgSyntax)
+				return
+			}
+			var ok1, ok2 bool
+			offset, ok1 = parseInt(args[i+1])
+			count, ok2 = parseInt(args[i+2])
+			if !ok1 || !ok2 {
+				c.writeError(msgNotInt)
+				return
+			}
+			i += 2
+		default:
+			c.writeError(msgSyntax)
+			return
+		}
+	}
+	if byScore {
+		min, max := args[1], args[2]
+		if rev {
+			min, max = max, min
+		}
+		c.zrangeByScore(string(args[0]), min, max, rev, withScores, offset, count)
+		return
+	}
+	if offset != 0 || count != -1 {
+		c.writeError("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+		return
+	}
+	c.zrange(args[:3], rev, withScores)
+}
+
+func cmdZRevRange(c *conn, args [][]byte) {
+	c.zrangeCompat(args, true)
+}
+
+func (c *conn) zrangeCompat(args [][]byte, rev bool) {
+	withScores := false
+	if len(args) == 4 && strings.ToLower(string(args[3])) == "withscores" {
+		withScores = true
+	} else if len(args) != 3 {
+		c.writeError(msgSyntax)
+		return
+	}
+	c.zrange(args[:3], rev, withScores)
+}
+
+func (c *conn) zrange(args [][]byte, rev, withScores bool) {
+	start, ok1 := parseInt(args[1])
+	stop, ok2 := parseInt(args[2])
+	if !ok1 || !ok2 {
+		c.writeError(msgNotInt)
+		return
+	}
+	z, ok := c.zset(string(args[0]), false)
+	if !ok {
+		return
+	}
+	if z == nil {
+		c.writeArray(0)
+		return
+	}
+	members := z.sorted()
+	if rev {
+		reverse(members)
+	}
+	s, e, ok := normalizeRange(start, stop, len(members))
+	if !ok {
+		c.writeArray(0)
+		return
+	}
+	c.writeZMembers(members[s:e], withScores)
+}
+
+func cmdZRangeByScore(c *conn, args [][]byte) {
+	c.zrangeByScoreCompat(args, false)
+}
+
+func cmdZRevRangeByScore(c *conn, args [][]byte) {
+	c.zrangeByScoreCompat(args, true)
+}
+
+func (c *conn) zrangeByScoreCompat(args [][]byte, rev bool) {
+	withScores := false
+	offset, count := int64(0), int64(-1)
+	for i := 3; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "withscores":
+			withScores = true
+		case "limit":
+			if i+2 >= len(args) {
+				c.writeError(msgSyntax)
+				return
+			}
+			var ok1, ok2 bool
+			offset, ok1 = parseInt(args[i+1])
+			count, ok2 = parseInt(args[i+2])
+			if !ok1 || !ok2 {
+				c.writeError(msgNotInt)
+				return
+			}
+			i += 2
+		default:
+			c.writeError(msgSyntax)
+			return
+		}
+	}
+	min, max := args[1], args[2]
+	if rev {
+		min, max = max, min
+	}
+	c.zrangeByScore(string(args[0]), min, max, rev, withScores, offset, count)
+}
+
+func (c *conn) zrangeByScore(key string, minArg, maxArg []byte, rev, withScores bool, offset, count int64) {
+	min, ok1 := parseScoreBound(minArg)
+	max, ok2 := parseScoreBound(maxArg)
+	if !ok1 || !ok2 {
+		c.writeError("ERR min or max is not a float")
+		return
+	}
+	z, ok := c.zset(key, false)
+	if !ok {
+		return
+	}
+	if z == nil {
+		c.writeArray(0)
+		return
+	}
+	var members []zmember
+	for _, m := range z.sorted() {
+		if inScoreRange(m.score, min, max) {
+			members = append(members, m)
+		}
+	}
+	if rev {
+		reverse(members)
+	}
+	if offset < 0 || offset >= int64(len(members)) {
+		members = nil
+	} else {
+		members = members[offset:]
+		if count >= 0 && count < int64(len(members)) {
+			members = members[:count]
+		}
+	}
+	c.writeZMembers(members, withScores)
+}
+
+func cmdZRank(c *conn, args [][]byte) {
+	c.zrank(args, false)
+}
+
+func cmdZRevRank(c *conn, args [][]byte) {
+	c.zrank(args, true)
+}
+
+func (c *conn) zrank(args [][]byte, rev bool) {
+	z, ok := c.zset(string(args[0]), false)
+	if !ok {
+		return
+	}
+	if _, exists := z.lookup(string(args[1])); !exists {
+		c.writeNull()
+		return
+	}
+	r := z.rank(string(args[1]))
+	if rev {
+		r = len(z.scores) - 1 - r
+	}
+	c.writeInt(int64(r))
+}
+
+func cmdZRem(c *conn, args [][]byte) {
+	key := string(args[0])
+	z, ok := c.zset(key, false)
+	if !ok {
+		return
+	}
+	n := 0
+	for _, m := range args[1:] {
+		if _, exists := z.lookup(string(m)); exists {
+			delete(z.scores, string(m))
+			n++
+		}
+	}
+	c.removeIfEmpty(key)
+	c.writeInt(int64(n))
+}
+
+func cmdZRemRangeByRank(c *conn, args [][]byte) {
+	key := string(args[0])
+	start, ok1 := parseInt(args[1])
+	stop, ok2 := parseInt(args[2])
+	if !ok1 || !ok2 {
+		c.writeError(msgNotInt)
+		return
+	}
+	z, ok := c.zset(key, false)
+	if !ok {
+		return
+	}
+	if z == nil {
+		c.writeInt(0)
+		return
+	}
+	members := z.sorted()
+	s, e, ok := normalizeRange(start, stop, len(members))
+	if !ok {
+		c.writeInt(0)
+		return
+	}
+	for _, m := range members[s:e] {
+		delete(z.scores, m.member)
+	}
+	c.removeIfEmpty(key)
+	c.writeInt(int64(e - s))
+}
+
+func cmdZRemRangeByScore(c *conn, args [][]byte) {
+	key := string(args[0])
+	min, ok1 := parseScoreBound(args[1])
+	max, ok2 := parseScoreBound(args[2])
+	if !ok1 || !ok2 {
+		c.writeError("ERR min or max is not a float")
+		return
+	}
+	z, ok := c.zset(key, false)
+	if !ok {
+		return
+	}
+	n := 0
+	if z != nil {
+		for m, s := range z.scores {
+			if inScoreRange(s, min, max) {
+				delete(z.scores, m)
+				n++
+			}
+		}
+		c.removeIfEmpty(key)
+	}
+	c.writeInt(int64(n))
+}
+
+func reverse(members []zmember) {
+	for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+		members[i], members[j] = members[j], members[i]
+	}
+}
@@ -0,0 +1,364 @@
+// Package replica implements the replica side of the Redis replication
+// protocol to consume every write made on a master.
+//
+// A Replica performs the handshake (REPLCONF and PSYNC), decodes the RDB
+// snapshot of a full resynchronization, and then decodes the stream of
+// write commands while acknowledging the processed offset with REPLCONF
+// ACK. When run again after an error it tries to continue the stream with
+// a partial resynchronization.
+package replica
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samuel/go-redis"
+	"github.com/samuel/go-redis/aof"
+	"github.com/samuel/go-redis/rdb"
+)
+
+const (
+	DefaultAckInterval = time.Second
+	DefaultTimeout     = time.Minute
+
+	eofMarkLen = 40
+)
+
+var (
+	ErrInvalidReply = errors.New("replica: invalid reply from master")
+	ErrSyncFailed   = errors.New("replica: full sync payload is invalid")
+)
+
+// MasterError is an error reply from the master during the handshake.
+type MasterError struct {
+	Cmd string
+	Msg string
+}
+
+func (e *MasterError) Error() string {
+	return "replica: master replied to " + e.Cmd + ": " + e.Msg
+}
+
+// Command is a write command from the replication stream. Offset is the
+// replication offset after the command.
+type Command struct {
+	aof.Command
+	Offset int64
+}
+
+// Handler receives events from the master. Nil functions are skipped.
+// Returning an error stops Run.
+type Handler struct {
+	// FullSync is called when the master starts a full resynchronization
+	// before the keys of the snapshot are passed to Entry. Keys received
+	// before should be discarded.
+	FullSync func(replID string, offset int64) error
+
+	// Entry is called for every key of a full resynchronization snapshot.
+	Entry func(e *rdb.Entry) error
+
+	// Synced is called when the snapshot has been loaded, or right away
+	// when the master accepts to continue the stream.
+	Synced func(replID string, offset int64) error
+
+	// Command is called for every write command. Replication pings and
+	// REPLCONF commands are handled internally.
+	Command func(cmd *Command) error
+}
+
+type Replica struct {
+	cli *redis.Client
+
+	// AckInterval is how often the offset is acknowledged.
+	AckInterval time.Duration
+
+	// Timeout is used for the handshake and the maximum time without
+	// receiving data from the master after the sync.
+	Timeout time.Duration
+
+	// ListeningPort is reported to the master and shown in INFO
+	// replication. It's not used to connect to the replica.
+	ListeningPort int
+
+	mu     sync.Mutex
+	replID string
+	offset int64
+	db     int
+}
+
+func New(net, addr string) *Replica {
+	return &Replica{
+		cli:         redis.NewClient(net, addr),
+		AckInterval: DefaultAckInterval,
+		Timeout:     DefaultTimeout,
+		offset:      -1,
+	}
+}
+
+// SetAuth sets the credentials used to authenticate. The username may be
+// empty to use the default user.
+func (r *Replica) SetAuth(username, password string) {
+	r.cli.SetAuth(username, password)
+}
+
+// Position returns the replication ID, the offset processed so far and
+// the database selected at that offset. The offset is -1 before the first
+// sync.
+func (r *Replica) Position() (string, int64, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.replID, r.offset, r.db
+}
+
+// SetPosition sets the replication ID, offset and selected database to
+// continue from. It can be used to resume after a restart with a stored
+// position.
+func (r *Replica) SetPosition(replID string, offset int64, db int) {
+	r.mu.Lock()
+	r.replID = replID
+	r.offset = offset
+	r.db = db
+	r.mu.Unlock()
+}
+
+func (r *Replica) setOffset(offset int64, db int) {
+	r.mu.Lock()
+	r.offset = offset
+	r.db = db
+	r.mu.Unlock()
+}
+
+// Run connects to the master and delivers events to h until ctx is done
+// or an error occurs. It can be called again to reconnect.
+func (r *Replica) Run(ctx context.Context, h *Handler) error {
+	c, err := r.cli.ReplicationConn()
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		c.Close()
+	}()
+
+	err = r.run(c, h)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (r *Replica) run(c *redis.ReplicationConn, h *Handler) error {
+	c.SetDeadline(time.Now().Add(r.Timeout))
+	if err := r.handshake(c); err != nil {
+		return err
+	}
+	replID, offset, db := r.Position()
+	psyncID, psyncOffset := "?", "-1"
+	if replID != "" && offset >= 0 {
+		psyncID, psyncOffset = replID, strconv.FormatInt(offset+1, 10)
+	}
+	reply, err := request(c, "PSYNC", psyncID, psyncOffset)
+	if err != nil {
+		return err
+	}
+
+	fields := strings.Fields(reply)
+	switch {
+	case len(fields) == 3 && fields[0] == "FULLRESYNC":
+		replID = fields[1]
+		if offset, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+			return ErrInvalidReply
+		}
+		if h.FullSync != nil {
+			if err := h.FullSync(replID, offset); err != nil {
+				return err
+			}
+		}
+		// Loading a big snapshot may take longer than the timeout
+		c.SetDeadline(time.Time{})
+		if err := r.loadSnapshot(c.Reader(), h); err != nil {
+			return err
+		}
+		db = 0
+		r.SetPosition(replID, offset, db)
+	case len(fields) >= 1 && fields[0] == "CONTINUE":
+		if len(fields) == 2 {
+			// The master changed its ID after a failover
+			replID = fields[1]
+			r.SetPosition(replID, offset, db)
+		}
+	default:
+		return ErrInvalidReply
+	}
+	if h.Synced != nil {
+		if err := h.Synced(replID, offset); err != nil {
+			return err
+		}
+	}
+	return r.stream(c, h, offset, db)
+}
+
+// handshake runs after the connection is authenticated.
+func (r *Replica) handshake(c *redis.ReplicationConn) error {
+	if _, err := request(c, "PING"); err != nil {
+		return err
+	}
+	if r.ListeningPort > 0 {
+		if _, err := request(c, "REPLCONF", "listening-port", r.ListeningPort); err != nil {
+			return err
+		}
+	}
+	_, err := request(c, "REPLCONF", "capa", "eof", "capa", "psync2")
+	return err
+}
+
+// request sends a handshake command and returns its status reply. Error
+// replies are returned as a MasterError.
+func request(c *redis.ReplicationConn, cmd string, args ...interface{}) (string, error) {
+	reply, err := c.Request(cmd, args...)
+	if e, ok := err.(redis.ErrReply); ok {
+		return "", &MasterError{Cmd: cmd, Msg: e.Message()}
+	}
+	return reply, err
+}
+
+// loadSnapshot reads the RDB payload of a full resync which is either
+// sent with its length ("$<len>") or, for diskless syncs, delimited by a
+// random mark ("$EOF:<mark>").
+func (r *Replica) loadSnapshot(br *bufio.Reader, h *Handler) error {
+	var line []byte
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		// Newlines are sent as keepalives while the master prepares
+		// the snapshot.
+		if b == '\n' {
+			continue
+		}
+		if b != '$' {
+			return ErrSyncFailed
+		}
+		if line, err = readLine(br); err != nil {
+			return err
+		}
+		break
+	}
+
+	handler := &rdb.Handler{Entry: h.Entry}
+	if bytes.HasPrefix(line, []byte("EOF:")) {
+		mark := append([]byte(nil), line[4:]...)
+		if len(mark) != eofMarkLen {
+			return ErrSyncFailed
+		}
+		// The RDB parser doesn't read past the end of the file when
+		// given a bufio.Reader so the mark follows.
+		if err := rdb.Parse(br, handler); err != nil {
+			return err
+		}
+		end := make([]byte, eofMarkLen)
+		if _, err := io.ReadFull(br, end); err != nil {
+			return err
+		}
+		if !bytes.Equal(end, mark) {
+			return ErrSyncFailed
+		}
+		return nil
+	}
+
+	n, err := strconv.ParseInt(string(line), 10, 64)
+	if err != nil || n < 0 {
+		return ErrSyncFailed
+	}
+	lr := &io.LimitedReader{R: br, N: n}
+	if err := rdb.Parse(lr, handler); err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, lr)
+	return err
+}
+
+// stream decodes the command stream and acknowledges the offset.
+func (r *Replica) stream(c *redis.ReplicationConn, h *Handler, offset int64, db int) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	ackErr := make(chan error, 1)
+	go func() {
+		t := time.NewTicker(r.AckInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				_, off, _ := r.Position()
+				if err := ack(c, off); err != nil {
+					ackErr <- err
+					c.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	ar := aof.NewReader(c.Reader())
+	ar.SetDB(db)
+	for {
+		c.SetReadDeadline(time.Now().Add(r.Timeout))
+		cmd, err := ar.Next()
+		if err != nil {
+			select {
+			case e := <-ackErr:
+				return e
+			default:
+			}
+			return err
+		}
+		off := offset + ar.Offset()
+		switch cmd.Name() {
+		case "PING":
+			r.setOffset(off, ar.DB())
+			continue
+		case "REPLCONF":
+			r.setOffset(off, ar.DB())
+			if len(cmd.Args) > 1 && strings.EqualFold(string(cmd.Args[1]), "GETACK") {
+				if err := ack(c, off); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if h.Command != nil {
+			if err := h.Command(&Command{Command: *cmd, Offset: off}); err != nil {
+				return err
+			}
+		}
+		// The offset only advances once the command has been handled
+		r.setOffset(off, ar.DB())
+	}
+}
+
+func ack(c *redis.ReplicationConn, offset int64) error {
+	return c.Send("REPLCONF", "ACK", offset)
+}
+
+func readLine(br *bufio.Reader) ([]byte, error) {
+	line, err := br.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(line[:len(line)-1], []byte("\r")), nil
+}
@@ -0,0 +1,271 @@
+package replica
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-redis/rdb"
+)
+
+func resp(args ...string) string {
+	s := "*" + strconv.Itoa(len(args)) + "\r\n"
+	for _, a := range args {
+		s += "$" + strconv.Itoa(len(a)) + "\r\n" + a + "\r\n"
+	}
+	return s
+}
+
+// fakeMaster accepts one replica and plays the master side of a sync.
+type fakeMaster struct {
+	t    *testing.T
+	l    net.Listener
+	r    *bufio.Reader
+	nc   net.Conn
+	acks chan string
+}
+
+func newFakeMaster(t *testing.T) *fakeMaster {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fakeMaster{t: t, l: l, acks: make(chan string, 16)}
+}
+
+func (m *fakeMaster) accept() {
+	nc, err := m.l.Accept()
+	if err != nil {
+		m.t.Error(err)
+		return
+	}
+	m.nc = nc
+	m.r = bufio.NewReader(nc)
+}
+
+// expect reads a command and checks its arguments.
+func (m *fakeMaster) expect(args ...string) {
+	cmd := m.read()
+	if strings.Join(cmd, " ") != strings.Join(args, " ") {
+		m.t.Errorf("expected %q, got %q", args, cmd)
+	}
+}
+
+func (m *fakeMaster) read() []string {
+	line, err := m.r.ReadString('\n')
+	if err != nil || len(line) < 2 {
+		return nil
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		m.r.ReadString('\n')
+		a, _ := m.r.ReadString('\n')
+		args[i] = strings.TrimSpace(a)
+	}
+	return args
+}
+
+func (m *fakeMaster) write(s string) {
+	m.nc.Write([]byte(s))
+}
+
+func TestReplica(t *testing.T) {
+	m := newFakeMaster(t)
+	defer m.l.Close()
+
+	snapshot := "REDIS0011\xfe\x00\x00\x01a\x011\xff\x00\x00\x00\x00\x00\x00\x00\x00"
+	stream := resp("SELECT", "0") + resp("SET", "b", "2") + resp("PING") + resp("REPLCONF", "GETACK", "*") + resp("INCR", "a")
+	getackEnd := int64(len(resp("SELECT", "0") + resp("SET", "b", "2") + resp("PING") + resp("REPLCONF", "GETACK", "*")))
+
+	go func() {
+		m.accept()
+		m.expect("PING")
+		m.write("+PONG\r\n")
+		m.expect("REPLCONF", "capa", "eof", "capa", "psync2")
+		m.write("+OK\r\n")
+		m.expect("PSYNC", "?", "-1")
+		m.write("+FULLRESYNC 0123456789abcdef0123456789abcdef01234567 100\r\n")
+		m.write("\n\n$" + strconv.Itoa(len(snapshot)) + "\r\n" + snapshot)
+		m.write(stream)
+		for {
+			cmd := m.read()
+			if len(cmd) == 0 {
+				return
+			}
+			m.acks <- strings.Join(cmd, " ")
+		}
+	}()
+
+	r := New("tcp", m.l.Addr().String())
+	r.AckInterval = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		events []string
+		offset int64
+	)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- r.Run(ctx, &Handler{
+			FullSync: func(replID string, offset int64) error {
+				events = append(events, "fullsync "+strconv.FormatInt(offset, 10))
+				return nil
+			},
+			Entry: func(e *rdb.Entry) error {
+				events = append(events, "entry "+string(e.Key))
+				return nil
+			},
+			Synced: func(replID string, offset int64) error {
+				events = append(events, "synced")
+				return nil
+			},
+			Command: func(cmd *Command) error {
+				events = append(events, cmd.Name())
+				offset = cmd.Offset
+				if cmd.Name() == "INCR" {
+					cancel()
+				}
+				return nil
+			},
+		})
+	}()
+
+	select {
+	case ack := <-m.acks:
+		if expected := "REPLCONF ACK " + strconv.FormatInt(100+getackEnd, 10); ack != expected {
+			t.Fatalf("expected %q, got %q", expected, ack)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for ACK")
+	}
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	expected := "fullsync 100,entry a,synced,SELECT,SET,INCR"
+	if s := strings.Join(events, ","); s != expected {
+		t.Fatalf("expected events %q, got %q", expected, s)
+	}
+	if offset != 100+int64(len(stream)) {
+		t.Fatalf("expected offset %d, got %d", 100+len(stream), offset)
+	}
+	if id, off, db := r.Position(); id != "0123456789abcdef0123456789abcdef01234567" || off != offset || db != 0 {
+		t.Fatalf("unexpected position %s %d %d", id, off, db)
+	}
+}
+
+func TestReplicaEOFMark(t *testing.T) {
+	m := newFakeMaster(t)
+	defer m.l.Close()
+
+	mark := strings.Repeat("x", eofMarkLen)
+	snapshot := "REDIS0011\xfe\x00\x00\x01a\x011\xff\x00\x00\x00\x00\x00\x00\x00\x00"
+	go func() {
+		m.accept()
+		m.expect("AUTH", "user", "secret")
+		m.write("+OK\r\n")
+		m.expect("PING")
+		m.write("+PONG\r\n")
+		m.expect("REPLCONF", "capa", "eof", "capa", "psync2")
+		m.write("+OK\r\n")
+		m.expect("PSYNC", "abc", "11")
+		m.write("+FULLRESYNC def 7\r\n")
+		m.write("$EOF:" + mark + "\r\n" + snapshot + mark)
+		m.write(resp("SET", "b", "2"))
+	}()
+
+	r := New("tcp", m.l.Addr().String())
+	r.SetAuth("user", "secret")
+	r.SetPosition("abc", 10, 0)
+	var keys []string
+	stop := errString("stop")
+	err := r.Run(context.Background(), &Handler{
+		Entry: func(e *rdb.Entry) error {
+			keys = append(keys, string(e.Key))
+			return nil
+		},
+		Command: func(cmd *Command) error {
+			keys = append(keys, string(cmd.Args[1]))
+			return stop
+		},
+	})
+	if err != stop {
+		t.Fatalf("expected handler error, got %v", err)
+	}
+	if strings.Join(keys, ",") != "a,b" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	// The failed command isn't counted
+	if id, off, _ := r.Position(); id != "def" || off != 7 {
+		t.Fatalf("unexpected position %s %d", id, off)
+	}
+}
+
+func TestReplicaContinue(t *testing.T) {
+	m := newFakeMaster(t)
+	defer m.l.Close()
+
+	stream := resp("SET", "a", "1") + resp("SELECT", "5") + resp("SET", "b", "2")
+	go func() {
+		m.accept()
+		m.expect("PING")
+		m.write("+PONG\r\n")
+		m.expect("REPLCONF", "listening-port", "6380")
+		m.write("+OK\r\n")
+		m.expect("REPLCONF", "capa", "eof", "capa", "psync2")
+		m.write("+OK\r\n")
+		m.expect("PSYNC", "abc", "11")
+		m.write("+CONTINUE def\r\n")
+		m.write(stream)
+	}()
+
+	r := New("tcp", m.l.Addr().String())
+	r.ListeningPort = 6380
+	r.SetPosition("abc", 10, 3)
+	var cmds []string
+	stop := errString("stop")
+	err := r.Run(context.Background(), &Handler{
+		Command: func(cmd *Command) error {
+			cmds = append(cmds, strconv.Itoa(cmd.DB)+" "+cmd.Name())
+			if len(cmds) == 3 {
+				return stop
+			}
+			return nil
+		},
+	})
+	if err != stop {
+		t.Fatalf("expected handler error, got %v", err)
+	}
+	// The stream continues in the database selected before
+	if s := strings.Join(cmds, ","); s != "3 SET,5 SELECT,5 SET" {
+		t.Fatalf("unexpected commands %s", s)
+	}
+	if id, off, db := r.Position(); id != "def" || off != 10+int64(len(resp("SET", "a", "1")+resp("SELECT", "5"))) || db != 5 {
+		t.Fatalf("unexpected position %s %d %d", id, off, db)
+	}
+}
+
+func TestReplicaMasterError(t *testing.T) {
+	m := newFakeMaster(t)
+	defer m.l.Close()
+	go func() {
+		m.accept()
+		m.expect("PING")
+		m.write("-NOAUTH Authentication required.\r\n")
+	}()
+	err := New("tcp", m.l.Addr().String()).Run(context.Background(), &Handler{})
+	if e, ok := err.(*MasterError); !ok || e.Cmd != "PING" || e.Msg != "NOAUTH Authentication required." {
+		t.Fatalf("expected a MasterError, got %v", err)
+	}
+}
+
+type errString string
+
+func (e errString) Error() string {
+	return string(e)
+}
@@ -0,0 +1,71 @@
+package redis
+
+import (
+	"bufio"
+	"sync"
+	"time"
+)
+
+// ReplicationConn is a dedicated connection that speaks the replica side
+// of the replication protocol. The replica package builds on it.
+type ReplicationConn struct {
+	rc *redisConnection
+
+	// Acknowledgements are sent while the stream is being read
+	wmu sync.Mutex
+}
+
+// ReplicationConn opens a new authenticated connection that isn't part of
+// the pool.
+func (cli *Client) ReplicationConn() (*ReplicationConn, error) {
+	rc, err := cli.newConnection()
+	if err != nil {
+		return nil, err
+	}
+	return &ReplicationConn{rc: rc}, nil
+}
+
+// Request sends a command and returns its status reply.
+func (c *ReplicationConn) Request(cmd string, args ...interface{}) (string, error) {
+	c.wmu.Lock()
+	err := c.send(cmd, args...)
+	c.wmu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	b, err := c.rc.readStatusBytes()
+	return string(b), err
+}
+
+// Send sends a command that doesn't get a reply such as REPLCONF ACK. It
+// may be called concurrently with reads.
+func (c *ReplicationConn) Send(cmd string, args ...interface{}) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.send(cmd, args...)
+}
+
+func (c *ReplicationConn) send(cmd string, args ...interface{}) error {
+	if err := c.rc.sendCommand(cmd, args...); err != nil {
+		return err
+	}
+	return c.rc.flush()
+}
+
+// Reader returns the reader of the connection to read the snapshot and
+// the command stream that follow PSYNC.
+func (c *ReplicationConn) Reader() *bufio.Reader {
+	return c.rc.rw.Reader
+}
+
+func (c *ReplicationConn) SetDeadline(t time.Time) error {
+	return c.rc.nc.SetDeadline(t)
+}
+
+func (c *ReplicationConn) SetReadDeadline(t time.Time) error {
+	return c.rc.nc.SetReadDeadline(t)
+}
+
+func (c *ReplicationConn) Close() error {
+	return c.rc.close()
+}
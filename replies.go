@@ -49,3 +49,82 @@ func (r *BulkReply) Value() []byte {
 func (r *BulkReply) Err() error {
 	return r.err
 }
+
+// Generic Reply
+
+type GenericReply struct {
+	val interface{}
+	err error
+}
+
+func (r *GenericReply) read(c *redisConnection) error {
+	v, err := c.readReply()
+	if _, ok := err.(ErrReply); err != nil && !ok {
+		return err
+	}
+	r.val = v
+	r.err = err
+	return nil
+}
+
+// Value returns the reply with the types returned by Client.Do.
+func (r *GenericReply) Value() interface{} {
+	return r.val
+}
+
+func (r *GenericReply) Err() error {
+	return r.err
+}
+
+// Integer Reply
+
+type IntegerReply struct {
+	val int64
+	err error
+}
+
+func (r *IntegerReply) read(c *redisConnection) error {
+	v, err := c.readInteger()
+	if _, ok := err.(ErrReply); err != nil && !ok {
+		return err
+	}
+	r.val = v
+	r.err = err
+	return nil
+}
+
+func (r *IntegerReply) Value() int64 {
+	return r.val
+}
+
+func (r *IntegerReply) Err() error {
+	return r.err
+}
+
+// BitField Reply
+
+type BitFieldReply struct {
+	val []*int64
+	err error
+}
+
+func (r *BitFieldReply) read(c *redisConnection) error {
+	v, err := c.readReply()
+	if _, ok := err.(ErrReply); err != nil && !ok {
+		return err
+	}
+	if err == nil {
+		r.val, err = bitFieldValues(v)
+	}
+	r.err = err
+	return nil
+}
+
+// Value returns the results as returned by Client.BitField.
+func (r *BitFieldReply) Value() []*int64 {
+	return r.val
+}
+
+func (r *BitFieldReply) Err() error {
+	return r.err
+}
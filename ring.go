@@ -0,0 +1,677 @@
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRingHealthCheckInterval = time.Second
+
+	// Number of consecutive failed health checks before a shard is
+	// removed from the ring.
+	ringFailureThreshold = 3
+)
+
+var (
+	ErrNoShards   = errors.New("redis: no live shards in ring")
+	ErrCrossShard = errors.New("redis: keys of the command are on different ring shards")
+	ErrNoRouteKey = errors.New("redis: command has no key to route it by in ring")
+)
+
+type ringShard struct {
+	name     string
+	cli      *Client
+	seed     uint64
+	up       bool
+	failures int
+}
+
+// Ring shards keys over independent Redis servers using rendezvous
+// (highest random weight) hashing. Shards that fail health checks are
+// removed from the ring until they answer PING again, which only moves
+// the keys of the failed shard.
+//
+// Commands are sent to the shard owning their keys. Apart from MGet, the
+// keys of a multi-key command, script or pipelined command must all be on
+// the same shard or ErrCrossShard is returned. Keyless commands return
+// ErrNoRouteKey and should be run on the clients returned by Shard.
+type Ring struct {
+	mu     sync.RWMutex
+	shards []*ringShard
+	live   []*ringShard
+
+	interval time.Duration
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewRing returns a ring over the given shards which maps a shard name to
+// its address. Keys are assigned by name so addresses may change without
+// moving keys. The ring health checks every shard with PING until Close
+// is called.
+func NewRing(net string, shards map[string]string) *Ring {
+	r := &Ring{
+		interval: DefaultRingHealthCheckInterval,
+		done:     make(chan struct{}),
+	}
+	names := make([]string, 0, len(shards))
+	for name := range shards {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r.shards = append(r.shards, &ringShard{
+			name: name,
+			cli:  NewClient(net, shards[name]),
+			seed: fnv64a(fnv64Offset, name),
+			up:   true,
+		})
+	}
+	r.live = append([]*ringShard(nil), r.shards...)
+	go r.healthCheck()
+	return r
+}
+
+func (r *Ring) SetTimeout(timeout time.Duration) {
+	for _, s := range r.shards {
+		s.cli.SetTimeout(timeout)
+	}
+}
+
+// SetAuth sets the credentials used to authenticate with every shard.
+func (r *Ring) SetAuth(username, password string) {
+	for _, s := range r.shards {
+		s.cli.SetAuth(username, password)
+	}
+}
+
+func (r *Ring) SetMaxIdleConnections(maxIdle int) {
+	for _, s := range r.shards {
+		s.cli.SetMaxIdleConncetions(maxIdle)
+	}
+}
+
+// SetHealthCheckInterval changes how often shards are pinged. It takes
+// effect after the next check.
+func (r *Ring) SetHealthCheckInterval(interval time.Duration) {
+	r.mu.Lock()
+	r.interval = interval
+	r.mu.Unlock()
+}
+
+// Close stops health checking and closes the idle connections of every
+// shard.
+func (r *Ring) Close() error {
+	r.once.Do(func() { close(r.done) })
+	var err error
+	for _, s := range r.shards {
+		if e := s.cli.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (r *Ring) healthCheck() {
+	for {
+		r.mu.RLock()
+		interval := r.interval
+		r.mu.RUnlock()
+		select {
+		case <-r.done:
+			return
+		case <-time.After(interval):
+		}
+		r.checkShards()
+	}
+}
+
+func (r *Ring) checkShards() {
+	changed := false
+	for _, s := range r.shards {
+		err := s.cli.Ping()
+		r.mu.Lock()
+		if err == nil {
+			s.failures = 0
+			if !s.up {
+				s.up = true
+				changed = true
+			}
+		} else {
+			s.failures++
+			if s.up && s.failures >= ringFailureThreshold {
+				s.up = false
+				changed = true
+			}
+		}
+		r.mu.Unlock()
+	}
+	if changed {
+		r.mu.Lock()
+		live := make([]*ringShard, 0, len(r.shards))
+		for _, s := range r.shards {
+			if s.up {
+				live = append(live, s)
+			}
+		}
+		r.live = live
+		r.mu.Unlock()
+	}
+}
+
+// Shard returns the client of the shard that owns key.
+func (r *Ring) Shard(key string) (*Client, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s := rendezvous(r.live, key)
+	if s == nil {
+		return nil, ErrNoShards
+	}
+	return s.cli, nil
+}
+
+// shardFor returns the client of the shard that owns all keys.
+func (r *Ring) shardFor(keys ...string) (*Client, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoRouteKey
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var s *ringShard
+	for _, k := range keys {
+		ks := rendezvous(r.live, k)
+		if ks == nil {
+			return nil, ErrNoShards
+		}
+		if s != nil && ks != s {
+			return nil, ErrCrossShard
+		}
+		s = ks
+	}
+	return s.cli, nil
+}
+
+// commandKeys returns the keys of a command given to Do. The arguments
+// are encoded as they would be sent to find them with CommandKeys.
+func commandKeys(cmd string, args []interface{}) ([]string, error) {
+	var b bytes.Buffer
+	rc := &redisConnection{
+		rw:  bufio.NewReadWriter(bufio.NewReader(&b), bufio.NewWriter(&b)),
+		buf: make([]byte, connectionBufferSize),
+	}
+	if err := rc.sendCommand(cmd, args...); err != nil {
+		return nil, err
+	}
+	if err := rc.flush(); err != nil {
+		return nil, err
+	}
+	req, err := rc.readRequest()
+	if err != nil {
+		return nil, err
+	}
+	keys := CommandKeys(req)
+	out := make([]string, len(keys))
+	for i, k := range keys {
+		out[i] = string(k)
+	}
+	return out, nil
+}
+
+func rendezvous(shards []*ringShard, key string) *ringShard {
+	var best *ringShard
+	var bestScore uint64
+	for _, s := range shards {
+		if score := mix64(fnv64a(s.seed, key)); best == nil || score > bestScore {
+			best, bestScore = s, score
+		}
+	}
+	return best
+}
+
+const (
+	fnv64Offset = 14695981039346656037
+	fnv64Prime  = 1099511628211
+)
+
+func fnv64a(h uint64, s string) uint64 {
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= fnv64Prime
+	}
+	return h
+}
+
+// mix64 is the splitmix64 finalizer. FNV alone doesn't spread keys that
+// only differ in their last bytes well enough for rendezvous hashing.
+func mix64(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+// BLMove requires src and dest to be on the same shard.
+func (r *Ring) BLMove(ctx context.Context, src, dest, srcPos, destPos string, timeout time.Duration) ([]byte, error) {
+	cli, err := r.shardFor(src, dest)
+	if err != nil {
+		return nil, err
+	}
+	return cli.BLMove(ctx, src, dest, srcPos, destPos, timeout)
+}
+
+func (r *Ring) BLPop(ctx context.Context, timeout time.Duration, keys ...string) (string, []byte, error) {
+	cli, err := r.shardFor(keys...)
+	if err != nil {
+		return "", nil, err
+	}
+	return cli.BLPop(ctx, timeout, keys...)
+}
+
+func (r *Ring) BRPop(ctx context.Context, timeout time.Duration, keys ...string) (string, []byte, error) {
+	cli, err := r.shardFor(keys...)
+	if err != nil {
+		return "", nil, err
+	}
+	return cli.BRPop(ctx, timeout, keys...)
+}
+
+func (r *Ring) BitCount(key string, br *BitRange) (int64, error) {
+	cli, err := r.Shard(key)
+	if err != nil {
+		return 0, err
+	}
+	return cli.BitCount(key, br)
+}
+
+// BitField runs f on the shard that owns its key.
+func (r *Ring) BitField(f *BitField) ([]*int64, error) {
+	cli, err := r.Shard(f.key)
+	if err != nil {
+		return nil, err
+	}
+	return cli.BitField(f)
+}
+
+func (r *Ring) BitPos(key string, bit int, br *BitRange) (int64, error) {
+	cli, err := r.Shard(key)
+	if err != nil {
+		return 0, err
+	}
+	return cli.BitPos(key, bit, br)
+}
+
+func (r *Ring) Decr(key string) (int64, error) {
+	cli, err := r.Shard(key)
+	if err != nil {
+		return 0, err
+	}
+	return cli.Decr(key)
+}
+
+// Do runs a command on the shard owning the keys found by CommandKeys.
+func (r *Ring) Do(cmd string, args ...interface{}) (interface{}, error) {
+	cli, err := r.commandShard(cmd, args)
+	if err != nil {
+		return nil, err
+	}
+	return cli.Do(cmd, args...)
+}
+
+func (r *Ring) DoContext(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	cli, err := r.commandShard(cmd, args)
+	if err != nil {
+		return nil, err
+	}
+	return cli.DoContext(ctx, cmd, args...)
+}
+
+func (r *Ring) commandShard(cmd string, args []interface{}) (*Client, error) {
+	keys, err := commandKeys(cmd, args)
+	if err != nil {
+		return nil, err
+	}
+	return r.shardFor(keys...)
+}
+
+func (r *Ring) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	cli, err := r.shardFor(keys...)
+	if err != nil {
+		return nil, err
+	}
+	return cli.Eval(script, keys, args...)
+}
+
+func (r *Ring) EvalSha(sha1 string, keys []string, args ...interface{}) (interface{}, error) {
+	cli, err := r.shardFor(keys...)
+	if err != nil {
+		return nil, err
+	}
+	return cli.EvalSha(sha1, keys, args...)
+}
+
+func (r *Ring) GeoAdd(key string, opt *GeoAddOptions, locations ...GeoLocation) (int64, error) {
+	cli, err := r.Shard(key)
+	if err != nil {
+		return 0, err
+	}
+	return cli.GeoAdd(key, opt, locations...)
+}
+
+func (r *Ring) GeoDist(key, member1, member2 string, unit GeoUnit) (float64, bool, error) {
+	cli, err := r.Shard(key)
+	if err != nil {
+		return 0, false, err
+	}
+	return cli.GeoDist(key, member1, member2, unit)
+}
+
+func (r *Ring) GeoHash(key string, members ...string) ([]string, error) {
+	cli, err := r.Shard(key)
+	if err != nil {
+		return nil, err
+	}
+	return cli.GeoHash(key, members...)
+}
+
+func (r *Ring) GeoPos(key string, members ...string) ([]*GeoLocation, error) {
+	cli, err := r.Shard(key)
+	if err != nil {
+		return nil, err
+	}
+	return cli.GeoPos(key, members...)
+}
+
+func (r *Ring) GeoSearch(key string, q *GeoSearchQuery) ([]GeoLocation, error) {
+	cli, err := r.Shard(key)
+	if err != nil {
+		return nil, err
+	}
+	return cli.GeoSearch(key, q)
+}
+
+func (r *Ring) Get(key string) ([]byte, error) {
+	cli, err := r.Shard(key)
+	if err != nil {
+		return nil, err
+	}
+	return cli.Get(key)
+}
+
+func (r *Ring) GetBit(key string, offset int64) (int64, error) {
+	cli, err := r.Shard(key)
+	if err != nil {
+		return 0, err
+	}
+	return cli.GetBit(key, offset)
+}
+
+func (r *Ring) GetInto(key string, dst []byte) ([]byte, error) {
+	cli, err := r.Shard(key)
+	if err != nil {
+		return nil, err
+	}
+	return cli.GetInto(key, dst)
+}
+
+func (r *Ring) GetReader(key string) (io.ReadCloser, error) {
+	cli, err := r.Shard(key)
+	if err != nil {
+		return nil, err
+	}
+	return cli.GetReader(key)
+}
+
+func (r *Ring) HGetAll(key string) (map[string][]byte, error) {
+	cli, err := r.Shard(key)
+	if err != nil {
+		return nil, err
+	}
+	return cli.HGetAll(key)
+}
+
+func (r *Ring) Incr(key string) (int64, error) {
+	cli, err := r.Shard(key)
+	if err != nil {
+		return 0, err
+	}
+	return cli.Incr(key)
+}
+
+// MGet splits the keys by shard and issues one MGET per shard in parallel.
+func (r *Ring) MGet(key ...string) ([][]byte, error) {
+	r.mu.RLock()
+	groups := make(map[*ringShard][]int)
+	for i, k := range key {
+		s := rendezvous(r.live, k)
+		if s == nil {
+			r.mu.RUnlock()
+			return nil, ErrNoShards
+		}
+		groups[s] = append(groups[s], i)
+	}
+	r.mu.RUnlock()
+	if len(groups) == 1 {
+		for s := range groups {
+			return s.cli.MGet(key...)
+		}
+	}
+
+	out := make([][]byte, len(key))
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var err error
+	for s, idx := range groups {
+		keys := make([]string, len(idx))
+		for i, j := range idx {
+			keys[i] = key[j]
+		}
+		wg.Add(1)
+		go func(cli *Client, keys []string, idx []int) {
+			defer wg.Done()
+			vals, e := cli.MGet(keys...)
+			if e != nil {
+				errOnce.Do(func() { err = e })
+				return
+			}
+			for i, j := range idx {
+				out[j] = vals[i]
+			}
+		}(s.cli, keys, idx)
+	}
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *Ring) MemoryUsage(key string, samples int) (int64, error) {
+	cli, err := r.Shard(key)
+	if err != nil {
+		return 0, err
+	}
+	return cli.MemoryUsage(key, samples)
+}
+
+func (r *Ring) PFAdd(key string, elements ...string) (bool, error) {
+	cli, err := r.Shard(key)
+	if err != nil {
+		return false, err
+	}
+	return cli.PFAdd(key, elements...)
+}
+
+// Ping pings every live shard.
+func (r *Ring) Ping() error {
+	r.mu.RLock()
+	live := r.live
+	r.mu.RUnlock()
+	if len(live) == 0 {
+		return ErrNoShards
+	}
+	for _, s := range live {
+		if err := s.cli.Ping(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pipeline returns a pipeline that sends commands to the shards owning
+// their keys.
+func (r *Ring) Pipeline() *RingPipeline {
+	return &RingPipeline{r: r}
+}
+
+// RunScript runs s with Script.Run on the shard owning keys.
+func (r *Ring) RunScript(s *Script, keys []string, args ...interface{}) (interface{}, error) {
+	cli, err := r.shardFor(keys...)
+	if err != nil {
+		return nil, err
+	}
+	return s.Run(cli, keys, args...)
+}
+
+func (r *Ring) Set(key string, value []byte, expireTime time.Duration) error {
+	cli, err := r.Shard(key)
+	if err != nil {
+		return err
+	}
+	return cli.Set(key, value, expireTime)
+}
+
+func (r *Ring) SetBit(key string, offset int64, value int) (int64, error) {
+	cli, err := r.Shard(key)
+	if err != nil {
+		return 0, err
+	}
+	return cli.SetBit(key, offset, value)
+}
+
+func (r *Ring) SetFromReader(key string, rd io.Reader, size int64) error {
+	cli, err := r.Shard(key)
+	if err != nil {
+		return err
+	}
+	return cli.SetFromReader(key, rd, size)
+}
+
+func (r *Ring) SetNX(key string, value []byte, expireTime time.Duration) (bool, error) {
+	cli, err := r.Shard(key)
+	if err != nil {
+		return false, err
+	}
+	return cli.SetNX(key, value, expireTime)
+}
+
+func (r *Ring) SetXX(key string, value []byte, expireTime time.Duration) (bool, error) {
+	cli, err := r.Shard(key)
+	if err != nil {
+		return false, err
+	}
+	return cli.SetXX(key, value, expireTime)
+}
+
+type ringCommand struct {
+	keys  []string
+	cmd   string
+	args  []interface{}
+	reply Reply
+}
+
+// RingPipeline buffers commands until Flush which sends them in one batch
+// per shard.
+type RingPipeline struct {
+	r    *Ring
+	cmds []ringCommand
+	// err is the first error finding the keys of a command, returned by
+	// Flush
+	err error
+}
+
+func (p *RingPipeline) Get(key string) *BulkReply {
+	r := &BulkReply{}
+	p.cmds = append(p.cmds, ringCommand{[]string{key}, "GET", []interface{}{key}, r})
+	return r
+}
+
+// Do queues a command routed like Ring.Do.
+func (p *RingPipeline) Do(cmd string, args ...interface{}) *GenericReply {
+	r := &GenericReply{}
+	keys, err := commandKeys(cmd, args)
+	if err != nil {
+		if p.err == nil {
+			p.err = err
+		}
+		return r
+	}
+	p.cmds = append(p.cmds, ringCommand{keys, cmd, args, r})
+	return r
+}
+
+// Flush sends the buffered commands and returns the replies in the order
+// the commands were added. Nothing is sent if a command can't be routed.
+func (p *RingPipeline) Flush() ([]Reply, error) {
+	cmds, err := p.cmds, p.err
+	p.cmds, p.err = nil, nil
+	if err != nil {
+		return nil, err
+	}
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+	byShard := make(map[*Client][]int)
+	for i, c := range cmds {
+		cli, err := p.r.shardFor(c.keys...)
+		if err != nil {
+			return nil, err
+		}
+		byShard[cli] = append(byShard[cli], i)
+	}
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	for cli, idx := range byShard {
+		wg.Add(1)
+		go func(cli *Client, idx []int) {
+			defer wg.Done()
+			e := cli.withConnection(func(rc *redisConnection) error {
+				for _, i := range idx {
+					if err := rc.sendCommand(cmds[i].cmd, cmds[i].args...); err != nil {
+						return err
+					}
+				}
+				if err := rc.flush(); err != nil {
+					return err
+				}
+				for _, i := range idx {
+					if err := cmds[i].reply.read(rc); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if e != nil {
+				errOnce.Do(func() { err = e })
+			}
+		}(cli, idx)
+	}
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	replies := make([]Reply, len(cmds))
+	for i, c := range cmds {
+		replies[i] = c.reply
+	}
+	return replies, nil
+}
@@ -0,0 +1,166 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestRendezvous(t *testing.T) {
+	shards := []*ringShard{
+		{name: "a", seed: fnv64a(fnv64Offset, "a")},
+		{name: "b", seed: fnv64a(fnv64Offset, "b")},
+		{name: "c", seed: fnv64a(fnv64Offset, "c")},
+	}
+	const keys = 3000
+	owner := make(map[string]*ringShard, keys)
+	counts := make(map[string]int)
+	for i := 0; i < keys; i++ {
+		k := fmt.Sprintf("key:%d", i)
+		s := rendezvous(shards, k)
+		owner[k] = s
+		counts[s.name]++
+	}
+	for _, s := range shards {
+		if n := counts[s.name]; n < keys/4 || n > keys/2 {
+			t.Errorf("shard %s got %d of %d keys", s.name, n, keys)
+		}
+	}
+
+	// Removing a shard should only move the keys it owned
+	for k, s := range owner {
+		n := rendezvous(shards[:2], k)
+		if s != shards[2] && n != s {
+			t.Fatalf("key %s moved from %s to %s", k, s.name, n.name)
+		}
+	}
+
+	if rendezvous(nil, "foo") != nil {
+		t.Fatal("rendezvous should return nil without shards")
+	}
+}
+
+func TestRingHealthCheck(t *testing.T) {
+	r := NewRing("tcp", map[string]string{"down": "127.0.0.1:1"})
+	defer r.Close()
+	for i := 0; i < ringFailureThreshold; i++ {
+		if _, err := r.Shard("foo"); err != nil {
+			t.Fatalf("shard shouldn't be removed after %d failed checks", i)
+		}
+		r.checkShards()
+	}
+	if _, err := r.Shard("foo"); err != ErrNoShards {
+		t.Fatalf("shard should be removed after failing health checks: %+v", err)
+	}
+	if _, err := r.Get("foo"); err != ErrNoShards {
+		t.Fatalf("Get should fail without live shards: %+v", err)
+	}
+}
+
+// startRing returns a ring over two fake shards named a and b with the
+// recorders of their commands and a key owned by each shard.
+func startRing(t *testing.T) (*Ring, map[string]*commandRecorder, map[string]string) {
+	recorders := make(map[string]*commandRecorder)
+	addrs := make(map[string]string)
+	for _, name := range []string{"a", "b"} {
+		cr := &commandRecorder{}
+		srv := NewServer()
+		srv.HandleFunc("pfadd", cr.reply(int64(1)))
+		srv.HandleFunc("bitfield", cr.reply([]interface{}{int64(0)}))
+		srv.HandleFunc("set", cr.reply("OK"))
+		srv.HandleFunc("get", cr.reply([]byte(name)))
+		srv.HandleFunc("eval", cr.reply(int64(1)))
+		srv.HandleFunc("evalsha", cr.reply(int64(2)))
+		srv.HandleFunc("blpop", cr.reply([]interface{}{[]byte("list"), []byte(name)}))
+		recorders[name] = cr
+		addrs[name] = startServer(t, srv)
+	}
+	r := NewRing("tcp", addrs)
+	t.Cleanup(func() { r.Close() })
+
+	// Find a key owned by each shard
+	keys := make(map[string]string)
+	for i := 0; len(keys) < 2; i++ {
+		k := fmt.Sprintf("key:%d", i)
+		cli, err := r.Shard(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range r.shards {
+			if s.cli == cli && keys[s.name] == "" {
+				keys[s.name] = k
+			}
+		}
+	}
+	return r, recorders, keys
+}
+
+func TestRingRouting(t *testing.T) {
+	r, recorders, keys := startRing(t)
+	for _, name := range []string{"a", "b"} {
+		k := keys[name]
+		if ok, err := r.PFAdd(k, "x"); err != nil || !ok {
+			t.Fatalf("PFAdd returned %t, %+v", ok, err)
+		}
+		if v, err := r.BitField(NewBitField(k).IncrBy(Unsigned(8), 0, 1)); err != nil || len(v) != 1 {
+			t.Fatalf("BitField returned %+v, %+v", v, err)
+		}
+		recorders[name].check(t, []string{"PFADD " + k + " x", "BITFIELD " + k + " INCRBY u8 0 1"})
+	}
+}
+
+func TestRingCommands(t *testing.T) {
+	r, recorders, keys := startRing(t)
+	ka, kb := keys["a"], keys["b"]
+	script := NewScript("return 2")
+
+	if v, err := r.Do("SET", ka, 1); err != nil || v != "OK" {
+		t.Fatalf("Do returned %v, %+v", v, err)
+	}
+	if v, err := r.Eval("return 1", []string{ka}); err != nil || v != int64(1) {
+		t.Fatalf("Eval returned %v, %+v", v, err)
+	}
+	if v, err := r.RunScript(script, []string{ka}, "x"); err != nil || v != int64(2) {
+		t.Fatalf("RunScript returned %v, %+v", v, err)
+	}
+	if _, v, err := r.BLPop(context.Background(), 0, ka); err != nil || string(v) != "a" {
+		t.Fatalf("BLPop returned %q, %+v", v, err)
+	}
+	p := r.Pipeline()
+	p.Do("SET", kb, 2)
+	get := p.Get(ka)
+	if _, err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if string(get.Value()) != "a" {
+		t.Fatalf("pipelined GET returned %q", get.Value())
+	}
+	recorders["a"].check(t, []string{
+		"SET " + ka + " 1",
+		"EVAL return 1 1 " + ka,
+		"EVALSHA " + script.Hash() + " 1 " + ka + " x",
+		"BLPOP " + ka + " 0",
+		"GET " + ka,
+	})
+	recorders["b"].check(t, []string{"SET " + kb + " 2"})
+
+	// Commands that can't be routed to a single shard aren't sent
+	if _, err := r.Do("DEL", ka, kb); err != ErrCrossShard {
+		t.Fatalf("expected ErrCrossShard, got %+v", err)
+	}
+	if _, err := r.Eval("return 1", nil); err != ErrNoRouteKey {
+		t.Fatalf("expected ErrNoRouteKey, got %+v", err)
+	}
+	if _, err := r.Do("PING"); err != ErrNoRouteKey {
+		t.Fatalf("expected ErrNoRouteKey, got %+v", err)
+	}
+	if _, _, err := r.BRPop(context.Background(), 0, ka, kb); err != ErrCrossShard {
+		t.Fatalf("expected ErrCrossShard, got %+v", err)
+	}
+	p.Get(ka)
+	p.Do("MSET", ka, 1, kb, 2)
+	if _, err := p.Flush(); err != ErrCrossShard {
+		t.Fatalf("expected ErrCrossShard, got %+v", err)
+	}
+	recorders["b"].check(t, []string{"SET " + kb + " 2"})
+}
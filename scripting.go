@@ -0,0 +1,50 @@
+package redis
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+)
+
+func (cli *Client) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	return cli.replyRequest("EVAL", scriptArgs(script, keys, args)...)
+}
+
+func (cli *Client) EvalSha(sha1 string, keys []string, args ...interface{}) (interface{}, error) {
+	return cli.replyRequest("EVALSHA", scriptArgs(sha1, keys, args)...)
+}
+
+func scriptArgs(script string, keys []string, args []interface{}) []interface{} {
+	a := make([]interface{}, 0, 2+len(keys)+len(args))
+	a = append(a, script, len(keys))
+	for _, k := range keys {
+		a = append(a, k)
+	}
+	return append(a, args...)
+}
+
+// Script is a Lua script that is run with EVALSHA, falling back to EVAL
+// the first time a server hasn't seen it.
+type Script struct {
+	src string
+	sha string
+}
+
+func NewScript(src string) *Script {
+	h := sha1.Sum([]byte(src))
+	return &Script{
+		src: src,
+		sha: hex.EncodeToString(h[:]),
+	}
+}
+
+func (s *Script) Hash() string {
+	return s.sha
+}
+
+func (s *Script) Run(cli *Client, keys []string, args ...interface{}) (interface{}, error) {
+	r, err := cli.EvalSha(s.sha, keys, args...)
+	if e, ok := err.(ErrReply); ok && e.tag == "NOSCRIPT" {
+		return cli.Eval(s.src, keys, args...)
+	}
+	return r, err
+}
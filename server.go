@@ -0,0 +1,570 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Server is a framework for writing services that speak the Redis
+// protocol. Commands are dispatched to handlers registered with
+// HandleFunc. Requests on a connection are handled one at a time in
+// order, and replies to pipelined requests are flushed together.
+//
+// QUIT and HELLO are handled by the server unless a handler is
+// registered for them.
+type Server struct {
+	// MaxConnections limits the number of concurrent connections. New
+	// connections beyond the limit get an error reply and are closed.
+	// Zero means no limit.
+	MaxConnections int
+
+	// IdleTimeout closes connections that haven't sent a request for
+	// the given duration. Zero means no timeout.
+	IdleTimeout time.Duration
+
+	// NotFound handles commands without a registered handler. By
+	// default an "ERR unknown command" error is written.
+	NotFound HandlerFunc
+
+	// ErrorLog logs panics in handlers. If nil the log package's
+	// standard logger is used.
+	ErrorLog *log.Logger
+
+	mu         sync.Mutex
+	handlers   map[string]HandlerFunc
+	listeners  map[net.Listener]struct{}
+	conns      map[*ServerConn]struct{}
+	inShutdown bool
+	wg         sync.WaitGroup
+}
+
+// HandlerFunc handles a single command. args[0] is the command name as
+// sent by the client. The handler must write exactly one reply to conn
+// (an array counts as one reply).
+type HandlerFunc func(ctx context.Context, conn *ServerConn, args [][]byte)
+
+var (
+	ErrServerClosed = errors.New("redis: server closed")
+)
+
+const (
+	shutdownPollInterval = time.Millisecond * 10
+)
+
+func NewServer() *Server {
+	return &Server{
+		handlers:  make(map[string]HandlerFunc),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[*ServerConn]struct{}),
+	}
+}
+
+// HandleFunc registers the handler for a command. Command names are case
+// insensitive.
+func (srv *Server) HandleFunc(cmd string, fn HandlerFunc) {
+	srv.mu.Lock()
+	srv.handlers[strings.ToUpper(cmd)] = fn
+	srv.mu.Unlock()
+}
+
+func (srv *Server) handler(cmd []byte) HandlerFunc {
+	name := strings.ToUpper(string(cmd))
+	srv.mu.Lock()
+	fn := srv.handlers[name]
+	srv.mu.Unlock()
+	if fn != nil {
+		return fn
+	}
+	switch name {
+	case "QUIT":
+		return handleQuit
+	case "HELLO":
+		return handleHello
+	}
+	if srv.NotFound != nil {
+		return srv.NotFound
+	}
+	return handleNotFound
+}
+
+func (srv *Server) ListenAndServe(network, addr string) error {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(l)
+}
+
+// Serve accepts connections on l until the server is shut down. It always
+// returns a non-nil error and closes l. After Shutdown or Close the
+// returned error is ErrServerClosed.
+func (srv *Server) Serve(l net.Listener) error {
+	srv.mu.Lock()
+	if srv.inShutdown {
+		srv.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	srv.listeners[l] = struct{}{}
+	srv.mu.Unlock()
+	defer func() {
+		srv.mu.Lock()
+		delete(srv.listeners, l)
+		srv.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			srv.mu.Lock()
+			closed := srv.inShutdown
+			srv.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				time.Sleep(shutdownPollInterval)
+				continue
+			}
+			return err
+		}
+		sc := srv.newConn(nc)
+		if sc == nil {
+			continue
+		}
+		go sc.serve()
+	}
+}
+
+func (srv *Server) newConn(nc net.Conn) *ServerConn {
+	sc := &ServerConn{
+		srv: srv,
+		rc: &redisConnection{
+			nc:  nc,
+			rw:  bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc)),
+			buf: make([]byte, connectionBufferSize),
+		},
+		proto: 2,
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.inShutdown {
+		nc.Close()
+		return nil
+	}
+	if srv.MaxConnections > 0 && len(srv.conns) >= srv.MaxConnections {
+		sc.WriteError("ERR max number of clients reached")
+		sc.rc.flush()
+		nc.Close()
+		return nil
+	}
+	sc.ctx, sc.cancel = context.WithCancel(context.Background())
+	srv.conns[sc] = struct{}{}
+	srv.wg.Add(1)
+	return sc
+}
+
+// NumConnections returns the number of open connections.
+func (srv *Server) NumConnections() int {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return len(srv.conns)
+}
+
+// Shutdown stops the server from accepting connections, closes idle
+// connections and waits for the commands in progress to finish. If ctx
+// expires first all remaining connections are closed and the context's
+// error is returned.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	srv.closeListeners()
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if srv.closeIdleConns() {
+			srv.wg.Wait()
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			srv.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close immediately closes all listeners and connections.
+func (srv *Server) Close() error {
+	srv.closeListeners()
+	srv.mu.Lock()
+	for sc := range srv.conns {
+		sc.cancel()
+		sc.rc.close()
+	}
+	srv.mu.Unlock()
+	srv.wg.Wait()
+	return nil
+}
+
+func (srv *Server) closeListeners() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.inShutdown = true
+	for l := range srv.listeners {
+		l.Close()
+	}
+}
+
+// closeIdleConns closes connections waiting for a request and reports
+// whether there are no busy connections left.
+func (srv *Server) closeIdleConns() bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	quiescent := true
+	for sc := range srv.conns {
+		if atomic.LoadInt32(&sc.busy) != 0 {
+			quiescent = false
+			continue
+		}
+		sc.rc.close()
+	}
+	return quiescent
+}
+
+func (srv *Server) isShutdown() bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.inShutdown
+}
+
+// ServerConn is a client connection to a Server. It's used by handlers to
+// write replies and to keep per-connection state. The reply methods
+// buffer the reply which is sent after the handler returns.
+//
+// RESP3 replies are downgraded to their RESP2 equivalents unless the
+// client switched to protocol 3 with HELLO.
+type ServerConn struct {
+	srv    *Server
+	rc     *redisConnection
+	ctx    context.Context
+	cancel context.CancelFunc
+	busy   int32
+	proto  int
+	quit   bool
+
+	stateLock sync.Mutex
+	state     map[string]interface{}
+}
+
+func (sc *ServerConn) serve() {
+	defer func() {
+		sc.cancel()
+		sc.rc.close()
+		sc.srv.mu.Lock()
+		delete(sc.srv.conns, sc)
+		sc.srv.mu.Unlock()
+		sc.srv.wg.Done()
+	}()
+
+	for {
+		if sc.srv.IdleTimeout > 0 {
+			sc.rc.nc.SetReadDeadline(time.Now().Add(sc.srv.IdleTimeout))
+		}
+		args, err := sc.rc.readRequest()
+		if err != nil {
+			if err == ErrInvalidValue || err == ErrInvalidReplyMarker {
+				sc.WriteError("ERR Protocol error")
+				sc.rc.flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		atomic.StoreInt32(&sc.busy, 1)
+		sc.handle(args)
+		// Replies to pipelined requests are written in one go
+		if sc.quit || sc.rc.rw.Reader.Buffered() == 0 {
+			err = sc.rc.flush()
+		}
+		atomic.StoreInt32(&sc.busy, 0)
+		if err != nil || sc.quit || sc.srv.isShutdown() {
+			if err == nil {
+				sc.rc.flush()
+			}
+			return
+		}
+	}
+}
+
+// handle runs the handler of a request. A panic closes the connection
+// and drops buffered replies since the handler may have written part of
+// a reply.
+func (sc *ServerConn) handle(args [][]byte) {
+	defer func() {
+		if r := recover(); r != nil {
+			sc.srv.logf("redis: panic serving %s: %v\n%s", sc.RemoteAddr(), r, debug.Stack())
+			sc.rc.rw.Writer.Reset(sc.rc.nc)
+			sc.quit = true
+		}
+	}()
+	sc.srv.handler(args[0])(sc.ctx, sc, args)
+}
+
+func (srv *Server) logf(format string, args ...interface{}) {
+	if srv.ErrorLog != nil {
+		srv.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+func (sc *ServerConn) RemoteAddr() net.Addr {
+	return sc.rc.nc.RemoteAddr()
+}
+
+// Protocol returns the protocol version (2 or 3) used by the client.
+func (sc *ServerConn) Protocol() int {
+	return sc.proto
+}
+
+func (sc *ServerConn) SetProtocol(proto int) {
+	sc.proto = proto
+}
+
+// Close closes the connection after the current reply has been sent.
+func (sc *ServerConn) Close() {
+	sc.quit = true
+}
+
+// Get returns per-connection state stored with Set.
+func (sc *ServerConn) Get(key string) interface{} {
+	sc.stateLock.Lock()
+	defer sc.stateLock.Unlock()
+	return sc.state[key]
+}
+
+func (sc *ServerConn) Set(key string, value interface{}) {
+	sc.stateLock.Lock()
+	defer sc.stateLock.Unlock()
+	if sc.state == nil {
+		sc.state = make(map[string]interface{})
+	}
+	sc.state[key] = value
+}
+
+// Flush sends buffered replies to the client. Handlers only need it to
+// stream push messages outside of a request.
+func (sc *ServerConn) Flush() error {
+	return sc.rc.flush()
+}
+
+func (sc *ServerConn) WriteStatus(status string) error {
+	return sc.rc.writeStatus(status)
+}
+
+func (sc *ServerConn) WriteOK() error {
+	return sc.rc.writeStatus("OK")
+}
+
+// WriteError writes an error reply. By convention msg starts with an
+// upper case error code such as "ERR" or "WRONGTYPE".
+func (sc *ServerConn) WriteError(msg string) error {
+	return sc.rc.writeError(msg)
+}
+
+func (sc *ServerConn) WriteInteger(i int64) error {
+	return sc.rc.writeInteger(i)
+}
+
+// WriteBulk writes a bulk reply or a null reply if b is nil.
+func (sc *ServerConn) WriteBulk(b []byte) error {
+	if b == nil {
+		return sc.WriteNull()
+	}
+	return sc.rc.writeBulkBytes(b)
+}
+
+func (sc *ServerConn) WriteBulkString(s string) error {
+	return sc.rc.writeBulkString(s)
+}
+
+// WriteArray writes the header of an array with n elements which must be
+// followed by the n replies.
+func (sc *ServerConn) WriteArray(n int) error {
+	return sc.rc.writeArgumentCount(n)
+}
+
+func (sc *ServerConn) WriteNullArray() error {
+	if sc.proto >= 3 {
+		return sc.rc.writeLine(nullReplyMarker, "")
+	}
+	return sc.rc.writeNullMultiBulk()
+}
+
+func (sc *ServerConn) WriteNull() error {
+	if sc.proto >= 3 {
+		return sc.rc.writeLine(nullReplyMarker, "")
+	}
+	return sc.rc.writeNullBulk()
+}
+
+// WriteMap writes the header of a map with n key/value pairs which must
+// be followed by 2*n replies. On RESP2 it's written as a flat array.
+func (sc *ServerConn) WriteMap(n int) error {
+	if sc.proto >= 3 {
+		return sc.rc.writeI64(mapReplyMarker, int64(n))
+	}
+	return sc.rc.writeArgumentCount(n * 2)
+}
+
+func (sc *ServerConn) WriteSet(n int) error {
+	if sc.proto >= 3 {
+		return sc.rc.writeI64(setReplyMarker, int64(n))
+	}
+	return sc.rc.writeArgumentCount(n)
+}
+
+// WritePush writes the header of an out of band push message such as a
+// pub/sub message. On RESP2 it's written as an array.
+func (sc *ServerConn) WritePush(n int) error {
+	if sc.proto >= 3 {
+		return sc.rc.writeI64(pushReplyMarker, int64(n))
+	}
+	return sc.rc.writeArgumentCount(n)
+}
+
+func (sc *ServerConn) WriteDouble(f float64) error {
+	var s string
+	switch {
+	case math.IsInf(f, 1):
+		s = "inf"
+	case math.IsInf(f, -1):
+		s = "-inf"
+	case math.IsNaN(f):
+		s = "nan"
+	default:
+		s = strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	if sc.proto >= 3 {
+		return sc.rc.writeLine(doubleReplyMarker, s)
+	}
+	return sc.rc.writeBulkString(s)
+}
+
+func (sc *ServerConn) WriteBool(b bool) error {
+	if sc.proto >= 3 {
+		if b {
+			return sc.rc.writeLine(booleanReplyMarker, "t")
+		}
+		return sc.rc.writeLine(booleanReplyMarker, "f")
+	}
+	if b {
+		return sc.rc.writeInteger(1)
+	}
+	return sc.rc.writeInteger(0)
+}
+
+// WriteBigNumber writes an arbitrary precision integer given in decimal.
+func (sc *ServerConn) WriteBigNumber(n string) error {
+	if sc.proto >= 3 {
+		return sc.rc.writeLine(bigNumberReplyMarker, n)
+	}
+	return sc.rc.writeBulkString(n)
+}
+
+// WriteVerbatim writes a verbatim string where format is a three
+// character type such as "txt" or "mkd".
+func (sc *ServerConn) WriteVerbatim(format, s string) error {
+	if sc.proto < 3 {
+		return sc.rc.writeBulkString(s)
+	}
+	if err := sc.rc.writeI64(verbatimReplyMarker, int64(len(format)+1+len(s))); err != nil {
+		return err
+	}
+	if _, err := sc.rc.rw.WriteString(format + ":" + s); err != nil {
+		return err
+	}
+	_, err := sc.rc.rw.WriteString(eol)
+	return err
+}
+
+// WriteReply writes a reply value of the types returned by Client.Do.
+// An ErrReply is written back as the original error.
+func (sc *ServerConn) WriteReply(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		return sc.WriteNull()
+	case string:
+		return sc.WriteStatus(v)
+	case []byte:
+		return sc.WriteBulk(v)
+	case int64:
+		return sc.WriteInteger(v)
+	case int:
+		return sc.WriteInteger(int64(v))
+	case ErrReply:
+		if v.msg == "" {
+			return sc.WriteError(v.tag)
+		}
+		return sc.WriteError(v.tag + " " + v.msg)
+	case []interface{}:
+		if err := sc.WriteArray(len(v)); err != nil {
+			return err
+		}
+		for _, e := range v {
+			if err := sc.WriteReply(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return ErrInvalidArgumentType
+}
+
+func handleNotFound(ctx context.Context, conn *ServerConn, args [][]byte) {
+	conn.WriteError("ERR unknown command '" + string(args[0]) + "'")
+}
+
+func handleQuit(ctx context.Context, conn *ServerConn, args [][]byte) {
+	conn.WriteOK()
+	conn.Close()
+}
+
+// handleHello negotiates the protocol version. Authentication and
+// SETNAME options are not supported by the default handler.
+func handleHello(ctx context.Context, conn *ServerConn, args [][]byte) {
+	if len(args) > 1 {
+		proto, err := btoi64(args[1])
+		if err != nil {
+			conn.WriteError("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if proto != 2 && proto != 3 {
+			conn.WriteError("NOPROTO unsupported protocol version")
+			return
+		}
+		if len(args) > 2 {
+			conn.WriteError("ERR syntax error")
+			return
+		}
+		conn.SetProtocol(int(proto))
+	}
+	conn.WriteMap(2)
+	conn.WriteBulkString("proto")
+	conn.WriteInteger(int64(conn.Protocol()))
+	conn.WriteBulkString("mode")
+	conn.WriteBulkString("standalone")
+}
@@ -0,0 +1,267 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func startServer(t *testing.T, srv *Server) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	return l.Addr().String()
+}
+
+// commandRecorder records the commands received by a Server with canned
+// replies.
+type commandRecorder struct {
+	mu   sync.Mutex
+	cmds []string
+}
+
+func (cr *commandRecorder) reply(v interface{}) HandlerFunc {
+	return func(ctx context.Context, conn *ServerConn, args [][]byte) {
+		s := make([]string, len(args))
+		for i, a := range args {
+			s[i] = string(a)
+		}
+		cr.mu.Lock()
+		cr.cmds = append(cr.cmds, strings.Join(s, " "))
+		cr.mu.Unlock()
+		conn.WriteReply(v)
+	}
+}
+
+func (cr *commandRecorder) check(t *testing.T, exp []string) {
+	t.Helper()
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if strings.Join(cr.cmds, "\n") != strings.Join(exp, "\n") {
+		t.Fatalf("expected commands\n%s\ngot\n%s", strings.Join(exp, "\n"), strings.Join(cr.cmds, "\n"))
+	}
+}
+
+func TestServer(t *testing.T) {
+	var mu sync.Mutex
+	data := make(map[string][]byte)
+	srv := NewServer()
+	srv.HandleFunc("ping", func(ctx context.Context, conn *ServerConn, args [][]byte) {
+		conn.WriteStatus("PONG")
+	})
+	srv.HandleFunc("set", func(ctx context.Context, conn *ServerConn, args [][]byte) {
+		mu.Lock()
+		data[string(args[1])] = args[2]
+		mu.Unlock()
+		conn.WriteOK()
+	})
+	srv.HandleFunc("get", func(ctx context.Context, conn *ServerConn, args [][]byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		conn.WriteBulk(data[string(args[1])])
+	})
+	srv.HandleFunc("incr", func(ctx context.Context, conn *ServerConn, args [][]byte) {
+		n, _ := conn.Get("n").(int64)
+		n++
+		conn.Set("n", n)
+		conn.WriteInteger(n)
+	})
+	defer srv.Close()
+	addr := startServer(t, srv)
+
+	cli := NewClient("tcp", addr)
+	defer cli.Close()
+	if err := cli.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Set("foo", []byte("bar"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := cli.Get("foo"); err != nil || string(b) != "bar" {
+		t.Fatalf("Get returned %q, %v", b, err)
+	}
+	if b, err := cli.Get("missing"); err != nil || b != nil {
+		t.Fatalf("Get returned %q, %v", b, err)
+	}
+	if _, err := cli.Decr("foo"); err == nil {
+		t.Fatal("expected unknown command error")
+	}
+
+	// State is per connection
+	p, err := cli.Pipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 3; i++ {
+		if n, err := p.cn.integerRequest("INCR", "n"); err != nil || n != i {
+			t.Fatalf("INCR returned %d, %v", n, err)
+		}
+	}
+}
+
+func TestServerProtocol(t *testing.T) {
+	srv := NewServer()
+	srv.HandleFunc("types", func(ctx context.Context, conn *ServerConn, args [][]byte) {
+		conn.WriteArray(4)
+		conn.WriteBool(true)
+		conn.WriteDouble(1.5)
+		conn.WriteNull()
+		conn.WriteMap(1)
+		conn.WriteBulkString("k")
+		conn.WriteInteger(1)
+	})
+	defer srv.Close()
+	addr := startServer(t, srv)
+
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	// Pipelined inline and multi-bulk requests
+	if _, err := nc.Write([]byte("TYPES\r\n*2\r\n$5\r\nHELLO\r\n$1\r\n3\r\ntypes\r\nquit\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	nc.SetReadDeadline(time.Now().Add(time.Second))
+	r := bufio.NewReader(nc)
+	expected := "*4\r\n:1\r\n$3\r\n1.5\r\n$-1\r\n*2\r\n$1\r\nk\r\n:1\r\n" +
+		"%2\r\n$5\r\nproto\r\n:3\r\n$4\r\nmode\r\n$10\r\nstandalone\r\n" +
+		"*4\r\n#t\r\n,1.5\r\n_\r\n%1\r\n$1\r\nk\r\n:1\r\n" +
+		"+OK\r\n"
+	buf := make([]byte, len(expected))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != expected {
+		t.Fatalf("expected %q, got %q", expected, buf)
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Fatalf("expected connection to be closed after QUIT, got %v", err)
+	}
+}
+
+func TestServerBadRequests(t *testing.T) {
+	srv := NewServer()
+	srv.ErrorLog = log.New(io.Discard, "", 0)
+	srv.HandleFunc("ping", func(ctx context.Context, conn *ServerConn, args [][]byte) {
+		conn.WriteStatus("PONG")
+	})
+	srv.HandleFunc("panic", func(ctx context.Context, conn *ServerConn, args [][]byte) {
+		conn.WriteArray(2)
+		panic("boom")
+	})
+	defer srv.Close()
+	addr := startServer(t, srv)
+
+	for _, req := range []string{
+		"*1\r\n$9223372036854775000\r\n",
+		"*9223372036854775000\r\n",
+		"*-1\r\n",
+	} {
+		nc, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nc.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := nc.Write([]byte(req)); err != nil {
+			t.Fatal(err)
+		}
+		if b, err := io.ReadAll(nc); err != nil || string(b) != "-ERR Protocol error\r\n" {
+			t.Fatalf("expected a protocol error for %q, got %q %v", req, b, err)
+		}
+		nc.Close()
+	}
+
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	nc.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := nc.Write([]byte("PANIC\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := io.ReadAll(nc); err != nil || len(b) != 0 {
+		t.Fatalf("a panic should close the connection without a partial reply, got %q %v", b, err)
+	}
+
+	// The server keeps serving other connections
+	cli := NewClient("tcp", addr)
+	defer cli.Close()
+	if err := cli.Ping(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerMaxConnections(t *testing.T) {
+	srv := NewServer()
+	srv.MaxConnections = 1
+	srv.HandleFunc("ping", func(ctx context.Context, conn *ServerConn, args [][]byte) {
+		conn.WriteStatus("PONG")
+	})
+	defer srv.Close()
+	addr := startServer(t, srv)
+
+	cli1 := NewClient("tcp", addr)
+	defer cli1.Close()
+	// The pooled connection stays open
+	if err := cli1.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	cli2 := NewClient("tcp", addr)
+	defer cli2.Close()
+	err := cli2.Ping()
+	if e, ok := err.(ErrReply); !ok || e.msg != "max number of clients reached" {
+		t.Fatalf("expected max clients error, got %v", err)
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	srv := NewServer()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	srv.HandleFunc("slow", func(ctx context.Context, conn *ServerConn, args [][]byte) {
+		close(started)
+		<-release
+		conn.WriteOK()
+	})
+	addr := startServer(t, srv)
+
+	cli := NewClient("tcp", addr)
+	defer cli.Close()
+	done := make(chan error, 1)
+	go func() {
+		_, err := cli.statusRequest("SLOW")
+		done <- err
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- srv.Shutdown(context.Background())
+	}()
+	time.Sleep(shutdownPollInterval * 3)
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned before the command finished: %v", err)
+	default:
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("in-flight command failed: %v", err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Fatal("expected listener to be closed")
+	}
+}
@@ -0,0 +1,190 @@
+package redis
+
+import (
+	"bytes"
+	"io"
+)
+
+// bulkReaderMaxDrain is the largest unread part of a value that Close
+// reads to reuse the connection. Larger ones close the connection.
+const bulkReaderMaxDrain = 64 * 1024
+
+// GetInto is like Get but reads the value into dst, growing it if it's
+// too small, to avoid allocating for every read. The returned slice
+// shares dst's memory when it fits. It returns nil if the key doesn't
+// exist.
+func (cli *Client) GetInto(key string, dst []byte) (b []byte, err error) {
+	if nc := cli.nearCache.Load(); nc != nil {
+		if b, err = nc.get(cli, key); b != nil {
+			b = append(dst[:0], b...)
+		}
+		return
+	}
+	err = cli.withReadConnection(func(c *redisConnection) (err error) {
+		if err = c.sendCommand("GET", key); err == nil {
+			if err = c.flush(); err == nil {
+				b, err = c.readBulkInto(dst)
+			}
+		}
+		return
+	})
+	return
+}
+
+// readBulkInto reads a bulk reply into dst.
+func (rc *redisConnection) readBulkInto(dst []byte) ([]byte, error) {
+	n, marker, err := rc.readI64()
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, nil
+	}
+	if marker != bulkReplyMarker {
+		return nil, ErrInvalidReplyMarker
+	}
+	if n > maxBulkLen {
+		return nil, ErrInvalidValue
+	}
+	if int64(cap(dst)) < n {
+		dst = make([]byte, n)
+	}
+	dst = dst[:n]
+	if _, err := io.ReadFull(rc.rw, dst); err != nil {
+		return nil, err
+	}
+	if err := rc.readEOL(); err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+func (rc *redisConnection) readEOL() error {
+	b := rc.buf[:len(eol)]
+	if _, err := io.ReadFull(rc.rw, b); err != nil {
+		return err
+	}
+	if string(b) != eol {
+		return ErrInvalidValue
+	}
+	return nil
+}
+
+// GetReader streams the value of key from the connection without reading
+// it in memory. It returns nil if the key doesn't exist. The reader holds
+// a connection until closed. Like Get it reads from the node chosen by
+// the read policy.
+func (cli *Client) GetReader(key string) (r io.ReadCloser, err error) {
+	err = cli.withReadNode(func(n *Client) (err error) {
+		r, err = n.getReader(key)
+		return
+	})
+	return
+}
+
+func (cli *Client) getReader(key string) (io.ReadCloser, error) {
+	rc, err := cli.popConnection()
+	if err != nil {
+		return nil, err
+	}
+	if err := rc.sendCommand("GET", key); err != nil {
+		rc.close()
+		return nil, err
+	}
+	if err := rc.flush(); err != nil {
+		rc.close()
+		return nil, err
+	}
+	n, marker, err := rc.readI64()
+	if _, ok := err.(ErrReply); ok {
+		cli.pushConnection(rc)
+		return nil, err
+	} else if err != nil {
+		rc.close()
+		return nil, err
+	}
+	if marker != bulkReplyMarker {
+		rc.close()
+		return nil, ErrInvalidReplyMarker
+	}
+	if n < 0 {
+		cli.pushConnection(rc)
+		return nil, nil
+	}
+	return &bulkReader{cli: cli, rc: rc, r: io.LimitedReader{R: rc.rw, N: n}}, nil
+}
+
+type bulkReader struct {
+	cli *Client
+	rc  *redisConnection
+	r   io.LimitedReader
+}
+
+func (br *bulkReader) Read(p []byte) (int, error) {
+	if br.rc == nil {
+		return 0, io.ErrClosedPipe
+	}
+	n, err := br.r.Read(p)
+	if err == io.EOF && br.r.N > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Close returns the connection to the pool after reading what's left of
+// the value if it's small, or closes it.
+func (br *bulkReader) Close() error {
+	rc := br.rc
+	if rc == nil {
+		return nil
+	}
+	br.rc = nil
+	if br.r.N <= bulkReaderMaxDrain {
+		if _, err := io.Copy(io.Discard, &br.r); err == nil && br.r.N == 0 && rc.readEOL() == nil {
+			br.cli.pushConnection(rc)
+			return nil
+		}
+	}
+	return rc.close()
+}
+
+// SetFromReader sets key to size bytes read from r. The value is copied
+// to the connection as it's read.
+func (cli *Client) SetFromReader(key string, r io.Reader, size int64) error {
+	if size < 0 {
+		return ErrInvalidValue
+	}
+	return cli.withConnection(func(c *redisConnection) error {
+		if err := c.writeArgumentCount(3); err != nil {
+			return err
+		}
+		if err := c.writeBulkString("SET"); err != nil {
+			return err
+		}
+		if err := c.writeBulkString(key); err != nil {
+			return err
+		}
+		if err := c.writeI64(bulkReplyMarker, size); err != nil {
+			return err
+		}
+		// A short read leaves a partial command so the connection is
+		// closed by withConnection
+		if _, err := io.CopyN(c.rw, r, size); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if _, err := c.rw.WriteString(eol); err != nil {
+			return err
+		}
+		if err := c.flush(); err != nil {
+			return err
+		}
+		status, err := c.readStatusBytes()
+		if err == nil && !bytes.Equal(status, okStatus) {
+			err = ErrInvalidStatus
+		}
+		return err
+	})
+}
@@ -0,0 +1,109 @@
+package redis
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/samuel/go-redis/redistest"
+)
+
+func TestStream(t *testing.T) {
+	s := redistest.NewServer()
+	defer s.Close()
+	cli := NewClient("tcp", s.Addr())
+	defer cli.Close()
+
+	big := bytes.Repeat([]byte("0123456789"), 100000)
+	if err := cli.SetFromReader("big", bytes.NewReader(big), int64(len(big))); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.SetFromReader("short", strings.NewReader("abc"), 10); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected ErrUnexpectedEOF for a short reader, got %v", err)
+	}
+	if err := cli.SetFromReader("negative", strings.NewReader("abc"), -1); err != ErrInvalidValue {
+		t.Fatalf("expected ErrInvalidValue for a negative size, got %v", err)
+	}
+
+	r, err := cli.GetReader("big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if !bytes.Equal(b, big) {
+		t.Fatalf("read %d bytes, expected %d", len(b), len(big))
+	}
+
+	// Closing with a small part left reuses the connection, with a large
+	// part it's closed
+	for _, n := range []int{len(big) - 10, 10} {
+		r, err := cli.GetReader("big")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(r, make([]byte, n)); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Read(make([]byte, 1)); err == nil {
+			t.Fatal("expected an error reading after Close")
+		}
+		if err := cli.Set("small", []byte("value"), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r, err := cli.GetReader("missing"); err != nil || r != nil {
+		t.Fatalf("expected nil for a missing key, got %v, %v", r, err)
+	}
+
+	buf := make([]byte, 0, 16)
+	b, err = cli.GetInto("small", buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "value" || &b[0] != &buf[:1][0] {
+		t.Fatalf("expected value in the given buffer, got %q", b)
+	}
+	if b, err = cli.GetInto("big", buf); err != nil || !bytes.Equal(b, big) {
+		t.Fatalf("unexpected value of %d bytes, %v", len(b), err)
+	}
+	if b, err = cli.GetInto("missing", buf); err != nil || b != nil {
+		t.Fatalf("expected nil for a missing key, got %q, %v", b, err)
+	}
+}
+
+func TestGetReaderReadPolicy(t *testing.T) {
+	master := redistest.NewServer()
+	defer master.Close()
+	replica := redistest.NewServer()
+	defer replica.Close()
+	cli := NewClient("tcp", master.Addr())
+	defer cli.Close()
+	rcli := NewClient("tcp", replica.Addr())
+	defer rcli.Close()
+	if err := cli.Set("k", []byte("master"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := rcli.Set("k", []byte("replica"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	cli.SetReplicas(replica.Addr())
+	cli.SetReadPolicy(ReadPreferReplica)
+	r, err := cli.GetReader("k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(b) != "replica" {
+		t.Fatalf("expected the value of the replica, got %q, %v", b, err)
+	}
+}